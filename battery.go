@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const powerSupplyPath = "/sys/class/power_supply"
+
+var ErrNoBattery = errors.New("no battery in " + powerSupplyPath)
+
+// BatteryLevel is the battery level reported to hosts, fixed, the output of
+// a script or the capacity of a power supply
+type BatteryLevel struct {
+	lock     sync.Mutex
+	source   string
+	arg      string
+	level    byte
+	handlers []func(level byte)
+}
+
+// NewBatteryLevel spec is a percentage, "script:/path" or "sysfs[:name]"
+func NewBatteryLevel(spec string) (*BatteryLevel, error) {
+	b := &BatteryLevel{}
+	switch {
+	case strings.HasPrefix(spec, "script:"):
+		b.source = "script"
+		b.arg = strings.TrimPrefix(spec, "script:")
+	case spec == "sysfs" || strings.HasPrefix(spec, "sysfs:"):
+		b.source = "sysfs"
+		b.arg = strings.TrimPrefix(strings.TrimPrefix(spec, "sysfs"), ":")
+		if b.arg == "" {
+			name, err := findBattery()
+			if err != nil {
+				return nil, err
+			}
+			b.arg = name
+		}
+	default:
+		level, err := parseLevel(spec)
+		if err != nil {
+			return nil, err
+		}
+		b.source = "fixed"
+		b.level = level
+		return b, nil
+	}
+
+	level, err := b.read()
+	if err != nil {
+		return nil, err
+	}
+	b.level = level
+	return b, nil
+}
+
+func parseLevel(s string) (byte, error) {
+	v, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil {
+		return 0, err
+	}
+	if v < 0 || v > 100 {
+		return 0, errors.New("battery level out of range")
+	}
+	return byte(v), nil
+}
+
+// findBattery the first power supply of type Battery
+func findBattery() (string, error) {
+	entries, err := ioutil.ReadDir(powerSupplyPath)
+	if err != nil {
+		return "", err
+	}
+	for _, e := range entries {
+		typ, err := ioutil.ReadFile(filepath.Join(powerSupplyPath, e.Name(), "type"))
+		if err == nil && strings.TrimSpace(string(typ)) == "Battery" {
+			return e.Name(), nil
+		}
+	}
+	return "", ErrNoBattery
+}
+
+func (b *BatteryLevel) read() (byte, error) {
+	b.lock.Lock()
+	source, arg := b.source, b.arg
+	b.lock.Unlock()
+
+	switch source {
+	case "script":
+		out, err := exec.Command(arg).Output()
+		if err != nil {
+			return 0, err
+		}
+		return parseLevel(string(out))
+	case "sysfs":
+		capacity, err := ioutil.ReadFile(filepath.Join(powerSupplyPath, arg, "capacity"))
+		if err != nil {
+			return 0, err
+		}
+		return parseLevel(string(capacity))
+	}
+	return b.Level(), nil
+}
+
+func (b *BatteryLevel) Level() byte {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.level
+}
+
+// Set makes the level fixed from now on
+func (b *BatteryLevel) Set(level byte) {
+	b.lock.Lock()
+	b.source = "fixed"
+	b.lock.Unlock()
+	b.update(level)
+}
+
+func (b *BatteryLevel) update(level byte) {
+	b.lock.Lock()
+	changed := b.level != level
+	b.level = level
+	handlers := append([]func(level byte){}, b.handlers...)
+	b.lock.Unlock()
+
+	if !changed {
+		return
+	}
+	for _, fn := range handlers {
+		fn(level)
+	}
+}
+
+// OnChange fn runs with every new level
+func (b *BatteryLevel) OnChange(fn func(level byte)) {
+	b.lock.Lock()
+	b.handlers = append(b.handlers, fn)
+	b.lock.Unlock()
+}
+
+// Poll reads scripts and power supplies every interval
+func (b *BatteryLevel) Poll(interval time.Duration) {
+	for range time.Tick(interval) {
+		b.lock.Lock()
+		fixed := b.source == "fixed"
+		b.lock.Unlock()
+		if fixed {
+			continue
+		}
+
+		level, err := b.read()
+		if err != nil {
+			log.Printf("battery: %s", err)
+			continue
+		}
+		b.update(level)
+	}
+}
+
+func (b *BatteryLevel) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	if level := r.URL.Query().Get("level"); level != "" {
+		v, err := parseLevel(level)
+		if err != nil {
+			rw.Write([]byte("invalid level param"))
+			return
+		}
+		b.Set(v)
+	}
+
+	b.lock.Lock()
+	info := struct {
+		Level  byte   `json:"level"`
+		Source string `json:"source"`
+	}{b.level, b.source}
+	b.lock.Unlock()
+
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(info)
+}
@@ -1,9 +1,14 @@
 package bluez
 
 import (
+	"errors"
+	"strings"
+
 	"github.com/godbus/dbus"
 )
 
+var ErrAdapterNotFound = errors.New("adapter not found")
+
 type Adapter struct {
 	client  *Client
 	adapter string
@@ -20,10 +25,57 @@ func NewAdapter(adapter string) (*Adapter, error) {
 	}, nil
 }
 
+// FindAdapter pick the adapter by "hciN" or by address "AA:BB:CC:DD:EE:FF",
+// empty id picks the first adapter bluez knows
+func FindAdapter(id string) (*Adapter, error) {
+	if strings.HasPrefix(id, "hci") {
+		return NewAdapter(id)
+	}
+
+	client, err := NewClient(BluezInterface, ObjectManager, "/")
+	if err != nil {
+		return nil, err
+	}
+
+	objects := make(map[dbus.ObjectPath]map[string]map[string]dbus.Variant)
+	call, err := client.Call("GetManagedObjects", 0)
+	if err != nil {
+		return nil, err
+	}
+	if err := call.Store(&objects); err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for path, ifaces := range objects {
+		props, ok := ifaces[AdapterInterface]
+		if !ok {
+			continue
+		}
+		if id != "" {
+			address, _ := props["Address"].Value().(string)
+			if !strings.EqualFold(address, id) {
+				continue
+			}
+		}
+		names = append(names, strings.TrimPrefix(string(path), BluezPath+"/"))
+	}
+	if len(names) == 0 {
+		return nil, ErrAdapterNotFound
+	}
+
+	// map order is random, keep hci0 before hci1
+	first := names[0]
+	for _, name := range names[1:] {
+		if name < first {
+			first = name
+		}
+	}
+	return NewAdapter(first)
+}
+
 func (a *Adapter) StartDiscovery() error {
-	cell, err := a.client.Call(
-		AdapterInterface,
-		0, "StartDiscovery")
+	cell, err := a.client.Call("StartDiscovery", 0)
 	if err != nil {
 		return err
 	}
@@ -31,26 +83,255 @@ func (a *Adapter) StartDiscovery() error {
 }
 
 func (a *Adapter) StopDiscovery() error {
-	cell, err := a.client.Call(
-		AdapterInterface,
-		0, "StopDiscovery")
+	cell, err := a.client.Call("StopDiscovery", 0)
+	if err != nil {
+		return err
+	}
+	return cell.Store()
+}
+
+func (a *Adapter) RemoveDevice(path dbus.ObjectPath) error {
+	cell, err := a.client.Call("RemoveDevice", 0, path)
 	if err != nil {
 		return err
 	}
 	return cell.Store()
 }
 
-func (a *Adapter) RemoveDevice(path string) error {
-	cell, err := a.client.Call(
-		AdapterInterface,
-		0, "StopDiscovery",
-		dbus.ObjectPath(path))
+// DiscoveryFilter zero values are left out of the filter
+type DiscoveryFilter struct {
+	UUIDs         []string
+	RSSI          int16
+	Pathloss      uint16
+	Transport     string // auto, bredr or le
+	DuplicateData *bool
+	Discoverable  bool
+	Pattern       string
+}
+
+func (f *DiscoveryFilter) dict() map[string]dbus.Variant {
+	m := make(map[string]dbus.Variant)
+	if len(f.UUIDs) > 0 {
+		m["UUIDs"] = dbus.MakeVariant(f.UUIDs)
+	}
+	if f.RSSI != 0 {
+		m["RSSI"] = dbus.MakeVariant(f.RSSI)
+	}
+	if f.Pathloss != 0 {
+		m["Pathloss"] = dbus.MakeVariant(f.Pathloss)
+	}
+	if f.Transport != "" {
+		m["Transport"] = dbus.MakeVariant(f.Transport)
+	}
+	if f.DuplicateData != nil {
+		m["DuplicateData"] = dbus.MakeVariant(*f.DuplicateData)
+	}
+	if f.Discoverable {
+		m["Discoverable"] = dbus.MakeVariant(f.Discoverable)
+	}
+	if f.Pattern != "" {
+		m["Pattern"] = dbus.MakeVariant(f.Pattern)
+	}
+	return m
+}
+
+// SetDiscoveryFilter nil filter clears the filter
+func (a *Adapter) SetDiscoveryFilter(filter *DiscoveryFilter) error {
+	dict := make(map[string]dbus.Variant)
+	if filter != nil {
+		dict = filter.dict()
+	}
+	cell, err := a.client.Call("SetDiscoveryFilter", 0, dict)
 	if err != nil {
 		return err
 	}
 	return cell.Store()
 }
 
+func (a *Adapter) GetDiscoveryFilters() ([]string, error) {
+	cell, err := a.client.Call("GetDiscoveryFilters", 0)
+	if err != nil {
+		return nil, err
+	}
+	var filters []string
+	if err := cell.Store(&filters); err != nil {
+		return nil, err
+	}
+	return filters, nil
+}
+
 func (a *Adapter) Adapter() string {
 	return a.adapter
 }
+
+func (a *Adapter) Path() dbus.ObjectPath {
+	return dbus.ObjectPath(BluezPath + "/" + a.adapter)
+}
+
+func (a *Adapter) GetAddress() (string, error) {
+	return a.client.GetString("Address")
+}
+
+// GetAddressType public or random
+func (a *Adapter) GetAddressType() (string, error) {
+	return a.client.GetString("AddressType")
+}
+
+func (a *Adapter) GetName() (string, error) {
+	return a.client.GetString("Name")
+}
+
+func (a *Adapter) GetAlias() (string, error) {
+	return a.client.GetString("Alias")
+}
+
+func (a *Adapter) SetAlias(alias string) error {
+	return a.client.SetProperty("Alias", alias)
+}
+
+func (a *Adapter) GetClass() (uint32, error) {
+	return a.client.GetUint32("Class")
+}
+
+func (a *Adapter) GetPowered() (bool, error) {
+	return a.client.GetBool("Powered")
+}
+
+func (a *Adapter) SetPowered(powered bool) error {
+	return a.client.SetProperty("Powered", powered)
+}
+
+func (a *Adapter) GetDiscoverable() (bool, error) {
+	return a.client.GetBool("Discoverable")
+}
+
+func (a *Adapter) SetDiscoverable(discoverable bool) error {
+	return a.client.SetProperty("Discoverable", discoverable)
+}
+
+// GetDiscoverableTimeout in seconds, 0 disables the timeout
+func (a *Adapter) GetDiscoverableTimeout() (uint32, error) {
+	return a.client.GetUint32("DiscoverableTimeout")
+}
+
+func (a *Adapter) SetDiscoverableTimeout(timeout uint32) error {
+	return a.client.SetProperty("DiscoverableTimeout", timeout)
+}
+
+func (a *Adapter) GetPairable() (bool, error) {
+	return a.client.GetBool("Pairable")
+}
+
+func (a *Adapter) SetPairable(pairable bool) error {
+	return a.client.SetProperty("Pairable", pairable)
+}
+
+func (a *Adapter) GetPairableTimeout() (uint32, error) {
+	return a.client.GetUint32("PairableTimeout")
+}
+
+func (a *Adapter) SetPairableTimeout(timeout uint32) error {
+	return a.client.SetProperty("PairableTimeout", timeout)
+}
+
+func (a *Adapter) GetDiscovering() (bool, error) {
+	return a.client.GetBool("Discovering")
+}
+
+func (a *Adapter) GetUUIDs() ([]string, error) {
+	return a.client.GetStrings("UUIDs")
+}
+
+func (a *Adapter) GetModalias() (string, error) {
+	return a.client.GetString("Modalias")
+}
+
+// GetRoles central, peripheral or central-peripheral
+func (a *Adapter) GetRoles() ([]string, error) {
+	return a.client.GetStrings("Roles")
+}
+
+type AdapterProperties struct {
+	Address             string
+	AddressType         string
+	Name                string
+	Alias               string
+	Class               uint32
+	Powered             bool
+	Discoverable        bool
+	DiscoverableTimeout uint32
+	Pairable            bool
+	PairableTimeout     uint32
+	Discovering         bool
+	UUIDs               []string
+	Modalias            string
+	Roles               []string
+}
+
+// Update stores the known properties of m, unknown names and types are skipped
+func (p *AdapterProperties) Update(m map[string]dbus.Variant) {
+	for name, v := range m {
+		switch name {
+		case "Address":
+			p.Address, _ = v.Value().(string)
+		case "AddressType":
+			p.AddressType, _ = v.Value().(string)
+		case "Name":
+			p.Name, _ = v.Value().(string)
+		case "Alias":
+			p.Alias, _ = v.Value().(string)
+		case "Class":
+			p.Class, _ = v.Value().(uint32)
+		case "Powered":
+			p.Powered, _ = v.Value().(bool)
+		case "Discoverable":
+			p.Discoverable, _ = v.Value().(bool)
+		case "DiscoverableTimeout":
+			p.DiscoverableTimeout, _ = v.Value().(uint32)
+		case "Pairable":
+			p.Pairable, _ = v.Value().(bool)
+		case "PairableTimeout":
+			p.PairableTimeout, _ = v.Value().(uint32)
+		case "Discovering":
+			p.Discovering, _ = v.Value().(bool)
+		case "UUIDs":
+			p.UUIDs, _ = v.Value().([]string)
+		case "Modalias":
+			p.Modalias, _ = v.Value().(string)
+		case "Roles":
+			p.Roles, _ = v.Value().([]string)
+		}
+	}
+}
+
+func (a *Adapter) GetProperties() (*AdapterProperties, error) {
+	m, err := a.client.GetAllProperties()
+	if err != nil {
+		return nil, err
+	}
+	p := &AdapterProperties{}
+	p.Update(m)
+	return p, nil
+}
+
+// WatchProperties fn receives the properties after the change and the changed names
+func (a *Adapter) WatchProperties(fn func(p *AdapterProperties, changed []string)) (func(), error) {
+	p, err := a.GetProperties()
+	if err != nil {
+		return nil, err
+	}
+	return a.client.WatchProperties(func(m map[string]dbus.Variant, invalidated []string) {
+		p.Update(m)
+		var names []string
+		for name := range m {
+			names = append(names, name)
+		}
+		snapshot := *p
+		fn(&snapshot, append(names, invalidated...))
+	})
+}
+
+// Close releases the connection reference of the adapter
+func (a *Adapter) Close() error {
+	return a.client.Close()
+}
@@ -0,0 +1,57 @@
+package bluez
+
+import "github.com/godbus/dbus"
+
+// AdminPolicy limits the services bluetoothd offers and accepts on an
+// adapter, it needs the admin plugin of bluez 5.60 or newer
+type AdminPolicy struct {
+	set    *Client
+	status *Client
+}
+
+func NewAdminPolicy(adapter string) (*AdminPolicy, error) {
+	path := dbus.ObjectPath(BluezPath + "/" + adapter)
+	set, err := NewClientWithFullPath(BluezInterface, AdminPolicySetInterface, path)
+	if err != nil {
+		return nil, err
+	}
+	status, err := NewClientWithFullPath(BluezInterface, AdminPolicyStatusInterface, path)
+	if err != nil {
+		set.Close()
+		return nil, err
+	}
+	return &AdminPolicy{set: set, status: status}, nil
+}
+
+// SetServiceAllowList uuids in short "0x1124" or full form, empty allows
+// every service again, bluetoothd keeps the list across restarts
+func (p *AdminPolicy) SetServiceAllowList(uuids []string) error {
+	normalized := make([]string, 0, len(uuids))
+	for _, uuid := range uuids {
+		normalized = append(normalized, NormalizeUUID(uuid))
+	}
+	call, err := p.set.Call("SetServiceAllowList", 0, normalized)
+	if err != nil {
+		return err
+	}
+	return call.Store()
+}
+
+func (p *AdminPolicy) GetServiceAllowList() ([]string, error) {
+	return p.status.GetStrings("ServiceAllowList")
+}
+
+func (p *AdminPolicy) Close() error {
+	p.set.Close()
+	return p.status.Close()
+}
+
+// GetAffectedByPolicy whether the allow list blocks a service the device has
+func (d *Device) GetAffectedByPolicy() (bool, error) {
+	status, err := NewClientWithFullPath(BluezInterface, AdminPolicyStatusInterface, d.path)
+	if err != nil {
+		return false, err
+	}
+	defer status.Close()
+	return status.GetBool("IsAffectedByPolicy")
+}
@@ -0,0 +1,213 @@
+package bluez
+
+import (
+	"sync"
+
+	"github.com/godbus/dbus"
+)
+
+const (
+	AdvertisementTypePeripheral = "peripheral"
+	AdvertisementTypeBroadcast  = "broadcast"
+)
+
+// AdvertisementData zero values are left out of the advertisement
+type AdvertisementData struct {
+	// Type peripheral or broadcast, empty is peripheral
+	Type             string
+	ServiceUUIDs     []string
+	Appearance       uint16
+	LocalName        string
+	ManufacturerData map[uint16][]byte
+	// Includes "tx-power", "appearance" or "local-name"
+	Includes     []string
+	Discoverable bool
+	// Timeout in seconds bluez keeps advertising
+	Timeout uint16
+}
+
+func (a *AdvertisementData) props() map[string]*Property {
+	typ := a.Type
+	if typ == "" {
+		typ = AdvertisementTypePeripheral
+	}
+	props := map[string]*Property{
+		"Type": {Value: typ},
+	}
+	if len(a.ServiceUUIDs) > 0 {
+		props["ServiceUUIDs"] = &Property{Value: a.ServiceUUIDs}
+	}
+	if a.Appearance != 0 {
+		props["Appearance"] = &Property{Value: a.Appearance}
+	}
+	if a.LocalName != "" {
+		props["LocalName"] = &Property{Value: a.LocalName}
+	}
+	if len(a.ManufacturerData) > 0 {
+		data := make(map[uint16]dbus.Variant)
+		for id, v := range a.ManufacturerData {
+			data[id] = dbus.MakeVariant(v)
+		}
+		props["ManufacturerData"] = &Property{Value: data}
+	}
+	if len(a.Includes) > 0 {
+		props["Includes"] = &Property{Value: a.Includes}
+	}
+	if a.Discoverable {
+		props["Discoverable"] = &Property{Value: a.Discoverable}
+	}
+	if a.Timeout != 0 {
+		props["Timeout"] = &Property{Value: a.Timeout}
+	}
+	return props
+}
+
+// Advertisement is an LEAdvertisement1 object, it is only exported while
+// registered with an adapter
+type Advertisement struct {
+	object  *Object
+	data    AdvertisementData
+	lock    sync.Mutex
+	manager *LEAdvertisingManager
+	unhook  func()
+	// OnRelease runs when bluez drops the advertisement on its own
+	OnRelease func()
+}
+
+func NewAdvertisement(path dbus.ObjectPath, data AdvertisementData) *Advertisement {
+	a := &Advertisement{object: NewObject(path), data: data}
+	a.object.AddInterface(LEAdvertisementInterface, a, data.props())
+	return a
+}
+
+func (a *Advertisement) Path() dbus.ObjectPath {
+	return a.object.Path()
+}
+
+// Register exports the advertisement and registers it with the adapter "hciN"
+func (a *Advertisement) Register(adapter string) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if a.manager != nil {
+		return nil
+	}
+
+	conn, err := DefaultConn()
+	if err != nil {
+		return err
+	}
+	if err := a.object.Export(conn); err != nil {
+		return err
+	}
+
+	manager, err := NewLEAdvertisingManager(adapter)
+	if err != nil {
+		a.object.Unexport()
+		return err
+	}
+	if err := manager.RegisterAdvertisement(a.Path(), nil); err != nil {
+		a.object.Unexport()
+		return err
+	}
+	a.manager = manager
+	a.unhook = conn.OnReconnect(func() error {
+		return manager.RegisterAdvertisement(a.Path(), nil)
+	})
+	return nil
+}
+
+// Unregister stops advertising and removes the object from the bus
+func (a *Advertisement) Unregister() error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if a.manager == nil {
+		return nil
+	}
+	a.unhook()
+	err := a.manager.UnregisterAdvertisement(a.Path())
+	a.object.Unexport()
+	a.manager = nil
+	return err
+}
+
+func (a *Advertisement) Registered() bool {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.manager != nil
+}
+
+// Release bluez removed the advertisement, the timeout ran out or the
+// adapter went away
+func (a *Advertisement) Release() *dbus.Error {
+	a.lock.Lock()
+	if a.manager != nil {
+		a.unhook()
+		a.object.Unexport()
+		a.manager = nil
+	}
+	a.lock.Unlock()
+
+	if a.OnRelease != nil {
+		go a.OnRelease()
+	}
+	return nil
+}
+
+type LEAdvertisingManager struct {
+	client *Client
+}
+
+func NewLEAdvertisingManager(adapter string) (*LEAdvertisingManager, error) {
+	client, err := NewClient(BluezInterface, LEAdvertisingManagerInterface, BluezPath+"/"+adapter)
+	if err != nil {
+		return nil, err
+	}
+	return &LEAdvertisingManager{client: client}, nil
+}
+
+func (m *LEAdvertisingManager) RegisterAdvertisement(advertisement dbus.ObjectPath, options map[string]dbus.Variant) error {
+	if options == nil {
+		options = make(map[string]dbus.Variant)
+	}
+	call, err := m.client.Call("RegisterAdvertisement", 0, advertisement, options)
+	if err != nil {
+		return err
+	}
+	return call.Store()
+}
+
+func (m *LEAdvertisingManager) UnregisterAdvertisement(advertisement dbus.ObjectPath) error {
+	call, err := m.client.Call("UnregisterAdvertisement", 0, advertisement)
+	if err != nil {
+		return err
+	}
+	return call.Store()
+}
+
+func (m *LEAdvertisingManager) GetActiveInstances() (byte, error) {
+	v, err := m.client.GetProperty("ActiveInstances")
+	if err != nil {
+		return 0, err
+	}
+	n, ok := v.Value().(byte)
+	if !ok {
+		return 0, ErrInvalidPropertyType
+	}
+	return n, nil
+}
+
+func (m *LEAdvertisingManager) GetSupportedInstances() (byte, error) {
+	v, err := m.client.GetProperty("SupportedInstances")
+	if err != nil {
+		return 0, err
+	}
+	n, ok := v.Value().(byte)
+	if !ok {
+		return 0, ErrInvalidPropertyType
+	}
+	return n, nil
+}
+
+func (m *LEAdvertisingManager) GetSupportedIncludes() ([]string, error) {
+	return m.client.GetStrings("SupportedIncludes")
+}
@@ -35,7 +35,7 @@ type SimpleAgent struct {
 	path    dbus.ObjectPath
 	passKey uint32
 	pinCode string
-	conn    *dbus.Conn
+	conn    *Conn
 }
 
 func NewSimpleAgent(path dbus.ObjectPath) (*SimpleAgent, error) {
@@ -0,0 +1,205 @@
+package bluez
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/godbus/dbus"
+)
+
+// BatteryProvider is the object tree handed to BatteryProviderManager1,
+// batteries can come and go while it is registered
+type BatteryProvider struct {
+	tree      *ObjectTree
+	lock      sync.Mutex
+	conn      *Conn
+	manager   *BatteryProviderManager
+	unhook    func()
+	batteries []*Battery
+	next      int
+}
+
+// Battery is a BatteryProvider1 object bluez shows on Device
+type Battery struct {
+	object     *Object
+	provider   *BatteryProvider
+	device     dbus.ObjectPath
+	source     string
+	lock       sync.Mutex
+	percentage byte
+}
+
+func NewBatteryProvider(path dbus.ObjectPath) *BatteryProvider {
+	return &BatteryProvider{tree: NewObjectTree(path)}
+}
+
+func (p *BatteryProvider) Path() dbus.ObjectPath {
+	return p.tree.Path()
+}
+
+// AddBattery reports percentage for the bluez device object device, source
+// describes where the level comes from
+func (p *BatteryProvider) AddBattery(device dbus.ObjectPath, source string, percentage byte) (*Battery, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	b := &Battery{
+		object:     NewObject(dbus.ObjectPath(fmt.Sprintf("%s/battery%d", p.Path(), p.next))),
+		provider:   p,
+		device:     device,
+		source:     source,
+		percentage: percentage,
+	}
+	p.next++
+
+	b.object.AddInterface(BatteryProviderInterface, b, map[string]*Property{
+		"Percentage": {Value: percentage},
+		"Source":     {Value: source, Emit: EmitConst},
+		"Device":     {Value: device, Emit: EmitConst},
+	})
+	if err := p.tree.Add(b.object); err != nil {
+		p.tree.Remove(b.object)
+		return nil, err
+	}
+	p.batteries = append(p.batteries, b)
+	return b, nil
+}
+
+func (p *BatteryProvider) RemoveBattery(b *Battery) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for i := 0; i < len(p.batteries); i++ {
+		if p.batteries[i] != b {
+			continue
+		}
+		p.batteries = append(p.batteries[:i:i], p.batteries[i+1:]...)
+		p.tree.Remove(b.object)
+		return
+	}
+}
+
+// Batteries of device, empty device returns all of them
+func (p *BatteryProvider) Batteries(device dbus.ObjectPath) []*Battery {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	var batteries []*Battery
+	for _, b := range p.batteries {
+		if device == "" || b.device == device {
+			batteries = append(batteries, b)
+		}
+	}
+	return batteries
+}
+
+// Register exports the batteries and registers the provider on the adapter "hciN"
+func (p *BatteryProvider) Register(adapter string) error {
+	p.lock.Lock()
+	if p.conn == nil {
+		conn, err := DefaultConn()
+		if err != nil {
+			p.lock.Unlock()
+			return err
+		}
+		if err := p.tree.Export(conn); err != nil {
+			p.lock.Unlock()
+			return err
+		}
+		p.conn = conn
+	}
+	p.lock.Unlock()
+
+	// bluez calls back into GetManagedObjects before it answers
+	manager, err := NewBatteryProviderManager(adapter)
+	if err != nil {
+		return err
+	}
+	if err := manager.RegisterBatteryProvider(p.Path()); err != nil {
+		return err
+	}
+
+	p.lock.Lock()
+	p.manager = manager
+	if p.unhook != nil {
+		p.unhook()
+	}
+	p.unhook = p.conn.OnReconnect(func() error {
+		return manager.RegisterBatteryProvider(p.Path())
+	})
+	p.lock.Unlock()
+	return nil
+}
+
+func (p *BatteryProvider) Unregister() error {
+	p.lock.Lock()
+	manager := p.manager
+	p.manager = nil
+	if p.unhook != nil {
+		p.unhook()
+		p.unhook = nil
+	}
+	p.lock.Unlock()
+
+	if manager == nil {
+		return nil
+	}
+	return manager.UnregisterBatteryProvider(p.Path())
+}
+
+func (b *Battery) Path() dbus.ObjectPath {
+	return b.object.Path()
+}
+
+func (b *Battery) Device() dbus.ObjectPath {
+	return b.device
+}
+
+func (b *Battery) Percentage() byte {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.percentage
+}
+
+// SetPercentage values above 100 are clamped
+func (b *Battery) SetPercentage(percentage byte) {
+	if percentage > 100 {
+		percentage = 100
+	}
+
+	b.lock.Lock()
+	changed := b.percentage != percentage
+	b.percentage = percentage
+	b.lock.Unlock()
+
+	if changed {
+		b.object.Set(BatteryProviderInterface, "Percentage", percentage)
+	}
+}
+
+type BatteryProviderManager struct {
+	client *Client
+}
+
+func NewBatteryProviderManager(adapter string) (*BatteryProviderManager, error) {
+	client, err := NewClient(BluezInterface, BatteryProviderManagerInterface, BluezPath+"/"+adapter)
+	if err != nil {
+		return nil, err
+	}
+	return &BatteryProviderManager{client: client}, nil
+}
+
+func (m *BatteryProviderManager) RegisterBatteryProvider(provider dbus.ObjectPath) error {
+	call, err := m.client.Call("RegisterBatteryProvider", 0, provider)
+	if err != nil {
+		return err
+	}
+	return call.Store()
+}
+
+func (m *BatteryProviderManager) UnregisterBatteryProvider(provider dbus.ObjectPath) error {
+	call, err := m.client.Call("UnregisterBatteryProvider", 0, provider)
+	if err != nil {
+		return err
+	}
+	return call.Store()
+}
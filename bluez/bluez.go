@@ -2,34 +2,26 @@ package bluez
 
 import (
 	"github.com/godbus/dbus"
-	"github.com/godbus/dbus/introspect"
 )
 
-func ExportInterface(i interface{}, path dbus.ObjectPath, interfaceName string) (*dbus.Conn, error) {
-	conn, err := dbus.SystemBus()
+// ExportInterface exports i on path, the interface joins an object already
+// exported there
+func ExportInterface(i interface{}, path dbus.ObjectPath, interfaceName string) (*Conn, error) {
+	conn, err := DefaultConn()
 	if err != nil {
 		return nil, err
 	}
 
-	err = conn.Export(i, path, interfaceName)
-	if err != nil {
-		return nil, err
+	if o := conn.Object(path); o != nil {
+		return conn, o.AddInterface(interfaceName, i, nil)
 	}
 
-	node := &introspect.Node{
-		Interfaces: []introspect.Interface{
-			introspect.IntrospectData,
-			{
-				Name:    interfaceName,
-				Methods: introspect.Methods(i),
-			},
-		},
+	o := NewObject(path)
+	if err := o.AddInterface(interfaceName, i, nil); err != nil {
+		return nil, err
 	}
-
-	err = conn.Export(introspect.NewIntrospectable(node), path, Introspectable)
-	if err != nil {
+	if err := o.Export(conn); err != nil {
 		return nil, err
 	}
-
 	return conn, nil
 }
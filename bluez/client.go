@@ -1,62 +1,191 @@
 package bluez
 
 import (
+	"context"
 	"errors"
 
 	"github.com/godbus/dbus"
 )
 
 type Client struct {
-	iface      string
-	conn       *dbus.Conn
-	dbusObject dbus.BusObject
+	iface string
+	dest  string
+	path  dbus.ObjectPath
+	conn  *Conn
 }
 
-var ErrNotConnected = errors.New("not connected")
+var (
+	ErrNotConnected        = errors.New("not connected")
+	ErrInvalidPropertyType = errors.New("invalid property type")
+)
 
 func NewClientWithFullPath(name, iface string, path dbus.ObjectPath) (*Client, error) {
-	bus, err := dbus.SystemBus()
+	conn, err := DefaultConn()
 	if err != nil {
 		return nil, err
 	}
-	obj := bus.Object(name, path)
-	c := &Client{}
-	c.dbusObject = obj
-	c.conn = bus
-	c.iface = iface
-	return c, nil
+	return NewClientWithConn(conn, name, iface, path), nil
 }
 
 func NewClient(name, iface, path string) (*Client, error) {
 	return NewClientWithFullPath(name, iface, dbus.ObjectPath(path))
 }
 
+// NewClientWithConn the client holds a reference of conn until Close
+func NewClientWithConn(conn *Conn, name, iface string, path dbus.ObjectPath) *Client {
+	return &Client{
+		iface: iface,
+		dest:  name,
+		path:  path,
+		conn:  conn.Ref(),
+	}
+}
+
 func (c *Client) fullDotName(name string) string {
 	return c.iface + "." + name
 }
 
+func (c *Client) Path() dbus.ObjectPath {
+	return c.path
+}
+
+// CallContext calls method of the client interface, ctx bounds the wait for
+// the reply
+func (c *Client) CallContext(ctx context.Context, method string, flags dbus.Flags, args ...interface{}) (*dbus.Call, error) {
+	if c.conn == nil {
+		return nil, ErrNotConnected
+	}
+	return c.conn.CallContext(ctx, c.dest, c.path, c.fullDotName(method), flags, args...), nil
+}
+
+// Call is CallContext with the timeout of the connection
 func (c *Client) Call(method string, flags dbus.Flags, args ...interface{}) (*dbus.Call, error) {
 	if c.conn == nil {
 		return nil, ErrNotConnected
 	}
-	return c.dbusObject.Call(c.fullDotName(method), flags, args...), nil
+	return c.conn.Call(c.dest, c.path, c.fullDotName(method), flags, args...), nil
 }
 
 func (c *Client) GetProperty(p string) (dbus.Variant, error) {
-	return c.dbusObject.GetProperty(c.fullDotName(p))
+	var v dbus.Variant
+	if c.conn == nil {
+		return v, ErrNotConnected
+	}
+	err := c.conn.Call(c.dest, c.path, PropertiesInterface+".Get", 0, c.iface, p).Store(&v)
+	return v, err
+}
+
+func (c *Client) GetAllProperties() (map[string]dbus.Variant, error) {
+	if c.conn == nil {
+		return nil, ErrNotConnected
+	}
+	props := make(map[string]dbus.Variant)
+	err := c.conn.Call(c.dest, c.path, PropertiesInterface+".GetAll", 0, c.iface).Store(&props)
+	if err != nil {
+		return nil, err
+	}
+	return props, nil
+}
+
+func (c *Client) GetBool(p string) (bool, error) {
+	v, err := c.GetProperty(p)
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.Value().(bool)
+	if !ok {
+		return false, ErrInvalidPropertyType
+	}
+	return b, nil
+}
+
+func (c *Client) GetString(p string) (string, error) {
+	v, err := c.GetProperty(p)
+	if err != nil {
+		return "", err
+	}
+	s, ok := v.Value().(string)
+	if !ok {
+		return "", ErrInvalidPropertyType
+	}
+	return s, nil
+}
+
+func (c *Client) GetStrings(p string) ([]string, error) {
+	v, err := c.GetProperty(p)
+	if err != nil {
+		return nil, err
+	}
+	s, ok := v.Value().([]string)
+	if !ok {
+		return nil, ErrInvalidPropertyType
+	}
+	return s, nil
+}
+
+func (c *Client) GetUint32(p string) (uint32, error) {
+	v, err := c.GetProperty(p)
+	if err != nil {
+		return 0, err
+	}
+	u, ok := v.Value().(uint32)
+	if !ok {
+		return 0, ErrInvalidPropertyType
+	}
+	return u, nil
+}
+
+// WatchProperties calls fn with every PropertiesChanged signal of the client
+// interface on its object path until the returned cancel func is called
+func (c *Client) WatchProperties(fn func(changed map[string]dbus.Variant, invalidated []string)) (func(), error) {
+	if c.conn == nil {
+		return nil, ErrNotConnected
+	}
+
+	path := c.path
+	rule := "type='signal',interface='" + PropertiesInterface + "',member='PropertiesChanged',path='" + string(path) + "'"
+	if err := c.conn.AddMatch(rule); err != nil {
+		return nil, err
+	}
+
+	ch := make(chan *dbus.Signal, 16)
+	c.conn.Signal(ch)
+
+	go func() {
+		for sig := range ch {
+			if sig.Path != path || sig.Name != PropertiesInterface+".PropertiesChanged" || len(sig.Body) < 3 {
+				continue
+			}
+			if iface, ok := sig.Body[0].(string); !ok || iface != c.iface {
+				continue
+			}
+			changed, _ := sig.Body[1].(map[string]dbus.Variant)
+			invalidated, _ := sig.Body[2].([]string)
+			fn(changed, invalidated)
+		}
+	}()
+
+	conn := c.conn
+	return func() {
+		conn.RemoveSignal(ch)
+		close(ch)
+		conn.RemoveMatch(rule)
+	}, nil
 }
 
 func (c *Client) SetProperty(p string, v interface{}) error {
-	return c.dbusObject.Call("org.freedesktop.DBus.Properties.Set", 0, c.iface, p, dbus.MakeVariant(v)).Store()
+	if c.conn == nil {
+		return ErrNotConnected
+	}
+	return c.conn.Call(c.dest, c.path, PropertiesInterface+".Set", 0, c.iface, p, dbus.MakeVariant(v)).Store()
 }
 
+// Close drops the reference on the shared connection, other clients keep working
 func (c *Client) Close() error {
-	if c.conn != nil {
-		if err := c.conn.Close(); err != nil {
-			return err
-		}
-		c.dbusObject = nil
-		c.conn = nil
+	if c.conn == nil {
+		return nil
 	}
-	return nil
+	err := c.conn.Close()
+	c.conn = nil
+	return err
 }
@@ -0,0 +1,550 @@
+package bluez
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/godbus/dbus"
+)
+
+const (
+	defaultSystemBusAddress = "unix:path=/var/run/dbus/system_bus_socket"
+	DefaultCallTimeout      = time.Second * 25
+)
+
+var ErrConnClosed = errors.New("connection closed")
+
+// Conn is one bus connection shared by clients and exported objects, it
+// remembers exports, match rules and registrations and restores them when
+// the bus drops and comes back
+type Conn struct {
+	address string
+	lock    sync.Mutex
+	bus     *dbus.Conn
+	refs    int
+	closed  bool
+	timeout time.Duration
+	exports map[string]func(bus *dbus.Conn) error
+	matches map[string]int
+	signals []*subscriber
+	hooks   map[int]func() error
+	nextID  int
+	objects map[dbus.ObjectPath]*Object
+}
+
+func systemBusAddress() string {
+	if address := os.Getenv("DBUS_SYSTEM_BUS_ADDRESS"); address != "" {
+		return address
+	}
+	return defaultSystemBusAddress
+}
+
+// Dial connects to address, empty address is the system bus
+func Dial(address string) (*Conn, error) {
+	if address == "" {
+		address = systemBusAddress()
+	}
+	c := newConn(address)
+	bus, err := c.connect()
+	if err != nil {
+		return nil, err
+	}
+	c.bus = bus
+	return c, nil
+}
+
+// NewConn wraps an established connection, it is not reconnected since
+// its address is unknown
+func NewConn(bus *dbus.Conn) *Conn {
+	c := newConn("")
+	c.bus = bus
+	c.watch(bus)
+	return c
+}
+
+func newConn(address string) *Conn {
+	return &Conn{
+		address: address,
+		refs:    1,
+		timeout: DefaultCallTimeout,
+		exports: make(map[string]func(bus *dbus.Conn) error),
+		matches: make(map[string]int),
+		hooks:   make(map[int]func() error),
+		objects: make(map[dbus.ObjectPath]*Object),
+	}
+}
+
+func (c *Conn) connect() (*dbus.Conn, error) {
+	bus, err := dbus.Dial(c.address)
+	if err != nil {
+		return nil, err
+	}
+	if err := bus.Auth(nil); err != nil {
+		bus.Close()
+		return nil, err
+	}
+	if err := bus.Hello(); err != nil {
+		bus.Close()
+		return nil, err
+	}
+	c.watch(bus)
+	return bus, nil
+}
+
+// watch fans the signals of bus out to the channels passed to Signal, the
+// channels survive reconnects
+func (c *Conn) watch(bus *dbus.Conn) {
+	ch := make(chan *dbus.Signal, 64)
+	bus.Signal(ch)
+
+	go func() {
+		for sig := range ch {
+			// queued under the lock, once RemoveSignal returned the
+			// channel gets nothing more and may be closed
+			c.lock.Lock()
+			for _, s := range c.signals {
+				s.push(sig)
+			}
+			c.lock.Unlock()
+		}
+
+		// the channel gets closed with the connection
+		c.lock.Lock()
+		lost := !c.closed && c.bus == bus
+		c.lock.Unlock()
+		if lost {
+			go c.reconnect(bus)
+		}
+	}()
+}
+
+func (c *Conn) reconnect(lost *dbus.Conn) {
+	if c.address == "" {
+		log.Printf("bluez: bus connection lost")
+		return
+	}
+	log.Printf("bluez: bus connection lost, reconnecting")
+
+	wait := time.Second
+	for {
+		c.lock.Lock()
+		closed := c.closed
+		c.lock.Unlock()
+		if closed {
+			return
+		}
+
+		bus, err := c.connect()
+		if err == nil {
+			err = c.restore(bus)
+			if err == nil {
+				break
+			}
+			bus.Close()
+		}
+		log.Printf("bluez: reconnect %s", err)
+
+		time.Sleep(wait)
+		if wait < time.Second*30 {
+			wait *= 2
+		}
+	}
+
+	c.lock.Lock()
+	hooks := make([]func() error, 0, len(c.hooks))
+	for _, fn := range c.hooks {
+		hooks = append(hooks, fn)
+	}
+	c.lock.Unlock()
+
+	for _, fn := range hooks {
+		if err := fn(); err != nil {
+			log.Printf("bluez: restore registration %s", err)
+		}
+	}
+	log.Printf("bluez: bus connection restored")
+}
+
+// restore re-exports and re-adds the match rules on bus and makes it current
+func (c *Conn) restore(bus *dbus.Conn) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for _, export := range c.exports {
+		if err := export(bus); err != nil {
+			return err
+		}
+	}
+	for rule := range c.matches {
+		if err := bus.BusObject().Call("org.freedesktop.DBus.AddMatch", 0, rule).Store(); err != nil {
+			return err
+		}
+	}
+	if c.closed {
+		return ErrConnClosed
+	}
+	c.bus = bus
+	return nil
+}
+
+// Ref takes another reference, every Ref needs its own Close
+func (c *Conn) Ref() *Conn {
+	c.lock.Lock()
+	c.refs++
+	c.lock.Unlock()
+	return c
+}
+
+// Close drops a reference, the connection closes with the last one
+func (c *Conn) Close() error {
+	c.lock.Lock()
+	if c.refs > 0 {
+		c.refs--
+	}
+	if c.refs > 0 || c.closed {
+		c.lock.Unlock()
+		return nil
+	}
+	c.closed = true
+	bus := c.bus
+	signals := c.signals
+	c.signals = nil
+	c.lock.Unlock()
+
+	for _, s := range signals {
+		s.stop()
+	}
+	return bus.Close()
+}
+
+// Bus the current connection, it changes after a reconnect
+func (c *Conn) Bus() *dbus.Conn {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.bus
+}
+
+func (c *Conn) Timeout() time.Duration {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.timeout
+}
+
+// SetTimeout the deadline of calls made without a context
+func (c *Conn) SetTimeout(timeout time.Duration) {
+	c.lock.Lock()
+	c.timeout = timeout
+	c.lock.Unlock()
+}
+
+// CallContext calls method on the object dest path, ctx bounds the wait
+// for the reply, the error ends up in the returned call
+func (c *Conn) CallContext(ctx context.Context, dest string, path dbus.ObjectPath, method string, flags dbus.Flags, args ...interface{}) *dbus.Call {
+	c.lock.Lock()
+	closed := c.closed
+	bus := c.bus
+	c.lock.Unlock()
+	if closed {
+		return &dbus.Call{Destination: dest, Path: path, Method: method, Err: ErrConnClosed}
+	}
+
+	obj := bus.Object(dest, path)
+	if flags&dbus.FlagNoReplyExpected != 0 {
+		return obj.Call(method, flags, args...)
+	}
+
+	done := make(chan *dbus.Call, 1)
+	call := obj.Go(method, flags, done, args...)
+	if call.Err != nil {
+		return call
+	}
+	select {
+	case call = <-done:
+		return call
+	case <-ctx.Done():
+		return &dbus.Call{Destination: dest, Path: path, Method: method, Args: args, Err: ctx.Err()}
+	}
+}
+
+// Call is CallContext with the connection timeout
+func (c *Conn) Call(dest string, path dbus.ObjectPath, method string, flags dbus.Flags, args ...interface{}) *dbus.Call {
+	ctx, cancel := context.WithTimeout(context.Background(), c.Timeout())
+	defer cancel()
+	return c.CallContext(ctx, dest, path, method, flags, args...)
+}
+
+func exportKey(path dbus.ObjectPath, iface string) string {
+	return string(path) + " " + iface
+}
+
+// export runs fn now and again after every reconnect until unexport
+func (c *Conn) export(path dbus.ObjectPath, iface string, fn func(bus *dbus.Conn) error) error {
+	if err := fn(c.Bus()); err != nil {
+		return err
+	}
+	c.lock.Lock()
+	c.exports[exportKey(path, iface)] = fn
+	c.lock.Unlock()
+	return nil
+}
+
+func (c *Conn) unexport(path dbus.ObjectPath, iface string) {
+	c.lock.Lock()
+	delete(c.exports, exportKey(path, iface))
+	c.lock.Unlock()
+}
+
+// exportObject an object owns its path, interfaces are added to it
+func (c *Conn) exportObject(o *Object) error {
+	c.lock.Lock()
+	if _, ok := c.objects[o.path]; ok {
+		c.lock.Unlock()
+		return ErrObjectExists
+	}
+	c.objects[o.path] = o
+	c.lock.Unlock()
+
+	if err := c.export(o.path, "", o.exportTo); err != nil {
+		c.lock.Lock()
+		delete(c.objects, o.path)
+		c.lock.Unlock()
+		return err
+	}
+	return nil
+}
+
+func (c *Conn) unexportObject(o *Object) {
+	c.unexport(o.path, "")
+	c.lock.Lock()
+	if c.objects[o.path] == o {
+		delete(c.objects, o.path)
+	}
+	c.lock.Unlock()
+}
+
+// Object exported on path, nil when there is none
+func (c *Conn) Object(path dbus.ObjectPath) *Object {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.objects[path]
+}
+
+// children names of the nodes directly below path that lead to objects
+func (c *Conn) children(path dbus.ObjectPath) []string {
+	prefix := string(path) + "/"
+	if path == "/" {
+		prefix = "/"
+	}
+
+	c.lock.Lock()
+	seen := make(map[string]bool)
+	for p := range c.objects {
+		if p == path || !strings.HasPrefix(string(p), prefix) {
+			continue
+		}
+		name := strings.SplitN(string(p)[len(prefix):], "/", 2)[0]
+		seen[name] = true
+	}
+	c.lock.Unlock()
+
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Export v on path like dbus.Conn.Export, it survives reconnects
+func (c *Conn) Export(v interface{}, path dbus.ObjectPath, iface string) error {
+	return c.export(path, iface, func(bus *dbus.Conn) error {
+		return bus.Export(v, path, iface)
+	})
+}
+
+func (c *Conn) Unexport(path dbus.ObjectPath, iface string) {
+	c.unexport(path, iface)
+	c.Bus().Export(nil, path, iface)
+}
+
+func (c *Conn) Emit(path dbus.ObjectPath, name string, values ...interface{}) error {
+	return c.Bus().Emit(path, name, values...)
+}
+
+// AddMatch rules are counted, the last RemoveMatch removes it from the bus
+func (c *Conn) AddMatch(rule string) error {
+	c.lock.Lock()
+	n := c.matches[rule]
+	c.matches[rule] = n + 1
+	c.lock.Unlock()
+	if n > 0 {
+		return nil
+	}
+
+	if call := c.Call("org.freedesktop.DBus", "/org/freedesktop/DBus", "org.freedesktop.DBus.AddMatch", 0, rule); call.Err != nil {
+		c.lock.Lock()
+		delete(c.matches, rule)
+		c.lock.Unlock()
+		return call.Err
+	}
+	return nil
+}
+
+func (c *Conn) RemoveMatch(rule string) error {
+	c.lock.Lock()
+	n := c.matches[rule]
+	if n > 1 {
+		c.matches[rule] = n - 1
+	} else {
+		delete(c.matches, rule)
+	}
+	c.lock.Unlock()
+	if n != 1 {
+		return nil
+	}
+	return c.Call("org.freedesktop.DBus", "/org/freedesktop/DBus", "org.freedesktop.DBus.RemoveMatch", 0, rule).Err
+}
+
+// Signal ch receives every signal, it is never closed by the connection,
+// signals queue up while ch is full, after RemoveSignal it is safe to close
+func (c *Conn) Signal(ch chan<- *dbus.Signal) {
+	s := newSubscriber(ch)
+	c.lock.Lock()
+	c.signals = append(c.signals[:len(c.signals):len(c.signals)], s)
+	c.lock.Unlock()
+}
+
+func (c *Conn) RemoveSignal(ch chan<- *dbus.Signal) {
+	c.lock.Lock()
+	var removed *subscriber
+	for i := 0; i < len(c.signals); i++ {
+		if c.signals[i].ch == ch {
+			removed = c.signals[i]
+			c.signals = append(c.signals[:i:i], c.signals[i+1:]...)
+			break
+		}
+	}
+	c.lock.Unlock()
+	if removed != nil {
+		removed.stop()
+	}
+}
+
+// subscriber delivers the signals of one channel passed to Signal, a slow
+// reader holds up nobody else and loses nothing
+type subscriber struct {
+	ch     chan<- *dbus.Signal
+	lock   sync.Mutex
+	queue  []*dbus.Signal
+	wake   chan struct{}
+	done   chan struct{}
+	exited chan struct{}
+}
+
+func newSubscriber(ch chan<- *dbus.Signal) *subscriber {
+	s := &subscriber{
+		ch:     ch,
+		wake:   make(chan struct{}, 1),
+		done:   make(chan struct{}),
+		exited: make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// push never blocks, the watch loop calls it for every subscriber
+func (s *subscriber) push(sig *dbus.Signal) {
+	s.lock.Lock()
+	s.queue = append(s.queue, sig)
+	s.lock.Unlock()
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *subscriber) run() {
+	defer close(s.exited)
+	for {
+		s.lock.Lock()
+		queue := s.queue
+		s.queue = nil
+		s.lock.Unlock()
+		for _, sig := range queue {
+			select {
+			case s.ch <- sig:
+			case <-s.done:
+				return
+			}
+		}
+		select {
+		case <-s.wake:
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// stop returns once nothing is sent on ch anymore
+func (s *subscriber) stop() {
+	close(s.done)
+	<-s.exited
+}
+
+// OnReconnect fn runs after the connection came back and everything got
+// exported again, registrations with bluez are renewed from it
+func (c *Conn) OnReconnect(fn func() error) func() {
+	c.lock.Lock()
+	id := c.nextID
+	c.nextID++
+	c.hooks[id] = fn
+	c.lock.Unlock()
+
+	return func() {
+		c.lock.Lock()
+		delete(c.hooks, id)
+		c.lock.Unlock()
+	}
+}
+
+var (
+	defaultLock sync.Mutex
+	defaultConn *Conn
+)
+
+// SetConn makes clients and exported objects created afterwards use conn,
+// nil goes back to the system bus
+func SetConn(conn *Conn) {
+	defaultLock.Lock()
+	defaultConn = conn
+	defaultLock.Unlock()
+}
+
+// SetBus is SetConn for an established connection
+func SetBus(bus *dbus.Conn) {
+	if bus == nil {
+		SetConn(nil)
+		return
+	}
+	SetConn(NewConn(bus))
+}
+
+// DefaultConn the connection set with SetConn, the system bus otherwise
+func DefaultConn() (*Conn, error) {
+	defaultLock.Lock()
+	defer defaultLock.Unlock()
+	if defaultConn != nil {
+		return defaultConn, nil
+	}
+	conn, err := Dial("")
+	if err != nil {
+		return nil, err
+	}
+	defaultConn = conn
+	return conn, nil
+}
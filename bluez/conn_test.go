@@ -0,0 +1,55 @@
+package bluez_test
+
+import (
+	"testing"
+	"time"
+	"vitrhid/bluez"
+
+	"github.com/godbus/dbus"
+)
+
+func TestSignalFull(t *testing.T) {
+	mock, conn := startBluez(t)
+	hci, err := mock.AddAdapter("hci0", "00:00:00:00:00:01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rule := "type='signal',interface='" + bluez.PropertiesInterface + "',path='" + string(hci.Path()) + "'"
+	if err := conn.AddMatch(rule); err != nil {
+		t.Fatal(err)
+	}
+
+	// a full channel neither loses signals nor holds up the others
+	slow := make(chan *dbus.Signal)
+	fast := make(chan *dbus.Signal, 100)
+	conn.Signal(slow)
+	conn.Signal(fast)
+	defer conn.RemoveSignal(slow)
+	defer conn.RemoveSignal(fast)
+
+	const changes = 20
+	for i := 0; i < changes; i++ {
+		hci.Set("Class", uint32(i+1))
+	}
+	timeout := time.After(time.Second * 2)
+	for i := 0; i < changes; i++ {
+		select {
+		case <-fast:
+		case <-timeout:
+			t.Fatalf("fast channel got %d signals", i)
+		}
+	}
+	for i := 0; i < changes; i++ {
+		select {
+		case <-slow:
+		case <-timeout:
+			t.Fatalf("slow channel got %d signals", i)
+		}
+	}
+
+	// nothing is sent after RemoveSignal
+	conn.RemoveSignal(slow)
+	close(slow)
+	hci.Set("Class", uint32(0))
+	<-fast
+}
@@ -10,18 +10,30 @@ var (
 )
 
 const (
-	BluezInterface          = "org.bluez"
-	BluezPath               = "/org/bluez"
-	AdapterInterface        = "org.bluez.Adapter1"
-	DeviceInterface         = "org.bluez.Device1"
-	AgentManagerInterface   = "org.bluez.AgentManager1"
-	AgentInterface          = "org.bluez.Agent1"
-	ProfileInterface        = "org.bluez.Profile1"
-	ProfileManagerInterface = "org.bluez.ProfileManager1"
+	BluezInterface                  = "org.bluez"
+	BluezPath                       = "/org/bluez"
+	AdapterInterface                = "org.bluez.Adapter1"
+	DeviceInterface                 = "org.bluez.Device1"
+	AgentManagerInterface           = "org.bluez.AgentManager1"
+	AgentInterface                  = "org.bluez.Agent1"
+	ProfileInterface                = "org.bluez.Profile1"
+	ProfileManagerInterface         = "org.bluez.ProfileManager1"
+	GattManagerInterface            = "org.bluez.GattManager1"
+	GattServiceInterface            = "org.bluez.GattService1"
+	GattCharInterface               = "org.bluez.GattCharacteristic1"
+	GattDescInterface               = "org.bluez.GattDescriptor1"
+	LEAdvertisementInterface        = "org.bluez.LEAdvertisement1"
+	LEAdvertisingManagerInterface   = "org.bluez.LEAdvertisingManager1"
+	BatteryProviderInterface        = "org.bluez.BatteryProvider1"
+	BatteryProviderManagerInterface = "org.bluez.BatteryProviderManager1"
+	AdminPolicySetInterface         = "org.bluez.AdminPolicySet1"
+	AdminPolicyStatusInterface      = "org.bluez.AdminPolicyStatus1"
 )
 
 const (
-	Introspectable = "org.freedesktop.DBus.Introspectable"
+	Introspectable      = "org.freedesktop.DBus.Introspectable"
+	PropertiesInterface = "org.freedesktop.DBus.Properties"
+	ObjectManager       = "org.freedesktop.DBus.ObjectManager"
 )
 
 const hextable = "0123456789abcdef"
@@ -4,6 +4,7 @@ import "github.com/godbus/dbus"
 
 type Device struct {
 	client *Client
+	path   dbus.ObjectPath
 }
 
 func NewDeviceWithFullPath(path dbus.ObjectPath) (*Device, error) {
@@ -13,6 +14,7 @@ func NewDeviceWithFullPath(path dbus.ObjectPath) (*Device, error) {
 	}
 	return &Device{
 		client: devClient,
+		path:   path,
 	}, nil
 }
 
@@ -24,14 +26,286 @@ func NewDevice(adapter string, address []byte) (*Device, error) {
 	return NewDeviceWithFullPath(dbus.ObjectPath(BluezPath + "/" + adapter + "/" + ap))
 }
 
-func (d *Device) GetTrusted() (bool, error) {
-	v, err := d.client.GetProperty("Trusted")
+func (d *Device) Path() dbus.ObjectPath {
+	return d.path
+}
+
+func (d *Device) call(method string, args ...interface{}) error {
+	call, err := d.client.Call(method, 0, args...)
 	if err != nil {
-		return false, err
+		return err
 	}
-	return v.Value().(bool), nil
+	return call.Store()
+}
+
+// Connect all auto-connectable profiles of the device
+func (d *Device) Connect() error {
+	return d.call("Connect")
+}
+
+func (d *Device) Disconnect() error {
+	return d.call("Disconnect")
+}
+
+func (d *Device) ConnectProfile(uuid string) error {
+	return d.call("ConnectProfile", uuid)
+}
+
+func (d *Device) DisconnectProfile(uuid string) error {
+	return d.call("DisconnectProfile", uuid)
+}
+
+func (d *Device) Pair() error {
+	return d.call("Pair")
+}
+
+func (d *Device) CancelPairing() error {
+	return d.call("CancelPairing")
+}
+
+func (d *Device) GetAddress() (string, error) {
+	return d.client.GetString("Address")
+}
+
+// GetAddressType public or random
+func (d *Device) GetAddressType() (string, error) {
+	return d.client.GetString("AddressType")
+}
+
+func (d *Device) GetName() (string, error) {
+	return d.client.GetString("Name")
+}
+
+func (d *Device) GetAlias() (string, error) {
+	return d.client.GetString("Alias")
+}
+
+func (d *Device) SetAlias(alias string) error {
+	return d.client.SetProperty("Alias", alias)
+}
+
+func (d *Device) GetClass() (uint32, error) {
+	return d.client.GetUint32("Class")
+}
+
+func (d *Device) GetAppearance() (uint16, error) {
+	v, err := d.client.GetProperty("Appearance")
+	if err != nil {
+		return 0, err
+	}
+	a, ok := v.Value().(uint16)
+	if !ok {
+		return 0, ErrInvalidPropertyType
+	}
+	return a, nil
+}
+
+func (d *Device) GetIcon() (string, error) {
+	return d.client.GetString("Icon")
+}
+
+func (d *Device) GetPaired() (bool, error) {
+	return d.client.GetBool("Paired")
+}
+
+func (d *Device) GetBonded() (bool, error) {
+	return d.client.GetBool("Bonded")
+}
+
+func (d *Device) GetTrusted() (bool, error) {
+	return d.client.GetBool("Trusted")
 }
 
 func (d *Device) SetTrusted(trusted bool) error {
 	return d.client.SetProperty("Trusted", trusted)
 }
+
+func (d *Device) GetBlocked() (bool, error) {
+	return d.client.GetBool("Blocked")
+}
+
+func (d *Device) SetBlocked(blocked bool) error {
+	return d.client.SetProperty("Blocked", blocked)
+}
+
+func (d *Device) GetConnected() (bool, error) {
+	return d.client.GetBool("Connected")
+}
+
+// GetRSSI only available while the device is discovered
+func (d *Device) GetRSSI() (int16, error) {
+	v, err := d.client.GetProperty("RSSI")
+	if err != nil {
+		return 0, err
+	}
+	rssi, ok := v.Value().(int16)
+	if !ok {
+		return 0, ErrInvalidPropertyType
+	}
+	return rssi, nil
+}
+
+func (d *Device) GetUUIDs() ([]string, error) {
+	return d.client.GetStrings("UUIDs")
+}
+
+func (d *Device) GetModalias() (string, error) {
+	return d.client.GetString("Modalias")
+}
+
+func (d *Device) GetWakeAllowed() (bool, error) {
+	return d.client.GetBool("WakeAllowed")
+}
+
+func (d *Device) SetWakeAllowed(allowed bool) error {
+	return d.client.SetProperty("WakeAllowed", allowed)
+}
+
+func (d *Device) GetServicesResolved() (bool, error) {
+	return d.client.GetBool("ServicesResolved")
+}
+
+func (d *Device) GetProperties() (*DeviceProperties, error) {
+	m, err := d.client.GetAllProperties()
+	if err != nil {
+		return nil, err
+	}
+	p := &DeviceProperties{}
+	p.Update(m)
+	return p, nil
+}
+
+// DevicePropertiesHandler receives the properties after the change and the changed names
+type DevicePropertiesHandler func(p *DeviceProperties, changed []string)
+
+// WatchProperties fn runs for every PropertiesChanged of the device
+func (d *Device) WatchProperties(fn DevicePropertiesHandler) (func(), error) {
+	p, err := d.GetProperties()
+	if err != nil {
+		return nil, err
+	}
+	return d.client.WatchProperties(func(m map[string]dbus.Variant, invalidated []string) {
+		p.Update(m)
+		p.invalidate(invalidated)
+		var names []string
+		for name := range m {
+			names = append(names, name)
+		}
+		snapshot := *p
+		fn(&snapshot, append(names, invalidated...))
+	})
+}
+
+func (d *Device) watchBool(property string, get func(p *DeviceProperties) bool, fn func(bool)) (func(), error) {
+	return d.WatchProperties(func(p *DeviceProperties, changed []string) {
+		for _, name := range changed {
+			if name == property {
+				fn(get(p))
+				return
+			}
+		}
+	})
+}
+
+// OnConnected fn runs whenever the Connected property flips
+func (d *Device) OnConnected(fn func(connected bool)) (func(), error) {
+	return d.watchBool("Connected", func(p *DeviceProperties) bool { return p.Connected }, fn)
+}
+
+func (d *Device) OnPaired(fn func(paired bool)) (func(), error) {
+	return d.watchBool("Paired", func(p *DeviceProperties) bool { return p.Paired }, fn)
+}
+
+func (d *Device) OnTrusted(fn func(trusted bool)) (func(), error) {
+	return d.watchBool("Trusted", func(p *DeviceProperties) bool { return p.Trusted }, fn)
+}
+
+func (d *Device) OnServicesResolved(fn func(resolved bool)) (func(), error) {
+	return d.watchBool("ServicesResolved", func(p *DeviceProperties) bool { return p.ServicesResolved }, fn)
+}
+
+type DeviceProperties struct {
+	Address          string
+	AddressType      string
+	Name             string
+	Alias            string
+	Class            uint32
+	Appearance       uint16
+	Icon             string
+	Paired           bool
+	Bonded           bool
+	Trusted          bool
+	Blocked          bool
+	Connected        bool
+	RSSI             int16
+	UUIDs            []string
+	Modalias         string
+	Adapter          dbus.ObjectPath
+	WakeAllowed      bool
+	ServicesResolved bool
+}
+
+// Update stores the known properties of m, unknown names and types are skipped
+func (p *DeviceProperties) Update(m map[string]dbus.Variant) {
+	for name, v := range m {
+		switch name {
+		case "Address":
+			p.Address, _ = v.Value().(string)
+		case "AddressType":
+			p.AddressType, _ = v.Value().(string)
+		case "Name":
+			p.Name, _ = v.Value().(string)
+		case "Alias":
+			p.Alias, _ = v.Value().(string)
+		case "Class":
+			p.Class, _ = v.Value().(uint32)
+		case "Appearance":
+			p.Appearance, _ = v.Value().(uint16)
+		case "Icon":
+			p.Icon, _ = v.Value().(string)
+		case "Paired":
+			p.Paired, _ = v.Value().(bool)
+		case "Bonded":
+			p.Bonded, _ = v.Value().(bool)
+		case "Trusted":
+			p.Trusted, _ = v.Value().(bool)
+		case "Blocked":
+			p.Blocked, _ = v.Value().(bool)
+		case "Connected":
+			p.Connected, _ = v.Value().(bool)
+		case "RSSI":
+			p.RSSI, _ = v.Value().(int16)
+		case "UUIDs":
+			p.UUIDs, _ = v.Value().([]string)
+		case "Modalias":
+			p.Modalias, _ = v.Value().(string)
+		case "Adapter":
+			p.Adapter, _ = v.Value().(dbus.ObjectPath)
+		case "WakeAllowed":
+			p.WakeAllowed, _ = v.Value().(bool)
+		case "ServicesResolved":
+			p.ServicesResolved, _ = v.Value().(bool)
+		}
+	}
+}
+
+// invalidate resets properties bluez dropped, e.g. RSSI once out of range
+func (p *DeviceProperties) invalidate(names []string) {
+	for _, name := range names {
+		switch name {
+		case "RSSI":
+			p.RSSI = 0
+		case "Name":
+			p.Name = ""
+		case "UUIDs":
+			p.UUIDs = nil
+		case "Modalias":
+			p.Modalias = ""
+		}
+	}
+}
+
+// Close releases the connection reference of the device
+func (d *Device) Close() error {
+	return d.client.Close()
+}
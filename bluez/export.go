@@ -0,0 +1,640 @@
+package bluez
+
+import (
+	"encoding/xml"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/godbus/dbus"
+	"github.com/godbus/dbus/introspect"
+	"github.com/godbus/dbus/prop"
+)
+
+var (
+	ErrObjectExists    = errors.New("object already exported")
+	ErrInterfaceExists = errors.New("interface already exported")
+	ErrOutsideTree     = errors.New("object outside of the tree")
+)
+
+var (
+	ErrUnknownInterface = &dbus.Error{
+		Name: "org.freedesktop.DBus.Error.UnknownInterface",
+		Body: []interface{}{"Unknown Interface"},
+	}
+	ErrUnknownProperty = &dbus.Error{
+		Name: "org.freedesktop.DBus.Error.UnknownProperty",
+		Body: []interface{}{"Unknown Property"},
+	}
+	ErrPropertyReadOnly = &dbus.Error{
+		Name: "org.freedesktop.DBus.Error.PropertyReadOnly",
+		Body: []interface{}{"Property Read Only"},
+	}
+	ErrInvalidArgs = &dbus.Error{
+		Name: "org.freedesktop.DBus.Error.InvalidArgs",
+		Body: []interface{}{"Invalid Arguments"},
+	}
+)
+
+// EmitMode how a change of a property is announced, the modes follow the
+// org.freedesktop.DBus.Property.EmitsChanged annotation
+type EmitMode int
+
+const (
+	EmitTrue EmitMode = iota
+	EmitInvalidates
+	EmitConst
+	EmitFalse
+)
+
+func (m EmitMode) String() string {
+	switch m {
+	case EmitInvalidates:
+		return "invalidates"
+	case EmitConst:
+		return "const"
+	case EmitFalse:
+		return "false"
+	}
+	return "true"
+}
+
+// Property of an exported object, Value decides the d-bus type
+type Property struct {
+	Value interface{}
+	// Get computes the value on every read instead of Value
+	Get func() interface{}
+	// Set makes the property writable from the bus, it sees the value
+	// before it is stored and an error rejects it
+	Set  func(value interface{}) *dbus.Error
+	Emit EmitMode
+}
+
+type objectInterface struct {
+	name    string
+	methods interface{}
+	props   map[string]*Property
+	signals []introspect.Signal
+}
+
+// Object is an exported object with any number of interfaces, it answers
+// Properties and Introspectable for them and follows its connection across
+// reconnects
+type Object struct {
+	path    dbus.ObjectPath
+	lock    sync.Mutex
+	conn    *Conn
+	ifaces  []*objectInterface
+	manager *ObjectTree
+	// children is set on the root of an ObjectTree
+	children *ObjectTree
+}
+
+func NewObject(path dbus.ObjectPath) *Object {
+	return &Object{path: path}
+}
+
+func (o *Object) Path() dbus.ObjectPath {
+	return o.path
+}
+
+func (o *Object) connection() *Conn {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	return o.conn
+}
+
+func (o *Object) find(iface string) *objectInterface {
+	for _, i := range o.ifaces {
+		if i.name == iface {
+			return i
+		}
+	}
+	return nil
+}
+
+// AddInterface methods are exported like dbus.Conn.Export, nil for an
+// interface with properties only, an exported object announces the
+// interface right away
+func (o *Object) AddInterface(iface string, methods interface{}, props map[string]*Property, signals ...introspect.Signal) error {
+	if props == nil {
+		props = make(map[string]*Property)
+	}
+	i := &objectInterface{name: iface, methods: methods, props: props, signals: signals}
+
+	o.lock.Lock()
+	if o.find(iface) != nil {
+		o.lock.Unlock()
+		return ErrInterfaceExists
+	}
+	o.ifaces = append(o.ifaces, i)
+	conn := o.conn
+	manager := o.manager
+	o.lock.Unlock()
+
+	if conn == nil {
+		return nil
+	}
+	if methods != nil {
+		if err := conn.Bus().Export(methods, o.path, iface); err != nil {
+			o.removeInterface(iface)
+			return err
+		}
+	}
+	if manager != nil {
+		manager.interfacesAdded(o.path, map[string]map[string]dbus.Variant{iface: o.getAll(i)})
+	}
+	return nil
+}
+
+func (o *Object) removeInterface(iface string) *objectInterface {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	for n, i := range o.ifaces {
+		if i.name == iface {
+			o.ifaces = append(o.ifaces[:n:n], o.ifaces[n+1:]...)
+			return i
+		}
+	}
+	return nil
+}
+
+func (o *Object) RemoveInterface(iface string) {
+	if o.removeInterface(iface) == nil {
+		return
+	}
+	o.lock.Lock()
+	conn := o.conn
+	manager := o.manager
+	o.lock.Unlock()
+
+	if conn == nil {
+		return
+	}
+	conn.Bus().Export(nil, o.path, iface)
+	if manager != nil {
+		manager.interfacesRemoved(o.path, []string{iface})
+	}
+}
+
+// Export puts the object and the objects of its tree on conn
+func (o *Object) Export(conn *Conn) error {
+	o.lock.Lock()
+	if o.conn != nil {
+		o.lock.Unlock()
+		return nil
+	}
+	o.conn = conn
+	o.lock.Unlock()
+
+	if err := conn.exportObject(o); err != nil {
+		o.lock.Lock()
+		o.conn = nil
+		o.lock.Unlock()
+		return err
+	}
+	if o.children != nil {
+		for _, child := range o.children.Objects() {
+			if err := child.Export(conn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Unexport removes the object and the objects of its tree from the bus
+func (o *Object) Unexport() {
+	if o.children != nil {
+		for _, child := range o.children.Objects() {
+			child.Unexport()
+		}
+	}
+
+	o.lock.Lock()
+	conn := o.conn
+	o.conn = nil
+	ifaces := o.ifaces
+	o.lock.Unlock()
+	if conn == nil {
+		return
+	}
+
+	conn.unexportObject(o)
+	bus := conn.Bus()
+	for _, i := range ifaces {
+		bus.Export(nil, o.path, i.name)
+	}
+	bus.Export(nil, o.path, PropertiesInterface)
+	bus.Export(nil, o.path, Introspectable)
+}
+
+// exportTo runs for the first export and after every reconnect
+func (o *Object) exportTo(bus *dbus.Conn) error {
+	o.lock.Lock()
+	ifaces := o.ifaces
+	o.lock.Unlock()
+
+	for _, i := range ifaces {
+		if i.methods == nil {
+			continue
+		}
+		if err := bus.Export(i.methods, o.path, i.name); err != nil {
+			return err
+		}
+	}
+	if err := bus.Export(&objectProperties{o}, o.path, PropertiesInterface); err != nil {
+		return err
+	}
+	return bus.Export(&objectIntrospectable{o}, o.path, Introspectable)
+}
+
+// Emit sends the signal iface.name from the object, nothing happens while
+// it is not exported
+func (o *Object) Emit(iface, name string, values ...interface{}) error {
+	conn := o.connection()
+	if conn == nil {
+		return nil
+	}
+	return conn.Emit(o.path, iface+"."+name, values...)
+}
+
+func (o *Object) property(iface, name string) (*Property, *dbus.Error) {
+	i := o.find(iface)
+	if i == nil {
+		return nil, ErrUnknownInterface
+	}
+	p, ok := i.props[name]
+	if !ok {
+		return nil, ErrUnknownProperty
+	}
+	return p, nil
+}
+
+func (o *Object) get(iface, name string) (interface{}, *dbus.Error) {
+	o.lock.Lock()
+	p, derr := o.property(iface, name)
+	if derr != nil {
+		o.lock.Unlock()
+		return nil, derr
+	}
+	value, get := p.Value, p.Get
+	o.lock.Unlock()
+
+	if get != nil {
+		return get(), nil
+	}
+	return value, nil
+}
+
+// Get the current value of a property
+func (o *Object) Get(iface, name string) (interface{}, error) {
+	v, derr := o.get(iface, name)
+	if derr != nil {
+		return nil, derr
+	}
+	return v, nil
+}
+
+// Set stores the value and announces it as the property asks for, it
+// skips the Set hook of the property
+func (o *Object) Set(iface, name string, value interface{}) error {
+	o.lock.Lock()
+	p, derr := o.property(iface, name)
+	if derr != nil {
+		o.lock.Unlock()
+		return derr
+	}
+	p.Value = value
+	mode := p.Emit
+	conn := o.conn
+	o.lock.Unlock()
+
+	if conn == nil {
+		return nil
+	}
+	return o.changed(conn, iface, name, mode, value)
+}
+
+func (o *Object) changed(conn *Conn, iface, name string, mode EmitMode, value interface{}) error {
+	switch mode {
+	case EmitTrue:
+		return conn.Emit(o.path, PropertiesInterface+".PropertiesChanged", iface,
+			map[string]dbus.Variant{name: dbus.MakeVariant(value)}, []string{})
+	case EmitInvalidates:
+		return conn.Emit(o.path, PropertiesInterface+".PropertiesChanged", iface,
+			map[string]dbus.Variant{}, []string{name})
+	}
+	return nil
+}
+
+// set is a write from the bus
+func (o *Object) set(iface, name string, value interface{}) *dbus.Error {
+	current, derr := o.get(iface, name)
+	if derr != nil {
+		return derr
+	}
+
+	o.lock.Lock()
+	p, _ := o.property(iface, name)
+	hook := p.Set
+	o.lock.Unlock()
+
+	if hook == nil {
+		return ErrPropertyReadOnly
+	}
+	if dbus.SignatureOf(value) != dbus.SignatureOf(current) {
+		return ErrInvalidArgs
+	}
+	if derr := hook(value); derr != nil {
+		return derr
+	}
+	if err := o.Set(iface, name, value); err != nil {
+		return ErrFailed
+	}
+	return nil
+}
+
+func (o *Object) getAll(i *objectInterface) map[string]dbus.Variant {
+	o.lock.Lock()
+	values := make(map[string]interface{}, len(i.props))
+	getters := make(map[string]func() interface{})
+	for name, p := range i.props {
+		if p.Get != nil {
+			getters[name] = p.Get
+		} else {
+			values[name] = p.Value
+		}
+	}
+	o.lock.Unlock()
+
+	for name, get := range getters {
+		values[name] = get()
+	}
+	props := make(map[string]dbus.Variant, len(values))
+	for name, v := range values {
+		props[name] = dbus.MakeVariant(v)
+	}
+	return props
+}
+
+// GetAll properties of iface
+func (o *Object) GetAll(iface string) (map[string]dbus.Variant, error) {
+	o.lock.Lock()
+	i := o.find(iface)
+	o.lock.Unlock()
+	if i == nil {
+		return nil, ErrUnknownInterface
+	}
+	return o.getAll(i), nil
+}
+
+// Interfaces with their properties as ObjectManager reports them
+func (o *Object) Interfaces() map[string]map[string]dbus.Variant {
+	o.lock.Lock()
+	ifaces := o.ifaces
+	o.lock.Unlock()
+
+	m := make(map[string]map[string]dbus.Variant, len(ifaces))
+	for _, i := range ifaces {
+		m[i.name] = o.getAll(i)
+	}
+	return m
+}
+
+func (o *Object) introspect() *introspect.Node {
+	o.lock.Lock()
+	ifaces := o.ifaces
+	conn := o.conn
+	o.lock.Unlock()
+
+	node := &introspect.Node{
+		Name:       string(o.path),
+		Interfaces: []introspect.Interface{introspect.IntrospectData, prop.IntrospectData},
+	}
+	for _, i := range ifaces {
+		data := introspect.Interface{Name: i.name, Signals: i.signals}
+		if i.methods != nil {
+			data.Methods = introspect.Methods(i.methods)
+		}
+
+		props := o.getAll(i)
+		names := make([]string, 0, len(props))
+		for name := range props {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			p := introspect.Property{
+				Name:   name,
+				Type:   props[name].Signature().String(),
+				Access: "read",
+			}
+			o.lock.Lock()
+			if i.props[name].Set != nil {
+				p.Access = "readwrite"
+			}
+			if mode := i.props[name].Emit; mode != EmitTrue {
+				p.Annotations = []introspect.Annotation{{
+					Name:  "org.freedesktop.DBus.Property.EmitsChanged",
+					Value: mode.String(),
+				}}
+			}
+			o.lock.Unlock()
+			data.Properties = append(data.Properties, p)
+		}
+		node.Interfaces = append(node.Interfaces, data)
+	}
+
+	if conn != nil {
+		for _, name := range conn.children(o.path) {
+			node.Children = append(node.Children, introspect.Node{Name: name})
+		}
+	}
+	return node
+}
+
+type objectProperties struct {
+	o *Object
+}
+
+func (p *objectProperties) Get(iface, name string) (dbus.Variant, *dbus.Error) {
+	v, derr := p.o.get(iface, name)
+	if derr != nil {
+		return dbus.Variant{}, derr
+	}
+	return dbus.MakeVariant(v), nil
+}
+
+func (p *objectProperties) GetAll(iface string) (map[string]dbus.Variant, *dbus.Error) {
+	props, err := p.o.GetAll(iface)
+	if err != nil {
+		return nil, ErrUnknownInterface
+	}
+	return props, nil
+}
+
+func (p *objectProperties) Set(iface, name string, value dbus.Variant) *dbus.Error {
+	return p.o.set(iface, name, value.Value())
+}
+
+type objectIntrospectable struct {
+	o *Object
+}
+
+func (i *objectIntrospectable) Introspect() (string, *dbus.Error) {
+	b, err := xml.Marshal(i.o.introspect())
+	if err != nil {
+		return "", ErrFailed
+	}
+	return strings.TrimSpace(introspect.IntrospectDeclarationString) + string(b), nil
+}
+
+var objectManagerSignals = []introspect.Signal{
+	{
+		Name: "InterfacesAdded",
+		Args: []introspect.Arg{{Name: "object", Type: "o"}, {Name: "interfaces", Type: "a{sa{sv}}"}},
+	},
+	{
+		Name: "InterfacesRemoved",
+		Args: []introspect.Arg{{Name: "object", Type: "o"}, {Name: "interfaces", Type: "as"}},
+	},
+}
+
+// ObjectTree exports org.freedesktop.DBus.ObjectManager on its root and
+// announces the objects added below it, the root of a tree can be added to
+// another tree
+type ObjectTree struct {
+	root    *Object
+	lock    sync.Mutex
+	objects []*Object
+}
+
+func NewObjectTree(path dbus.ObjectPath) *ObjectTree {
+	t := &ObjectTree{root: NewObject(path)}
+	t.root.children = t
+	t.root.AddInterface(ObjectManager, &objectManager{t}, nil, objectManagerSignals...)
+	return t
+}
+
+func (t *ObjectTree) Root() *Object {
+	return t.root
+}
+
+func (t *ObjectTree) Path() dbus.ObjectPath {
+	return t.root.path
+}
+
+func (t *ObjectTree) Objects() []*Object {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return append([]*Object(nil), t.objects...)
+}
+
+func (t *ObjectTree) below(path dbus.ObjectPath) bool {
+	if t.root.path == "/" {
+		return path != "/"
+	}
+	return strings.HasPrefix(string(path), string(t.root.path)+"/")
+}
+
+// Add o below the root, it is exported and announced when the tree is
+func (t *ObjectTree) Add(o *Object) error {
+	if !t.below(o.path) {
+		return ErrOutsideTree
+	}
+	o.lock.Lock()
+	o.manager = t
+	o.lock.Unlock()
+
+	t.lock.Lock()
+	t.objects = append(t.objects, o)
+	t.lock.Unlock()
+
+	conn := t.root.connection()
+	if conn == nil {
+		return nil
+	}
+	if err := o.Export(conn); err != nil {
+		return err
+	}
+	t.announce(o)
+	return nil
+}
+
+// announce o and a tree below it
+func (t *ObjectTree) announce(o *Object) {
+	t.interfacesAdded(o.path, o.Interfaces())
+	if o.children != nil {
+		for _, child := range o.children.Objects() {
+			t.announce(child)
+		}
+	}
+}
+
+func (t *ObjectTree) Remove(o *Object) {
+	t.lock.Lock()
+	found := false
+	for n := 0; n < len(t.objects); n++ {
+		if t.objects[n] == o {
+			t.objects = append(t.objects[:n:n], t.objects[n+1:]...)
+			found = true
+			break
+		}
+	}
+	t.lock.Unlock()
+	if !found {
+		return
+	}
+
+	o.lock.Lock()
+	o.manager = nil
+	var names []string
+	for _, i := range o.ifaces {
+		names = append(names, i.name)
+	}
+	o.lock.Unlock()
+
+	if t.root.connection() != nil {
+		t.interfacesRemoved(o.path, names)
+	}
+	o.Unexport()
+}
+
+// Export the root and every object of the tree
+func (t *ObjectTree) Export(conn *Conn) error {
+	return t.root.Export(conn)
+}
+
+func (t *ObjectTree) Unexport() {
+	t.root.Unexport()
+}
+
+func (t *ObjectTree) interfacesAdded(path dbus.ObjectPath, ifaces map[string]map[string]dbus.Variant) {
+	t.root.Emit(ObjectManager, "InterfacesAdded", path, ifaces)
+}
+
+func (t *ObjectTree) interfacesRemoved(path dbus.ObjectPath, ifaces []string) {
+	t.root.Emit(ObjectManager, "InterfacesRemoved", path, ifaces)
+}
+
+// managed collects the objects of the tree and the trees below it
+func (t *ObjectTree) managed(objects map[dbus.ObjectPath]map[string]map[string]dbus.Variant) {
+	for _, o := range t.Objects() {
+		objects[o.path] = o.Interfaces()
+		if o.children != nil {
+			o.children.managed(objects)
+		}
+	}
+}
+
+type objectManager struct {
+	t *ObjectTree
+}
+
+func (m *objectManager) GetManagedObjects() (map[dbus.ObjectPath]map[string]map[string]dbus.Variant, *dbus.Error) {
+	objects := make(map[dbus.ObjectPath]map[string]map[string]dbus.Variant)
+	m.t.managed(objects)
+	return objects, nil
+}
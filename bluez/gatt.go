@@ -0,0 +1,326 @@
+package bluez
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/godbus/dbus"
+)
+
+var (
+	ErrNotPermitted = &dbus.Error{
+		Name: "org.bluez.Error.NotPermitted",
+		Body: []interface{}{"Not Permitted"},
+	}
+	ErrInvalidOffset = &dbus.Error{
+		Name: "org.bluez.Error.InvalidOffset",
+		Body: []interface{}{"Invalid Offset"},
+	}
+	ErrFailed = &dbus.Error{
+		Name: "org.bluez.Error.Failed",
+		Body: []interface{}{"Failed"},
+	}
+)
+
+// readOffset applies the "offset" option of ReadValue
+func readOffset(value []byte, options map[string]dbus.Variant) ([]byte, *dbus.Error) {
+	v, ok := options["offset"]
+	if !ok {
+		return value, nil
+	}
+	offset, _ := v.Value().(uint16)
+	if int(offset) > len(value) {
+		return nil, ErrInvalidOffset
+	}
+	return value[offset:], nil
+}
+
+// GattApplication is the object tree handed to GattManager1, add services
+// before Register, bluez reads the tree once
+type GattApplication struct {
+	tree     *ObjectTree
+	conn     *Conn
+	services []*GattService
+	manager  *GattManager
+	unhook   func()
+}
+
+func NewGattApplication(path dbus.ObjectPath) *GattApplication {
+	return &GattApplication{tree: NewObjectTree(path)}
+}
+
+func (a *GattApplication) Path() dbus.ObjectPath {
+	return a.tree.Path()
+}
+
+func (a *GattApplication) AddService(uuid string, primary bool) *GattService {
+	s := &GattService{
+		app:     a,
+		object:  NewObject(dbus.ObjectPath(fmt.Sprintf("%s/service%d", a.tree.Path(), len(a.services)))),
+		UUID:    NormalizeUUID(uuid),
+		Primary: primary,
+	}
+	s.object.AddInterface(GattServiceInterface, nil, map[string]*Property{
+		"UUID":            {Value: s.UUID, Emit: EmitConst},
+		"Primary":         {Value: s.Primary, Emit: EmitConst},
+		"Characteristics": {Get: s.characteristicPaths, Emit: EmitFalse},
+	})
+	a.tree.Add(s.object)
+	a.services = append(a.services, s)
+	return s
+}
+
+// Register exports the tree and registers it on the adapter "hciN"
+func (a *GattApplication) Register(adapter string) error {
+	if a.conn == nil {
+		conn, err := DefaultConn()
+		if err != nil {
+			return err
+		}
+		if err := a.tree.Export(conn); err != nil {
+			return err
+		}
+		a.conn = conn
+	}
+	gm, err := NewGattManager(adapter)
+	if err != nil {
+		return err
+	}
+	if err := gm.RegisterApplication(a.Path(), nil); err != nil {
+		return err
+	}
+	a.manager = gm
+	if a.unhook != nil {
+		a.unhook()
+	}
+	a.unhook = a.conn.OnReconnect(func() error {
+		return gm.RegisterApplication(a.Path(), nil)
+	})
+	return nil
+}
+
+func (a *GattApplication) Unregister() error {
+	if a.manager == nil {
+		return nil
+	}
+	a.unhook()
+	err := a.manager.UnregisterApplication(a.Path())
+	a.manager = nil
+	return err
+}
+
+type GattService struct {
+	app             *GattApplication
+	object          *Object
+	UUID            string
+	Primary         bool
+	characteristics []*GattCharacteristic
+}
+
+func (s *GattService) Path() dbus.ObjectPath {
+	return s.object.Path()
+}
+
+func (s *GattService) characteristicPaths() interface{} {
+	chars := []dbus.ObjectPath{}
+	for _, c := range s.characteristics {
+		chars = append(chars, c.Path())
+	}
+	return chars
+}
+
+// AddCharacteristic flags as bluez names them, "read", "notify",
+// "encrypt-read", "write-without-response" ...
+func (s *GattService) AddCharacteristic(uuid string, flags []string, value []byte) *GattCharacteristic {
+	c := &GattCharacteristic{
+		object:  NewObject(dbus.ObjectPath(fmt.Sprintf("%s/char%d", s.Path(), len(s.characteristics)))),
+		service: s,
+		UUID:    NormalizeUUID(uuid),
+		Flags:   flags,
+		value:   value,
+	}
+	c.object.AddInterface(GattCharInterface, c, map[string]*Property{
+		"UUID":        {Value: c.UUID, Emit: EmitConst},
+		"Service":     {Value: s.Path(), Emit: EmitConst},
+		"Flags":       {Value: c.Flags, Emit: EmitConst},
+		"Descriptors": {Get: c.descriptorPaths, Emit: EmitFalse},
+		"Value":       {Value: value},
+		"Notifying":   {Value: false},
+	})
+	s.app.tree.Add(c.object)
+	s.characteristics = append(s.characteristics, c)
+	return c
+}
+
+type GattCharacteristic struct {
+	object      *Object
+	service     *GattService
+	UUID        string
+	Flags       []string
+	descriptors []*GattDescriptor
+	lock        sync.Mutex
+	value       []byte
+	notifying   bool
+
+	// OnWrite runs for every write of the host, an error rejects it
+	OnWrite func(value []byte) error
+	// OnNotify runs when the host subscribes or unsubscribes
+	OnNotify func(notifying bool)
+}
+
+func (c *GattCharacteristic) Path() dbus.ObjectPath {
+	return c.object.Path()
+}
+
+func (c *GattCharacteristic) descriptorPaths() interface{} {
+	descs := []dbus.ObjectPath{}
+	for _, d := range c.descriptors {
+		descs = append(descs, d.Path())
+	}
+	return descs
+}
+
+func (c *GattCharacteristic) AddDescriptor(uuid string, flags []string, value []byte) *GattDescriptor {
+	d := &GattDescriptor{
+		object:         NewObject(dbus.ObjectPath(fmt.Sprintf("%s/desc%d", c.Path(), len(c.descriptors)))),
+		characteristic: c,
+		UUID:           NormalizeUUID(uuid),
+		Flags:          flags,
+		value:          value,
+	}
+	d.object.AddInterface(GattDescInterface, d, map[string]*Property{
+		"UUID":           {Value: d.UUID, Emit: EmitConst},
+		"Characteristic": {Value: c.Path(), Emit: EmitConst},
+		"Flags":          {Value: d.Flags, Emit: EmitConst},
+		"Value":          {Value: value, Emit: EmitFalse},
+	})
+	c.service.app.tree.Add(d.object)
+	c.descriptors = append(c.descriptors, d)
+	return d
+}
+
+func (c *GattCharacteristic) Value() []byte {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.value
+}
+
+// SetValue stores value and notifies it to subscribed hosts
+func (c *GattCharacteristic) SetValue(value []byte) {
+	c.lock.Lock()
+	c.value = value
+	c.lock.Unlock()
+	c.object.Set(GattCharInterface, "Value", value)
+}
+
+func (c *GattCharacteristic) Notifying() bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.notifying
+}
+
+func (c *GattCharacteristic) ReadValue(options map[string]dbus.Variant) ([]byte, *dbus.Error) {
+	return readOffset(c.Value(), options)
+}
+
+func (c *GattCharacteristic) WriteValue(value []byte, options map[string]dbus.Variant) *dbus.Error {
+	if c.OnWrite != nil {
+		if err := c.OnWrite(value); err != nil {
+			return ErrNotPermitted
+		}
+	}
+	c.SetValue(value)
+	return nil
+}
+
+func (c *GattCharacteristic) setNotifying(notifying bool) {
+	c.lock.Lock()
+	changed := c.notifying != notifying
+	c.notifying = notifying
+	c.lock.Unlock()
+
+	if !changed {
+		return
+	}
+	c.object.Set(GattCharInterface, "Notifying", notifying)
+	if c.OnNotify != nil {
+		c.OnNotify(notifying)
+	}
+}
+
+func (c *GattCharacteristic) StartNotify() *dbus.Error {
+	c.setNotifying(true)
+	return nil
+}
+
+func (c *GattCharacteristic) StopNotify() *dbus.Error {
+	c.setNotifying(false)
+	return nil
+}
+
+type GattDescriptor struct {
+	object         *Object
+	characteristic *GattCharacteristic
+	UUID           string
+	Flags          []string
+	lock           sync.Mutex
+	value          []byte
+
+	// OnWrite runs for every write of the host, an error rejects it
+	OnWrite func(value []byte) error
+}
+
+func (d *GattDescriptor) Path() dbus.ObjectPath {
+	return d.object.Path()
+}
+
+func (d *GattDescriptor) ReadValue(options map[string]dbus.Variant) ([]byte, *dbus.Error) {
+	d.lock.Lock()
+	value := d.value
+	d.lock.Unlock()
+	return readOffset(value, options)
+}
+
+func (d *GattDescriptor) WriteValue(value []byte, options map[string]dbus.Variant) *dbus.Error {
+	if d.OnWrite != nil {
+		if err := d.OnWrite(value); err != nil {
+			return ErrNotPermitted
+		}
+	}
+	d.lock.Lock()
+	d.value = value
+	d.lock.Unlock()
+	d.object.Set(GattDescInterface, "Value", value)
+	return nil
+}
+
+type GattManager struct {
+	client *Client
+}
+
+func NewGattManager(adapter string) (*GattManager, error) {
+	client, err := NewClient(BluezInterface, GattManagerInterface, BluezPath+"/"+adapter)
+	if err != nil {
+		return nil, err
+	}
+	return &GattManager{client: client}, nil
+}
+
+func (m *GattManager) RegisterApplication(app dbus.ObjectPath, options map[string]dbus.Variant) error {
+	if options == nil {
+		options = make(map[string]dbus.Variant)
+	}
+	call, err := m.client.Call("RegisterApplication", 0, app, options)
+	if err != nil {
+		return err
+	}
+	return call.Store()
+}
+
+func (m *GattManager) UnregisterApplication(app dbus.ObjectPath) error {
+	call, err := m.client.Call("UnregisterApplication", 0, app)
+	if err != nil {
+		return err
+	}
+	return call.Store()
+}
@@ -0,0 +1,243 @@
+package bluez
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/godbus/dbus"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	HIDControlPSM   = 0x11
+	HIDInterruptPSM = 0x13
+)
+
+// HIDConnection both channels of a host, the receiver owns the fds
+type HIDConnection struct {
+	Device    dbus.ObjectPath
+	Address   string // "AA:BB:CC:DD:EE:FF"
+	Control   int
+	Interrupt int
+}
+
+// SendReport writes a DATA input report to the interrupt channel
+func (c *HIDConnection) SendReport(id byte, data []byte) error {
+	b := append([]byte{0xA1, id}, data...)
+	_, err := unix.Write(c.Interrupt, b)
+	return err
+}
+
+func (c *HIDConnection) Close() {
+	if c.Control >= 0 {
+		unix.Close(c.Control)
+	}
+	if c.Interrupt >= 0 {
+		unix.Close(c.Interrupt)
+	}
+}
+
+// HIDProfile owns the HID control and interrupt channels bluez accepts for
+// us, bluez only listens on a single psm per profile so it is registered
+// twice, control on path and interrupt on path/interrupt
+type HIDProfile struct {
+	path         dbus.ObjectPath
+	conn         *Conn
+	onConnect    func(c *HIDConnection)
+	onDisconnect func(device dbus.ObjectPath)
+	lock         sync.Mutex
+	pending      map[dbus.ObjectPath]*HIDConnection
+	unhook       func()
+}
+
+// hidChannel is the Profile1 object of one psm
+type hidChannel struct {
+	profile *HIDProfile
+	psm     uint16
+}
+
+// NewHIDProfile onConnect runs once both channels of a device arrived,
+// onDisconnect once bluez asks to drop the device, it may be nil
+func NewHIDProfile(path dbus.ObjectPath, onConnect func(c *HIDConnection), onDisconnect func(device dbus.ObjectPath)) (*HIDProfile, error) {
+	profile := &HIDProfile{
+		path:         path,
+		onConnect:    onConnect,
+		onDisconnect: onDisconnect,
+		pending:      make(map[dbus.ObjectPath]*HIDConnection),
+	}
+
+	conn, err := ExportInterface(&hidChannel{profile: profile, psm: HIDControlPSM}, profile.ControlPath(), ProfileInterface)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := ExportInterface(&hidChannel{profile: profile, psm: HIDInterruptPSM}, profile.InterruptPath(), ProfileInterface); err != nil {
+		return nil, err
+	}
+	profile.conn = conn
+
+	return profile, nil
+}
+
+func (p *HIDProfile) ControlPath() dbus.ObjectPath {
+	return p.path
+}
+
+func (p *HIDProfile) InterruptPath() dbus.ObjectPath {
+	return p.path + "/interrupt"
+}
+
+// Register both channels with uuid, opts go to the control channel with the
+// ServiceRecord, the interrupt channel only gets the security options
+func (p *HIDProfile) Register(pm *ProfileManager, uuid string, opts map[string]interface{}) error {
+	control := make(map[string]interface{})
+	interrupt := make(map[string]interface{})
+	for k, v := range opts {
+		control[k] = v
+		switch k {
+		case "Role", "RequireAuthentication", "RequireAuthorization":
+			interrupt[k] = v
+		}
+	}
+	control["PSM"] = uint16(HIDControlPSM)
+	interrupt["PSM"] = uint16(HIDInterruptPSM)
+
+	if err := pm.RegisterProfile(p.ControlPath(), uuid, control); err != nil {
+		return err
+	}
+	if err := pm.RegisterProfile(p.InterruptPath(), uuid, interrupt); err != nil {
+		pm.UnregisterProfile(p.ControlPath())
+		return err
+	}
+
+	p.lock.Lock()
+	if p.unhook == nil {
+		p.unhook = p.conn.OnReconnect(func() error {
+			if err := pm.RegisterProfile(p.ControlPath(), uuid, control); err != nil {
+				return err
+			}
+			return pm.RegisterProfile(p.InterruptPath(), uuid, interrupt)
+		})
+	}
+	p.lock.Unlock()
+	return nil
+}
+
+func (p *HIDProfile) Unregister(pm *ProfileManager) error {
+	p.lock.Lock()
+	if p.unhook != nil {
+		p.unhook()
+		p.unhook = nil
+	}
+	p.lock.Unlock()
+
+	err := pm.UnregisterProfile(p.InterruptPath())
+	if err2 := pm.UnregisterProfile(p.ControlPath()); err == nil {
+		err = err2
+	}
+	return err
+}
+
+// peerAddress the remote address of a l2cap socket as "AA:BB:CC:DD:EE:FF",
+// the kernel hands it out little endian
+func peerAddress(fd int) (string, error) {
+	sa, err := unix.Getpeername(fd)
+	if err != nil {
+		return "", err
+	}
+	l2, ok := sa.(*unix.SockaddrL2)
+	if !ok {
+		return "", fmt.Errorf("unexpected peer address %T", sa)
+	}
+	var parts []string
+	for i := len(l2.Addr) - 1; i >= 0; i-- {
+		parts = append(parts, fmt.Sprintf("%02X", l2.Addr[i]))
+	}
+	return strings.Join(parts, ":"), nil
+}
+
+// pathAddress the address of a device path ".../dev_AA_BB_CC_DD_EE_FF"
+func pathAddress(device dbus.ObjectPath) string {
+	s := string(device)
+	i := strings.LastIndex(s, "/dev_")
+	if i < 0 {
+		return ""
+	}
+	return strings.Replace(s[i+len("/dev_"):], "_", ":", -1)
+}
+
+func (p *HIDProfile) add(device dbus.ObjectPath, fd int, psm uint16) {
+	p.lock.Lock()
+	c, ok := p.pending[device]
+	if !ok {
+		c = &HIDConnection{Device: device, Control: -1, Interrupt: -1}
+		p.pending[device] = c
+	}
+	// a channel connected twice replaces the stale one
+	if psm == HIDControlPSM {
+		if c.Control >= 0 {
+			unix.Close(c.Control)
+		}
+		c.Control = fd
+	} else {
+		if c.Interrupt >= 0 {
+			unix.Close(c.Interrupt)
+		}
+		c.Interrupt = fd
+	}
+	if c.Address == "" {
+		c.Address = pathAddress(device)
+	}
+	if c.Address == "" {
+		c.Address, _ = peerAddress(fd)
+	}
+	ready := c.Control >= 0 && c.Interrupt >= 0
+	if ready {
+		delete(p.pending, device)
+	}
+	p.lock.Unlock()
+
+	if ready {
+		p.onConnect(c)
+	}
+}
+
+func (p *HIDProfile) drop(device dbus.ObjectPath) {
+	p.lock.Lock()
+	c, ok := p.pending[device]
+	delete(p.pending, device)
+	p.lock.Unlock()
+
+	if ok {
+		c.Close()
+	}
+	if p.onDisconnect != nil {
+		p.onDisconnect(device)
+	}
+}
+
+func (h *hidChannel) NewConnection(device dbus.ObjectPath, fd int32, properties map[string]interface{}) *dbus.Error {
+	log.Printf("hid: %s psm %#02x connected", device, h.psm)
+	h.profile.add(device, int(fd), h.psm)
+	return nil
+}
+
+func (h *hidChannel) RequestDisconnection(device dbus.ObjectPath) *dbus.Error {
+	log.Printf("hid: %s psm %#02x disconnection", device, h.psm)
+	h.profile.drop(device)
+	return nil
+}
+
+// Release bluez dropped the profile, half connected devices are closed
+func (h *hidChannel) Release() *dbus.Error {
+	h.profile.lock.Lock()
+	pending := h.profile.pending
+	h.profile.pending = make(map[dbus.ObjectPath]*HIDConnection)
+	h.profile.lock.Unlock()
+
+	for _, c := range pending {
+		c.Close()
+	}
+	return nil
+}
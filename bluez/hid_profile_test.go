@@ -0,0 +1,202 @@
+package bluez_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+	"vitrhid/bluez"
+	"vitrhid/bluezmock"
+
+	"github.com/godbus/dbus"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	profilePath = dbus.ObjectPath("/test/profile")
+	hidUUID     = "00001124-0000-1000-8000-00805f9b34fb"
+)
+
+func startHIDProfile(t *testing.T) (*bluezmock.Bluez, *bluezmock.Device, chan *bluez.HIDConnection, chan dbus.ObjectPath) {
+	t.Helper()
+	mock, _ := startBluez(t)
+	adapter, err := mock.AddAdapter("hci0", "00:00:00:00:00:01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	device, err := mock.AddDevice(adapter, allowedAddress, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	connected := make(chan *bluez.HIDConnection, 1)
+	// bluez asks both channels to disconnect
+	disconnected := make(chan dbus.ObjectPath, 2)
+	profile, err := bluez.NewHIDProfile(profilePath,
+		func(c *bluez.HIDConnection) { connected <- c },
+		func(device dbus.ObjectPath) { disconnected <- device })
+	if err != nil {
+		t.Fatal(err)
+	}
+	pm, err := bluez.NewProfileManager()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := profile.Register(pm, hidUUID, map[string]interface{}{
+		"Role":                  "server",
+		"RequireAuthentication": true,
+		"ServiceRecord":         "<record/>",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return mock, device, connected, disconnected
+}
+
+func TestHIDProfileRegister(t *testing.T) {
+	mock, _, _, _ := startHIDProfile(t)
+
+	profiles := mock.Profiles(hidUUID)
+	if len(profiles) != 2 {
+		t.Fatalf("%d profiles registered", len(profiles))
+	}
+	psms := map[dbus.ObjectPath]uint16{profilePath: bluez.HIDControlPSM, profilePath + "/interrupt": bluez.HIDInterruptPSM}
+	for _, p := range profiles {
+		if psm, _ := p.Options["PSM"].Value().(uint16); psm != psms[p.Path] {
+			t.Errorf("%s psm %#x", p.Path, psm)
+		}
+		if auth, _ := p.Options["RequireAuthentication"].Value().(bool); !auth {
+			t.Errorf("%s without RequireAuthentication", p.Path)
+		}
+		_, record := p.Options["ServiceRecord"]
+		if record != (p.Path == profilePath) {
+			t.Errorf("%s ServiceRecord %v", p.Path, record)
+		}
+	}
+}
+
+func TestHIDProfileConnection(t *testing.T) {
+	mock, device, connected, disconnected := startHIDProfile(t)
+
+	remotes, err := mock.ConnectProfile(device.Path(), hidUUID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(remotes) != 2 {
+		t.Fatalf("%d channels connected", len(remotes))
+	}
+
+	var c *bluez.HIDConnection
+	select {
+	case c = <-connected:
+	case <-time.After(time.Second * 2):
+		t.Fatal("no connection after both channels")
+	}
+	defer c.Close()
+	if c.Device != device.Path() || c.Address != allowedAddress || c.Control < 0 || c.Interrupt < 0 {
+		t.Fatalf("connection %+v", c)
+	}
+
+	// the remotes follow the registration order, control first
+	if err := c.SendReport(3, []byte{1, 2}); err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, 16)
+	n, err := unix.Read(remotes[1], b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte{0xA1, 3, 1, 2}; !bytes.Equal(b[:n], want) {
+		t.Errorf("interrupt got % x, want % x", b[:n], want)
+	}
+
+	if err := mock.DisconnectProfile(device.Path(), hidUUID); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case path := <-disconnected:
+		if path != device.Path() {
+			t.Errorf("disconnected %s", path)
+		}
+	case <-time.After(time.Second * 2):
+		t.Fatal("no disconnect")
+	}
+}
+
+// newConnection hands one channel to the profile object on path the way
+// bluez does, the remote end is returned
+func newConnection(t *testing.T, mock *bluezmock.Bluez, path, device dbus.ObjectPath) int {
+	t.Helper()
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_SEQPACKET, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unix.Close(fds[0])
+	if err := profileCall(t, mock, path, "NewConnection", device, dbus.UnixFD(fds[0]), map[string]dbus.Variant{}); err != nil {
+		t.Fatal(err)
+	}
+	return fds[1]
+}
+
+func profileCall(t *testing.T, mock *bluezmock.Bluez, path dbus.ObjectPath, method string, args ...interface{}) error {
+	t.Helper()
+	client, err := mock.Client()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	sender := mock.Profiles(hidUUID)[0].Sender
+	return client.Object(sender, path).Call(bluez.ProfileInterface+"."+method, 0, args...).Err
+}
+
+func TestHIDProfileHalfConnected(t *testing.T) {
+	mock, device, connected, _ := startHIDProfile(t)
+
+	// a control channel alone is no connection
+	control := newConnection(t, mock, profilePath, device.Path())
+	defer unix.Close(control)
+	select {
+	case c := <-connected:
+		t.Fatalf("connected with one channel %+v", c)
+	case <-time.After(time.Millisecond * 100):
+	}
+
+	// releasing the profile closes what is pending
+	if err := profileCall(t, mock, profilePath, "Release"); err != nil {
+		t.Fatalf("release: %s", err)
+	}
+	unix.SetNonblock(control, false)
+	tv := unix.NsecToTimeval(int64(time.Second * 2))
+	unix.SetsockoptTimeval(control, unix.SOL_SOCKET, unix.SO_RCVTIMEO, &tv)
+	n, err := unix.Read(control, make([]byte, 8))
+	if n != 0 || err != nil {
+		t.Errorf("pending control channel still open, read %d %v", n, err)
+	}
+}
+
+func TestHIDProfileReconnectChannel(t *testing.T) {
+	mock, device, connected, _ := startHIDProfile(t)
+
+	// a channel connected twice replaces the stale one
+	stale := newConnection(t, mock, profilePath, device.Path())
+	defer unix.Close(stale)
+	control := newConnection(t, mock, profilePath, device.Path())
+	defer unix.Close(control)
+	interrupt := newConnection(t, mock, profilePath+"/interrupt", device.Path())
+	defer unix.Close(interrupt)
+
+	select {
+	case c := <-connected:
+		defer c.Close()
+		if _, err := unix.Write(c.Control, []byte{0x71}); err != nil {
+			t.Fatal(err)
+		}
+		b := make([]byte, 8)
+		if n, err := unix.Read(control, b); err != nil || n != 1 || b[0] != 0x71 {
+			t.Errorf("control got % x %v", b[:n], err)
+		}
+	case <-time.After(time.Second * 2):
+		t.Fatal("no connection")
+	}
+	if n, err := unix.Read(stale, make([]byte, 8)); n != 0 || err != nil {
+		t.Errorf("stale control channel still open, read %d %v", n, err)
+	}
+}
@@ -0,0 +1,271 @@
+package bluez
+
+import (
+	"encoding/binary"
+	"errors"
+	"sync"
+
+	"github.com/godbus/dbus"
+)
+
+const (
+	HIDServiceUUID               = "0x1812"
+	DeviceInformationServiceUUID = "0x180a"
+	BatteryServiceUUID           = "0x180f"
+
+	hidInformationUUID  = "0x2a4a"
+	reportMapUUID       = "0x2a4b"
+	hidControlPointUUID = "0x2a4c"
+	reportUUID          = "0x2a4d"
+	protocolModeUUID    = "0x2a4e"
+	bootKeyboardInUUID  = "0x2a22"
+	bootKeyboardOutUUID = "0x2a32"
+	bootMouseInUUID     = "0x2a33"
+	reportReferenceUUID = "0x2908"
+	manufacturerUUID    = "0x2a29"
+	pnpIDUUID           = "0x2a50"
+	batteryLevelUUID    = "0x2a19"
+)
+
+// report types of the Report Reference descriptor
+const (
+	ReportTypeInput   byte = 1
+	ReportTypeOutput  byte = 2
+	ReportTypeFeature byte = 3
+)
+
+const (
+	ProtocolModeBoot   byte = 0
+	ProtocolModeReport byte = 1
+)
+
+// boot report ids of HOGPBoot, the same hidp puts in front of boot reports
+const (
+	BootKeyboardReportID byte = 1
+	BootMouseReportID    byte = 2
+)
+
+var (
+	ErrUnknownReport = errors.New("unknown report")
+	ErrInvalidValue  = errors.New("invalid value")
+)
+
+// ReportSender delivers an input report to the host over whatever transport
+// the host is connected with
+type ReportSender interface {
+	SendReport(id byte, data []byte) error
+}
+
+// HOGPBoot translates between the reports of the report map and the boot
+// reports, hid.Descriptor is one
+type HOGPBoot interface {
+	// BootReport the boot form of input report id, BootKeyboardReportID
+	// or BootMouseReportID, ok is false for reports without one
+	BootReport(id byte, data []byte) (byte, []byte, bool)
+	// FromBootOutput the output report of the boot keyboard leds
+	FromBootOutput(data []byte) (byte, []byte, bool)
+}
+
+type HOGPReport struct {
+	ID   byte
+	Type byte
+}
+
+type HOGPConfig struct {
+	ReportMap []byte
+	Reports   []HOGPReport
+
+	Manufacturer string
+	// VendorID is a usb vendor id
+	VendorID  uint16
+	ProductID uint16
+	Version   uint16
+
+	BatteryLevel byte
+
+	// Boot adds the Boot Keyboard Input and Output characteristics with
+	// BootKeyboard and Boot Mouse Input with BootMouse, input reports go
+	// out on them while the host selected boot protocol
+	Boot         HOGPBoot
+	BootKeyboard bool
+	BootMouse    bool
+
+	// OnOutput receives output and feature reports written by the host
+	OnOutput func(id byte, data []byte)
+	// OnSubscribe runs when the host enables or disables input notifications
+	OnSubscribe func(subscribed bool)
+}
+
+// HOGP is a HID over GATT peripheral with the Device Information and
+// Battery services next to the HID service
+type HOGP struct {
+	app          *GattApplication
+	config       HOGPConfig
+	lock         sync.Mutex
+	inputs       map[byte]*GattCharacteristic
+	bootInputs   map[byte]*GattCharacteristic
+	subscribed   int
+	protocolMode *GattCharacteristic
+	battery      *GattCharacteristic
+	suspended    bool
+}
+
+func NewHOGP(path dbus.ObjectPath, config HOGPConfig) *HOGP {
+	h := &HOGP{
+		app:        NewGattApplication(path),
+		config:     config,
+		inputs:     make(map[byte]*GattCharacteristic),
+		bootInputs: make(map[byte]*GattCharacteristic),
+	}
+
+	hid := h.app.AddService(HIDServiceUUID, true)
+
+	// bcdHID 1.11, country code 0, normally connectable
+	hid.AddCharacteristic(hidInformationUUID, []string{"read"}, []byte{0x11, 0x01, 0x00, 0x02})
+	hid.AddCharacteristic(reportMapUUID, []string{"read", "encrypt-read"}, config.ReportMap)
+
+	h.protocolMode = hid.AddCharacteristic(protocolModeUUID, []string{"read", "write-without-response"}, []byte{ProtocolModeReport})
+
+	control := hid.AddCharacteristic(hidControlPointUUID, []string{"write-without-response"}, []byte{0})
+	control.OnWrite = func(value []byte) error {
+		if len(value) != 1 {
+			return ErrInvalidValue
+		}
+		h.lock.Lock()
+		// 0 suspend, 1 exit suspend
+		h.suspended = value[0] == 0
+		h.lock.Unlock()
+		return nil
+	}
+
+	for _, r := range config.Reports {
+		r := r
+		var flags []string
+		switch r.Type {
+		case ReportTypeInput:
+			flags = []string{"read", "notify", "encrypt-read"}
+		default:
+			flags = []string{"read", "write", "write-without-response", "encrypt-read", "encrypt-write"}
+		}
+		c := hid.AddCharacteristic(reportUUID, flags, nil)
+		c.AddDescriptor(reportReferenceUUID, []string{"read"}, []byte{r.ID, r.Type})
+
+		if r.Type == ReportTypeInput {
+			c.OnNotify = h.notify
+			h.inputs[r.ID] = c
+			continue
+		}
+		c.OnWrite = func(value []byte) error {
+			if h.config.OnOutput != nil {
+				h.config.OnOutput(r.ID, value)
+			}
+			return nil
+		}
+	}
+
+	if config.Boot != nil && config.BootKeyboard {
+		c := hid.AddCharacteristic(bootKeyboardInUUID, []string{"read", "notify", "encrypt-read"}, make([]byte, 8))
+		c.OnNotify = h.notify
+		h.bootInputs[BootKeyboardReportID] = c
+
+		out := hid.AddCharacteristic(bootKeyboardOutUUID, []string{"read", "write", "write-without-response", "encrypt-read", "encrypt-write"}, []byte{0})
+		out.OnWrite = func(value []byte) error {
+			id, data, ok := h.config.Boot.FromBootOutput(value)
+			if ok && h.config.OnOutput != nil {
+				h.config.OnOutput(id, data)
+			}
+			return nil
+		}
+	}
+	if config.Boot != nil && config.BootMouse {
+		c := hid.AddCharacteristic(bootMouseInUUID, []string{"read", "notify", "encrypt-read"}, make([]byte, 3))
+		c.OnNotify = h.notify
+		h.bootInputs[BootMouseReportID] = c
+	}
+
+	pnp := make([]byte, 7)
+	pnp[0] = 0x02 // usb vendor id source
+	binary.LittleEndian.PutUint16(pnp[1:], config.VendorID)
+	binary.LittleEndian.PutUint16(pnp[3:], config.ProductID)
+	binary.LittleEndian.PutUint16(pnp[5:], config.Version)
+
+	info := h.app.AddService(DeviceInformationServiceUUID, true)
+	info.AddCharacteristic(manufacturerUUID, []string{"read"}, []byte(config.Manufacturer))
+	info.AddCharacteristic(pnpIDUUID, []string{"read"}, pnp)
+
+	battery := h.app.AddService(BatteryServiceUUID, true)
+	h.battery = battery.AddCharacteristic(batteryLevelUUID, []string{"read", "notify"}, []byte{config.BatteryLevel})
+
+	return h
+}
+
+func (h *HOGP) notify(notifying bool) {
+	h.lock.Lock()
+	before := h.subscribed > 0
+	if notifying {
+		h.subscribed++
+	} else if h.subscribed > 0 {
+		h.subscribed--
+	}
+	after := h.subscribed > 0
+	h.lock.Unlock()
+
+	if before != after && h.config.OnSubscribe != nil {
+		h.config.OnSubscribe(after)
+	}
+}
+
+func (h *HOGP) Application() *GattApplication {
+	return h.app
+}
+
+// Register the gatt application on the adapter "hciN"
+func (h *HOGP) Register(adapter string) error {
+	return h.app.Register(adapter)
+}
+
+func (h *HOGP) Unregister() error {
+	return h.app.Unregister()
+}
+
+// SendReport notifies the input report id without the report id byte, in
+// boot protocol its boot form, reports without one are dropped
+func (h *HOGP) SendReport(id byte, data []byte) error {
+	c, ok := h.inputs[id]
+	if !ok {
+		return ErrUnknownReport
+	}
+	if h.config.Boot != nil && h.ProtocolMode() == ProtocolModeBoot {
+		var bootID byte
+		if bootID, data, ok = h.config.Boot.BootReport(id, data); !ok {
+			return nil
+		}
+		if c, ok = h.bootInputs[bootID]; !ok {
+			return nil
+		}
+	}
+	if !c.Notifying() {
+		return ErrNotConnected
+	}
+	c.SetValue(append([]byte(nil), data...))
+	return nil
+}
+
+func (h *HOGP) ProtocolMode() byte {
+	v := h.protocolMode.Value()
+	if len(v) == 0 {
+		return ProtocolModeReport
+	}
+	return v[0]
+}
+
+// Suspended the host told us through the control point it is suspended
+func (h *HOGP) Suspended() bool {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return h.suspended
+}
+
+func (h *HOGP) SetBatteryLevel(level byte) {
+	h.battery.SetValue([]byte{level})
+}
@@ -0,0 +1,71 @@
+package bluez_test
+
+import (
+	"os/exec"
+	"testing"
+	"time"
+	"vitrhid/bluez"
+	"vitrhid/bluezmock"
+
+	"github.com/godbus/dbus"
+)
+
+// startBluez runs bluezmock on a private bus and makes it the default
+// connection of the bluez package until the test ends
+func startBluez(t *testing.T) (*bluezmock.Bluez, *bluez.Conn) {
+	t.Helper()
+	if _, err := exec.LookPath("dbus-daemon"); err != nil {
+		t.Skip("dbus-daemon not found")
+	}
+
+	mock, err := bluezmock.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := bluez.Dial(mock.Address())
+	if err != nil {
+		mock.Close()
+		t.Fatal(err)
+	}
+	bluez.SetConn(conn)
+
+	t.Cleanup(func() {
+		bluez.SetConn(nil)
+		closeConn(conn)
+		mock.Close()
+	})
+	return mock, conn
+}
+
+// waitFor polls cond for up to two seconds
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second * 2)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+}
+
+// errName the dbus error name of err, empty for nil
+func errName(err error) string {
+	switch e := err.(type) {
+	case nil:
+		return ""
+	case dbus.Error:
+		return e.Name
+	case *dbus.Error:
+		return e.Name
+	}
+	return err.Error()
+}
+
+// closeConn drops every reference clients of the test still hold, a conn
+// left open would keep reconnecting to the stopped mock
+func closeConn(conn *bluez.Conn) {
+	for conn.Call("org.freedesktop.DBus", "/org/freedesktop/DBus", "org.freedesktop.DBus.Peer.Ping", 0).Err != bluez.ErrConnClosed {
+		conn.Close()
+	}
+}
@@ -0,0 +1,306 @@
+package bluez
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/godbus/dbus"
+)
+
+type ObjectEventKind int
+
+const (
+	ObjectAdded ObjectEventKind = iota
+	ObjectRemoved
+	ObjectChanged
+)
+
+// ObjectEvent Changed lists the changed property names for ObjectChanged,
+// Adapter or Device holds a snapshot of the object after the change
+type ObjectEvent struct {
+	Kind      ObjectEventKind
+	Path      dbus.ObjectPath
+	Interface string
+	Changed   []string
+	Adapter   *AdapterProperties
+	Device    *DeviceProperties
+}
+
+type watcherSubscriber struct {
+	fn func(ev *ObjectEvent)
+}
+
+// Watcher mirrors the Adapter1 and Device1 objects of bluez, it loads
+// GetManagedObjects once and follows InterfacesAdded, InterfacesRemoved and
+// PropertiesChanged afterwards
+type Watcher struct {
+	client   *Client
+	lock     sync.RWMutex
+	adapters map[dbus.ObjectPath]*AdapterProperties
+	devices  map[dbus.ObjectPath]*DeviceProperties
+	subs     []*watcherSubscriber
+	signals  chan *dbus.Signal
+	rules    []string
+	unhook   func()
+}
+
+func NewWatcher() (*Watcher, error) {
+	client, err := NewClient(BluezInterface, ObjectManager, "/")
+	if err != nil {
+		return nil, err
+	}
+
+	w := &Watcher{
+		client:   client,
+		adapters: make(map[dbus.ObjectPath]*AdapterProperties),
+		devices:  make(map[dbus.ObjectPath]*DeviceProperties),
+		signals:  make(chan *dbus.Signal, 64),
+		rules: []string{
+			"type='signal',sender='" + BluezInterface + "',interface='" + ObjectManager + "'",
+			"type='signal',sender='" + BluezInterface + "',interface='" + PropertiesInterface + "',member='PropertiesChanged',path_namespace='" + BluezPath + "'",
+		},
+	}
+
+	// subscribe before loading so nothing between both gets lost
+	for _, rule := range w.rules {
+		if err := client.conn.AddMatch(rule); err != nil {
+			return nil, err
+		}
+	}
+	client.conn.Signal(w.signals)
+
+	if err := w.load(); err != nil {
+		w.Close()
+		return nil, err
+	}
+
+	// signals got lost while the bus was gone
+	w.unhook = client.conn.OnReconnect(w.reload)
+
+	go w.loop()
+
+	return w, nil
+}
+
+func (w *Watcher) load() error {
+	objects := make(map[dbus.ObjectPath]map[string]map[string]dbus.Variant)
+	call, err := w.client.Call("GetManagedObjects", 0)
+	if err != nil {
+		return err
+	}
+	if err := call.Store(&objects); err != nil {
+		return err
+	}
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	for path, ifaces := range objects {
+		w.add(path, ifaces)
+	}
+	return nil
+}
+
+func (w *Watcher) reload() error {
+	w.lock.Lock()
+	w.adapters = make(map[dbus.ObjectPath]*AdapterProperties)
+	w.devices = make(map[dbus.ObjectPath]*DeviceProperties)
+	w.lock.Unlock()
+	return w.load()
+}
+
+// add callers hold the lock, returns the events to publish, a path which
+// is known already was loaded after its signal got queued and is merged
+// without an event
+func (w *Watcher) add(path dbus.ObjectPath, ifaces map[string]map[string]dbus.Variant) []*ObjectEvent {
+	var events []*ObjectEvent
+	if props, ok := ifaces[AdapterInterface]; ok {
+		if a, ok := w.adapters[path]; ok {
+			a.Update(props)
+		} else {
+			a := &AdapterProperties{}
+			a.Update(props)
+			w.adapters[path] = a
+			snapshot := *a
+			events = append(events, &ObjectEvent{Kind: ObjectAdded, Path: path, Interface: AdapterInterface, Adapter: &snapshot})
+		}
+	}
+	if props, ok := ifaces[DeviceInterface]; ok {
+		if d, ok := w.devices[path]; ok {
+			d.Update(props)
+		} else {
+			d := &DeviceProperties{}
+			d.Update(props)
+			w.devices[path] = d
+			snapshot := *d
+			events = append(events, &ObjectEvent{Kind: ObjectAdded, Path: path, Interface: DeviceInterface, Device: &snapshot})
+		}
+	}
+	return events
+}
+
+func (w *Watcher) handle(sig *dbus.Signal) []*ObjectEvent {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	switch sig.Name {
+	case ObjectManager + ".InterfacesAdded":
+		if len(sig.Body) < 2 {
+			return nil
+		}
+		path, _ := sig.Body[0].(dbus.ObjectPath)
+		ifaces, _ := sig.Body[1].(map[string]map[string]dbus.Variant)
+		return w.add(path, ifaces)
+	case ObjectManager + ".InterfacesRemoved":
+		if len(sig.Body) < 2 {
+			return nil
+		}
+		path, _ := sig.Body[0].(dbus.ObjectPath)
+		ifaces, _ := sig.Body[1].([]string)
+		var events []*ObjectEvent
+		for _, iface := range ifaces {
+			switch iface {
+			case AdapterInterface:
+				if a, ok := w.adapters[path]; ok {
+					delete(w.adapters, path)
+					events = append(events, &ObjectEvent{Kind: ObjectRemoved, Path: path, Interface: iface, Adapter: a})
+				}
+			case DeviceInterface:
+				if d, ok := w.devices[path]; ok {
+					delete(w.devices, path)
+					events = append(events, &ObjectEvent{Kind: ObjectRemoved, Path: path, Interface: iface, Device: d})
+				}
+			}
+		}
+		return events
+	case PropertiesInterface + ".PropertiesChanged":
+		if len(sig.Body) < 3 {
+			return nil
+		}
+		iface, _ := sig.Body[0].(string)
+		changed, _ := sig.Body[1].(map[string]dbus.Variant)
+		invalidated, _ := sig.Body[2].([]string)
+		var names []string
+		for name := range changed {
+			names = append(names, name)
+		}
+		names = append(names, invalidated...)
+
+		switch iface {
+		case AdapterInterface:
+			a, ok := w.adapters[sig.Path]
+			if !ok {
+				return nil
+			}
+			a.Update(changed)
+			snapshot := *a
+			return []*ObjectEvent{{Kind: ObjectChanged, Path: sig.Path, Interface: iface, Changed: names, Adapter: &snapshot}}
+		case DeviceInterface:
+			d, ok := w.devices[sig.Path]
+			if !ok {
+				return nil
+			}
+			d.Update(changed)
+			d.invalidate(invalidated)
+			snapshot := *d
+			return []*ObjectEvent{{Kind: ObjectChanged, Path: sig.Path, Interface: iface, Changed: names, Device: &snapshot}}
+		}
+	}
+	return nil
+}
+
+func (w *Watcher) loop() {
+	for sig := range w.signals {
+		if !strings.HasPrefix(sig.Name, ObjectManager) && !strings.HasPrefix(sig.Name, PropertiesInterface) {
+			continue
+		}
+		events := w.handle(sig)
+		if len(events) == 0 {
+			continue
+		}
+
+		w.lock.RLock()
+		subs := append([]*watcherSubscriber(nil), w.subs...)
+		w.lock.RUnlock()
+
+		for _, ev := range events {
+			for _, sub := range subs {
+				sub.fn(ev)
+			}
+		}
+	}
+}
+
+// Subscribe fn runs on the watcher goroutine for every change, the returned
+// func removes it again
+func (w *Watcher) Subscribe(fn func(ev *ObjectEvent)) func() {
+	sub := &watcherSubscriber{fn: fn}
+
+	w.lock.Lock()
+	w.subs = append(w.subs, sub)
+	w.lock.Unlock()
+
+	return func() {
+		w.lock.Lock()
+		defer w.lock.Unlock()
+		for i := 0; i < len(w.subs); i++ {
+			if w.subs[i] == sub {
+				w.subs = append(w.subs[:i:i], w.subs[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+func (w *Watcher) Adapters() map[dbus.ObjectPath]AdapterProperties {
+	w.lock.RLock()
+	defer w.lock.RUnlock()
+	m := make(map[dbus.ObjectPath]AdapterProperties, len(w.adapters))
+	for path, a := range w.adapters {
+		m[path] = *a
+	}
+	return m
+}
+
+func (w *Watcher) Devices() map[dbus.ObjectPath]DeviceProperties {
+	w.lock.RLock()
+	defer w.lock.RUnlock()
+	m := make(map[dbus.ObjectPath]DeviceProperties, len(w.devices))
+	for path, d := range w.devices {
+		m[path] = *d
+	}
+	return m
+}
+
+func (w *Watcher) Device(path dbus.ObjectPath) (DeviceProperties, bool) {
+	w.lock.RLock()
+	defer w.lock.RUnlock()
+	d, ok := w.devices[path]
+	if !ok {
+		return DeviceProperties{}, false
+	}
+	return *d, true
+}
+
+// DeviceByAddress address as "AA:BB:CC:DD:EE:FF", the first match of any adapter
+func (w *Watcher) DeviceByAddress(address string) (dbus.ObjectPath, DeviceProperties, bool) {
+	w.lock.RLock()
+	defer w.lock.RUnlock()
+	for path, d := range w.devices {
+		if strings.EqualFold(d.Address, address) {
+			return path, *d, true
+		}
+	}
+	return "", DeviceProperties{}, false
+}
+
+func (w *Watcher) Close() error {
+	if w.unhook != nil {
+		w.unhook()
+	}
+	w.client.conn.RemoveSignal(w.signals)
+	for _, rule := range w.rules {
+		w.client.conn.RemoveMatch(rule)
+	}
+	close(w.signals)
+	return nil
+}
@@ -0,0 +1,275 @@
+package bluez_test
+
+import (
+	"sort"
+	"sync"
+	"testing"
+	"vitrhid/bluez"
+)
+
+func TestAdapterProperties(t *testing.T) {
+	mock, _ := startBluez(t)
+	hci, err := mock.AddAdapter("hci0", "00:00:00:00:00:01")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	adapter, err := bluez.FindAdapter("00:00:00:00:00:01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer adapter.Close()
+	if adapter.Path() != hci.Path() {
+		t.Fatalf("found %s", adapter.Path())
+	}
+
+	changes := make(chan bluez.AdapterProperties, 4)
+	cancel, err := adapter.WatchProperties(func(p *bluez.AdapterProperties, changed []string) {
+		changes <- *p
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cancel()
+
+	hci.Set("Powered", true)
+	if p := <-changes; !p.Powered || p.Address != "00:00:00:00:00:01" {
+		t.Errorf("after power on %+v", p)
+	}
+
+	if err := adapter.SetAlias("vitrhid"); err != nil {
+		t.Fatal(err)
+	}
+	if alias := hci.Get("Alias"); alias != "vitrhid" {
+		t.Errorf("alias %v", alias)
+	}
+	if p := <-changes; p.Alias != "vitrhid" {
+		t.Errorf("after alias %+v", p)
+	}
+
+	if err := adapter.SetDiscoveryFilter(&bluez.DiscoveryFilter{Transport: "le"}); err != nil {
+		t.Fatal(err)
+	}
+	if transport, _ := hci.DiscoveryFilter()["Transport"].Value().(string); transport != "le" {
+		t.Errorf("filter %v", hci.DiscoveryFilter())
+	}
+}
+
+func TestDeviceProperties(t *testing.T) {
+	mock, _ := startBluez(t)
+	hci, err := mock.AddAdapter("hci0", "00:00:00:00:00:01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := mock.AddDevice(hci, allowedAddress, map[string]interface{}{"Name": "phone", "Class": uint32(0x5a020c)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	device, err := bluez.NewDeviceWithFullPath(d.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer device.Close()
+	p, err := device.GetProperties()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Address != allowedAddress || p.Name != "phone" || p.Class != 0x5a020c || p.Adapter != hci.Path() {
+		t.Errorf("properties %+v", p)
+	}
+
+	connected := make(chan bool, 4)
+	cancel, err := device.OnConnected(func(c bool) { connected <- c })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cancel()
+
+	// changes of other properties do not call it
+	d.Set("RSSI", int16(-40))
+	d.Set("Connected", true)
+	if c := <-connected; !c {
+		t.Error("connected false after connect")
+	}
+	d.Set("Connected", false)
+	if c := <-connected; c {
+		t.Error("connected true after disconnect")
+	}
+
+	if err := device.SetTrusted(true); err != nil {
+		t.Fatal(err)
+	}
+	if trusted, _ := d.Get("Trusted").(bool); !trusted {
+		t.Error("not trusted after SetTrusted")
+	}
+}
+
+func TestWatcher(t *testing.T) {
+	mock, _ := startBluez(t)
+	hci, err := mock.AddAdapter("hci0", "00:00:00:00:00:01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	known, err := mock.AddDevice(hci, allowedAddress, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := bluez.NewWatcher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	// objects of GetManagedObjects
+	if _, ok := w.Adapters()[hci.Path()]; !ok {
+		t.Errorf("adapters %v", w.Adapters())
+	}
+	if _, ok := w.Device(known.Path()); !ok {
+		t.Errorf("devices %v", w.Devices())
+	}
+
+	var lock sync.Mutex
+	var events []string
+	w.Subscribe(func(ev *bluez.ObjectEvent) {
+		if ev.Interface != bluez.DeviceInterface {
+			return
+		}
+		lock.Lock()
+		defer lock.Unlock()
+		switch ev.Kind {
+		case bluez.ObjectAdded:
+			events = append(events, "added "+ev.Device.Address)
+		case bluez.ObjectRemoved:
+			events = append(events, "removed "+ev.Device.Address)
+		case bluez.ObjectChanged:
+			sort.Strings(ev.Changed)
+			for _, name := range ev.Changed {
+				events = append(events, "changed "+ev.Device.Address+" "+name)
+			}
+		}
+	})
+	count := func(n int) func() bool {
+		return func() bool {
+			lock.Lock()
+			defer lock.Unlock()
+			return len(events) >= n
+		}
+	}
+
+	added, err := mock.AddDevice(hci, otherAddress, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "added", count(1))
+	added.Set("Alias", "tablet")
+	waitFor(t, "changed", count(2))
+	if err := mock.RemoveDevice(known.Path()); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "removed", count(3))
+
+	want := []string{
+		"added " + otherAddress,
+		"changed " + otherAddress + " Alias",
+		"removed " + allowedAddress,
+	}
+	lock.Lock()
+	for i := range want {
+		if events[i] != want[i] {
+			t.Errorf("event %d %q, want %q", i, events[i], want[i])
+		}
+	}
+	lock.Unlock()
+
+	path, p, ok := w.DeviceByAddress(otherAddress)
+	if !ok || path != added.Path() || p.Alias != "tablet" {
+		t.Errorf("by address %s %+v %v", path, p, ok)
+	}
+	if _, ok := w.Device(known.Path()); ok {
+		t.Error("removed device still known")
+	}
+}
+
+func TestReconnect(t *testing.T) {
+	mock, conn := startBluez(t)
+	hci, err := mock.AddAdapter("hci0", "00:00:00:00:00:01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := mock.AddDevice(hci, allowedAddress, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	agent, err := bluez.NewPolicyAgent(agentPath, bluez.AgentPolicy{
+		Confirm: func(req *bluez.ConfirmRequest) bool { return true },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	agent.OpenPairingWindow(0)
+	am, err := bluez.NewAgentManager()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := agent.Register(am, bluez.AgentCapabilityDisplayYesNo, true); err != nil {
+		t.Fatal(err)
+	}
+	profile, err := bluez.NewHIDProfile(profilePath, func(c *bluez.HIDConnection) { c.Close() }, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pm, err := bluez.NewProfileManager()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := profile.Register(pm, hidUUID, nil); err != nil {
+		t.Fatal(err)
+	}
+	w, err := bluez.NewWatcher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	before, _ := mock.DefaultAgent()
+	conn.Bus().Close()
+
+	// registrations come back from the new unique name
+	waitFor(t, "agent registered again", func() bool {
+		a, ok := mock.DefaultAgent()
+		return ok && a.Sender != before.Sender && a.Path == agentPath
+	})
+	waitFor(t, "profiles registered again", func() bool {
+		var paths []string
+		for _, p := range mock.Profiles(hidUUID) {
+			if p.Sender != before.Sender {
+				paths = append(paths, string(p.Path))
+			}
+		}
+		sort.Strings(paths)
+		return len(paths) == 2 && paths[0] == string(profilePath) && paths[1] == string(profilePath+"/interrupt")
+	})
+
+	// the objects are exported on the new connection
+	if got := callAgent(t, mock, "RequestConfirmation", d.Path(), uint32(1)); got != "" {
+		t.Errorf("confirmation after reconnect: %q", got)
+	}
+
+	// the watcher reloads and follows signals again
+	added, err := mock.AddDevice(hci, otherAddress, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "watcher sees new device", func() bool {
+		_, ok := w.Device(added.Path())
+		return ok
+	})
+	added.Set("Name", "tablet")
+	waitFor(t, "watcher sees name", func() bool {
+		p, _ := w.Device(added.Path())
+		return p.Name == "tablet"
+	})
+}
@@ -0,0 +1,373 @@
+package bluez
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/godbus/dbus"
+)
+
+// DeviceMatch matches a device on every non zero field, Class is compared
+// after applying ClassMask, a zero ClassMask compares the whole class
+type DeviceMatch struct {
+	Address   string
+	Name      string
+	Class     uint32
+	ClassMask uint32
+}
+
+func (m DeviceMatch) match(p *DeviceProperties) bool {
+	if m.Address != "" && !strings.EqualFold(m.Address, p.Address) {
+		return false
+	}
+	if m.Name != "" && m.Name != p.Name && m.Name != p.Alias {
+		return false
+	}
+	if m.Class != 0 {
+		mask := m.ClassMask
+		if mask == 0 {
+			mask = 0xFFFFFF
+		}
+		if p.Class&mask != m.Class&mask {
+			return false
+		}
+	}
+	return true
+}
+
+// DisplaySink shows pin codes and passkeys to whoever pairs the host
+type DisplaySink interface {
+	DisplayPinCode(device dbus.ObjectPath, pinCode string)
+	DisplayPasskey(device dbus.ObjectPath, passkey uint32, entered uint16)
+	Cancel(device dbus.ObjectPath)
+}
+
+// LogDisplay writes pin codes and passkeys to the standard logger
+type LogDisplay struct{}
+
+func (LogDisplay) DisplayPinCode(device dbus.ObjectPath, pinCode string) {
+	log.Printf("agent: %s pin code %s", device, pinCode)
+}
+
+func (LogDisplay) DisplayPasskey(device dbus.ObjectPath, passkey uint32, entered uint16) {
+	log.Printf("agent: %s passkey %06d entered %d", device, passkey, entered)
+}
+
+func (LogDisplay) Cancel(device dbus.ObjectPath) {
+	log.Printf("agent: %s canceled", device)
+}
+
+// ConfirmRequest is a numeric comparison waiting for an answer, Canceled is
+// closed once bluez cancels the request
+type ConfirmRequest struct {
+	Device  dbus.ObjectPath
+	Props   DeviceProperties
+	Passkey uint32
+	// JustWorks a pairing without passkey bluez asks to authorize, Passkey
+	// is unused
+	JustWorks bool
+	Canceled  <-chan struct{}
+}
+
+type AgentPolicy struct {
+	// Allow empty allows every device not denied
+	Allow []DeviceMatch
+	Deny  []DeviceMatch
+	// Services authorized service uuids, short "0x1124" or full form
+	Services []string
+	// Confirm answers numeric comparison and just works pairing, nil
+	// rejects them
+	Confirm func(req *ConfirmRequest) bool
+	// Display nil uses LogDisplay
+	Display DisplaySink
+	// TrustOnPair marks confirmed devices as trusted
+	TrustOnPair bool
+}
+
+// PolicyAgent is an Agent1 which only pairs allowed devices while the
+// pairing window is open
+type PolicyAgent struct {
+	path     dbus.ObjectPath
+	conn     *Conn
+	policy   AgentPolicy
+	services map[string]bool
+	lock     sync.Mutex
+	window   time.Time
+	always   bool
+	canceled chan struct{}
+	// pairing the device of the last pairing request, service
+	// authorizations can not be canceled and leave it alone
+	pairing  dbus.ObjectPath
+	released bool
+	unhook   func()
+}
+
+func NewPolicyAgent(path dbus.ObjectPath, policy AgentPolicy) (*PolicyAgent, error) {
+	if policy.Display == nil {
+		policy.Display = LogDisplay{}
+	}
+	agent := &PolicyAgent{
+		path:     path,
+		policy:   policy,
+		services: make(map[string]bool),
+		canceled: make(chan struct{}),
+	}
+	for _, uuid := range policy.Services {
+		agent.services[NormalizeUUID(uuid)] = true
+	}
+
+	conn, err := ExportInterface(agent, path, AgentInterface)
+	if err != nil {
+		return nil, err
+	}
+	agent.conn = conn
+
+	return agent, nil
+}
+
+// Register the agent with bluez, optionally as the default agent
+func (a *PolicyAgent) Register(am *AgentManager, capability AgentCapability, asDefault bool) error {
+	if err := am.RegisterAgent(a.path, capability); err != nil {
+		return err
+	}
+	a.lock.Lock()
+	a.released = false
+	if a.unhook == nil {
+		a.unhook = a.conn.OnReconnect(func() error {
+			if err := am.RegisterAgent(a.path, capability); err != nil {
+				return err
+			}
+			if asDefault {
+				return am.RequestDefaultAgent(a.path)
+			}
+			return nil
+		})
+	}
+	a.lock.Unlock()
+	if asDefault {
+		return am.RequestDefaultAgent(a.path)
+	}
+	return nil
+}
+
+// NormalizeUUID expands 16 and 32 bit uuids to the lower case 128 bit form
+func NormalizeUUID(uuid string) string {
+	uuid = strings.ToLower(strings.TrimPrefix(strings.ToLower(uuid), "0x"))
+	if len(uuid) <= 8 {
+		return fmt.Sprintf("%08s-0000-1000-8000-00805f9b34fb", uuid)
+	}
+	return uuid
+}
+
+// OpenPairingWindow accept pairing for d, zero or negative keeps it open
+func (a *PolicyAgent) OpenPairingWindow(d time.Duration) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if d <= 0 {
+		a.always = true
+		return
+	}
+	a.always = false
+	a.window = time.Now().Add(d)
+}
+
+func (a *PolicyAgent) ClosePairingWindow() {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.always = false
+	a.window = time.Time{}
+}
+
+func (a *PolicyAgent) PairingWindowOpen() bool {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return !a.released && (a.always || time.Now().Before(a.window))
+}
+
+func (a *PolicyAgent) properties(device dbus.ObjectPath) (*DeviceProperties, error) {
+	d, err := NewDeviceWithFullPath(device)
+	if err != nil {
+		return nil, err
+	}
+	return d.GetProperties()
+}
+
+func (a *PolicyAgent) allowed(p *DeviceProperties) bool {
+	for _, m := range a.policy.Deny {
+		if m.match(p) {
+			return false
+		}
+	}
+	if len(a.policy.Allow) == 0 {
+		return true
+	}
+	for _, m := range a.policy.Allow {
+		if m.match(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// check rejects devices outside of the policy or the pairing window
+func (a *PolicyAgent) check(device dbus.ObjectPath, pairing bool) (*DeviceProperties, *dbus.Error) {
+	if pairing {
+		a.lock.Lock()
+		a.pairing = device
+		a.lock.Unlock()
+	}
+
+	p, err := a.properties(device)
+	if err != nil {
+		log.Printf("agent: %s properties %s", device, err)
+		return nil, ErrRejected
+	}
+	if !a.allowed(p) {
+		log.Printf("agent: %s %s not allowed", device, p.Address)
+		return nil, ErrRejected
+	}
+	if pairing && !a.PairingWindowOpen() {
+		log.Printf("agent: %s %s pairing window closed", device, p.Address)
+		return nil, ErrRejected
+	}
+	return p, nil
+}
+
+func randomDigits(max uint32) (uint32, error) {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint32(b) % max, nil
+}
+
+func (a *PolicyAgent) RequestPinCode(device dbus.ObjectPath) (string, *dbus.Error) {
+	if _, derr := a.check(device, true); derr != nil {
+		return "", derr
+	}
+	v, err := randomDigits(1000000)
+	if err != nil {
+		return "", ErrRejected
+	}
+	pinCode := fmt.Sprintf("%06d", v)
+	a.policy.Display.DisplayPinCode(device, pinCode)
+	return pinCode, nil
+}
+
+func (a *PolicyAgent) DisplayPinCode(device dbus.ObjectPath, pinCode string) *dbus.Error {
+	if _, derr := a.check(device, true); derr != nil {
+		return derr
+	}
+	a.policy.Display.DisplayPinCode(device, pinCode)
+	return nil
+}
+
+func (a *PolicyAgent) RequestPasskey(device dbus.ObjectPath) (uint32, *dbus.Error) {
+	if _, derr := a.check(device, true); derr != nil {
+		return 0, derr
+	}
+	passkey, err := randomDigits(1000000)
+	if err != nil {
+		return 0, ErrRejected
+	}
+	a.policy.Display.DisplayPasskey(device, passkey, 0)
+	return passkey, nil
+}
+
+func (a *PolicyAgent) DisplayPasskey(device dbus.ObjectPath, passkey uint32, entered uint16) *dbus.Error {
+	if _, derr := a.check(device, true); derr != nil {
+		return derr
+	}
+	a.policy.Display.DisplayPasskey(device, passkey, entered)
+	return nil
+}
+
+func (a *PolicyAgent) RequestConfirmation(device dbus.ObjectPath, passkey uint32) *dbus.Error {
+	p, derr := a.check(device, true)
+	if derr != nil {
+		return derr
+	}
+	return a.confirm(&ConfirmRequest{Device: device, Props: *p, Passkey: passkey})
+}
+
+// RequestAuthorization is how just works pairing arrives, it is confirmed
+// like a numeric comparison
+func (a *PolicyAgent) RequestAuthorization(device dbus.ObjectPath) *dbus.Error {
+	p, derr := a.check(device, true)
+	if derr != nil {
+		return derr
+	}
+	return a.confirm(&ConfirmRequest{Device: device, Props: *p, JustWorks: true})
+}
+
+// confirm asks policy.Confirm and trusts the device on success
+func (a *PolicyAgent) confirm(req *ConfirmRequest) *dbus.Error {
+	if a.policy.Confirm == nil {
+		return ErrRejected
+	}
+
+	a.lock.Lock()
+	canceled := a.canceled
+	a.lock.Unlock()
+
+	req.Canceled = canceled
+	if !a.policy.Confirm(req) {
+		return ErrRejected
+	}
+
+	select {
+	case <-canceled:
+		return ErrCanceled
+	default:
+	}
+
+	if a.policy.TrustOnPair {
+		d, err := NewDeviceWithFullPath(req.Device)
+		if err != nil {
+			return ErrCanceled
+		}
+		if err := d.SetTrusted(true); err != nil {
+			return ErrCanceled
+		}
+	}
+	return nil
+}
+
+func (a *PolicyAgent) AuthorizeService(device dbus.ObjectPath, uuid string) *dbus.Error {
+	if _, derr := a.check(device, false); derr != nil {
+		return derr
+	}
+	if !a.services[NormalizeUUID(uuid)] {
+		log.Printf("agent: %s service %s not authorized", device, uuid)
+		return ErrRejected
+	}
+	return nil
+}
+
+// Release bluez unregistered the agent, nothing gets paired afterwards
+func (a *PolicyAgent) Release() *dbus.Error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.released = true
+	a.always = false
+	a.window = time.Time{}
+	close(a.canceled)
+	a.canceled = make(chan struct{})
+	return nil
+}
+
+// Cancel aborts the request in flight, pending confirmations see Canceled closed
+func (a *PolicyAgent) Cancel() *dbus.Error {
+	a.lock.Lock()
+	close(a.canceled)
+	a.canceled = make(chan struct{})
+	device := a.pairing
+	a.lock.Unlock()
+	a.policy.Display.Cancel(device)
+	return nil
+}
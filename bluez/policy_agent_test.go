@@ -0,0 +1,254 @@
+package bluez_test
+
+import (
+	"testing"
+	"time"
+	"vitrhid/bluez"
+	"vitrhid/bluezmock"
+
+	"github.com/godbus/dbus"
+)
+
+const agentPath = dbus.ObjectPath("/test/agent")
+
+const (
+	allowedAddress = "11:11:11:11:11:11"
+	deniedAddress  = "22:22:22:22:22:22"
+	otherAddress   = "33:33:33:33:33:33"
+)
+
+// startAgent registers a policy agent allowing allowedAddress and denying
+// deniedAddress as default agent with the devices of the test
+func startAgent(t *testing.T, policy bluez.AgentPolicy) (*bluezmock.Bluez, *bluez.PolicyAgent, map[string]*bluezmock.Device) {
+	t.Helper()
+	mock, _ := startBluez(t)
+
+	adapter, err := mock.AddAdapter("hci0", "00:00:00:00:00:01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	devices := make(map[string]*bluezmock.Device)
+	for _, address := range []string{allowedAddress, deniedAddress, otherAddress} {
+		if devices[address], err = mock.AddDevice(adapter, address, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	policy.Allow = []bluez.DeviceMatch{{Address: allowedAddress}, {Address: deniedAddress}}
+	policy.Deny = []bluez.DeviceMatch{{Address: deniedAddress}}
+	agent, err := bluez.NewPolicyAgent(agentPath, policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	am, err := bluez.NewAgentManager()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := agent.Register(am, bluez.AgentCapabilityDisplayYesNo, true); err != nil {
+		t.Fatal(err)
+	}
+	return mock, agent, devices
+}
+
+func callAgent(t *testing.T, mock *bluezmock.Bluez, method string, args ...interface{}) string {
+	t.Helper()
+	call, ok := mock.CallAgent(method, args...)
+	if !ok {
+		t.Fatal("no default agent")
+	}
+	return errName(call.Err)
+}
+
+func TestPolicyAgentRegister(t *testing.T) {
+	mock, _, _ := startAgent(t, bluez.AgentPolicy{})
+
+	a, ok := mock.DefaultAgent()
+	if !ok {
+		t.Fatal("agent is not the default agent")
+	}
+	if a.Path != agentPath || a.Capability != string(bluez.AgentCapabilityDisplayYesNo) {
+		t.Fatalf("registered %s %s", a.Path, a.Capability)
+	}
+}
+
+func TestPolicyAgentAllowDeny(t *testing.T) {
+	mock, agent, devices := startAgent(t, bluez.AgentPolicy{
+		Confirm: func(req *bluez.ConfirmRequest) bool { return true },
+	})
+	agent.OpenPairingWindow(0)
+
+	tests := []struct {
+		address string
+		want    string
+	}{
+		{allowedAddress, ""},
+		{deniedAddress, bluez.ErrRejected.Name},
+		{otherAddress, bluez.ErrRejected.Name},
+	}
+	for _, tt := range tests {
+		if got := callAgent(t, mock, "RequestConfirmation", devices[tt.address].Path(), uint32(123456)); got != tt.want {
+			t.Errorf("%s confirmation: got %q, want %q", tt.address, got, tt.want)
+		}
+		if got := callAgent(t, mock, "RequestPasskey", devices[tt.address].Path()); got != tt.want {
+			t.Errorf("%s passkey: got %q, want %q", tt.address, got, tt.want)
+		}
+	}
+}
+
+func TestPolicyAgentPairingWindow(t *testing.T) {
+	mock, agent, devices := startAgent(t, bluez.AgentPolicy{
+		Services: []string{"0x1124"},
+		Confirm:  func(req *bluez.ConfirmRequest) bool { return true },
+	})
+	device := devices[allowedAddress].Path()
+
+	if agent.PairingWindowOpen() {
+		t.Fatal("window open before OpenPairingWindow")
+	}
+	if got := callAgent(t, mock, "RequestConfirmation", device, uint32(1)); got != bluez.ErrRejected.Name {
+		t.Errorf("closed window: got %q", got)
+	}
+
+	agent.OpenPairingWindow(time.Millisecond * 200)
+	if got := callAgent(t, mock, "RequestConfirmation", device, uint32(1)); got != "" {
+		t.Errorf("open window: got %q", got)
+	}
+	time.Sleep(time.Millisecond * 250)
+	if got := callAgent(t, mock, "RequestConfirmation", device, uint32(1)); got != bluez.ErrRejected.Name {
+		t.Errorf("expired window: got %q", got)
+	}
+
+	// services of paired devices are authorized without a window
+	if got := callAgent(t, mock, "AuthorizeService", device, bluez.NormalizeUUID("0x1124")); got != "" {
+		t.Errorf("hid service: got %q", got)
+	}
+	if got := callAgent(t, mock, "AuthorizeService", device, bluez.NormalizeUUID("0x110b")); got != bluez.ErrRejected.Name {
+		t.Errorf("audio sink service: got %q", got)
+	}
+	if got := callAgent(t, mock, "AuthorizeService", devices[deniedAddress].Path(), bluez.NormalizeUUID("0x1124")); got != bluez.ErrRejected.Name {
+		t.Errorf("denied device service: got %q", got)
+	}
+}
+
+func TestPolicyAgentConfirm(t *testing.T) {
+	requests := make(chan bluez.ConfirmRequest, 4)
+	accept := true
+	mock, agent, devices := startAgent(t, bluez.AgentPolicy{
+		Confirm: func(req *bluez.ConfirmRequest) bool {
+			requests <- *req
+			return accept
+		},
+		TrustOnPair: true,
+	})
+	agent.OpenPairingWindow(0)
+	d := devices[allowedAddress]
+
+	if got := callAgent(t, mock, "RequestConfirmation", d.Path(), uint32(654321)); got != "" {
+		t.Fatalf("confirmation: got %q", got)
+	}
+	req := <-requests
+	if req.Device != d.Path() || req.Passkey != 654321 || req.JustWorks || req.Props.Address != allowedAddress {
+		t.Errorf("request %+v", req)
+	}
+	if trusted, _ := d.Get("Trusted").(bool); !trusted {
+		t.Error("confirmed device not trusted")
+	}
+
+	// just works pairing of a DisplayYesNo agent
+	d.Set("Trusted", false)
+	if got := callAgent(t, mock, "RequestAuthorization", d.Path()); got != "" {
+		t.Fatalf("authorization: got %q", got)
+	}
+	if req := <-requests; !req.JustWorks {
+		t.Errorf("authorization request %+v", req)
+	}
+	if trusted, _ := d.Get("Trusted").(bool); !trusted {
+		t.Error("authorized device not trusted")
+	}
+
+	accept = false
+	d.Set("Trusted", false)
+	if got := callAgent(t, mock, "RequestAuthorization", d.Path()); got != bluez.ErrRejected.Name {
+		t.Errorf("refused authorization: got %q", got)
+	}
+	<-requests
+	if trusted, _ := d.Get("Trusted").(bool); trusted {
+		t.Error("refused device trusted")
+	}
+}
+
+func TestPolicyAgentNoConfirm(t *testing.T) {
+	mock, agent, devices := startAgent(t, bluez.AgentPolicy{})
+	agent.OpenPairingWindow(0)
+
+	if got := callAgent(t, mock, "RequestConfirmation", devices[allowedAddress].Path(), uint32(1)); got != bluez.ErrRejected.Name {
+		t.Errorf("confirmation: got %q", got)
+	}
+	if got := callAgent(t, mock, "RequestAuthorization", devices[allowedAddress].Path()); got != bluez.ErrRejected.Name {
+		t.Errorf("authorization: got %q", got)
+	}
+}
+
+// cancelDisplay keeps the devices Cancel was called for
+type cancelDisplay struct {
+	bluez.LogDisplay
+	canceled chan dbus.ObjectPath
+}
+
+func (d cancelDisplay) Cancel(device dbus.ObjectPath) {
+	d.canceled <- device
+}
+
+func TestPolicyAgentCancel(t *testing.T) {
+	waiting := make(chan struct{})
+	display := cancelDisplay{canceled: make(chan dbus.ObjectPath, 1)}
+	mock, agent, devices := startAgent(t, bluez.AgentPolicy{
+		Confirm: func(req *bluez.ConfirmRequest) bool {
+			close(waiting)
+			<-req.Canceled
+			return false
+		},
+		Display: display,
+	})
+	agent.OpenPairingWindow(0)
+
+	done := make(chan string, 1)
+	go func() {
+		call, _ := mock.CallAgent("RequestConfirmation", devices[allowedAddress].Path(), uint32(1))
+		done <- errName(call.Err)
+	}()
+	<-waiting
+	// a service authorization in between does not take over the cancel
+	callAgent(t, mock, "AuthorizeService", devices[otherAddress].Path(), "0x1124")
+	if err := devices[allowedAddress].CancelPairing(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case got := <-done:
+		if got != bluez.ErrRejected.Name {
+			t.Errorf("canceled confirmation: got %q", got)
+		}
+	case <-time.After(time.Second * 2):
+		t.Fatal("confirmation not canceled")
+	}
+	if got := <-display.canceled; got != devices[allowedAddress].Path() {
+		t.Errorf("canceled %s", got)
+	}
+}
+
+func TestPolicyAgentRelease(t *testing.T) {
+	mock, agent, devices := startAgent(t, bluez.AgentPolicy{
+		Confirm: func(req *bluez.ConfirmRequest) bool { return true },
+	})
+	agent.OpenPairingWindow(0)
+
+	if got := callAgent(t, mock, "Release"); got != "" {
+		t.Fatalf("release: got %q", got)
+	}
+	if agent.PairingWindowOpen() {
+		t.Error("window open after release")
+	}
+	if got := callAgent(t, mock, "RequestConfirmation", devices[allowedAddress].Path(), uint32(1)); got != bluez.ErrRejected.Name {
+		t.Errorf("confirmation after release: got %q", got)
+	}
+}
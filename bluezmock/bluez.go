@@ -0,0 +1,344 @@
+// Package bluezmock is a fake bluetoothd for tests, it owns org.bluez on a
+// private bus and implements enough of the adapter, device, agent and
+// profile api to drive the bluez package without root or hardware
+package bluezmock
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"vitrhid/bluez"
+
+	"github.com/godbus/dbus"
+	"github.com/godbus/dbus/prop"
+	"golang.org/x/sys/unix"
+)
+
+var (
+	ErrNameTaken = errors.New("org.bluez already owned")
+
+	errDoesNotExist = &dbus.Error{
+		Name: "org.bluez.Error.DoesNotExist",
+		Body: []interface{}{"Does Not Exist"},
+	}
+	errAlreadyExists = &dbus.Error{
+		Name: "org.bluez.Error.AlreadyExists",
+		Body: []interface{}{"Already Exists"},
+	}
+	errNotAvailable = &dbus.Error{
+		Name: "org.bluez.Error.NotAvailable",
+		Body: []interface{}{"Not Available"},
+	}
+)
+
+// Agent an agent registered through AgentManager1
+type Agent struct {
+	Sender     string
+	Path       dbus.ObjectPath
+	Capability string
+}
+
+// Profile a profile registered through ProfileManager1
+type Profile struct {
+	Sender  string
+	Path    dbus.ObjectPath
+	UUID    string
+	Options map[string]dbus.Variant
+}
+
+type Bluez struct {
+	daemon       *Daemon
+	conn         *dbus.Conn
+	lock         sync.Mutex
+	adapters     map[dbus.ObjectPath]*Adapter
+	devices      map[dbus.ObjectPath]*Device
+	agents       []*Agent
+	defaultAgent *Agent
+	profiles     []*Profile
+}
+
+// Start runs a private dbus-daemon with a fake bluez on it, Client
+// connects the code under test
+func Start() (*Bluez, error) {
+	daemon, err := StartDaemon()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := daemon.Conn()
+	if err != nil {
+		daemon.Close()
+		return nil, err
+	}
+	b, err := New(conn)
+	if err != nil {
+		conn.Close()
+		daemon.Close()
+		return nil, err
+	}
+	b.daemon = daemon
+	return b, nil
+}
+
+// New serves bluez on conn, it must be a connection of its own since the
+// code under test has to call it through the bus
+func New(conn *dbus.Conn) (*Bluez, error) {
+	reply, err := conn.RequestName(bluez.BluezInterface, dbus.NameFlagDoNotQueue)
+	if err != nil {
+		return nil, err
+	}
+	if reply != dbus.RequestNameReplyPrimaryOwner {
+		return nil, ErrNameTaken
+	}
+
+	b := &Bluez{
+		conn:     conn,
+		adapters: make(map[dbus.ObjectPath]*Adapter),
+		devices:  make(map[dbus.ObjectPath]*Device),
+	}
+
+	if err := conn.Export(&objectManager{b}, "/", bluez.ObjectManager); err != nil {
+		return nil, err
+	}
+	if err := conn.Export(&agentManager{b}, bluez.BluezPath, bluez.AgentManagerInterface); err != nil {
+		return nil, err
+	}
+	if err := conn.Export(&profileManager{b}, bluez.BluezPath, bluez.ProfileManagerInterface); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Address of the private bus, bluez.Dial it for a connection that
+// reconnects
+func (b *Bluez) Address() string {
+	if b.daemon == nil {
+		return ""
+	}
+	return b.daemon.Address
+}
+
+// Client a new connection to the private bus, pass it to bluez.SetBus
+func (b *Bluez) Client() (*dbus.Conn, error) {
+	if b.daemon == nil {
+		return nil, errors.New("bluezmock: not started with Start")
+	}
+	return b.daemon.Conn()
+}
+
+func (b *Bluez) Close() error {
+	b.lock.Lock()
+	for _, d := range b.devices {
+		d.closeRemotes()
+	}
+	b.lock.Unlock()
+
+	b.conn.Close()
+	if b.daemon != nil {
+		return b.daemon.Close()
+	}
+	return nil
+}
+
+func (b *Bluez) interfacesAdded(path dbus.ObjectPath, iface string, props *prop.Properties) {
+	all, _ := props.GetAll(iface)
+	b.conn.Emit("/", bluez.ObjectManager+".InterfacesAdded", path, map[string]map[string]dbus.Variant{iface: all})
+}
+
+func (b *Bluez) interfacesRemoved(path dbus.ObjectPath, iface string) {
+	b.conn.Emit("/", bluez.ObjectManager+".InterfacesRemoved", path, []string{iface})
+}
+
+// Agents every registered agent, the default one is among them
+func (b *Bluez) Agents() []Agent {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	var agents []Agent
+	for _, a := range b.agents {
+		agents = append(agents, *a)
+	}
+	return agents
+}
+
+func (b *Bluez) DefaultAgent() (Agent, bool) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.defaultAgent == nil {
+		return Agent{}, false
+	}
+	return *b.defaultAgent, true
+}
+
+// CallAgent calls method of Agent1 on the default agent, false without one
+func (b *Bluez) CallAgent(method string, args ...interface{}) (*dbus.Call, bool) {
+	a, ok := b.DefaultAgent()
+	if !ok {
+		return nil, false
+	}
+	return b.conn.Object(a.Sender, a.Path).Call(bluez.AgentInterface+"."+method, 0, args...), true
+}
+
+// Profiles registered for uuid, empty uuid returns all of them
+func (b *Bluez) Profiles(uuid string) []Profile {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	var profiles []Profile
+	for _, p := range b.profiles {
+		if uuid == "" || p.UUID == bluez.NormalizeUUID(uuid) {
+			profiles = append(profiles, *p)
+		}
+	}
+	return profiles
+}
+
+// ConnectProfile hands a socket to every profile of uuid like bluez does
+// for an incoming connection, the returned fds are the remote ends
+func (b *Bluez) ConnectProfile(device dbus.ObjectPath, uuid string) ([]int, error) {
+	b.lock.Lock()
+	d, ok := b.devices[device]
+	b.lock.Unlock()
+	if !ok {
+		return nil, errDoesNotExist
+	}
+
+	profiles := b.Profiles(uuid)
+	if len(profiles) == 0 {
+		return nil, errNotAvailable
+	}
+
+	var remotes []int
+	for _, p := range profiles {
+		fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_SEQPACKET, 0)
+		if err != nil {
+			return remotes, err
+		}
+		call := b.conn.Object(p.Sender, p.Path).Call(bluez.ProfileInterface+".NewConnection", 0,
+			device, dbus.UnixFD(fds[0]), map[string]dbus.Variant{})
+		// the receiver got its own copy
+		unix.Close(fds[0])
+		if call.Err != nil {
+			unix.Close(fds[1])
+			return remotes, call.Err
+		}
+		remotes = append(remotes, fds[1])
+		d.addRemote(p, fds[1])
+	}
+	d.Set("Connected", true)
+	return remotes, nil
+}
+
+// DisconnectProfile asks every profile with a connection of the device to
+// drop it and closes the remote ends
+func (b *Bluez) DisconnectProfile(device dbus.ObjectPath, uuid string) error {
+	b.lock.Lock()
+	d, ok := b.devices[device]
+	b.lock.Unlock()
+	if !ok {
+		return errDoesNotExist
+	}
+
+	for _, r := range d.takeRemotes(uuid) {
+		b.conn.Object(r.profile.Sender, r.profile.Path).Call(bluez.ProfileInterface+".RequestDisconnection", 0, device)
+		unix.Close(r.fd)
+	}
+	return nil
+}
+
+type objectManager struct {
+	b *Bluez
+}
+
+func (m *objectManager) GetManagedObjects() (map[dbus.ObjectPath]map[string]map[string]dbus.Variant, *dbus.Error) {
+	m.b.lock.Lock()
+	defer m.b.lock.Unlock()
+	objects := make(map[dbus.ObjectPath]map[string]map[string]dbus.Variant)
+	for path, a := range m.b.adapters {
+		props, _ := a.props.GetAll(bluez.AdapterInterface)
+		objects[path] = map[string]map[string]dbus.Variant{bluez.AdapterInterface: props}
+	}
+	for path, d := range m.b.devices {
+		props, _ := d.props.GetAll(bluez.DeviceInterface)
+		objects[path] = map[string]map[string]dbus.Variant{bluez.DeviceInterface: props}
+	}
+	return objects, nil
+}
+
+type agentManager struct {
+	b *Bluez
+}
+
+func (m *agentManager) RegisterAgent(sender dbus.Sender, path dbus.ObjectPath, capability string) *dbus.Error {
+	m.b.lock.Lock()
+	defer m.b.lock.Unlock()
+	for _, a := range m.b.agents {
+		if a.Sender == string(sender) {
+			return errAlreadyExists
+		}
+	}
+	m.b.agents = append(m.b.agents, &Agent{Sender: string(sender), Path: path, Capability: capability})
+	return nil
+}
+
+func (m *agentManager) UnregisterAgent(sender dbus.Sender, path dbus.ObjectPath) *dbus.Error {
+	m.b.lock.Lock()
+	defer m.b.lock.Unlock()
+	for i, a := range m.b.agents {
+		if a.Sender == string(sender) && a.Path == path {
+			m.b.agents = append(m.b.agents[:i:i], m.b.agents[i+1:]...)
+			if m.b.defaultAgent == a {
+				m.b.defaultAgent = nil
+			}
+			return nil
+		}
+	}
+	return errDoesNotExist
+}
+
+func (m *agentManager) RequestDefaultAgent(sender dbus.Sender, path dbus.ObjectPath) *dbus.Error {
+	m.b.lock.Lock()
+	defer m.b.lock.Unlock()
+	for _, a := range m.b.agents {
+		if a.Sender == string(sender) && a.Path == path {
+			m.b.defaultAgent = a
+			return nil
+		}
+	}
+	return errDoesNotExist
+}
+
+type profileManager struct {
+	b *Bluez
+}
+
+func (m *profileManager) RegisterProfile(sender dbus.Sender, path dbus.ObjectPath, uuid string, options map[string]dbus.Variant) *dbus.Error {
+	m.b.lock.Lock()
+	defer m.b.lock.Unlock()
+	for _, p := range m.b.profiles {
+		if p.Sender == string(sender) && p.Path == path {
+			return errAlreadyExists
+		}
+	}
+	m.b.profiles = append(m.b.profiles, &Profile{
+		Sender:  string(sender),
+		Path:    path,
+		UUID:    bluez.NormalizeUUID(uuid),
+		Options: options,
+	})
+	return nil
+}
+
+func (m *profileManager) UnregisterProfile(sender dbus.Sender, path dbus.ObjectPath) *dbus.Error {
+	m.b.lock.Lock()
+	defer m.b.lock.Unlock()
+	for i, p := range m.b.profiles {
+		if p.Sender == string(sender) && p.Path == path {
+			m.b.profiles = append(m.b.profiles[:i:i], m.b.profiles[i+1:]...)
+			return nil
+		}
+	}
+	return errDoesNotExist
+}
+
+// devicePath the path of address "AA:BB:CC:DD:EE:FF" below adapter
+func devicePath(adapter dbus.ObjectPath, address string) dbus.ObjectPath {
+	return adapter + "/dev_" + dbus.ObjectPath(strings.Replace(strings.ToUpper(address), ":", "_", -1))
+}
@@ -0,0 +1,247 @@
+package bluezmock
+
+import (
+	"os/exec"
+	"testing"
+	"time"
+	"vitrhid/bluez"
+
+	"github.com/godbus/dbus"
+	"golang.org/x/sys/unix"
+)
+
+func start(t *testing.T) (*Bluez, *dbus.Conn) {
+	t.Helper()
+	if _, err := exec.LookPath("dbus-daemon"); err != nil {
+		t.Skip("dbus-daemon not found")
+	}
+	b, err := Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := b.Client()
+	if err != nil {
+		b.Close()
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		client.Close()
+		b.Close()
+	})
+	return b, client
+}
+
+func managedObjects(t *testing.T, client *dbus.Conn) map[dbus.ObjectPath]map[string]map[string]dbus.Variant {
+	t.Helper()
+	var objects map[dbus.ObjectPath]map[string]map[string]dbus.Variant
+	err := client.Object(bluez.BluezInterface, "/").Call(bluez.ObjectManager+".GetManagedObjects", 0).Store(&objects)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return objects
+}
+
+func TestObjects(t *testing.T) {
+	b, client := start(t)
+
+	signals := make(chan *dbus.Signal, 10)
+	client.Signal(signals)
+	client.BusObject().Call("org.freedesktop.DBus.AddMatch", 0,
+		"type='signal',sender='"+bluez.BluezInterface+"',interface='"+bluez.ObjectManager+"'")
+
+	adapter, err := b.AddAdapter("hci0", "AA:AA:AA:AA:AA:AA")
+	if err != nil {
+		t.Fatal(err)
+	}
+	device, err := b.AddDevice(adapter, "11:22:33:44:55:66", map[string]interface{}{"Name": "phone", "Paired": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := dbus.ObjectPath("/org/bluez/hci0/dev_11_22_33_44_55_66"); device.Path() != want {
+		t.Errorf("device path %s, want %s", device.Path(), want)
+	}
+
+	objects := managedObjects(t, client)
+	if got := objects[adapter.Path()][bluez.AdapterInterface]["Address"].Value(); got != "AA:AA:AA:AA:AA:AA" {
+		t.Errorf("adapter address %v", got)
+	}
+	props := objects[device.Path()][bluez.DeviceInterface]
+	if props["Name"].Value() != "phone" || props["Paired"].Value() != true || props["Adapter"].Value() != adapter.Path() {
+		t.Errorf("device properties %v", props)
+	}
+
+	if err := b.RemoveDevice(device.Path()); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := managedObjects(t, client)[device.Path()]; ok {
+		t.Error("removed device still managed")
+	}
+	if err := b.RemoveDevice(device.Path()); err == nil {
+		t.Error("removed a device twice")
+	}
+
+	// godbus delivers every signal on a goroutine of its own, the order
+	// they arrive in is not the order they were sent in
+	got := make(map[string]bool)
+	timeout := time.After(time.Second * 2)
+	for len(got) < 3 {
+		select {
+		case s := <-signals:
+			if s.Path == "/" {
+				got[s.Name+" "+string(s.Body[0].(dbus.ObjectPath))] = true
+			}
+		case <-timeout:
+			t.Fatalf("signals %v", got)
+		}
+	}
+	for _, want := range []string{
+		bluez.ObjectManager + ".InterfacesAdded " + string(adapter.Path()),
+		bluez.ObjectManager + ".InterfacesAdded " + string(device.Path()),
+		bluez.ObjectManager + ".InterfacesRemoved " + string(device.Path()),
+	} {
+		if !got[want] {
+			t.Errorf("no signal %q in %v", want, got)
+		}
+	}
+}
+
+type agent struct {
+	passkeys chan uint32
+	reject   bool
+}
+
+func (a *agent) RequestConfirmation(device dbus.ObjectPath, passkey uint32) *dbus.Error {
+	a.passkeys <- passkey
+	if a.reject {
+		return &dbus.Error{Name: "org.bluez.Error.Rejected", Body: []interface{}{"Rejected"}}
+	}
+	return nil
+}
+
+func TestAgent(t *testing.T) {
+	b, client := start(t)
+	adapter, err := b.AddAdapter("hci0", "AA:AA:AA:AA:AA:AA")
+	if err != nil {
+		t.Fatal(err)
+	}
+	device, err := b.AddDevice(adapter, "11:22:33:44:55:66", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := &agent{passkeys: make(chan uint32, 2)}
+	if err := client.Export(a, "/test/agent", bluez.AgentInterface); err != nil {
+		t.Fatal(err)
+	}
+	manager := client.Object(bluez.BluezInterface, bluez.BluezPath)
+	if err := manager.Call(bluez.AgentManagerInterface+".RegisterAgent", 0, dbus.ObjectPath("/test/agent"), "DisplayYesNo").Err; err != nil {
+		t.Fatal(err)
+	}
+	if err := manager.Call(bluez.AgentManagerInterface+".RegisterAgent", 0, dbus.ObjectPath("/test/agent"), "DisplayYesNo").Err; err == nil {
+		t.Error("registered the agent twice")
+	}
+	if _, ok := b.DefaultAgent(); ok {
+		t.Error("default agent before RequestDefaultAgent")
+	}
+	if err := manager.Call(bluez.AgentManagerInterface+".RequestDefaultAgent", 0, dbus.ObjectPath("/test/agent")).Err; err != nil {
+		t.Fatal(err)
+	}
+	if agents := b.Agents(); len(agents) != 1 || agents[0].Capability != "DisplayYesNo" || agents[0].Sender != client.Names()[0] {
+		t.Errorf("agents %+v", agents)
+	}
+
+	a.reject = true
+	if err := client.Object(bluez.BluezInterface, device.Path()).Call(bluez.DeviceInterface+".Pair", 0).Err; err == nil {
+		t.Error("pairing rejected by the agent succeeded")
+	}
+	if device.Get("Paired") != false {
+		t.Error("paired after a rejection")
+	}
+	a.reject = false
+	if err := client.Object(bluez.BluezInterface, device.Path()).Call(bluez.DeviceInterface+".Pair", 0).Err; err != nil {
+		t.Fatal(err)
+	}
+	if device.Get("Paired") != true || device.Get("Bonded") != true {
+		t.Error("not paired after a confirmation")
+	}
+	if len(a.passkeys) != 2 {
+		t.Errorf("agent asked %d times", len(a.passkeys))
+	}
+
+	if err := manager.Call(bluez.AgentManagerInterface+".UnregisterAgent", 0, dbus.ObjectPath("/test/agent")).Err; err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := b.DefaultAgent(); ok {
+		t.Error("default agent after UnregisterAgent")
+	}
+}
+
+type profile struct {
+	fds         chan int
+	disconnects chan dbus.ObjectPath
+}
+
+func (p *profile) NewConnection(device dbus.ObjectPath, fd dbus.UnixFD, options map[string]dbus.Variant) *dbus.Error {
+	p.fds <- int(fd)
+	return nil
+}
+
+func (p *profile) RequestDisconnection(device dbus.ObjectPath) *dbus.Error {
+	p.disconnects <- device
+	return nil
+}
+
+const hidUUID = "00001124-0000-1000-8000-00805f9b34fb"
+
+func TestProfile(t *testing.T) {
+	b, client := start(t)
+	adapter, err := b.AddAdapter("hci0", "AA:AA:AA:AA:AA:AA")
+	if err != nil {
+		t.Fatal(err)
+	}
+	device, err := b.AddDevice(adapter, "11:22:33:44:55:66", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := &profile{fds: make(chan int, 1), disconnects: make(chan dbus.ObjectPath, 1)}
+	if err := client.Export(p, "/test/profile", bluez.ProfileInterface); err != nil {
+		t.Fatal(err)
+	}
+	manager := client.Object(bluez.BluezInterface, bluez.BluezPath)
+	err = manager.Call(bluez.ProfileManagerInterface+".RegisterProfile", 0,
+		dbus.ObjectPath("/test/profile"), "1124", map[string]dbus.Variant{}).Err
+	if err != nil {
+		t.Fatal(err)
+	}
+	if profiles := b.Profiles(hidUUID); len(profiles) != 1 || profiles[0].Path != "/test/profile" {
+		t.Errorf("hid profiles %+v", profiles)
+	}
+
+	remotes, err := b.ConnectProfile(device.Path(), hidUUID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fd := <-p.fds
+	defer unix.Close(fd)
+	if len(remotes) != 1 || device.Get("Connected") != true {
+		t.Fatalf("remotes %v connected %v", remotes, device.Get("Connected"))
+	}
+	if _, err := unix.Write(remotes[0], []byte{0xA1, 1}); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 8)
+	if n, err := unix.Read(fd, buf); err != nil || n != 2 || buf[0] != 0xA1 {
+		t.Errorf("read % x %v", buf[:n], err)
+	}
+
+	if err := b.DisconnectProfile(device.Path(), hidUUID); err != nil {
+		t.Fatal(err)
+	}
+	if got := <-p.disconnects; got != device.Path() {
+		t.Errorf("disconnected %s", got)
+	}
+	if _, err := b.ConnectProfile(device.Path(), "180f"); err == nil {
+		t.Error("connected a profile nobody registered")
+	}
+}
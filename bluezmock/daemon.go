@@ -0,0 +1,98 @@
+package bluezmock
+
+import (
+	"bufio"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/godbus/dbus"
+)
+
+const daemonConfig = `<!DOCTYPE busconfig PUBLIC "-//freedesktop//DTD D-Bus Bus Configuration 1.0//EN"
+ "http://www.freedesktop.org/standards/dbus/1.0/busconfig.dtd">
+<busconfig>
+  <type>session</type>
+  <listen>unix:path=%SOCKET%</listen>
+  <auth>EXTERNAL</auth>
+  <policy context="default">
+    <allow send_destination="*" eavesdrop="true"/>
+    <allow eavesdrop="true"/>
+    <allow own="*"/>
+  </policy>
+</busconfig>
+`
+
+var ErrNoAddress = errors.New("dbus-daemon printed no address")
+
+// Daemon is a private dbus-daemon nothing else is connected to
+type Daemon struct {
+	Address string
+	dir     string
+	cmd     *exec.Cmd
+}
+
+// StartDaemon runs dbus-daemon from PATH listening in a temporary directory
+func StartDaemon() (*Daemon, error) {
+	dir, err := ioutil.TempDir("", "bluezmock")
+	if err != nil {
+		return nil, err
+	}
+
+	config := filepath.Join(dir, "bus.conf")
+	content := strings.Replace(daemonConfig, "%SOCKET%", filepath.Join(dir, "bus"), 1)
+	if err := ioutil.WriteFile(config, []byte(content), 0600); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+
+	cmd := exec.Command("dbus-daemon", "--config-file="+config, "--nofork", "--print-address")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+
+	d := &Daemon{dir: dir, cmd: cmd}
+	address, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil || strings.TrimSpace(address) == "" {
+		d.Close()
+		return nil, ErrNoAddress
+	}
+	d.Address = strings.TrimSpace(address)
+
+	return d, nil
+}
+
+// Conn opens a new connection to the daemon, every connection gets its own
+// unique name like a separate process would
+func (d *Daemon) Conn() (*dbus.Conn, error) {
+	conn, err := dbus.Dial(d.Address)
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.Auth(nil); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := conn.Hello(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+func (d *Daemon) Close() error {
+	if d.cmd.Process != nil {
+		d.cmd.Process.Kill()
+		d.cmd.Wait()
+	}
+	return os.RemoveAll(d.dir)
+}
@@ -0,0 +1,294 @@
+package bluezmock
+
+import (
+	"sync"
+	"vitrhid/bluez"
+
+	"github.com/godbus/dbus"
+	"github.com/godbus/dbus/prop"
+	"golang.org/x/sys/unix"
+)
+
+type Adapter struct {
+	b       *Bluez
+	path    dbus.ObjectPath
+	props   *prop.Properties
+	lock    sync.Mutex
+	filters map[string]dbus.Variant
+}
+
+// AddAdapter adds "hciN" with address, powered off and not discoverable
+func (b *Bluez) AddAdapter(name, address string) (*Adapter, error) {
+	a := &Adapter{
+		b:    b,
+		path: dbus.ObjectPath(bluez.BluezPath + "/" + name),
+	}
+
+	if err := b.conn.Export(a, a.path, bluez.AdapterInterface); err != nil {
+		return nil, err
+	}
+	a.props = prop.New(b.conn, a.path, map[string]map[string]*prop.Prop{
+		bluez.AdapterInterface: {
+			"Address":             {Value: address, Emit: prop.EmitTrue},
+			"AddressType":         {Value: "public", Emit: prop.EmitTrue},
+			"Name":                {Value: name, Emit: prop.EmitTrue},
+			"Alias":               {Value: name, Writable: true, Emit: prop.EmitTrue},
+			"Class":               {Value: uint32(0), Emit: prop.EmitTrue},
+			"Powered":             {Value: false, Writable: true, Emit: prop.EmitTrue},
+			"Discoverable":        {Value: false, Writable: true, Emit: prop.EmitTrue},
+			"DiscoverableTimeout": {Value: uint32(180), Writable: true, Emit: prop.EmitTrue},
+			"Pairable":            {Value: true, Writable: true, Emit: prop.EmitTrue},
+			"PairableTimeout":     {Value: uint32(0), Writable: true, Emit: prop.EmitTrue},
+			"Discovering":         {Value: false, Emit: prop.EmitTrue},
+			"UUIDs":               {Value: []string{}, Emit: prop.EmitTrue},
+			"Modalias":            {Value: "usb:v1D6Bp0246d0537", Emit: prop.EmitTrue},
+			"Roles":               {Value: []string{"central", "peripheral"}, Emit: prop.EmitTrue},
+		},
+		bluez.AdminPolicyStatusInterface: {
+			"ServiceAllowList": {Value: []string{}, Emit: prop.EmitTrue},
+		},
+	})
+	if err := b.conn.Export(&adminPolicy{a}, a.path, bluez.AdminPolicySetInterface); err != nil {
+		return nil, err
+	}
+
+	b.lock.Lock()
+	b.adapters[a.path] = a
+	b.lock.Unlock()
+
+	b.interfacesAdded(a.path, bluez.AdapterInterface, a.props)
+	return a, nil
+}
+
+func (a *Adapter) Path() dbus.ObjectPath {
+	return a.path
+}
+
+// Set changes a property as bluez would, PropertiesChanged included
+func (a *Adapter) Set(name string, value interface{}) {
+	a.props.SetMust(bluez.AdapterInterface, name, value)
+}
+
+func (a *Adapter) Get(name string) interface{} {
+	return a.props.GetMust(bluez.AdapterInterface, name)
+}
+
+// ServiceAllowList the list set through AdminPolicySet1, empty allows all
+func (a *Adapter) ServiceAllowList() []string {
+	return a.props.GetMust(bluez.AdminPolicyStatusInterface, "ServiceAllowList").([]string)
+}
+
+// DiscoveryFilter the last filter set through SetDiscoveryFilter
+func (a *Adapter) DiscoveryFilter() map[string]dbus.Variant {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.filters
+}
+
+func (a *Adapter) StartDiscovery() *dbus.Error {
+	a.Set("Discovering", true)
+	return nil
+}
+
+func (a *Adapter) StopDiscovery() *dbus.Error {
+	a.Set("Discovering", false)
+	return nil
+}
+
+func (a *Adapter) SetDiscoveryFilter(filter map[string]dbus.Variant) *dbus.Error {
+	a.lock.Lock()
+	a.filters = filter
+	a.lock.Unlock()
+	return nil
+}
+
+func (a *Adapter) GetDiscoveryFilters() ([]string, *dbus.Error) {
+	return []string{"UUIDs", "RSSI", "Pathloss", "Transport", "DuplicateData", "Discoverable", "Pattern"}, nil
+}
+
+func (a *Adapter) RemoveDevice(device dbus.ObjectPath) *dbus.Error {
+	if err := a.b.RemoveDevice(device); err != nil {
+		return errDoesNotExist
+	}
+	return nil
+}
+
+type adminPolicy struct {
+	a *Adapter
+}
+
+func (p *adminPolicy) SetServiceAllowList(uuids []string) *dbus.Error {
+	p.a.props.SetMust(bluez.AdminPolicyStatusInterface, "ServiceAllowList", uuids)
+	return nil
+}
+
+type remote struct {
+	profile Profile
+	fd      int
+}
+
+type Device struct {
+	b       *Bluez
+	path    dbus.ObjectPath
+	props   *prop.Properties
+	lock    sync.Mutex
+	remotes []remote
+}
+
+// AddDevice adds a known device with address to the adapter, props
+// override the defaults like "Name", "Class" or "Paired"
+func (b *Bluez) AddDevice(adapter *Adapter, address string, props map[string]interface{}) (*Device, error) {
+	d := &Device{
+		b:    b,
+		path: devicePath(adapter.path, address),
+	}
+
+	values := map[string]*prop.Prop{
+		"Address":          {Value: address, Emit: prop.EmitTrue},
+		"AddressType":      {Value: "public", Emit: prop.EmitTrue},
+		"Name":             {Value: address, Emit: prop.EmitTrue},
+		"Alias":            {Value: address, Writable: true, Emit: prop.EmitTrue},
+		"Class":            {Value: uint32(0), Emit: prop.EmitTrue},
+		"Appearance":       {Value: uint16(0), Emit: prop.EmitTrue},
+		"Icon":             {Value: "", Emit: prop.EmitTrue},
+		"Paired":           {Value: false, Emit: prop.EmitTrue},
+		"Bonded":           {Value: false, Emit: prop.EmitTrue},
+		"Trusted":          {Value: false, Writable: true, Emit: prop.EmitTrue},
+		"Blocked":          {Value: false, Writable: true, Emit: prop.EmitTrue},
+		"Connected":        {Value: false, Emit: prop.EmitTrue},
+		"LegacyPairing":    {Value: false, Emit: prop.EmitTrue},
+		"RSSI":             {Value: int16(0), Emit: prop.EmitTrue},
+		"UUIDs":            {Value: []string{}, Emit: prop.EmitTrue},
+		"Modalias":         {Value: "", Emit: prop.EmitTrue},
+		"Adapter":          {Value: adapter.path, Emit: prop.EmitTrue},
+		"WakeAllowed":      {Value: false, Writable: true, Emit: prop.EmitTrue},
+		"ServicesResolved": {Value: false, Emit: prop.EmitTrue},
+	}
+	for name, v := range props {
+		if p, ok := values[name]; ok {
+			p.Value = v
+		} else {
+			values[name] = &prop.Prop{Value: v, Emit: prop.EmitTrue}
+		}
+	}
+
+	if err := b.conn.Export(d, d.path, bluez.DeviceInterface); err != nil {
+		return nil, err
+	}
+	d.props = prop.New(b.conn, d.path, map[string]map[string]*prop.Prop{bluez.DeviceInterface: values})
+
+	b.lock.Lock()
+	b.devices[d.path] = d
+	b.lock.Unlock()
+
+	b.interfacesAdded(d.path, bluez.DeviceInterface, d.props)
+	return d, nil
+}
+
+// RemoveDevice drops the device, open profile connections are closed
+func (b *Bluez) RemoveDevice(device dbus.ObjectPath) error {
+	b.lock.Lock()
+	d, ok := b.devices[device]
+	delete(b.devices, device)
+	b.lock.Unlock()
+	if !ok {
+		return errDoesNotExist
+	}
+
+	b.DisconnectProfile(device, "")
+	b.conn.Export(nil, device, bluez.DeviceInterface)
+	b.conn.Export(nil, device, bluez.PropertiesInterface)
+	b.interfacesRemoved(d.path, bluez.DeviceInterface)
+	return nil
+}
+
+func (d *Device) Path() dbus.ObjectPath {
+	return d.path
+}
+
+// Set changes a property as bluez would, PropertiesChanged included
+func (d *Device) Set(name string, value interface{}) {
+	d.props.SetMust(bluez.DeviceInterface, name, value)
+}
+
+func (d *Device) Get(name string) interface{} {
+	return d.props.GetMust(bluez.DeviceInterface, name)
+}
+
+func (d *Device) addRemote(p Profile, fd int) {
+	d.lock.Lock()
+	d.remotes = append(d.remotes, remote{profile: p, fd: fd})
+	d.lock.Unlock()
+}
+
+// takeRemotes removes the connections of uuid, empty uuid takes all
+func (d *Device) takeRemotes(uuid string) []remote {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	var taken, kept []remote
+	for _, r := range d.remotes {
+		if uuid == "" || r.profile.UUID == bluez.NormalizeUUID(uuid) {
+			taken = append(taken, r)
+		} else {
+			kept = append(kept, r)
+		}
+	}
+	d.remotes = kept
+	return taken
+}
+
+func (d *Device) Connect() *dbus.Error {
+	d.Set("Connected", true)
+	return nil
+}
+
+func (d *Device) Disconnect() *dbus.Error {
+	d.b.DisconnectProfile(d.path, "")
+	d.Set("Connected", false)
+	return nil
+}
+
+func (d *Device) ConnectProfile(uuid string) *dbus.Error {
+	// the remote ends stay with the device until it disconnects
+	if _, err := d.b.ConnectProfile(d.path, uuid); err != nil {
+		if derr, ok := err.(*dbus.Error); ok {
+			return derr
+		}
+		return dbus.MakeFailedError(err)
+	}
+	return nil
+}
+
+func (d *Device) DisconnectProfile(uuid string) *dbus.Error {
+	if err := d.b.DisconnectProfile(d.path, uuid); err != nil {
+		return errDoesNotExist
+	}
+	return nil
+}
+
+// Pair asks the default agent to confirm passkey 0 when there is one
+func (d *Device) Pair() *dbus.Error {
+	if call, ok := d.b.CallAgent("RequestConfirmation", d.path, uint32(0)); ok && call.Err != nil {
+		if derr, ok := call.Err.(dbus.Error); ok {
+			return &derr
+		}
+		return dbus.MakeFailedError(call.Err)
+	}
+	d.Set("Paired", true)
+	d.Set("Bonded", true)
+	return nil
+}
+
+func (d *Device) CancelPairing() *dbus.Error {
+	if _, ok := d.b.CallAgent("Cancel"); !ok {
+		return errDoesNotExist
+	}
+	return nil
+}
+
+// closeRemotes used when the mock goes away
+func (d *Device) closeRemotes() {
+	for _, r := range d.takeRemotes("") {
+		unix.Close(r.fd)
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"strings"
+	"vitrhid/hid"
+)
+
+const hidImport = "vitrhid/hid"
+
+// member one struct field, Count is the length of array fields
+type member struct {
+	Name    string
+	Type    string
+	Comment string
+	Bool    bool
+	Signed  bool
+	Offset  int
+	Size    int
+	Count   int
+}
+
+func intType(size int, signed bool) string {
+	bits := 8
+	switch {
+	case size > 16:
+		bits = 32
+	case size > 8:
+		bits = 16
+	}
+	if signed {
+		return fmt.Sprintf("int%d", bits)
+	}
+	return fmt.Sprintf("uint%d", bits)
+}
+
+func members(r *hid.Report) []member {
+	var list []member
+	used := make(map[string]int)
+	unique := func(name string) string {
+		used[name]++
+		if n := used[name]; n > 1 {
+			return fmt.Sprintf("%s%d", name, n)
+		}
+		return name
+	}
+
+	for _, f := range r.Fields {
+		if f.Constant() {
+			continue
+		}
+		if !f.Variable() {
+			page := uint16(f.UsageMinimum >> 16)
+			name := hid.PageName(page) + "Usages"
+			if page == hid.PageKeyboard {
+				name = "Keys"
+			}
+			list = append(list, member{
+				Name:    unique(name),
+				Type:    fmt.Sprintf("[%d]%s", f.Count, intType(f.Size, f.Signed())),
+				Comment: fmt.Sprintf("%s usages %#02x..%#02x", hid.PageName(page), uint16(f.UsageMinimum), uint16(f.UsageMaximum)),
+				Signed:  f.Signed(),
+				Offset:  f.BitOffset,
+				Size:    f.Size,
+				Count:   f.Count,
+			})
+			continue
+		}
+		for n := 0; n < f.Count; n++ {
+			m := member{
+				Name:   unique(hid.UsageName(f.Usage(n))),
+				Signed: f.Signed(),
+				Offset: f.BitOffset + n*f.Size,
+				Size:   f.Size,
+			}
+			if f.Size == 1 {
+				m.Type, m.Bool = "bool", true
+			} else {
+				m.Type = intType(f.Size, f.Signed())
+				m.Comment = fmt.Sprintf("%d..%d", f.LogicalMin, f.LogicalMax)
+			}
+			list = append(list, m)
+		}
+	}
+	return list
+}
+
+func title(k hid.ReportKind) string {
+	s := k.String()
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+func generate(desc *hid.Descriptor, pkg, name, args string) ([]byte, error) {
+	ids := make(map[byte]bool)
+	var order []byte
+	for _, r := range desc.Reports {
+		if !ids[r.ID] {
+			order = append(order, r.ID)
+		}
+		ids[r.ID] = true
+	}
+	idName := func(id byte) string {
+		if len(ids) > 1 {
+			return fmt.Sprintf("%sReportID%d", name, id)
+		}
+		return name + "ReportID"
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// Code generated by hidgen %s; DO NOT EDIT.\n\npackage %s\n\nimport %q\n", args, pkg, hidImport)
+
+	for _, id := range order {
+		if id != 0 {
+			fmt.Fprintf(&b, "\n// %s report id of the %s reports\nconst %s = %d\n", idName(id), name, idName(id), id)
+		}
+	}
+
+	for _, r := range desc.Reports {
+		typ := name + title(r.Kind) + "Report"
+		if len(ids) > 1 {
+			typ = fmt.Sprintf("%s%d", typ, r.ID)
+		}
+		list := members(r)
+
+		fmt.Fprintf(&b, "\n// %sSize bytes of %s without report id\nconst %sSize = %d\n", typ, typ, typ, r.Size())
+
+		fmt.Fprintf(&b, "\n// %s %s report %d\ntype %s struct {\n", typ, r.Kind, r.ID, typ)
+		for _, m := range list {
+			if m.Comment != "" {
+				fmt.Fprintf(&b, "\t%s %s // %s\n", m.Name, m.Type, m.Comment)
+			} else {
+				fmt.Fprintf(&b, "\t%s %s\n", m.Name, m.Type)
+			}
+		}
+		fmt.Fprintf(&b, "}\n")
+
+		id := "0"
+		if r.ID != 0 {
+			id = idName(r.ID)
+		}
+		fmt.Fprintf(&b, "\nfunc (r *%s) ReportID() byte {\n\treturn %s\n}\n", typ, id)
+
+		fmt.Fprintf(&b, `
+// AppendBinary appends the report without report id, it does not allocate
+// when b has %[1]sSize bytes to spare
+func (r *%[1]s) AppendBinary(b []byte) ([]byte, error) {
+	n := len(b)
+	b = append(b, make([]byte, %[1]sSize)...)
+	d := b[n:]
+`, typ)
+		for _, m := range list {
+			switch {
+			case m.Count > 0:
+				fmt.Fprintf(&b, "\tfor i, v := range r.%s {\n\t\thid.PutBits(d, %d+i*%d, %d, uint32(v))\n\t}\n", m.Name, m.Offset, m.Size, m.Size)
+			case m.Bool:
+				fmt.Fprintf(&b, "\tif r.%s {\n\t\td[%d] |= %#02x\n\t}\n", m.Name, m.Offset/8, 1<<uint(m.Offset%8))
+			default:
+				fmt.Fprintf(&b, "\thid.PutBits(d, %d, %d, uint32(r.%s))\n", m.Offset, m.Size, m.Name)
+			}
+		}
+		fmt.Fprintf(&b, "\treturn b, nil\n}\n")
+
+		fmt.Fprintf(&b, `
+func (r *%[1]s) MarshalBinary() ([]byte, error) {
+	return r.AppendBinary(make([]byte, 0, %[1]sSize))
+}
+
+// UnmarshalBinary reads the report without report id
+func (r *%[1]s) UnmarshalBinary(d []byte) error {
+	if len(d) < %[1]sSize {
+		return hid.ErrTruncated
+	}
+`, typ)
+		for _, m := range list {
+			read := "hid.Bits"
+			if m.Signed {
+				read = "hid.SignedBits"
+			}
+			switch {
+			case m.Count > 0:
+				elem := m.Type[strings.Index(m.Type, "]")+1:]
+				fmt.Fprintf(&b, "\tfor i := range r.%s {\n\t\tr.%s[i] = %s(%s(d, %d+i*%d, %d))\n\t}\n", m.Name, m.Name, elem, read, m.Offset, m.Size, m.Size)
+			case m.Bool:
+				fmt.Fprintf(&b, "\tr.%s = d[%d]&%#02x != 0\n", m.Name, m.Offset/8, 1<<uint(m.Offset%8))
+			default:
+				fmt.Fprintf(&b, "\tr.%s = %s(%s(d, %d, %d))\n", m.Name, m.Type, read, m.Offset, m.Size)
+			}
+		}
+		fmt.Fprintf(&b, "\treturn nil\n}\n")
+	}
+
+	return format.Source(b.Bytes())
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+	"vitrhid/growcastle"
+	"vitrhid/hid"
+)
+
+// TestGrowcastle the committed reports are what go generate writes
+func TestGrowcastle(t *testing.T) {
+	tests := []struct {
+		file string
+		name string
+		args string
+		raw  []byte
+	}{
+		{"keyboard_report.go", "Keyboard", "-func KeyboardDescriptor(1)", growcastle.KeyboardDescriptor(1)},
+		{"touchscreen_report.go", "TouchScreen", "-func TouchScreenDescriptor()", growcastle.TouchScreenDescriptor()},
+		{"mouse_report.go", "Mouse", "-func MouseDescriptor()", growcastle.MouseDescriptor()},
+	}
+	for _, tt := range tests {
+		desc, err := hid.Parse(tt.raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		src, err := generate(desc, "growcastle", tt.name, tt.args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		committed, err := ioutil.ReadFile("../../growcastle/" + tt.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(src, committed) {
+			t.Errorf("%s is not what hidgen writes, run go generate ./growcastle", tt.file)
+		}
+	}
+}
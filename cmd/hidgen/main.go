@@ -0,0 +1,164 @@
+// hidgen writes Go report structs for a HID report descriptor, run it from
+// go generate:
+//
+//	//go:generate go run vitrhid/cmd/hidgen -func MouseDescriptor()
+//	//go:generate go run vitrhid/cmd/hidgen -hex gamepad.hex -name Gamepad
+//
+// -func calls a function of the package being generated, arguments have to
+// be literals
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"vitrhid/hid"
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: hidgen (-hex file | -func Function(args)) [-name Name] [-pkg package] [-o file]\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	hexFile := flag.String("hex", "", "descriptor as hex, # and // comments, commas and 0x are skipped")
+	function := flag.String("func", "", "builder function of the package returning the descriptor")
+	name := flag.String("name", "", "prefix of the generated names, defaults to the function name without Descriptor")
+	pkg := flag.String("pkg", os.Getenv("GOPACKAGE"), "package of the generated file")
+	out := flag.String("o", "", "output file, defaults to name_report.go")
+	flag.Usage = usage
+	flag.Parse()
+
+	if (*hexFile == "") == (*function == "") || *pkg == "" {
+		usage()
+		os.Exit(2)
+	}
+
+	var raw []byte
+	var err error
+	if *hexFile != "" {
+		raw, err = readHex(*hexFile)
+		if *name == "" {
+			*name = exported(strings.TrimSuffix(filepath.Base(*hexFile), filepath.Ext(*hexFile)))
+		}
+	} else {
+		raw, err = runBuilder(*function)
+		if *name == "" {
+			*name = strings.TrimSuffix(strings.SplitN(*function, "(", 2)[0], "Descriptor")
+		}
+	}
+	if err != nil {
+		fatal(err)
+	}
+
+	if err := hid.Check(raw); err != nil {
+		fatal(err)
+	}
+	desc, err := hid.Parse(raw)
+	if err != nil {
+		fatal(err)
+	}
+
+	src, err := generate(desc, *pkg, *name, strings.Join(os.Args[1:], " "))
+	if err != nil {
+		fatal(err)
+	}
+
+	if *out == "" {
+		*out = strings.ToLower(*name) + "_report.go"
+	}
+	if err := ioutil.WriteFile(*out, src, 0644); err != nil {
+		fatal(err)
+	}
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "hidgen:", err)
+	os.Exit(1)
+}
+
+func exported(s string) string {
+	var b strings.Builder
+	upper := true
+	for _, r := range s {
+		if r == '_' || r == '-' || r == '.' || r == ' ' {
+			upper = true
+			continue
+		}
+		if upper {
+			r = []rune(strings.ToUpper(string(r)))[0]
+			upper = false
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func readHex(name string) ([]byte, error) {
+	content, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var digits strings.Builder
+	for _, line := range strings.Split(string(content), "\n") {
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+		for _, field := range strings.FieldsFunc(line, func(r rune) bool {
+			return r == ',' || r == ' ' || r == '\t' || r == '\r'
+		}) {
+			digits.WriteString(strings.TrimPrefix(strings.TrimPrefix(field, "0x"), "0X"))
+		}
+	}
+	return hex.DecodeString(digits.String())
+}
+
+// runBuilder builds a throwaway program that prints the descriptor of
+// function, it runs in the package directory so the module resolves
+func runBuilder(function string) ([]byte, error) {
+	path, err := exec.Command("go", "list", "-f", "{{.ImportPath}}", ".").Output()
+	if err != nil {
+		return nil, fmt.Errorf("go list: %w", err)
+	}
+
+	dir, err := ioutil.TempDir("", "hidgen")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	program := fmt.Sprintf(`package main
+
+import (
+	"os"
+
+	pkg %q
+)
+
+func main() {
+	os.Stdout.Write(pkg.%s)
+}
+`, strings.TrimSpace(string(path)), function)
+
+	file := filepath.Join(dir, "main.go")
+	if err := ioutil.WriteFile(file, []byte(program), 0644); err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command("go", "run", file)
+	cmd.Stderr = os.Stderr
+	raw, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("running %s: %w", function, err)
+	}
+	return raw, nil
+}
@@ -0,0 +1,567 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"vitrhid/mgmt"
+)
+
+var errUsage = errors.New("invalid arguments")
+
+func onOff(args []string) (byte, error) {
+	if len(args) < 1 {
+		return 0, errUsage
+	}
+	switch args[0] {
+	case "on", "yes", "1":
+		return mgmt.On, nil
+	case "off", "no", "0":
+		return mgmt.Off, nil
+	}
+	return 0, errUsage
+}
+
+func parseUint(s string, bits int) (uint64, error) {
+	return strconv.ParseUint(s, 0, bits)
+}
+
+func addressType(s string) (byte, error) {
+	switch s {
+	case "bredr":
+		return mgmt.AddressBREDR, nil
+	case "public", "le-public":
+		return mgmt.AddressLEPublic, nil
+	case "random", "le-random":
+		return mgmt.AddressLERandom, nil
+	}
+	return 0, errors.New("unknown address type " + s)
+}
+
+func addressTypeString(t byte) string {
+	switch t {
+	case mgmt.AddressBREDR:
+		return "BR/EDR"
+	case mgmt.AddressLEPublic:
+		return "LE Public"
+	case mgmt.AddressLERandom:
+		return "LE Random"
+	}
+	return fmt.Sprintf("type %d", t)
+}
+
+func cstring(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(b)
+}
+
+func printSettings(prefix string, settings uint32) {
+	fmt.Printf("%s %s\n", prefix, strings.Join(mgmt.SettingNames(settings), " "))
+}
+
+// addressFlags parse [-t type] <address> with extra flags defined by setup
+func addressFlags(name string, args []string, setup func(fs *flag.FlagSet)) ([6]byte, byte, error) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	t := fs.String("t", "bredr", "address type bredr, le-public or le-random")
+	if setup != nil {
+		setup(fs)
+	}
+	if err := fs.Parse(args); err != nil {
+		return [6]byte{}, 0, err
+	}
+	if fs.NArg() != 1 {
+		return [6]byte{}, 0, errUsage
+	}
+	addr, err := mgmt.ParseAddress(fs.Arg(0))
+	if err != nil {
+		return addr, 0, err
+	}
+	at, err := addressType(*t)
+	return addr, at, err
+}
+
+func printAddress(prefix string, info *mgmt.AddressInfo) {
+	fmt.Printf("%s %s (%s)\n", prefix, mgmt.AddressString(info.Address), addressTypeString(info.AddressType))
+}
+
+func cmdInfo(ll *mgmt.BluetoothLowLevel, index uint16, args []string) error {
+	version, err := ll.ReadManagementVersionInformation()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("mgmt version %d.%d\n", version.Version, version.Revision)
+
+	list, err := ll.ReadControllerIndexList()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%d controllers\n", len(list.Controllers))
+	for _, i := range list.Controllers {
+		info, err := ll.ReadControllerInformation(i)
+		if err != nil {
+			fmt.Printf("hci%d: %s\n", i, err)
+			continue
+		}
+		fmt.Printf("hci%d:\taddr %s version %d manufacturer %d class 0x%02x%02x%02x\n",
+			i, mgmt.AddressString(info.Address), info.BluetoothVersion, info.Manufacturer,
+			info.ClassOfDevice[2], info.ClassOfDevice[1], info.ClassOfDevice[0])
+		printSettings("\tsupported settings:", info.SupportedSettings)
+		printSettings("\tcurrent settings:", info.CurrentSettings)
+		fmt.Printf("\tname %s\n\tshort name %s\n", cstring(info.Name[:]), cstring(info.ShortName[:]))
+	}
+
+	unconfigured, err := ll.ReadUnconfiguredControllerIndexList()
+	if err != nil {
+		return err
+	}
+	for _, i := range unconfigured.Controllers {
+		info, err := ll.ReadControllerConfigurationInformation(i)
+		if err != nil {
+			fmt.Printf("hci%d: unconfigured %s\n", i, err)
+			continue
+		}
+		fmt.Printf("hci%d:\tunconfigured manufacturer %d supported options %#x missing options %#x\n",
+			i, info.Manufacturer, info.SupportedOptions, info.MissingOptions)
+	}
+	return nil
+}
+
+func settingCommand(set func(index uint16, v byte) (uint32, error), index uint16, args []string) error {
+	v, err := onOff(args)
+	if err != nil {
+		return err
+	}
+	settings, err := set(index, v)
+	if err != nil {
+		return err
+	}
+	printSettings(fmt.Sprintf("hci%d settings:", index), settings)
+	return nil
+}
+
+func cmdPower(ll *mgmt.BluetoothLowLevel, index uint16, args []string) error {
+	return settingCommand(ll.SetPowered, index, args)
+}
+
+func cmdConnectable(ll *mgmt.BluetoothLowLevel, index uint16, args []string) error {
+	return settingCommand(ll.SetConnectable, index, args)
+}
+
+func cmdDiscoverable(ll *mgmt.BluetoothLowLevel, index uint16, args []string) error {
+	if len(args) < 1 {
+		return errUsage
+	}
+	var v byte
+	if args[0] == "limited" {
+		v = mgmt.DiscoverableLimit
+	} else {
+		var err error
+		if v, err = onOff(args); err != nil {
+			return err
+		}
+	}
+	timeout := uint64(0)
+	if len(args) > 1 {
+		var err error
+		if timeout, err = parseUint(args[1], 16); err != nil {
+			return err
+		}
+	}
+	settings, err := ll.SetDiscoverable(index, v, uint16(timeout))
+	if err != nil {
+		return err
+	}
+	printSettings(fmt.Sprintf("hci%d settings:", index), settings)
+	return nil
+}
+
+func cmdName(ll *mgmt.BluetoothLowLevel, index uint16, args []string) error {
+	if len(args) < 1 {
+		return errUsage
+	}
+	short := ""
+	if len(args) > 1 {
+		short = args[1]
+	}
+	if err := ll.SetLocalName(index, args[0], short); err != nil {
+		return err
+	}
+	fmt.Printf("hci%d name %s short name %s\n", index, args[0], short)
+	return nil
+}
+
+func cmdClass(ll *mgmt.BluetoothLowLevel, index uint16, args []string) error {
+	if len(args) != 2 {
+		return errUsage
+	}
+	major, err := parseUint(args[0], 8)
+	if err != nil {
+		return err
+	}
+	minor, err := parseUint(args[1], 8)
+	if err != nil {
+		return err
+	}
+	class, err := ll.SetDeviceClass(index, byte(major), byte(minor))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("hci%d class 0x%02x%02x%02x\n", index, class[2], class[1], class[0])
+	return nil
+}
+
+func cmdAppearance(ll *mgmt.BluetoothLowLevel, index uint16, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	v, err := parseUint(args[0], 16)
+	if err != nil {
+		return err
+	}
+	if err := ll.SetAppearance(index, uint16(v)); err != nil {
+		return err
+	}
+	fmt.Printf("hci%d appearance %#04x\n", index, v)
+	return nil
+}
+
+func cmdDeviceID(ll *mgmt.BluetoothLowLevel, index uint16, args []string) error {
+	if len(args) < 1 {
+		return errUsage
+	}
+	id := mgmt.DeviceID{}
+	switch args[0] {
+	case "usb":
+		id.Source = mgmt.DeviceIDSourceUSB
+	case "bluetooth":
+		id.Source = mgmt.DeviceIDSourceBluetooth
+	case "off":
+		id.Source = mgmt.DeviceIDSourceDisabled
+	default:
+		return errUsage
+	}
+	fields := []*uint16{&id.Vendor, &id.Product, &id.Version}
+	for i := 1; i < len(args) && i <= len(fields); i++ {
+		v, err := parseUint(args[i], 16)
+		if err != nil {
+			return err
+		}
+		*fields[i-1] = uint16(v)
+	}
+	if err := ll.SetDeviceID(index, id); err != nil {
+		return err
+	}
+	fmt.Printf("hci%d device id source %d vendor %#04x product %#04x version %#04x\n",
+		index, id.Source, id.Vendor, id.Product, id.Version)
+	return nil
+}
+
+func cmdPair(ll *mgmt.BluetoothLowLevel, index uint16, args []string) error {
+	var capability *uint
+	addr, at, err := addressFlags("pair", args, func(fs *flag.FlagSet) {
+		capability = fs.Uint("c", uint(mgmt.IOCapabilityNoInputNoOutput), "io capability 0-4")
+	})
+	if err != nil {
+		return err
+	}
+
+	// confirm numeric comparison on the terminal
+	cancel := ll.On(mgmt.EvUserConfirmationRequest, func(ev *mgmt.Event) {
+		req, ok := ev.Payload.(*mgmt.UserConfirmationRequest)
+		if !ok || ev.Controller != index {
+			return
+		}
+		fmt.Printf("confirm passkey %06d for %s (yes/no): ", req.Value, mgmt.AddressString(req.Address))
+		go func() {
+			var answer string
+			fmt.Scanln(&answer)
+			if answer == "yes" || answer == "y" {
+				ll.UserConfirmationReply(index, req.Address, req.AddressType)
+			} else {
+				ll.UserConfirmationNegativeReply(index, req.Address, req.AddressType)
+			}
+		}()
+	})
+	defer cancel()
+
+	info, err := ll.PairDevice(index, addr, at, byte(*capability))
+	if err != nil {
+		return err
+	}
+	printAddress("paired with", info)
+	return nil
+}
+
+func cmdUnpair(ll *mgmt.BluetoothLowLevel, index uint16, args []string) error {
+	addr, at, err := addressFlags("unpair", args, nil)
+	if err != nil {
+		return err
+	}
+	info, err := ll.UnpairDevice(index, addr, at, mgmt.On)
+	if err != nil {
+		return err
+	}
+	printAddress("unpaired", info)
+	return nil
+}
+
+func cmdBlock(ll *mgmt.BluetoothLowLevel, index uint16, args []string) error {
+	var unblock *bool
+	addr, at, err := addressFlags("block", args, func(fs *flag.FlagSet) {
+		unblock = fs.Bool("u", false, "unblock")
+	})
+	if err != nil {
+		return err
+	}
+	if *unblock {
+		info, err := ll.UnblockDevice(index, addr, at)
+		if err != nil {
+			return err
+		}
+		printAddress("unblocked", info)
+		return nil
+	}
+	info, err := ll.BlockDevice(index, addr, at)
+	if err != nil {
+		return err
+	}
+	printAddress("blocked", info)
+	return nil
+}
+
+func cmdConnections(ll *mgmt.BluetoothLowLevel, index uint16, args []string) error {
+	conns, err := ll.GetConnections(index)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("hci%d %d connections\n", index, len(conns))
+	for i := 0; i < len(conns); i++ {
+		printAddress("\t", &conns[i])
+	}
+	return nil
+}
+
+func cmdDisconnect(ll *mgmt.BluetoothLowLevel, index uint16, args []string) error {
+	addr, at, err := addressFlags("disconnect", args, nil)
+	if err != nil {
+		return err
+	}
+	info, err := ll.Disconnect(index, addr, at)
+	if err != nil {
+		return err
+	}
+	printAddress("disconnected", info)
+	return nil
+}
+
+func cmdKeys(ll *mgmt.BluetoothLowLevel, index uint16, args []string) error {
+	if len(args) < 1 {
+		return errUsage
+	}
+	switch args[0] {
+	case "clear":
+		if err := ll.LoadLinkKeys(index, mgmt.Off, nil); err != nil {
+			return err
+		}
+		fmt.Printf("hci%d link keys cleared\n", index)
+		return nil
+	case "load":
+		// the kernel can not list its keys, so there is nothing to merge with
+		fs := flag.NewFlagSet("keys load", flag.ContinueOnError)
+		replace := fs.Bool("replace", false, "replace every link key of the controller")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		args = fs.Args()
+		if len(args) < 2 {
+			return errUsage
+		}
+		if !*replace {
+			return errors.New("load replaces every link key of the controller and drops the bonds of bluetoothd, pass -replace")
+		}
+		addr, err := mgmt.ParseAddress(args[0])
+		if err != nil {
+			return err
+		}
+		value, err := hex.DecodeString(args[1])
+		if err != nil || len(value) != 16 {
+			return errors.New("link key must be 16 hex bytes")
+		}
+		key := mgmt.LinkKey{Address: addr, AddressType: mgmt.AddressBREDR, KeyType: 0x04}
+		copy(key.Value[:], value)
+		if len(args) > 2 {
+			t, err := parseUint(args[2], 8)
+			if err != nil {
+				return err
+			}
+			key.KeyType = byte(t)
+		}
+		fmt.Fprintf(os.Stderr, "warning: every other link key of hci%d is gone, bluetoothd restores its bonds on restart\n", index)
+		if err := ll.LoadLinkKeys(index, mgmt.Off, []mgmt.LinkKey{key}); err != nil {
+			return err
+		}
+		fmt.Printf("hci%d link key loaded for %s\n", index, args[0])
+		return nil
+	}
+	return errUsage
+}
+
+func cmdAdvertising(ll *mgmt.BluetoothLowLevel, index uint16, args []string) error {
+	if len(args) < 1 {
+		return errUsage
+	}
+	switch args[0] {
+	case "features":
+		features, err := ll.ReadAdvertisingFeatures(index)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("supported flags %#x\nmax adv data %d\nmax scan rsp %d\nmax instances %d\ninstances %v\n",
+			features.SupportedFlags, features.MaxAdvDataLen, features.MaxScanRspLen,
+			features.MaxInstances, features.Instances)
+		return nil
+	case "add":
+		fs := flag.NewFlagSet("adv add", flag.ContinueOnError)
+		connectable := fs.Bool("c", false, "connectable")
+		discoverable := fs.Bool("d", false, "general discoverable")
+		name := fs.Bool("n", false, "include local name")
+		appearance := fs.Bool("a", false, "include appearance")
+		instance := fs.Uint("i", 1, "instance")
+		timeout := fs.Uint("t", 0, "timeout in seconds")
+		duration := fs.Uint("D", 0, "duration in seconds")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		adv := mgmt.Advertising{
+			Instance: byte(*instance),
+			Timeout:  uint16(*timeout),
+			Duration: uint16(*duration),
+		}
+		if *connectable {
+			adv.Flags |= mgmt.AdvertisingFlagConnectable
+		}
+		if *discoverable {
+			adv.Flags |= mgmt.AdvertisingFlagDiscoverable
+		}
+		if *name {
+			adv.Flags |= mgmt.AdvertisingFlagLocalName
+		}
+		if *appearance {
+			adv.Flags |= mgmt.AdvertisingFlagAppearance
+		}
+		var err error
+		if fs.NArg() > 0 {
+			if adv.AdvData, err = hex.DecodeString(fs.Arg(0)); err != nil {
+				return err
+			}
+		}
+		if fs.NArg() > 1 {
+			if adv.ScanRsp, err = hex.DecodeString(fs.Arg(1)); err != nil {
+				return err
+			}
+		}
+		i, err := ll.AddAdvertising(index, adv)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("advertising instance %d added\n", i)
+		return nil
+	case "remove":
+		if len(args) != 2 {
+			return errUsage
+		}
+		v, err := parseUint(args[1], 8)
+		if err != nil {
+			return err
+		}
+		i, err := ll.RemoveAdvertising(index, byte(v))
+		if err != nil {
+			return err
+		}
+		fmt.Printf("advertising instance %d removed\n", i)
+		return nil
+	}
+	return errUsage
+}
+
+func cmdMonitor(ll *mgmt.BluetoothLowLevel, index uint16, args []string) error {
+	if len(args) == 0 {
+		return watchEvents(ll)
+	}
+	switch args[0] {
+	case "features":
+		features, err := ll.ReadAdvertisementMonitorFeatures(index)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("supported features %#x\nenabled features %#x\nmax handles %d\nmax patterns %d\nhandles %v\n",
+			features.SupportedFeatures, features.EnabledFeatures, features.MaxNumHandles,
+			features.MaxNumPatterns, features.Handles)
+		return nil
+	case "add":
+		fs := flag.NewFlagSet("monitor add", flag.ContinueOnError)
+		rssi := fs.Int("r", 0, "rssi threshold in dBm")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		if fs.NArg() != 1 {
+			return errUsage
+		}
+		patterns, err := mgmt.ParseAdvertisementPatterns(fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		var handle uint16
+		if *rssi != 0 {
+			handle, err = ll.AddAdvertisementPatternsMonitorWithRSSIThreshold(index, mgmt.AdvertisementMonitorRSSI{
+				HighThreshold:        int8(*rssi),
+				HighThresholdTimeout: 1,
+				LowThreshold:         int8(*rssi - 10),
+				LowThresholdTimeout:  5,
+			}, patterns)
+		} else {
+			handle, err = ll.AddAdvertisementPatternsMonitor(index, patterns)
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Printf("advertisement monitor %d added\n", handle)
+		return watchEvents(ll)
+	case "remove":
+		if len(args) != 2 {
+			return errUsage
+		}
+		v, err := parseUint(args[1], 16)
+		if err != nil {
+			return err
+		}
+		handle, err := ll.RemoveAdvertisementMonitor(index, uint16(v))
+		if err != nil {
+			return err
+		}
+		fmt.Printf("advertisement monitor %d removed\n", handle)
+		return nil
+	}
+	return errUsage
+}
+
+// watchEvents prints every event until interrupted
+func watchEvents(ll *mgmt.BluetoothLowLevel) error {
+	cancel := ll.On(mgmt.AnyEvent, func(ev *mgmt.Event) {
+		fmt.Printf("hci%d %s\n", ev.Controller, describeEvent(ev))
+	})
+	defer cancel()
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	<-sig
+	return nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"vitrhid/mgmt"
+)
+
+var eventNames = map[uint16]string{
+	mgmt.EvControllerError:                 "controller error",
+	mgmt.EvIndexAdded:                      "index added",
+	mgmt.EvIndexRemoved:                    "index removed",
+	mgmt.EvNewSettings:                     "new settings",
+	mgmt.EvClassOfDeviceChanged:            "class of device changed",
+	mgmt.EvLocalNameChanged:                "local name changed",
+	mgmt.EvNewLinkKey:                      "new link key",
+	mgmt.EvNewLongTermKey:                  "new long term key",
+	mgmt.EvDeviceConnected:                 "device connected",
+	mgmt.EvDeviceDisconnected:              "device disconnected",
+	mgmt.EvConnectFailed:                   "connect failed",
+	mgmt.EvPINCodeRequest:                  "pin code request",
+	mgmt.EvUserConfirmationRequest:         "user confirmation request",
+	mgmt.EvUserPasskeyRequest:              "user passkey request",
+	mgmt.EvAuthenticationFailed:            "authentication failed",
+	mgmt.EvDeviceFound:                     "device found",
+	mgmt.EvDiscovering:                     "discovering",
+	mgmt.EvDeviceBlocked:                   "device blocked",
+	mgmt.EvDeviceUnblocked:                 "device unblocked",
+	mgmt.EvDeviceUnpaired:                  "device unpaired",
+	mgmt.EvPasskeyNotify:                   "passkey notify",
+	mgmt.EvUnconfiguredIndexAdded:          "unconfigured index added",
+	mgmt.EvUnconfiguredIndexRemoved:        "unconfigured index removed",
+	mgmt.EvNewConfigurationOptions:         "new configuration options",
+	mgmt.EvAdvertisingAdded:                "advertising added",
+	mgmt.EvAdvertisingRemoved:              "advertising removed",
+	mgmt.EvAdvertisementMonitorAdded:       "advertisement monitor added",
+	mgmt.EvAdvertisementMonitorRemoved:     "advertisement monitor removed",
+	mgmt.EvAdvertisementMonitorDeviceFound: "advertisement monitor device found",
+	mgmt.EvAdvertisementMonitorDeviceLost:  "advertisement monitor device lost",
+	mgmt.EvControllerSuspend:               "controller suspend",
+	mgmt.EvControllerResume:                "controller resume",
+}
+
+func describeEvent(ev *mgmt.Event) string {
+	name, ok := eventNames[ev.Code]
+	if !ok {
+		name = fmt.Sprintf("event %#04x", ev.Code)
+	}
+
+	switch p := ev.Payload.(type) {
+	case nil:
+		if len(ev.Data) == 0 {
+			return name
+		}
+		return name + " " + hex.EncodeToString(ev.Data)
+	case uint32:
+		if ev.Code == mgmt.EvNewSettings {
+			return name + " " + strings.Join(mgmt.SettingNames(p), " ")
+		}
+		return fmt.Sprintf("%s %#x", name, p)
+	case []byte:
+		return fmt.Sprintf("%s %x", name, p)
+	case *mgmt.LocalName:
+		return fmt.Sprintf("%s %s (%s)", name, cstring(p.Name[:]), cstring(p.ShortName[:]))
+	case *mgmt.AddressInfo:
+		return fmt.Sprintf("%s %s (%s)", name, mgmt.AddressString(p.Address), addressTypeString(p.AddressType))
+	case *mgmt.AddressStatus:
+		return fmt.Sprintf("%s %s (%s) status %#02x", name, mgmt.AddressString(p.Address), addressTypeString(p.AddressType), p.Status)
+	case *mgmt.DeviceConnected:
+		return fmt.Sprintf("%s %s (%s) flags %#x", name, mgmt.AddressString(p.Address), addressTypeString(p.AddressType), p.Flags)
+	case *mgmt.DeviceDisconnected:
+		return fmt.Sprintf("%s %s (%s) reason %d", name, mgmt.AddressString(p.Address), addressTypeString(p.AddressType), p.Reason)
+	case *mgmt.NewLinkKey:
+		return fmt.Sprintf("%s %s type %d store %d", name, mgmt.AddressString(p.Key.Address), p.Key.KeyType, p.StoreHint)
+	case *mgmt.UserConfirmationRequest:
+		return fmt.Sprintf("%s %s passkey %06d hint %d", name, mgmt.AddressString(p.Address), p.Value, p.ConfirmHint)
+	case *mgmt.PasskeyNotify:
+		return fmt.Sprintf("%s %s passkey %06d entered %d", name, mgmt.AddressString(p.Address), p.Passkey, p.Entered)
+	case *mgmt.DeviceFound:
+		return fmt.Sprintf("%s %s (%s) rssi %d flags %#x eir %x", name, mgmt.AddressString(p.Address), addressTypeString(p.AddressType), p.RSSI, p.Flags, p.EIR)
+	case *mgmt.Discovering:
+		return fmt.Sprintf("%s type %d %d", name, p.AddressType, p.Discovering)
+	case *mgmt.ConfigurationOptions:
+		return fmt.Sprintf("%s missing %#x", name, p.MissingOptions)
+	case *mgmt.AdvertisementMonitorHandle:
+		return fmt.Sprintf("%s handle %d", name, p.Handle)
+	case *mgmt.AdvertisementMonitorDeviceFound:
+		return fmt.Sprintf("%s handle %d %s (%s) rssi %d", name, p.Handle, mgmt.AddressString(p.Address), addressTypeString(p.AddressType), p.RSSI)
+	case *mgmt.AdvertisementMonitorDeviceLost:
+		return fmt.Sprintf("%s handle %d %s (%s)", name, p.Handle, mgmt.AddressString(p.Address), addressTypeString(p.AddressType))
+	}
+	return fmt.Sprintf("%s %+v", name, ev.Payload)
+}
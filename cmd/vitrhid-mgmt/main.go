@@ -0,0 +1,79 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"vitrhid/mgmt"
+)
+
+type command struct {
+	usage string
+	run   func(ll *mgmt.BluetoothLowLevel, index uint16, args []string) error
+}
+
+var commands = map[string]command{
+	"info":         {"", cmdInfo},
+	"power":        {"<on/off>", cmdPower},
+	"connectable":  {"<on/off>", cmdConnectable},
+	"discoverable": {"<on/off/limited> [timeout]", cmdDiscoverable},
+	"name":         {"<name> [shortname]", cmdName},
+	"class":        {"<major> <minor>", cmdClass},
+	"appearance":   {"<appearance>", cmdAppearance},
+	"devid":        {"<usb/bluetooth/off> [vendor] [product] [version]", cmdDeviceID},
+	"pair":         {"[-c capability] [-t type] <address>", cmdPair},
+	"unpair":       {"[-t type] <address>", cmdUnpair},
+	"block":        {"[-u] [-t type] <address>", cmdBlock},
+	"con":          {"", cmdConnections},
+	"disconnect":   {"[-t type] <address>", cmdDisconnect},
+	"keys":         {"clear | load -replace <address> <hexkey> [keytype]", cmdKeys},
+	"adv":          {"features | add [-c] [-d] [-n] [-a] [-i instance] [-t timeout] [-D duration] <advhex> [scanrsphex] | remove <instance>", cmdAdvertising},
+	"monitor":      {"[features | add [-r rssi] <type:offset:hex,...> | remove <handle>]", cmdMonitor},
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: vitrhid-mgmt [-i index] <command> [args]\n\ncommands:\n")
+	var names []string
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-13s %s\n", name, commands[name].usage)
+	}
+}
+
+func main() {
+	index := flag.Uint("i", 0, "controller index")
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+	if *index > 0xffff {
+		fmt.Fprintf(os.Stderr, "invalid controller index %d\n", *index)
+		os.Exit(2)
+	}
+
+	cmd, ok := commands[flag.Arg(0)]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %s\n", flag.Arg(0))
+		usage()
+		os.Exit(2)
+	}
+
+	ll := mgmt.NewBluetoothLowLevel()
+	if err := ll.Connect(); err != nil {
+		fmt.Fprintf(os.Stderr, "mgmt: %s\n", err)
+		os.Exit(1)
+	}
+	defer ll.Close()
+
+	if err := cmd.run(ll, uint16(*index), flag.Args()[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", flag.Arg(0), err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,428 @@
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"syscall"
+	"vitrhid/bluez"
+	"vitrhid/growcastle"
+	"vitrhid/mgmt"
+
+	"github.com/godbus/dbus"
+	"github.com/godbus/dbus/introspect"
+	"golang.org/x/sys/unix"
+)
+
+type checkStatus int
+
+const (
+	checkOK checkStatus = iota
+	checkWarn
+	checkFail
+)
+
+func (s checkStatus) String() string {
+	switch s {
+	case checkWarn:
+		return "warn"
+	case checkFail:
+		return "fail"
+	}
+	return "ok"
+}
+
+// doctor runs the preflight checks behind `vitrhid doctor`, every problem
+// comes with the fix for it
+type doctor struct {
+	failed  bool
+	ll      *mgmt.BluetoothLowLevel
+	index   int
+	conn    *bluez.Conn
+	adapter map[string]map[string]dbus.Variant
+}
+
+func (d *doctor) report(status checkStatus, name, detail, fix string) {
+	fmt.Printf("%-4s  %s: %s\n", status, name, detail)
+	if fix != "" && status != checkOK {
+		fmt.Printf("      fix: %s\n", fix)
+	}
+	if status == checkFail {
+		d.failed = true
+	}
+}
+
+func (d *doctor) ok(name, format string, args ...interface{}) {
+	d.report(checkOK, name, fmt.Sprintf(format, args...), "")
+}
+
+func (d *doctor) warn(name, detail, fix string) {
+	d.report(checkWarn, name, detail, fix)
+}
+
+func (d *doctor) fail(name, detail, fix string) {
+	d.report(checkFail, name, detail, fix)
+}
+
+func permissionDenied(err error) bool {
+	return errors.Is(err, syscall.EPERM) || errors.Is(err, syscall.EACCES)
+}
+
+// runDoctor returns the exit status, 1 when a check failed
+func runDoctor() int {
+	d := &doctor{index: -1}
+	d.checkMgmt()
+	d.checkControllers()
+	d.checkBluetoothd()
+	d.checkBus()
+	d.checkInterfaces()
+	d.checkPSMs()
+	d.checkRecord()
+
+	if d.ll != nil {
+		d.ll.Close()
+	}
+	if d.conn != nil {
+		d.conn.Close()
+	}
+	if d.failed {
+		return 1
+	}
+	return 0
+}
+
+func (d *doctor) checkMgmt() {
+	ll := mgmt.NewBluetoothLowLevel()
+	if err := ll.Connect(); err != nil {
+		switch {
+		case permissionDenied(err):
+			d.fail("mgmt", err.Error(), "the mgmt socket needs CAP_NET_ADMIN, run as root or setcap cap_net_admin,cap_net_bind_service+ep on the binary")
+		case errors.Is(err, syscall.EAFNOSUPPORT) || errors.Is(err, syscall.EPROTONOSUPPORT):
+			d.fail("mgmt", err.Error(), "the kernel has no bluetooth support loaded, modprobe bluetooth")
+		default:
+			d.fail("mgmt", err.Error(), "check that the bluetooth subsystem is available with dmesg | grep -i bluetooth")
+		}
+		return
+	}
+	d.ll = ll
+
+	version, err := ll.ReadManagementVersionInformation()
+	if err != nil {
+		d.fail("mgmt", err.Error(), "")
+		return
+	}
+	switch {
+	case version.Version == 1 && version.Revision < 14:
+		d.fail("mgmt", fmt.Sprintf("version %d.%d", version.Version, version.Revision),
+			"set appearance needs mgmt 1.14, upgrade to a 4.13 or newer kernel")
+	case version.Version == 1 && version.Revision < 18 && *presencePatterns != "":
+		d.fail("mgmt", fmt.Sprintf("version %d.%d", version.Version, version.Revision),
+			"-presence needs advertisement monitors from mgmt 1.18, upgrade to a 5.10 or newer kernel")
+	default:
+		d.ok("mgmt", "version %d.%d", version.Version, version.Revision)
+	}
+}
+
+func (d *doctor) checkControllers() {
+	if d.ll == nil {
+		return
+	}
+	d.checkRfkill()
+
+	list, err := d.ll.ReadControllerIndexList()
+	if err != nil {
+		d.fail("controllers", err.Error(), "")
+		return
+	}
+	if unconfigured, err := d.ll.ReadUnconfiguredControllerIndexList(); err == nil && len(unconfigured.Controllers) > 0 {
+		d.warn("controllers", fmt.Sprintf("%d unconfigured", len(unconfigured.Controllers)),
+			"vitrhid configures the first one on start when no other is there, -public-address picks its address")
+	}
+	if len(list.Controllers) == 0 {
+		d.fail("controllers", "none found", "plug in a bluetooth controller and check it with lsusb and dmesg, rfkill unblock bluetooth when it is blocked")
+		return
+	}
+
+	index := list.Controllers[0]
+	if *controllerIndex >= 0 {
+		index = uint16(*controllerIndex)
+	}
+	d.index = int(index)
+	name := fmt.Sprintf("hci%d", index)
+
+	info, err := d.ll.ReadControllerInformation(index)
+	if err != nil {
+		d.fail(name, err.Error(), "pick an existing controller with -index, vitrhid-mgmt info lists them")
+		return
+	}
+	d.ok(name, "%s bluetooth version %d, %s", mgmt.AddressString(info.Address), info.BluetoothVersion,
+		strings.Join(mgmt.SettingNames(info.CurrentSettings), " "))
+
+	if info.SupportedSettings&mgmt.SettingBREDR == 0 {
+		d.fail(name, "no BR/EDR support", "classic hid hosts need a BR/EDR or dual mode controller, pick another one with -index")
+	} else if info.CurrentSettings&mgmt.SettingBREDR == 0 {
+		d.warn(name, "BR/EDR disabled", "classic hosts can not see it, btmgmt --index "+fmt.Sprint(index)+" bredr on")
+	}
+	if info.SupportedSettings&mgmt.SettingSecureSimplePairing == 0 {
+		d.warn(name, "no secure simple pairing", "phones refuse legacy pin pairing for mice, use a bluetooth 2.1 or newer controller")
+	}
+	if *hogpEnabled && info.SupportedSettings&mgmt.SettingLowEnergy == 0 {
+		d.fail(name, "no low energy support", "-hogp needs a bluetooth 4.0 controller, drop -hogp or pick another one with -index")
+	}
+}
+
+// checkRfkill a blocked radio keeps the controller from powering on
+func (d *doctor) checkRfkill() {
+	types, _ := filepath.Glob("/sys/class/rfkill/*/type")
+	for _, path := range types {
+		b, err := ioutil.ReadFile(path)
+		if err != nil || strings.TrimSpace(string(b)) != "bluetooth" {
+			continue
+		}
+		dir := filepath.Dir(path)
+		name := "rfkill " + filepath.Base(dir)
+		if hard, _ := ioutil.ReadFile(filepath.Join(dir, "hard")); strings.TrimSpace(string(hard)) == "1" {
+			d.fail(name, "hard blocked", "flip the hardware radio switch or enable bluetooth in the firmware setup")
+		} else if soft, _ := ioutil.ReadFile(filepath.Join(dir, "soft")); strings.TrimSpace(string(soft)) == "1" {
+			d.fail(name, "soft blocked", "rfkill unblock bluetooth")
+		}
+	}
+}
+
+// bluetoothdProcess finds the running daemon, pid 0 when there is none
+func bluetoothdProcess() (int, []string) {
+	dirs, _ := filepath.Glob("/proc/[0-9]*")
+	for _, dir := range dirs {
+		comm, err := ioutil.ReadFile(filepath.Join(dir, "comm"))
+		if err != nil || strings.TrimSpace(string(comm)) != "bluetoothd" {
+			continue
+		}
+		cmdline, _ := ioutil.ReadFile(filepath.Join(dir, "cmdline"))
+		var pid int
+		fmt.Sscan(filepath.Base(dir), &pid)
+		return pid, strings.Split(strings.TrimRight(string(cmdline), "\x00"), "\x00")
+	}
+	return 0, nil
+}
+
+// pluginEnabled follows the -p/--plugin and -P/--noplugin options of
+// bluetoothd, both take comma separated names
+func pluginEnabled(args []string, plugin string) bool {
+	var only, disabled []string
+	for i := 1; i < len(args); i++ {
+		arg := args[i]
+		var list *[]string
+		var value string
+		switch {
+		case arg == "-p" || arg == "--plugin" || arg == "-P" || arg == "--noplugin":
+			if i+1 < len(args) {
+				i++
+				value = args[i]
+			}
+			list = &disabled
+			if arg == "-p" || arg == "--plugin" {
+				list = &only
+			}
+		case strings.HasPrefix(arg, "--plugin="):
+			list, value = &only, strings.TrimPrefix(arg, "--plugin=")
+		case strings.HasPrefix(arg, "--noplugin="):
+			list, value = &disabled, strings.TrimPrefix(arg, "--noplugin=")
+		case strings.HasPrefix(arg, "-p"):
+			list, value = &only, arg[2:]
+		case strings.HasPrefix(arg, "-P"):
+			list, value = &disabled, arg[2:]
+		default:
+			continue
+		}
+		*list = append(*list, strings.Split(value, ",")...)
+	}
+
+	match := func(names []string) bool {
+		for _, name := range names {
+			if ok, _ := filepath.Match(name, plugin); ok {
+				return true
+			}
+		}
+		return false
+	}
+	if len(only) > 0 && !match(only) {
+		return false
+	}
+	return !match(disabled)
+}
+
+var bluezVersion = regexp.MustCompile(`(\d+)\.(\d+)`)
+
+func (d *doctor) checkBluetoothd() {
+	pid, args := bluetoothdProcess()
+	if pid == 0 {
+		d.fail("bluetoothd", "not running", "systemctl start bluetooth, or run bluetoothd -P input by hand")
+		return
+	}
+
+	exe, err := os.Readlink(fmt.Sprintf("/proc/%d/exe", pid))
+	if err != nil {
+		exe = args[0]
+	}
+	version := "unknown version"
+	if out, err := exec.Command(exe, "--version").Output(); err == nil {
+		version = strings.TrimSpace(string(out))
+	}
+	if m := bluezVersion.FindStringSubmatch(version); m != nil {
+		var major, minor int
+		fmt.Sscan(m[1], &major)
+		fmt.Sscan(m[2], &minor)
+		if major < 5 || major == 5 && minor < 43 {
+			d.fail("bluetoothd", "version "+version, "ProfileManager1 service records and LE advertising need bluez 5.43 or newer, upgrade the bluez package")
+			return
+		}
+	}
+	d.ok("bluetoothd", "pid %d version %s", pid, version)
+
+	if pluginEnabled(args, "input") {
+		d.fail("bluetoothd", "input plugin enabled",
+			"the input plugin holds psm 0x11 and 0x13 for hid hosts, add -P input to ExecStart in bluetooth.service (systemctl edit bluetooth) and restart it")
+	} else {
+		d.ok("bluetoothd", "input plugin disabled")
+	}
+}
+
+func (d *doctor) checkBus() {
+	conn, err := bluez.Dial(*busAddress)
+	if err != nil {
+		fix := "start the system bus with systemctl start dbus"
+		if *busAddress != "" {
+			fix = "check the -bus address " + *busAddress
+		}
+		d.fail("d-bus", err.Error(), fix)
+		return
+	}
+	d.conn = conn
+
+	var objects map[dbus.ObjectPath]map[string]map[string]dbus.Variant
+	call := conn.Call(bluez.BluezInterface, "/", bluez.ObjectManager+".GetManagedObjects", 0)
+	if call.Err == nil {
+		call.Err = call.Store(&objects)
+	}
+	if call.Err != nil {
+		var derr dbus.Error
+		if errors.As(call.Err, &derr) && derr.Name == "org.freedesktop.DBus.Error.AccessDenied" {
+			d.fail("d-bus", "org.bluez denies access",
+				"run as root or allow send_destination=\"org.bluez\" for this user in /etc/dbus-1/system.d/bluetooth.conf")
+			return
+		}
+		d.fail("d-bus", call.Err.Error(), "bluetoothd is not on this bus, check that it runs and registered org.bluez")
+		return
+	}
+	d.ok("d-bus", "org.bluez reachable")
+
+	if d.index >= 0 {
+		d.adapter = objects[dbus.ObjectPath(fmt.Sprintf("%s/hci%d", bluez.BluezPath, d.index))]
+		if d.adapter == nil {
+			d.fail("d-bus", fmt.Sprintf("hci%d is not on org.bluez", d.index), "bluetoothd ignores the controller, restart it after the controller shows up")
+		}
+	}
+}
+
+// checkInterfaces the managers vitrhid registers with for the given flags
+func (d *doctor) checkInterfaces() {
+	if d.conn == nil {
+		return
+	}
+
+	var data string
+	node := &introspect.Node{}
+	call := d.conn.Call(bluez.BluezInterface, bluez.BluezPath, bluez.Introspectable+".Introspect", 0)
+	if call.Err == nil {
+		call.Err = call.Store(&data)
+	}
+	if call.Err == nil {
+		call.Err = xml.Unmarshal([]byte(data), node)
+	}
+	if call.Err != nil {
+		d.fail("bluez", call.Err.Error(), "")
+		return
+	}
+
+	has := func(name string) bool {
+		for _, i := range node.Interfaces {
+			if i.Name == name {
+				return true
+			}
+		}
+		_, ok := d.adapter[name]
+		return ok
+	}
+
+	required := []struct {
+		iface string
+		need  bool
+		fix   string
+	}{
+		{bluez.AgentManagerInterface, true, "upgrade bluez, every 5.x release has it"},
+		{bluez.ProfileManagerInterface, true, "upgrade bluez, every 5.x release has it"},
+		{bluez.GattManagerInterface, *hogpEnabled, "-hogp needs bluez 5.43 or newer"},
+		{bluez.LEAdvertisingManagerInterface, *hogpEnabled, "-hogp needs bluez 5.43 or newer and a powered LE controller"},
+		{bluez.BatteryProviderManagerInterface, *batterySpec != "", "-battery needs bluez 5.56 or newer started with -E for experimental interfaces"},
+		{bluez.AdminPolicySetInterface, *lockdown, "-lockdown needs bluez 5.60 or newer with the admin plugin enabled"},
+	}
+	for _, r := range required {
+		if !r.need {
+			continue
+		}
+		if has(r.iface) {
+			d.ok("bluez", "%s available", r.iface)
+		} else {
+			d.fail("bluez", r.iface+" missing", r.fix)
+		}
+	}
+}
+
+// checkPSMs binds the hid psms the way -listen raw does
+func (d *doctor) checkPSMs() {
+	for _, psm := range []uint16{bluez.HIDControlPSM, bluez.HIDInterruptPSM} {
+		name := fmt.Sprintf("psm 0x%02x", psm)
+		fd, err := l2capListen(psm)
+		if err == nil {
+			unix.Close(fd)
+			d.ok(name, "available")
+			continue
+		}
+
+		switch {
+		case errors.Is(err, syscall.EADDRINUSE):
+			if *listenMode == "raw" {
+				d.fail(name, "in use", "another process holds it, usually bluetoothd's input plugin, restart bluetoothd with -P input and stop other vitrhid instances")
+			} else {
+				d.warn(name, "in use", "fine while vitrhid runs since bluetoothd listens for our profile, otherwise restart bluetoothd with -P input")
+			}
+		case permissionDenied(err):
+			d.fail(name, err.Error(), "psms below 0x1001 need CAP_NET_BIND_SERVICE, run as root or setcap cap_net_admin,cap_net_bind_service+ep on the binary")
+		default:
+			d.fail(name, err.Error(), "modprobe bluetooth and check that l2cap sockets work")
+		}
+	}
+}
+
+// checkRecord bluez lists the uuids of registered service records on the
+// adapter, ours shows up while vitrhid runs
+func (d *doctor) checkRecord() {
+	if d.adapter == nil {
+		return
+	}
+	uuids, _ := d.adapter[bluez.AdapterInterface]["UUIDs"].Value().([]string)
+	for _, uuid := range uuids {
+		if strings.EqualFold(uuid, growcastle.HIDServiceUUID) {
+			d.ok("sdp", "hid record registered")
+			return
+		}
+	}
+	d.warn("sdp", "no hid record registered",
+		"expected while vitrhid is not running, otherwise RegisterProfile failed, check its log and that bluetoothd runs with -P input")
+}
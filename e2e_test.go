@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+	"vitrhid/bluezmock"
+	"vitrhid/growcastle"
+	"vitrhid/harness"
+	"vitrhid/mgmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// TestMain runs the daemon when the end to end test starts the test binary
+// again with VITRHID_E2E_DAEMON set
+func TestMain(m *testing.M) {
+	if os.Getenv("VITRHID_E2E_DAEMON") != "" {
+		main()
+		return
+	}
+	os.Exit(m.Run())
+}
+
+func freeAddress(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().String()
+}
+
+// get the body of an api call, an error until the daemon listens
+func get(addr, path string) (string, error) {
+	res, err := http.Get("http://" + addr + path)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(res.Body)
+	return string(body), err
+}
+
+// TestEndToEnd runs vitrhid in raw listen mode on the device controller of
+// the harness with bluezmock as bluetoothd, the host controller pairs,
+// connects both channels and reads the reports the api sends
+func TestEndToEnd(t *testing.T) {
+	if _, err := os.Stat("/dev/vhci"); err != nil {
+		t.Skip("no /dev/vhci")
+	}
+	if _, err := exec.LookPath("dbus-daemon"); err != nil {
+		t.Skip("dbus-daemon not found")
+	}
+
+	mock, err := bluezmock.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mock.Close()
+
+	h, err := harness.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	// bluetoothd makes the adapter bondable, the mock does not
+	ll := mgmt.NewBluetoothLowLevel()
+	if err := ll.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer ll.Close()
+	if _, err := ll.SetBondable(h.Device.Index(), mgmt.On); err != nil {
+		t.Fatal(err)
+	}
+
+	api := freeAddress(t)
+	var output bytes.Buffer
+	daemon := exec.Command(os.Args[0],
+		"-bus", mock.Address(),
+		"-index", fmt.Sprint(h.Device.Index()),
+		"-listen", "raw",
+		"-keyboard",
+		"-pairing-window", "-1",
+		"-confirm", "auto",
+		"-http", api)
+	daemon.Env = append(os.Environ(), "VITRHID_E2E_DAEMON=1")
+	daemon.Stdout = &output
+	daemon.Stderr = &output
+	if err := daemon.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		daemon.Process.Kill()
+		daemon.Wait()
+		if t.Failed() {
+			t.Logf("vitrhid output:\n%s", output.String())
+		}
+	}()
+
+	wait := func(what string, cond func() bool) {
+		t.Helper()
+		deadline := time.Now().Add(time.Second * 10)
+		for !cond() {
+			if time.Now().After(deadline) {
+				t.Fatalf("timeout waiting for %s", what)
+			}
+			time.Sleep(time.Millisecond * 50)
+		}
+	}
+	wait("api", func() bool {
+		_, err := get(api, "/devices")
+		return err == nil
+	})
+
+	if err := h.Pair(); err != nil {
+		t.Fatalf("pair: %s", err)
+	}
+	host, err := h.ConnectHID()
+	if err != nil {
+		t.Fatalf("connect: %s", err)
+	}
+	defer host.Close()
+	tv := unix.NsecToTimeval(int64(time.Second * 5))
+	if err := unix.SetsockoptTimeval(host.Interrupt, unix.SOL_SOCKET, unix.SO_RCVTIMEO, &tv); err != nil {
+		t.Fatal(err)
+	}
+
+	// release succeeds once the daemon accepted the interrupt channel
+	addr := mgmt.AddressString(harness.HostAddress)
+	wait("interrupt channel", func() bool {
+		body, _ := get(api, "/keyboard/release?addr="+addr)
+		return body == "success"
+	})
+	// the raw key of the host is its address in display order
+	body, err := get(api, "/devices")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var devices []deviceInfo
+	if err := json.Unmarshal([]byte(body), &devices); err != nil {
+		t.Fatalf("devices %q: %s", body, err)
+	}
+	if len(devices) != 1 || devices[0].Addr != addr {
+		t.Errorf("devices %+v, want %s", devices, addr)
+	}
+
+	released, err := host.ReadReport()
+	if err != nil {
+		t.Fatalf("read release: %s", err)
+	}
+	if want := []byte{0xA1, growcastle.KeyboardReportID, 0, 0, 0, 0, 0, 0, 0, 0}; !bytes.Equal(released, want) {
+		t.Errorf("release report % x, want % x", released, want)
+	}
+
+	if body, err := get(api, "/keyboard/tap?keys=shift%2Ba&addr="+addr); err != nil || body != "success" {
+		t.Fatalf("tap: %q %v", body, err)
+	}
+	want := [][]byte{
+		{0xA1, growcastle.KeyboardReportID, 0x02, 0, 0, 0, 0, 0, 0, 0},
+		{0xA1, growcastle.KeyboardReportID, 0x02, 0, 0x04, 0, 0, 0, 0, 0},
+		{0xA1, growcastle.KeyboardReportID, 0x02, 0, 0, 0, 0, 0, 0, 0},
+		{0xA1, growcastle.KeyboardReportID, 0, 0, 0, 0, 0, 0, 0, 0},
+	}
+	for i, w := range want {
+		report, err := host.ReadReport()
+		if err != nil {
+			t.Fatalf("read report %d: %s", i, err)
+		}
+		if !bytes.Equal(report, w) {
+			t.Errorf("report %d % x, want % x", i, report, w)
+		}
+	}
+}
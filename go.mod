@@ -3,7 +3,7 @@ module vitrhid
 go 1.16
 
 require (
-	github.com/godbus/dbus v4.1.0+incompatible // indirect
+	github.com/godbus/dbus v4.1.0+incompatible
 	github.com/paypal/gatt v0.0.0-20151011220935-4ae819d591cf // indirect
-	golang.org/x/sys v0.0.0-20210630005230-0f9fa26af87c // indirect
+	golang.org/x/sys v0.0.0-20210630005230-0f9fa26af87c
 )
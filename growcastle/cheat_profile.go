@@ -9,7 +9,7 @@ import (
 )
 
 type Profile struct {
-	conn *dbus.Conn
+	conn *bluez.Conn
 }
 
 func NewProfile() (*Profile, error) {
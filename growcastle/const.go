@@ -3,10 +3,11 @@ package growcastle
 const (
 	ProfilePath = "/growcastle/profile"
 	AgentPath   = "/growcastle/agent"
-)
+	GattPath    = "/growcastle/gatt"
 
-const (
-	KeyboardReportId    = 0x1
-	TouchScreenReportId = 0x2
-	MouseReportId       = 0x3
+	AdvertisementPath = "/growcastle/advertisement"
+	BatteryPath       = "/growcastle/battery"
 )
+
+// HIDServiceUUID HumanInterfaceDeviceServiceClass
+const HIDServiceUUID = "00001124-0000-1000-8000-00805f9b34fb"
@@ -0,0 +1,144 @@
+// Code generated by hidgen -func KeyboardDescriptor(1); DO NOT EDIT.
+
+package growcastle
+
+import "vitrhid/hid"
+
+// KeyboardReportID report id of the Keyboard reports
+const KeyboardReportID = 1
+
+// KeyboardInputReportSize bytes of KeyboardInputReport without report id
+const KeyboardInputReportSize = 8
+
+// KeyboardInputReport input report 1
+type KeyboardInputReport struct {
+	LeftControl  bool
+	LeftShift    bool
+	LeftAlt      bool
+	LeftGUI      bool
+	RightControl bool
+	RightShift   bool
+	RightAlt     bool
+	RightGUI     bool
+	Keys         [6]uint8 // Keyboard usages 0x00..0xff
+}
+
+func (r *KeyboardInputReport) ReportID() byte {
+	return KeyboardReportID
+}
+
+// AppendBinary appends the report without report id, it does not allocate
+// when b has KeyboardInputReportSize bytes to spare
+func (r *KeyboardInputReport) AppendBinary(b []byte) ([]byte, error) {
+	n := len(b)
+	b = append(b, make([]byte, KeyboardInputReportSize)...)
+	d := b[n:]
+	if r.LeftControl {
+		d[0] |= 0x01
+	}
+	if r.LeftShift {
+		d[0] |= 0x02
+	}
+	if r.LeftAlt {
+		d[0] |= 0x04
+	}
+	if r.LeftGUI {
+		d[0] |= 0x08
+	}
+	if r.RightControl {
+		d[0] |= 0x10
+	}
+	if r.RightShift {
+		d[0] |= 0x20
+	}
+	if r.RightAlt {
+		d[0] |= 0x40
+	}
+	if r.RightGUI {
+		d[0] |= 0x80
+	}
+	for i, v := range r.Keys {
+		hid.PutBits(d, 16+i*8, 8, uint32(v))
+	}
+	return b, nil
+}
+
+func (r *KeyboardInputReport) MarshalBinary() ([]byte, error) {
+	return r.AppendBinary(make([]byte, 0, KeyboardInputReportSize))
+}
+
+// UnmarshalBinary reads the report without report id
+func (r *KeyboardInputReport) UnmarshalBinary(d []byte) error {
+	if len(d) < KeyboardInputReportSize {
+		return hid.ErrTruncated
+	}
+	r.LeftControl = d[0]&0x01 != 0
+	r.LeftShift = d[0]&0x02 != 0
+	r.LeftAlt = d[0]&0x04 != 0
+	r.LeftGUI = d[0]&0x08 != 0
+	r.RightControl = d[0]&0x10 != 0
+	r.RightShift = d[0]&0x20 != 0
+	r.RightAlt = d[0]&0x40 != 0
+	r.RightGUI = d[0]&0x80 != 0
+	for i := range r.Keys {
+		r.Keys[i] = uint8(hid.Bits(d, 16+i*8, 8))
+	}
+	return nil
+}
+
+// KeyboardOutputReportSize bytes of KeyboardOutputReport without report id
+const KeyboardOutputReportSize = 1
+
+// KeyboardOutputReport output report 1
+type KeyboardOutputReport struct {
+	NumLock    bool
+	CapsLock   bool
+	ScrollLock bool
+	Compose    bool
+	Kana       bool
+}
+
+func (r *KeyboardOutputReport) ReportID() byte {
+	return KeyboardReportID
+}
+
+// AppendBinary appends the report without report id, it does not allocate
+// when b has KeyboardOutputReportSize bytes to spare
+func (r *KeyboardOutputReport) AppendBinary(b []byte) ([]byte, error) {
+	n := len(b)
+	b = append(b, make([]byte, KeyboardOutputReportSize)...)
+	d := b[n:]
+	if r.NumLock {
+		d[0] |= 0x01
+	}
+	if r.CapsLock {
+		d[0] |= 0x02
+	}
+	if r.ScrollLock {
+		d[0] |= 0x04
+	}
+	if r.Compose {
+		d[0] |= 0x08
+	}
+	if r.Kana {
+		d[0] |= 0x10
+	}
+	return b, nil
+}
+
+func (r *KeyboardOutputReport) MarshalBinary() ([]byte, error) {
+	return r.AppendBinary(make([]byte, 0, KeyboardOutputReportSize))
+}
+
+// UnmarshalBinary reads the report without report id
+func (r *KeyboardOutputReport) UnmarshalBinary(d []byte) error {
+	if len(d) < KeyboardOutputReportSize {
+		return hid.ErrTruncated
+	}
+	r.NumLock = d[0]&0x01 != 0
+	r.CapsLock = d[0]&0x02 != 0
+	r.ScrollLock = d[0]&0x04 != 0
+	r.Compose = d[0]&0x08 != 0
+	r.Kana = d[0]&0x10 != 0
+	return nil
+}
@@ -0,0 +1,56 @@
+// Code generated by hidgen -func MouseDescriptor(); DO NOT EDIT.
+
+package growcastle
+
+import "vitrhid/hid"
+
+// MouseReportID report id of the Mouse reports
+const MouseReportID = 3
+
+// MouseInputReportSize bytes of MouseInputReport without report id
+const MouseInputReportSize = 3
+
+// MouseInputReport input report 3
+type MouseInputReport struct {
+	Button1 bool
+	Button2 bool
+	X       int8 // -127..127
+	Y       int8 // -127..127
+}
+
+func (r *MouseInputReport) ReportID() byte {
+	return MouseReportID
+}
+
+// AppendBinary appends the report without report id, it does not allocate
+// when b has MouseInputReportSize bytes to spare
+func (r *MouseInputReport) AppendBinary(b []byte) ([]byte, error) {
+	n := len(b)
+	b = append(b, make([]byte, MouseInputReportSize)...)
+	d := b[n:]
+	if r.Button1 {
+		d[0] |= 0x01
+	}
+	if r.Button2 {
+		d[0] |= 0x02
+	}
+	hid.PutBits(d, 8, 8, uint32(r.X))
+	hid.PutBits(d, 16, 8, uint32(r.Y))
+	return b, nil
+}
+
+func (r *MouseInputReport) MarshalBinary() ([]byte, error) {
+	return r.AppendBinary(make([]byte, 0, MouseInputReportSize))
+}
+
+// UnmarshalBinary reads the report without report id
+func (r *MouseInputReport) UnmarshalBinary(d []byte) error {
+	if len(d) < MouseInputReportSize {
+		return hid.ErrTruncated
+	}
+	r.Button1 = d[0]&0x01 != 0
+	r.Button2 = d[0]&0x02 != 0
+	r.X = int8(hid.SignedBits(d, 8, 8))
+	r.Y = int8(hid.SignedBits(d, 16, 8))
+	return nil
+}
@@ -3,46 +3,51 @@ package growcastle
 import (
 	"encoding/hex"
 	"encoding/xml"
+	"strconv"
+	"vitrhid/hid"
 )
 
+//go:generate go run vitrhid/cmd/hidgen -func KeyboardDescriptor(1)
+
 func KeyboardDescriptor(reportId byte) []byte {
-	return []byte{
-		0x05, 0x01, // Usage Page (Generic Desktop Ctrls)
-		0x09, 0x06, // Usage (Keyboard)
-		0xA1, 0x01, // Collection (Application)
-		0x85, KeyboardReportId, //   Report ID (1)
-		0x75, 0x01, //   Report Size (1)
-		0x95, 0x08, //   Report Count (8)
-		0x05, 0x07, //   Usage Page (Kbrd/Keypad)
-		0x19, 0xE0, //   Usage Minimum (0xE0)
-		0x29, 0xE7, //   Usage Maximum (0xE7)
-		0x15, 0x00, //   Logical Minimum (0)
-		0x25, 0x01, //   Logical Maximum (1)
-		0x81, 0x02, //   Input (Data,Var,Abs,No Wrap,Linear,Preferred State,No Null Position)
-		0x95, 0x01, //   Report Count (1)
-		0x75, 0x08, //   Report Size (8)
-		0x81, 0x03, //   Input (Const,Var,Abs,No Wrap,Linear,Preferred State,No Null Position)
-		0x95, 0x05, //   Report Count (5)
-		0x75, 0x01, //   Report Size (1)
-		0x05, 0x08, //   Usage Page (LEDs)
-		0x19, 0x01, //   Usage Minimum (Num Lock)
-		0x29, 0x05, //   Usage Maximum (Kana)
-		0x91, 0x02, //   Output (Data,Var,Abs,No Wrap,Linear,Preferred State,No Null Position,Non-volatile)
-		0x95, 0x01, //   Report Count (1)
-		0x75, 0x03, //   Report Size (3)
-		0x91, 0x03, //   Output (Const,Var,Abs,No Wrap,Linear,Preferred State,No Null Position,Non-volatile)
-		0x95, 0x06, //   Report Count (6)
-		0x75, 0x08, //   Report Size (8)
-		0x15, 0x00, //   Logical Minimum (0)
-		0x26, 0xFF, 0x00, //   Logical Maximum (255)
-		0x05, 0x07, //   Usage Page (Kbrd/Keypad)
-		0x19, 0x00, //   Usage Minimum (0x00)
-		0x29, 0xFF, //   Usage Maximum (0xFF)
-		0x81, 0x00, //   Input (Data,Array,Abs,No Wrap,Linear,Preferred State,No Null Position)
-		0xC0, // End Collection
-	}
+	return hid.NewBuilder().
+		UsagePage(hid.PageGenericDesktop).
+		Usage(hid.DesktopKeyboard).
+		Collection(hid.CollectionApplication).
+		ReportID(reportId).
+		// modifiers
+		ReportSize(1).
+		ReportCount(8).
+		UsagePage(hid.PageKeyboard).
+		UsageRange(hid.KeyLeftControl, hid.KeyRightGUI).
+		Logical(0, 1).
+		Input(hid.Data|hid.Variable|hid.Absolute).
+		// reserved
+		ReportCount(1).
+		ReportSize(8).
+		Input(hid.Constant|hid.Variable|hid.Absolute).
+		// leds
+		ReportCount(5).
+		ReportSize(1).
+		UsagePage(hid.PageLED).
+		UsageRange(hid.LEDNumLock, hid.LEDKana).
+		Output(hid.Data|hid.Variable|hid.Absolute).
+		ReportCount(1).
+		ReportSize(3).
+		Output(hid.Constant|hid.Variable|hid.Absolute).
+		// keys
+		ReportCount(6).
+		ReportSize(8).
+		Logical(0, 255).
+		UsagePage(hid.PageKeyboard).
+		UsageRange(0x00, 0xFF).
+		Input(hid.Data | hid.Array | hid.Absolute).
+		EndCollection().
+		MustBytes()
 }
 
+//go:generate go run vitrhid/cmd/hidgen -func TouchScreenDescriptor()
+
 // TouchScreenDescriptor
 // tip switch     byte
 // press          byte
@@ -53,86 +58,96 @@ func KeyboardDescriptor(reportId byte) []byte {
 // contact identifier       int16
 // contact count maximum    byte
 func TouchScreenDescriptor() []byte {
-	return []byte{
-		0x05, 0x0D, // Usage Page (Digitizer)
-		0x09, 0x04, // Usage (Touch Screen)
-		0xA1, 0x01, // Collection (Application)
-		0x85, TouchScreenReportId, //   Report ID (2)
-		0x09, 0x22, //   Usage (Finger)
-		0xA1, 0x00, //   Collection (Physical)
-		0x09, 0x42, //     Usage (Tip Switch)
-		0x15, 0x00, //     Logical Minimum (0)
-		0x25, 0x01, //     Logical Maximum (1)
-		0x75, 0x01, //     Report Size (1)
-		0x95, 0x01, //     Report Count (1)
-		0x81, 0x02, //     Input (Data,Var,Abs,No Wrap,Linear,Preferred State,No Null Position)
-		0x95, 0x03, //     Report Count (3)
-		0x81, 0x03, //     Input (Const,Var,Abs,No Wrap,Linear,Preferred State,No Null Position)
-		0x09, 0x32, //     Usage (In Range)
-		0x09, 0x47, //     Usage (0x47)
-		0x95, 0x02, //     Report Count (2)
-		0x81, 0x02, //     Input (Data,Var,Abs,No Wrap,Linear,Preferred State,No Null Position)
-		0x95, 0x0A, //     Report Count (10)
-		0x81, 0x03, //     Input (Const,Var,Abs,No Wrap,Linear,Preferred State,No Null Position)
-		0x05, 0x01, //     Usage Page (Generic Desktop Ctrls)
-		0x26, 0xFF, 0x7F, //     Logical Maximum (32767)
-		0x75, 0x10, //     Report Size (16)
-		0x95, 0x01, //     Report Count (1)
-		0x09, 0x30, //     Usage (X)
-		0x81, 0x02, //     Input (Data,Var,Abs,No Wrap,Linear,Preferred State,No Null Position)
-		0x09, 0x31, //     Usage (Y)
-		0x81, 0x02, //     Input (Data,Var,Abs,No Wrap,Linear,Preferred State,No Null Position)
-		0x05, 0x0D, //     Usage Page (Digitizer)
-		0x09, 0x48, //     Usage (0x48)
-		0x09, 0x49, //     Usage (0x49)
-		0x95, 0x02, //     Report Count (2)
-		0x81, 0x02, //     Input (Data,Var,Abs,No Wrap,Linear,Preferred State,No Null Position)
-		0x09, 0x51, //     Usage (0x51)
-		0x95, 0x01, //     Report Count (1)
-		0x81, 0x02, //     Input (Data,Var,Abs,No Wrap,Linear,Preferred State,No Null Position)
-		0x09, 0x55, //     Usage (0x55)
-		0x25, 0x08, //     Logical Maximum (8)
-		0x75, 0x08, //     Report Size (8)
-		0xB1, 0x02, //     Feature (Data,Var,Abs,No Wrap,Linear,Preferred State,No Null Position,Non-volatile)
-		0xC0, //   End Collection
-		0xC0, // End Collection
-	}
+	return hid.NewBuilder().
+		UsagePage(hid.PageDigitizer).
+		Usage(hid.DigitizerTouchScreen).
+		Collection(hid.CollectionApplication).
+		ReportID(2).
+		Usage(hid.DigitizerFinger).
+		Collection(hid.CollectionPhysical).
+		Usage(hid.DigitizerTipSwitch).
+		Logical(0, 1).
+		ReportSize(1).
+		ReportCount(1).
+		Input(hid.Data|hid.Variable|hid.Absolute).
+		ReportCount(3).
+		Input(hid.Constant|hid.Variable|hid.Absolute).
+		Usages(hid.DigitizerInRange, hid.DigitizerConfidence).
+		ReportCount(2).
+		Input(hid.Data|hid.Variable|hid.Absolute).
+		ReportCount(10).
+		Input(hid.Constant|hid.Variable|hid.Absolute).
+		UsagePage(hid.PageGenericDesktop).
+		LogicalMaximum(32767).
+		ReportSize(16).
+		ReportCount(1).
+		Usage(hid.DesktopX).
+		Input(hid.Data|hid.Variable|hid.Absolute).
+		Usage(hid.DesktopY).
+		Input(hid.Data|hid.Variable|hid.Absolute).
+		UsagePage(hid.PageDigitizer).
+		Usages(hid.DigitizerWidth, hid.DigitizerHeight).
+		ReportCount(2).
+		Input(hid.Data | hid.Variable | hid.Absolute).
+		Usage(hid.DigitizerContactIdentifier).
+		ReportCount(1).
+		Input(hid.Data | hid.Variable | hid.Absolute).
+		Usage(hid.DigitizerContactCountMaximum).
+		LogicalMaximum(8).
+		ReportSize(8).
+		Feature(hid.Data | hid.Variable | hid.Absolute).
+		EndCollection().
+		EndCollection().
+		MustBytes()
 }
 
+//go:generate go run vitrhid/cmd/hidgen -func MouseDescriptor()
+
 func MouseDescriptor() []byte {
-	return []byte{
-		0x05, 0x01, // USAGE_PAGE (Generic Desktop)     0
-		0x09, 0x02, // USAGE (Mouse)                    2
-		0xa1, 0x01, // COLLECTION (Application)         4
-		0x85, MouseReportId, //   REPORT_ID (Mouse)              6
-		0x09, 0x01, //   USAGE (Pointer)                8
-		0xa1, 0x00, //   COLLECTION (Physical)          10
-		0x05, 0x09, //     USAGE_PAGE (Button)          12
-		0x19, 0x01, //     USAGE_MINIMUM (Button 1)     14
-		0x29, 0x02, //     USAGE_MAXIMUM (Button 2)     16
-		0x15, 0x00, //     LOGICAL_MINIMUM (0)          18
-		0x25, 0x01, //     LOGICAL_MAXIMUM (1)          20
-		0x75, 0x01, //     REPORT_SIZE (1)              22
-		0x95, 0x02, //     REPORT_COUNT (2)             24
-		0x81, 0x02, //     INPUT (Data,Var,Abs)         26
-		0x95, 0x06, //     REPORT_COUNT (6)             28
-		0x81, 0x03, //     INPUT (Cnst,Var,Abs)         30
-		0x05, 0x01, //     USAGE_PAGE (Generic Desktop) 32
-		0x09, 0x30, //     USAGE (X)                    34
-		0x09, 0x31, //     USAGE (Y)                    36
-		0x15, 0x81, //     LOGICAL_MINIMUM (-127)       38
-		0x25, 0x7f, //     LOGICAL_MAXIMUM (127)        40
-		0x75, 0x08, //     REPORT_SIZE (8)              42
-		0x95, 0x02, //     REPORT_COUNT (2)             44
-		0x81, 0x06, //     INPUT (Data,Var,Rel)         46
-		0xc0, //   END_COLLECTION                 48
-		0xc0, // END_COLLECTION                   49/50
-	}
+	return hid.NewBuilder().
+		UsagePage(hid.PageGenericDesktop).
+		Usage(hid.DesktopMouse).
+		Collection(hid.CollectionApplication).
+		ReportID(3).
+		Usage(hid.DesktopPointer).
+		Collection(hid.CollectionPhysical).
+		UsagePage(hid.PageButton).
+		UsageRange(1, 2).
+		Logical(0, 1).
+		ReportSize(1).
+		ReportCount(2).
+		Input(hid.Data|hid.Variable|hid.Absolute).
+		ReportCount(6).
+		Input(hid.Constant|hid.Variable|hid.Absolute).
+		UsagePage(hid.PageGenericDesktop).
+		Usages(hid.DesktopX, hid.DesktopY).
+		Logical(-127, 127).
+		ReportSize(8).
+		ReportCount(2).
+		Input(hid.Data | hid.Variable | hid.Relative).
+		EndCollection().
+		EndCollection().
+		MustBytes()
 }
 
 // SDPRecord see https://btprodspecificationrefs.blob.core.windows.net/assigned-numbers/Assigned%20Number%20Types/Service%20Discovery.pdf
-// section Human Interface Device Profile
-func SDPRecord(descriptor [][]byte) (string, error) {
+// section Human Interface Device Profile, batteryPower tells the host the
+// device runs from a battery, descriptors that would not parse on the host,
+// alone or together, are refused, keyboards and mice are announced as boot
+// devices
+func SDPRecord(descriptor [][]byte, batteryPower bool) (string, error) {
+	if err := hid.CheckAll(descriptor); err != nil {
+		return "", err
+	}
+	var boot hid.BootDevice
+	for _, d := range descriptor {
+		parsed, err := hid.Parse(d)
+		if err != nil {
+			return "", err
+		}
+		boot |= parsed.Boot()
+	}
+
 	var records []interface{}
 
 	// ServiceClassIDList
@@ -296,7 +311,7 @@ func SDPRecord(descriptor [][]byte) (string, error) {
 	// HIDBatteryPower
 	records = append(records, Attribute{
 		Id:    "0x0209",
-		Value: Boolean{Value: "false"},
+		Value: Boolean{Value: strconv.FormatBool(batteryPower)},
 	})
 
 	// HIDRemoteWake
@@ -320,12 +335,12 @@ func SDPRecord(descriptor [][]byte) (string, error) {
 	// HIDBootDevice
 	records = append(records, Attribute{
 		Id:    "0x020e",
-		Value: Boolean{Value: "false"},
+		Value: Boolean{Value: strconv.FormatBool(boot != 0)},
 	})
 
 	// HIDSSRHostMaxLatency
 	records = append(records, Attribute{
-		Id:    "0x020e",
+		Id:    "0x020f",
 		Value: UInt16{Value: "0x0640"},
 	})
 
@@ -0,0 +1,61 @@
+package growcastle
+
+import (
+	"bytes"
+	"testing"
+	"vitrhid/hid"
+)
+
+// the descriptors as they were written by hand before the builder
+var (
+	handKeyboard = []byte{
+		0x05, 0x01, 0x09, 0x06, 0xA1, 0x01, 0x85, 0x01,
+		0x75, 0x01, 0x95, 0x08, 0x05, 0x07, 0x19, 0xE0, 0x29, 0xE7, 0x15, 0x00, 0x25, 0x01, 0x81, 0x02,
+		0x95, 0x01, 0x75, 0x08, 0x81, 0x03,
+		0x95, 0x05, 0x75, 0x01, 0x05, 0x08, 0x19, 0x01, 0x29, 0x05, 0x91, 0x02,
+		0x95, 0x01, 0x75, 0x03, 0x91, 0x03,
+		0x95, 0x06, 0x75, 0x08, 0x15, 0x00, 0x26, 0xFF, 0x00, 0x05, 0x07, 0x19, 0x00, 0x29, 0xFF, 0x81, 0x00,
+		0xC0,
+	}
+	handTouchScreen = []byte{
+		0x05, 0x0D, 0x09, 0x04, 0xA1, 0x01, 0x85, 0x02,
+		0x09, 0x22, 0xA1, 0x00,
+		0x09, 0x42, 0x15, 0x00, 0x25, 0x01, 0x75, 0x01, 0x95, 0x01, 0x81, 0x02,
+		0x95, 0x03, 0x81, 0x03,
+		0x09, 0x32, 0x09, 0x47, 0x95, 0x02, 0x81, 0x02,
+		0x95, 0x0A, 0x81, 0x03,
+		0x05, 0x01, 0x26, 0xFF, 0x7F, 0x75, 0x10, 0x95, 0x01, 0x09, 0x30, 0x81, 0x02, 0x09, 0x31, 0x81, 0x02,
+		0x05, 0x0D, 0x09, 0x48, 0x09, 0x49, 0x95, 0x02, 0x81, 0x02,
+		0x09, 0x51, 0x95, 0x01, 0x81, 0x02,
+		0x09, 0x55, 0x25, 0x08, 0x75, 0x08, 0xB1, 0x02,
+		0xC0, 0xC0,
+	}
+	handMouse = []byte{
+		0x05, 0x01, 0x09, 0x02, 0xa1, 0x01, 0x85, 0x03,
+		0x09, 0x01, 0xa1, 0x00,
+		0x05, 0x09, 0x19, 0x01, 0x29, 0x02, 0x15, 0x00, 0x25, 0x01, 0x75, 0x01, 0x95, 0x02, 0x81, 0x02,
+		0x95, 0x06, 0x81, 0x03,
+		0x05, 0x01, 0x09, 0x30, 0x09, 0x31, 0x15, 0x81, 0x25, 0x7f, 0x75, 0x08, 0x95, 0x02, 0x81, 0x06,
+		0xc0, 0xc0,
+	}
+)
+
+func TestDescriptors(t *testing.T) {
+	tests := []struct {
+		name  string
+		built []byte
+		hand  []byte
+	}{
+		{"keyboard", KeyboardDescriptor(KeyboardReportID), handKeyboard},
+		{"touch screen", TouchScreenDescriptor(), handTouchScreen},
+		{"mouse", MouseDescriptor(), handMouse},
+	}
+	for _, tt := range tests {
+		if !bytes.Equal(tt.built, tt.hand) {
+			t.Errorf("%s descriptor\n got % x\nwant % x", tt.name, tt.built, tt.hand)
+		}
+		if err := hid.Check(tt.built); err != nil {
+			t.Errorf("%s descriptor: %s", tt.name, err)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+// Code generated by hidgen -func TouchScreenDescriptor(); DO NOT EDIT.
+
+package growcastle
+
+import "vitrhid/hid"
+
+// TouchScreenReportID report id of the TouchScreen reports
+const TouchScreenReportID = 2
+
+// TouchScreenInputReportSize bytes of TouchScreenInputReport without report id
+const TouchScreenInputReportSize = 12
+
+// TouchScreenInputReport input report 2
+type TouchScreenInputReport struct {
+	TipSwitch         bool
+	InRange           bool
+	Confidence        bool
+	X                 uint16 // 0..32767
+	Y                 uint16 // 0..32767
+	Width             uint16 // 0..32767
+	Height            uint16 // 0..32767
+	ContactIdentifier uint16 // 0..32767
+}
+
+func (r *TouchScreenInputReport) ReportID() byte {
+	return TouchScreenReportID
+}
+
+// AppendBinary appends the report without report id, it does not allocate
+// when b has TouchScreenInputReportSize bytes to spare
+func (r *TouchScreenInputReport) AppendBinary(b []byte) ([]byte, error) {
+	n := len(b)
+	b = append(b, make([]byte, TouchScreenInputReportSize)...)
+	d := b[n:]
+	if r.TipSwitch {
+		d[0] |= 0x01
+	}
+	if r.InRange {
+		d[0] |= 0x10
+	}
+	if r.Confidence {
+		d[0] |= 0x20
+	}
+	hid.PutBits(d, 16, 16, uint32(r.X))
+	hid.PutBits(d, 32, 16, uint32(r.Y))
+	hid.PutBits(d, 48, 16, uint32(r.Width))
+	hid.PutBits(d, 64, 16, uint32(r.Height))
+	hid.PutBits(d, 80, 16, uint32(r.ContactIdentifier))
+	return b, nil
+}
+
+func (r *TouchScreenInputReport) MarshalBinary() ([]byte, error) {
+	return r.AppendBinary(make([]byte, 0, TouchScreenInputReportSize))
+}
+
+// UnmarshalBinary reads the report without report id
+func (r *TouchScreenInputReport) UnmarshalBinary(d []byte) error {
+	if len(d) < TouchScreenInputReportSize {
+		return hid.ErrTruncated
+	}
+	r.TipSwitch = d[0]&0x01 != 0
+	r.InRange = d[0]&0x10 != 0
+	r.Confidence = d[0]&0x20 != 0
+	r.X = uint16(hid.Bits(d, 16, 16))
+	r.Y = uint16(hid.Bits(d, 32, 16))
+	r.Width = uint16(hid.Bits(d, 48, 16))
+	r.Height = uint16(hid.Bits(d, 64, 16))
+	r.ContactIdentifier = uint16(hid.Bits(d, 80, 16))
+	return nil
+}
+
+// TouchScreenFeatureReportSize bytes of TouchScreenFeatureReport without report id
+const TouchScreenFeatureReportSize = 1
+
+// TouchScreenFeatureReport feature report 2
+type TouchScreenFeatureReport struct {
+	ContactCountMaximum uint8 // 0..8
+}
+
+func (r *TouchScreenFeatureReport) ReportID() byte {
+	return TouchScreenReportID
+}
+
+// AppendBinary appends the report without report id, it does not allocate
+// when b has TouchScreenFeatureReportSize bytes to spare
+func (r *TouchScreenFeatureReport) AppendBinary(b []byte) ([]byte, error) {
+	n := len(b)
+	b = append(b, make([]byte, TouchScreenFeatureReportSize)...)
+	d := b[n:]
+	hid.PutBits(d, 0, 8, uint32(r.ContactCountMaximum))
+	return b, nil
+}
+
+func (r *TouchScreenFeatureReport) MarshalBinary() ([]byte, error) {
+	return r.AppendBinary(make([]byte, 0, TouchScreenFeatureReportSize))
+}
+
+// UnmarshalBinary reads the report without report id
+func (r *TouchScreenFeatureReport) UnmarshalBinary(d []byte) error {
+	if len(d) < TouchScreenFeatureReportSize {
+		return hid.ErrTruncated
+	}
+	r.ContactCountMaximum = uint8(hid.Bits(d, 0, 8))
+	return nil
+}
@@ -0,0 +1,398 @@
+package harness
+
+import (
+	"bytes"
+	"crypto/rand"
+	"sync"
+)
+
+// Air connects emulators with each other, it pages, accepts and pairs ACL
+// links and forwards ACL data between both ends of a link
+type Air struct {
+	lock       sync.Mutex
+	devices    map[[6]byte]*Emulator
+	requests   map[*Emulator]map[[6]byte]*Emulator
+	conns      map[*Emulator]map[uint16]*link
+	nextHandle uint16
+
+	// Logf receives commands the emulators do not know, nil logs nothing
+	Logf func(format string, v ...interface{})
+}
+
+type link struct {
+	local  *Emulator
+	remote *Emulator
+	handle uint16
+	peer   *link
+	auth   *auth
+}
+
+// auth is shared by both ends while a link is being authenticated
+type auth struct {
+	initiator *link
+	responder *link
+	ssp       bool
+	key       [16]byte
+	ioCap     [2]byte
+	confirmed [2]bool
+	pin       []byte
+}
+
+func NewAir() *Air {
+	return &Air{
+		devices:    make(map[[6]byte]*Emulator),
+		requests:   make(map[*Emulator]map[[6]byte]*Emulator),
+		conns:      make(map[*Emulator]map[uint16]*link),
+		nextHandle: 1,
+	}
+}
+
+// NewEmulator creates a vhci controller with address in HCI byte order
+func (a *Air) NewEmulator(addr [6]byte) (*Emulator, error) {
+	return newEmulator(a, addr)
+}
+
+func (a *Air) attach(e *Emulator) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.devices[e.addr] = e
+	a.requests[e] = make(map[[6]byte]*Emulator)
+	a.conns[e] = make(map[uint16]*link)
+}
+
+func (a *Air) detach(e *Emulator) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.dropLinks(e)
+	delete(a.devices, e.addr)
+	delete(a.requests, e)
+	delete(a.conns, e)
+}
+
+func (a *Air) reset(e *Emulator) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	e.scan = 0
+	e.ssp = 0
+	e.leHost = 0
+	a.dropLinks(e)
+	a.requests[e] = make(map[[6]byte]*Emulator)
+}
+
+func (a *Air) dropLinks(e *Emulator) {
+	for h, l := range a.conns[e] {
+		delete(a.conns[e], h)
+		delete(a.conns[l.remote], l.peer.handle)
+		l.remote.event(evDisconnComplete, []byte{statusSuccess}, le16(l.peer.handle), []byte{statusRemoteUserTerm})
+	}
+}
+
+func (a *Air) setScan(e *Emulator, scan byte) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	e.scan = scan
+}
+
+func (a *Air) setSSP(e *Emulator, ssp byte) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	e.ssp = ssp
+}
+
+func (a *Air) linkByAddr(e *Emulator, addr []byte) *link {
+	for _, l := range a.conns[e] {
+		if bytes.Equal(l.remote.addr[:], addr) {
+			return l
+		}
+	}
+	return nil
+}
+
+func (a *Air) acl(e *Emulator, handle uint16, flags byte, data []byte) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	l := a.conns[e][handle]
+	if l == nil {
+		return
+	}
+
+	// first non-flushable from host arrives as first flushable on the other side
+	pb := flags & 0x03
+	if pb == 0x00 {
+		pb = 0x02
+	}
+	l.remote.acl(l.peer.handle, pb|flags&0x0C, data)
+	e.event(evNumCompletedPackets, []byte{0x01}, le16(handle), le16(1))
+}
+
+// command handles link control commands, false when op is unknown
+func (a *Air) command(e *Emulator, op uint16, p []byte) bool {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	ok := []byte{statusSuccess}
+
+	var (
+		l    *link
+		addr []byte
+	)
+	switch op {
+	case opDisconnect, opReadRemoteFeatures, opReadRemoteExtFeature, opReadClockOffset,
+		opWriteLinkPolicy, opWriteLinkSupervision, opReadEncryptKeySize,
+		opSetConnEncrypt, opAuthRequested:
+		if len(p) < 2 {
+			return false
+		}
+		l = a.conns[e][binaryOrder.Uint16(p)&0x0FFF]
+		if l == nil {
+			if op>>10 == 0x01 {
+				e.status(op, statusUnknownConnection)
+			} else {
+				e.complete(op, []byte{statusUnknownConnection}, p[:2])
+			}
+			return true
+		}
+	case opCreateConn, opAcceptConnRequest, opRejectConnRequest, opRemoteNameRequest,
+		opLinkKeyReply, opLinkKeyNegReply, opPINCodeReply, opPINCodeNegReply,
+		opIOCapabilityReply, opIOCapabilityNegReply, opUserConfirmReply, opUserConfirmNegReply:
+		if len(p) < 6 {
+			return false
+		}
+		addr = p[:6]
+		l = a.linkByAddr(e, addr)
+	}
+
+	switch op {
+	case opCreateConn:
+		var target [6]byte
+		copy(target[:], addr)
+		if l != nil {
+			e.status(op, statusConnAlreadyExists)
+			return true
+		}
+		e.status(op, statusSuccess)
+		remote := a.devices[target]
+		if remote == nil || remote == e || remote.scan&0x02 == 0 {
+			e.event(evConnComplete, []byte{statusPageTimeout}, le16(0), addr, []byte{0x01, 0x00})
+			return true
+		}
+		a.requests[remote][e.addr] = e
+		remote.event(evConnRequest, e.addr[:], e.class[:], []byte{0x01})
+	case opAcceptConnRequest:
+		var from [6]byte
+		copy(from[:], addr)
+		initiator := a.requests[e][from]
+		if initiator == nil {
+			e.status(op, statusUnknownConnection)
+			return true
+		}
+		delete(a.requests[e], from)
+		e.status(op, statusSuccess)
+
+		out := &link{local: initiator, remote: e, handle: a.nextHandle}
+		in := &link{local: e, remote: initiator, handle: a.nextHandle + 1, peer: out}
+		out.peer = in
+		a.nextHandle = (a.nextHandle+2)%0x0EFF + 1
+		a.conns[initiator][out.handle] = out
+		a.conns[e][in.handle] = in
+		initiator.event(evConnComplete, ok, le16(out.handle), e.addr[:], []byte{0x01, 0x00})
+		e.event(evConnComplete, ok, le16(in.handle), initiator.addr[:], []byte{0x01, 0x00})
+	case opRejectConnRequest:
+		var from [6]byte
+		copy(from[:], addr)
+		reason := byte(statusRejectedSecurity)
+		if len(p) > 6 {
+			reason = p[6]
+		}
+		initiator := a.requests[e][from]
+		delete(a.requests[e], from)
+		e.status(op, statusSuccess)
+		e.event(evConnComplete, []byte{reason}, le16(0), addr, []byte{0x01, 0x00})
+		if initiator != nil {
+			initiator.event(evConnComplete, []byte{reason}, le16(0), e.addr[:], []byte{0x01, 0x00})
+		}
+	case opDisconnect:
+		reason := byte(statusRemoteUserTerm)
+		if len(p) > 2 {
+			reason = p[2]
+		}
+		e.status(op, statusSuccess)
+		delete(a.conns[e], l.handle)
+		delete(a.conns[l.remote], l.peer.handle)
+		e.event(evDisconnComplete, ok, le16(l.handle), []byte{statusLocalHostTerm})
+		l.remote.event(evDisconnComplete, ok, le16(l.peer.handle), []byte{reason})
+	case opReadRemoteFeatures:
+		e.status(op, statusSuccess)
+		e.event(evRemoteFeatures, ok, le16(l.handle), l.remote.features(0))
+	case opReadRemoteExtFeature:
+		page := byte(0)
+		if len(p) > 2 {
+			page = p[2]
+		}
+		e.status(op, statusSuccess)
+		e.event(evRemoteExtFeatures, ok, le16(l.handle), []byte{page, 0x01}, l.remote.features(page))
+	case opRemoteNameRequest:
+		var target [6]byte
+		copy(target[:], addr)
+		e.status(op, statusSuccess)
+		remote := a.devices[target]
+		if remote == nil {
+			e.event(evRemoteNameComplete, []byte{statusPageTimeout}, addr, make([]byte, 248))
+			return true
+		}
+		e.event(evRemoteNameComplete, ok, addr, remote.name[:])
+	case opReadClockOffset:
+		e.status(op, statusSuccess)
+		e.event(evClockOffset, ok, le16(l.handle), le16(0))
+	case opWriteLinkPolicy, opWriteLinkSupervision:
+		e.complete(op, ok, le16(l.handle))
+	case opReadEncryptKeySize:
+		e.complete(op, ok, le16(l.handle), []byte{16})
+	case opSetConnEncrypt:
+		enable := byte(0x01)
+		if len(p) > 2 {
+			enable = p[2]
+		}
+		e.status(op, statusSuccess)
+		e.event(evEncryptChange, ok, le16(l.handle), []byte{enable})
+		l.remote.event(evEncryptChange, ok, le16(l.peer.handle), []byte{enable})
+	case opAuthRequested:
+		e.status(op, statusSuccess)
+		if l.auth != nil {
+			return true
+		}
+		au := &auth{initiator: l, responder: l.peer}
+		l.auth = au
+		l.peer.auth = au
+		e.event(evLinkKeyRequest, l.remote.addr[:])
+	default:
+		return a.pairing(e, op, p, l)
+	}
+
+	return true
+}
+
+// pairing runs the link key, secure simple pairing and legacy pin exchange
+func (a *Air) pairing(e *Emulator, op uint16, p []byte, l *link) bool {
+	switch op {
+	case opLinkKeyReply, opLinkKeyNegReply, opPINCodeReply, opPINCodeNegReply,
+		opIOCapabilityReply, opIOCapabilityNegReply, opUserConfirmReply, opUserConfirmNegReply:
+	default:
+		return false
+	}
+
+	e.complete(op, []byte{statusSuccess}, p[:6])
+	if l == nil || l.auth == nil {
+		return true
+	}
+	au := l.auth
+	side := 0
+	if l == au.responder {
+		side = 1
+	}
+
+	switch op {
+	case opLinkKeyReply:
+		var key [16]byte
+		copy(key[:], p[6:])
+		if side == 0 {
+			au.key = key
+			au.responder.local.event(evLinkKeyRequest, au.responder.remote.addr[:])
+			return true
+		}
+		if key != au.key {
+			a.fail(au, statusAuthFailure)
+			return true
+		}
+		a.done(au)
+	case opLinkKeyNegReply:
+		initiator := au.initiator
+		if initiator.local.ssp != 0 && initiator.remote.ssp != 0 {
+			au.ssp = true
+			initiator.local.event(evIOCapabilityRequest, initiator.remote.addr[:])
+		} else {
+			initiator.local.event(evPINCodeRequest, initiator.remote.addr[:])
+		}
+	case opIOCapabilityReply:
+		if len(p) < 9 {
+			a.fail(au, statusAuthFailure)
+			return true
+		}
+		au.ioCap[side] = p[6]
+		l.remote.event(evIOCapabilityResponse, l.local.addr[:], p[6:9])
+		if side == 0 {
+			au.responder.local.event(evIOCapabilityRequest, au.responder.remote.addr[:])
+			return true
+		}
+		passkey := make([]byte, 4)
+		rand.Read(passkey)
+		v := binaryOrder.Uint32(passkey) % 1000000
+		au.initiator.local.event(evUserConfirmRequest, au.initiator.remote.addr[:], le32(v))
+		au.responder.local.event(evUserConfirmRequest, au.responder.remote.addr[:], le32(v))
+	case opUserConfirmReply:
+		au.confirmed[side] = true
+		if !au.confirmed[0] || !au.confirmed[1] {
+			return true
+		}
+		keyType := byte(linkKeyAuthenticated192)
+		if au.ioCap[0] == ioCapabilityNoInputNoOutput || au.ioCap[1] == ioCapabilityNoInputNoOutput {
+			keyType = linkKeyUnauthenticated
+		}
+		a.newKey(au, keyType)
+		a.done(au)
+	case opPINCodeReply:
+		if len(p) < 7 || int(p[6]) > len(p)-7 {
+			a.fail(au, statusAuthFailure)
+			return true
+		}
+		pin := p[7 : 7+int(p[6])]
+		if side == 0 {
+			au.pin = append([]byte(nil), pin...)
+			au.responder.local.event(evPINCodeRequest, au.responder.remote.addr[:])
+			return true
+		}
+		if !bytes.Equal(pin, au.pin) {
+			a.fail(au, statusAuthFailure)
+			return true
+		}
+		a.newKey(au, linkKeyCombination)
+		a.done(au)
+	case opIOCapabilityNegReply:
+		a.fail(au, statusPairingNotAllowed)
+	case opUserConfirmNegReply:
+		a.fail(au, statusAuthFailure)
+	case opPINCodeNegReply:
+		a.fail(au, statusPINOrKeyMissing)
+	}
+
+	return true
+}
+
+func (a *Air) newKey(au *auth, keyType byte) {
+	var key [16]byte
+	rand.Read(key[:])
+	for _, l := range []*link{au.initiator, au.responder} {
+		if au.ssp {
+			l.local.event(evSimplePairingComplete, []byte{statusSuccess}, l.remote.addr[:])
+		}
+		l.local.event(evLinkKeyNotify, l.remote.addr[:], key[:], []byte{keyType})
+	}
+}
+
+func (a *Air) done(au *auth) {
+	au.initiator.auth = nil
+	au.responder.auth = nil
+	au.initiator.local.event(evAuthComplete, []byte{statusSuccess}, le16(au.initiator.handle))
+}
+
+func (a *Air) fail(au *auth, status byte) {
+	au.initiator.auth = nil
+	au.responder.auth = nil
+	if au.ssp {
+		for _, l := range []*link{au.initiator, au.responder} {
+			l.local.event(evSimplePairingComplete, []byte{status}, l.remote.addr[:])
+		}
+	}
+	au.initiator.local.event(evAuthComplete, []byte{status}, le16(au.initiator.handle))
+}
@@ -0,0 +1,233 @@
+package harness
+
+import (
+	"io"
+	"log"
+	"os"
+	"sync"
+)
+
+// Emulator answers the HCI commands the kernel issues to a vhci controller
+// and hands link control to the Air it is attached to
+type Emulator struct {
+	air    *Air
+	file   *os.File
+	wlock  sync.Mutex
+	index  uint16
+	addr   [6]byte
+	name   [248]byte
+	class  [3]byte
+	scan   byte
+	ssp    byte
+	leHost byte
+	done   chan struct{}
+}
+
+func newEmulator(air *Air, addr [6]byte) (*Emulator, error) {
+	f, index, err := openVHCI()
+	if err != nil {
+		return nil, err
+	}
+	e := &Emulator{
+		air:   air,
+		file:  f,
+		index: index,
+		addr:  addr,
+		done:  make(chan struct{}),
+	}
+	air.attach(e)
+	go e.readLoop()
+	return e, nil
+}
+
+func (e *Emulator) Index() uint16 {
+	return e.index
+}
+
+// Address in HCI byte order
+func (e *Emulator) Address() [6]byte {
+	return e.addr
+}
+
+func (e *Emulator) Close() error {
+	e.air.detach(e)
+	err := e.file.Close()
+	<-e.done
+	return err
+}
+
+func (e *Emulator) logf(format string, v ...interface{}) {
+	if e.air.Logf != nil {
+		e.air.Logf(format, v...)
+	}
+}
+
+func (e *Emulator) write(pkt []byte) {
+	e.wlock.Lock()
+	defer e.wlock.Unlock()
+	if _, err := e.file.Write(pkt); err != nil {
+		e.logf("hci%d: write %s", e.index, err)
+	}
+}
+
+func (e *Emulator) event(code byte, params ...[]byte) {
+	p := join(params...)
+	e.write(append([]byte{pktEvent, code, byte(len(p))}, p...))
+}
+
+func (e *Emulator) complete(op uint16, params ...[]byte) {
+	e.event(evCmdComplete, append([][]byte{{0x01}, le16(op)}, params...)...)
+}
+
+func (e *Emulator) status(op uint16, status byte) {
+	e.event(evCmdStatus, []byte{status, 0x01}, le16(op))
+}
+
+func (e *Emulator) acl(handle uint16, flags byte, data []byte) {
+	hdr := join([]byte{pktACL}, le16(handle|uint16(flags)<<12), le16(uint16(len(data))))
+	e.write(append(hdr, data...))
+}
+
+func (e *Emulator) readLoop() {
+	defer close(e.done)
+
+	buf := make([]byte, 4096)
+	for {
+		n, err := e.file.Read(buf)
+		if err != nil {
+			if err != io.EOF && !os.IsNotExist(err) {
+				e.logf("hci%d: read %s", e.index, err)
+			}
+			return
+		}
+		if n < 1 {
+			continue
+		}
+		pkt := make([]byte, n-1)
+		copy(pkt, buf[1:n])
+
+		switch buf[0] {
+		case pktCommand:
+			if len(pkt) < 3 {
+				continue
+			}
+			e.command(binaryOrder.Uint16(pkt), pkt[3:])
+		case pktACL:
+			if len(pkt) < 4 {
+				continue
+			}
+			h := binaryOrder.Uint16(pkt)
+			e.air.acl(e, h&0x0FFF, byte(h>>12), pkt[4:])
+		}
+	}
+}
+
+func (e *Emulator) command(op uint16, p []byte) {
+	ok := []byte{statusSuccess}
+
+	switch op {
+	case opReset:
+		e.air.reset(e)
+		e.complete(op, ok)
+	case opReadLocalVersion:
+		// hci 4.0, lmp 4.0, manufacturer 0x05f1 linux foundation
+		e.complete(op, ok, []byte{0x06}, le16(0), []byte{0x06}, le16(0x05F1), le16(0))
+	case opReadLocalCommands:
+		e.complete(op, ok, make([]byte, 64))
+	case opReadLocalFeatures:
+		e.complete(op, ok, lmpFeatures[:])
+	case opReadLocalExtFeatures:
+		page := byte(0)
+		if len(p) > 0 {
+			page = p[0]
+		}
+		e.air.lock.Lock()
+		f := e.features(page)
+		e.air.lock.Unlock()
+		e.complete(op, ok, []byte{page, 0x01}, f)
+	case opReadBufferSize:
+		e.complete(op, ok, le16(1021), []byte{0xFF}, le16(8), le16(8))
+	case opReadBDAddr:
+		e.complete(op, ok, e.addr[:])
+	case opReadClassOfDevice:
+		e.complete(op, ok, e.class[:])
+	case opWriteClassOfDevice:
+		copy(e.class[:], p)
+		e.complete(op, ok)
+	case opReadLocalName:
+		e.complete(op, ok, e.name[:])
+	case opWriteLocalName:
+		copy(e.name[:], p)
+		e.complete(op, ok)
+	case opReadVoiceSetting:
+		e.complete(op, ok, le16(0x0060))
+	case opReadNumSupportedIAC:
+		e.complete(op, ok, []byte{0x01})
+	case opReadCurrentIACLAP:
+		e.complete(op, ok, []byte{0x01, 0x33, 0x8B, 0x9E})
+	case opReadInquiryTxPower:
+		e.complete(op, ok, []byte{0x00})
+	case opWriteScanEnable:
+		if len(p) > 0 {
+			e.air.setScan(e, p[0])
+		}
+		e.complete(op, ok)
+	case opWriteSSPMode:
+		if len(p) > 0 {
+			e.air.setSSP(e, p[0])
+		}
+		e.complete(op, ok)
+	case opWriteLEHostSupported:
+		if len(p) > 0 {
+			e.air.lock.Lock()
+			e.leHost = p[0]
+			e.air.lock.Unlock()
+		}
+		e.complete(op, ok)
+	case opLEReadBufferSize:
+		e.complete(op, ok, le16(0), []byte{0x00})
+	case opLEReadLocalFeatures, opLEReadSupportedState:
+		e.complete(op, ok, make([]byte, 8))
+	case opLEReadAdvTxPower:
+		e.complete(op, ok, []byte{0x00})
+	case opLEReadAcceptListSize:
+		e.complete(op, ok, []byte{0x08})
+	case opInquiry:
+		e.status(op, statusSuccess)
+		e.event(evInquiryComplete, ok)
+	default:
+		if e.air.command(e, op, p) {
+			return
+		}
+		if op>>10 == 0x01 {
+			e.logf("hci%d: unknown link command %#04x", e.index, op)
+			e.status(op, statusSuccess)
+			return
+		}
+		e.logf("hci%d: unknown command %#04x", e.index, op)
+		e.complete(op, ok)
+	}
+}
+
+// features page 1 reflects host support set through the write commands,
+// callers hold the air lock
+func (e *Emulator) features(page byte) []byte {
+	f := make([]byte, 8)
+	switch page {
+	case 0:
+		copy(f, lmpFeatures[:])
+	case 1:
+		if e.ssp != 0 {
+			f[0] |= 0x01
+		}
+		if e.leHost != 0 {
+			f[0] |= 0x02
+		}
+	}
+	return f
+}
+
+// DefaultLogf logs unknown commands through the standard logger
+func DefaultLogf(format string, v ...interface{}) {
+	log.Printf(format, v...)
+}
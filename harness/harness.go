@@ -0,0 +1,225 @@
+package harness
+
+import (
+	"errors"
+	"syscall"
+	"time"
+	"vitrhid/mgmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// Harness creates two virtual controllers on the same Air, Device is meant
+// for vitrhid and Host plays the phone that connects to it
+//
+//	h, err := harness.New()
+//	// run vitrhid against h.Device.Index()
+//	err = h.Pair()
+//	host, err := h.ConnectHID()
+//	report, err := host.ReadReport()
+type Harness struct {
+	Air    *Air
+	Device *Emulator
+	Host   *Emulator
+	ll     *mgmt.BluetoothLowLevel
+	cancel []func()
+}
+
+var (
+	DeviceAddress = [6]byte{0x01, 0x00, 0x00, 0xDE, 0xAD, 0x00}
+	HostAddress   = [6]byte{0x02, 0x00, 0x00, 0xDE, 0xAD, 0x00}
+)
+
+const (
+	solBluetooth     = 274
+	btSecurity       = 4
+	btSecurityMedium = 2
+)
+
+var ErrIndexTimeout = errors.New("controller index not added")
+
+func New() (*Harness, error) {
+	h := &Harness{Air: NewAir()}
+
+	h.ll = mgmt.NewBluetoothLowLevel()
+	if err := h.ll.Connect(); err != nil {
+		return nil, err
+	}
+
+	added := make(chan uint16, 4)
+	cancel := h.ll.On(mgmt.EvIndexAdded, func(ev *mgmt.Event) {
+		select {
+		case added <- ev.Controller:
+		default:
+		}
+	})
+	defer cancel()
+
+	var err error
+	if h.Device, err = h.Air.NewEmulator(DeviceAddress); err != nil {
+		h.Close()
+		return nil, err
+	}
+	if h.Host, err = h.Air.NewEmulator(HostAddress); err != nil {
+		h.Close()
+		return nil, err
+	}
+
+	if err := waitIndexes(added, h.Device.Index(), h.Host.Index()); err != nil {
+		h.Close()
+		return nil, err
+	}
+
+	// answer pairing confirmations on both sides, vitrhid normally leaves
+	// this to the bluez agent
+	h.cancel = append(h.cancel, h.ll.On(mgmt.EvUserConfirmationRequest, func(ev *mgmt.Event) {
+		req, ok := ev.Payload.(*mgmt.UserConfirmationRequest)
+		if !ok {
+			return
+		}
+		go h.ll.UserConfirmationReply(ev.Controller, req.Address, req.AddressType)
+	}))
+
+	if err := h.setupHost(); err != nil {
+		h.Close()
+		return nil, err
+	}
+
+	return h, nil
+}
+
+func waitIndexes(added chan uint16, indexes ...uint16) error {
+	wait := make(map[uint16]bool)
+	for _, index := range indexes {
+		wait[index] = true
+	}
+	timeout := time.After(time.Second * 10)
+	for len(wait) > 0 {
+		select {
+		case index := <-added:
+			delete(wait, index)
+		case <-timeout:
+			return ErrIndexTimeout
+		}
+	}
+	return nil
+}
+
+func (h *Harness) setupHost() error {
+	index := h.Host.Index()
+	if _, err := h.ll.SetSecureSimplePairing(index, mgmt.On); err != nil {
+		return err
+	}
+	if _, err := h.ll.SetBondable(index, mgmt.On); err != nil {
+		return err
+	}
+	if _, err := h.ll.SetPowered(index, mgmt.On); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Pair the host with the device, the device has to be powered and connectable
+func (h *Harness) Pair() error {
+	_, err := h.ll.PairDevice(h.Host.Index(), h.Device.Address(), mgmt.AddressBREDR, mgmt.IOCapabilityNoInputNoOutput)
+	return err
+}
+
+func (h *Harness) Close() error {
+	for _, cancel := range h.cancel {
+		cancel()
+	}
+	h.cancel = nil
+	if h.Host != nil {
+		h.Host.Close()
+	}
+	if h.Device != nil {
+		h.Device.Close()
+	}
+	return h.ll.Close()
+}
+
+// HIDHost is the host end of a HID connection, control and interrupt
+// channel sockets dialed from Host to Device
+type HIDHost struct {
+	Control   int
+	Interrupt int
+}
+
+func sockaddr(addr [6]byte, psm uint16) *unix.SockaddrL2 {
+	sa := &unix.SockaddrL2{PSM: psm}
+	// SockaddrL2 keeps the address in display order
+	for i := 0; i < 6; i++ {
+		sa.Addr[i] = addr[5-i]
+	}
+	return sa
+}
+
+// DialL2CAP connect from local to remote psm at medium security, which
+// makes the kernel authenticate and encrypt the link first
+func DialL2CAP(local, remote [6]byte, psm uint16) (int, error) {
+	fd, err := unix.Socket(syscall.AF_BLUETOOTH, syscall.SOCK_SEQPACKET, unix.BTPROTO_L2CAP)
+	if err != nil {
+		return -1, err
+	}
+
+	if err := unix.Bind(fd, sockaddr(local, 0)); err != nil {
+		unix.Close(fd)
+		return -1, err
+	}
+
+	// struct bt_security { level, key_size }
+	if err := unix.SetsockoptString(fd, solBluetooth, btSecurity, string([]byte{btSecurityMedium, 0})); err != nil {
+		unix.Close(fd)
+		return -1, err
+	}
+
+	if err := unix.Connect(fd, sockaddr(remote, psm)); err != nil {
+		unix.Close(fd)
+		return -1, err
+	}
+
+	return fd, nil
+}
+
+func (h *Harness) ConnectHID() (*HIDHost, error) {
+	control, err := DialL2CAP(h.Host.Address(), h.Device.Address(), 0x11)
+	if err != nil {
+		return nil, err
+	}
+	interrupt, err := DialL2CAP(h.Host.Address(), h.Device.Address(), 0x13)
+	if err != nil {
+		unix.Close(control)
+		return nil, err
+	}
+	return &HIDHost{Control: control, Interrupt: interrupt}, nil
+}
+
+// ReadReport blocks until the device sends a report on the interrupt channel
+func (d *HIDHost) ReadReport() ([]byte, error) {
+	buf := make([]byte, 1024)
+	n, err := unix.Read(d.Interrupt, buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+// Request sends a hidp request on the control channel and reads the first
+// packet of the answer, a HANDSHAKE or DATA
+func (d *HIDHost) Request(request ...byte) ([]byte, error) {
+	if _, err := unix.Write(d.Control, request); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 1024)
+	n, err := unix.Read(d.Control, buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+func (d *HIDHost) Close() error {
+	unix.Close(d.Interrupt)
+	return unix.Close(d.Control)
+}
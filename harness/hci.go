@@ -0,0 +1,136 @@
+package harness
+
+import (
+	"encoding/binary"
+)
+
+var binaryOrder = binary.LittleEndian
+
+const (
+	pktCommand = 0x01
+	pktACL     = 0x02
+	pktEvent   = 0x04
+	pktVendor  = 0xFF
+)
+
+const (
+	evInquiryComplete       = 0x01
+	evConnComplete          = 0x03
+	evConnRequest           = 0x04
+	evDisconnComplete       = 0x05
+	evAuthComplete          = 0x06
+	evRemoteNameComplete    = 0x07
+	evEncryptChange         = 0x08
+	evRemoteFeatures        = 0x0B
+	evCmdComplete           = 0x0E
+	evCmdStatus             = 0x0F
+	evNumCompletedPackets   = 0x13
+	evPINCodeRequest        = 0x16
+	evLinkKeyRequest        = 0x17
+	evLinkKeyNotify         = 0x18
+	evClockOffset           = 0x1C
+	evRemoteExtFeatures     = 0x23
+	evIOCapabilityRequest   = 0x31
+	evIOCapabilityResponse  = 0x32
+	evUserConfirmRequest    = 0x33
+	evSimplePairingComplete = 0x36
+)
+
+func opcode(ogf, ocf uint16) uint16 {
+	return ogf<<10 | ocf
+}
+
+var (
+	opInquiry              = opcode(0x01, 0x0001)
+	opCreateConn           = opcode(0x01, 0x0005)
+	opDisconnect           = opcode(0x01, 0x0006)
+	opAcceptConnRequest    = opcode(0x01, 0x0009)
+	opRejectConnRequest    = opcode(0x01, 0x000A)
+	opLinkKeyReply         = opcode(0x01, 0x000B)
+	opLinkKeyNegReply      = opcode(0x01, 0x000C)
+	opPINCodeReply         = opcode(0x01, 0x000D)
+	opPINCodeNegReply      = opcode(0x01, 0x000E)
+	opAuthRequested        = opcode(0x01, 0x0011)
+	opSetConnEncrypt       = opcode(0x01, 0x0013)
+	opRemoteNameRequest    = opcode(0x01, 0x0019)
+	opReadRemoteFeatures   = opcode(0x01, 0x001B)
+	opReadRemoteExtFeature = opcode(0x01, 0x001C)
+	opReadClockOffset      = opcode(0x01, 0x001F)
+	opIOCapabilityReply    = opcode(0x01, 0x002B)
+	opUserConfirmReply     = opcode(0x01, 0x002C)
+	opUserConfirmNegReply  = opcode(0x01, 0x002D)
+	opIOCapabilityNegReply = opcode(0x01, 0x0034)
+	opWriteLinkPolicy      = opcode(0x02, 0x000D)
+	opReset                = opcode(0x03, 0x0003)
+	opWriteLocalName       = opcode(0x03, 0x0013)
+	opReadLocalName        = opcode(0x03, 0x0014)
+	opWriteScanEnable      = opcode(0x03, 0x001A)
+	opReadClassOfDevice    = opcode(0x03, 0x0023)
+	opWriteClassOfDevice   = opcode(0x03, 0x0024)
+	opReadVoiceSetting     = opcode(0x03, 0x0025)
+	opWriteLinkSupervision = opcode(0x03, 0x0037)
+	opReadNumSupportedIAC  = opcode(0x03, 0x0038)
+	opReadCurrentIACLAP    = opcode(0x03, 0x0039)
+	opWriteSSPMode         = opcode(0x03, 0x0056)
+	opReadInquiryTxPower   = opcode(0x03, 0x0058)
+	opWriteLEHostSupported = opcode(0x03, 0x006D)
+	opReadLocalVersion     = opcode(0x04, 0x0001)
+	opReadLocalCommands    = opcode(0x04, 0x0002)
+	opReadLocalFeatures    = opcode(0x04, 0x0003)
+	opReadLocalExtFeatures = opcode(0x04, 0x0004)
+	opReadBufferSize       = opcode(0x04, 0x0005)
+	opReadBDAddr           = opcode(0x04, 0x0009)
+	opReadEncryptKeySize   = opcode(0x05, 0x0008)
+	opLEReadBufferSize     = opcode(0x08, 0x0002)
+	opLEReadLocalFeatures  = opcode(0x08, 0x0003)
+	opLEReadAdvTxPower     = opcode(0x08, 0x0007)
+	opLEReadAcceptListSize = opcode(0x08, 0x000F)
+	opLEReadSupportedState = opcode(0x08, 0x001C)
+)
+
+const (
+	statusSuccess            = 0x00
+	statusUnknownConnection  = 0x02
+	statusPageTimeout        = 0x04
+	statusAuthFailure        = 0x05
+	statusPINOrKeyMissing    = 0x06
+	statusRejectedSecurity   = 0x0E
+	statusRemoteUserTerm     = 0x13
+	statusLocalHostTerm      = 0x16
+	statusPairingNotAllowed  = 0x18
+	statusConnAlreadyExists  = 0x0B
+	statusUnsupportedFeature = 0x11
+)
+
+const (
+	ioCapabilityNoInputNoOutput = 0x03
+)
+
+const (
+	linkKeyCombination      = 0x00
+	linkKeyUnauthenticated  = 0x04
+	linkKeyAuthenticated192 = 0x05
+)
+
+// local LMP features, encryption, LE, simultaneous LE BR/EDR, SSP and extended features
+var lmpFeatures = [8]byte{0x04, 0x00, 0x00, 0x00, 0x40, 0x00, 0x0A, 0x80}
+
+func le16(v uint16) []byte {
+	b := make([]byte, 2)
+	binaryOrder.PutUint16(b, v)
+	return b
+}
+
+func le32(v uint32) []byte {
+	b := make([]byte, 4)
+	binaryOrder.PutUint32(b, v)
+	return b
+}
+
+func join(parts ...[]byte) []byte {
+	var out []byte
+	for _, p := range parts {
+		out = append(out, p...)
+	}
+	return out
+}
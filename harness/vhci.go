@@ -0,0 +1,40 @@
+package harness
+
+import (
+	"errors"
+	"os"
+)
+
+const vhciPath = "/dev/vhci"
+
+// hciPrimary asks vhci for a BR/EDR/LE primary controller
+const hciPrimary = 0x00
+
+var ErrVHCIResponse = errors.New("unexpected vhci response")
+
+// openVHCI creates a virtual controller, the kernel replies with the
+// vendor packet 0xff, opcode, index before it sends any command
+func openVHCI() (*os.File, uint16, error) {
+	f, err := os.OpenFile(vhciPath, os.O_RDWR, 0)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if _, err := f.Write([]byte{pktVendor, hciPrimary}); err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+
+	buf := make([]byte, 4)
+	n, err := f.Read(buf)
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	if n != 4 || buf[0] != pktVendor || buf[1] != hciPrimary {
+		f.Close()
+		return nil, 0, ErrVHCIResponse
+	}
+
+	return f, binaryOrder.Uint16(buf[2:]), nil
+}
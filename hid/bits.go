@@ -0,0 +1,36 @@
+package hid
+
+// PutBits writes the low size bits of v at bit offset of b, least
+// significant bit first as reports are laid out
+func PutBits(b []byte, offset, size int, v uint32) {
+	for i := 0; i < size; i++ {
+		pos := offset + i
+		mask := byte(1) << uint(pos%8)
+		if i < 32 && v>>uint(i)&1 != 0 {
+			b[pos/8] |= mask
+		} else {
+			b[pos/8] &^= mask
+		}
+	}
+}
+
+// Bits reads size bits at bit offset of b
+func Bits(b []byte, offset, size int) uint32 {
+	var v uint32
+	for i := 0; i < size && i < 32; i++ {
+		pos := offset + i
+		if b[pos/8]>>uint(pos%8)&1 != 0 {
+			v |= 1 << uint(i)
+		}
+	}
+	return v
+}
+
+// SignedBits reads size bits at bit offset of b sign extended
+func SignedBits(b []byte, offset, size int) int32 {
+	v := Bits(b, offset, size)
+	if size > 0 && size < 32 && v>>uint(size-1)&1 != 0 {
+		v |= ^uint32(0) << uint(size)
+	}
+	return int32(v)
+}
@@ -0,0 +1,206 @@
+package hid
+
+// boot protocol report ids, hidp sends them in front of boot reports in
+// place of the report ids of the descriptor
+const (
+	BootKeyboardReportID byte = 1
+	BootMouseReportID    byte = 2
+)
+
+// boot report sizes without report id
+const (
+	BootKeyboardSize = 8
+	BootMouseSize    = 3
+)
+
+// BootDevice the boot reports a descriptor translates to
+type BootDevice byte
+
+const (
+	BootKeyboard BootDevice = 1 << iota
+	BootMouse
+)
+
+func usagePage(usage uint32) uint16 {
+	return uint16(usage >> 16)
+}
+
+func (f *Field) page() uint16 {
+	if f.Variable() {
+		return usagePage(f.Usage(0))
+	}
+	return usagePage(f.UsageMinimum)
+}
+
+// bootDevice keyboards have keys, mice relative x and y
+func bootDevice(r *Report) BootDevice {
+	if r.Kind != ReportInput {
+		return 0
+	}
+	var keys, x, y bool
+	for _, f := range r.Fields {
+		if f.Constant() {
+			continue
+		}
+		if f.page() == PageKeyboard {
+			keys = true
+		}
+		if f.Variable() && f.Flags&Relative != 0 {
+			x = x || f.HasUsage(ExtendedUsage(PageGenericDesktop, uint16(DesktopX)))
+			y = y || f.HasUsage(ExtendedUsage(PageGenericDesktop, uint16(DesktopY)))
+		}
+	}
+	switch {
+	case keys:
+		return BootKeyboard
+	case x && y:
+		return BootMouse
+	}
+	return 0
+}
+
+// Boot the boot devices the input reports can be sent as
+func (d *Descriptor) Boot() BootDevice {
+	var boot BootDevice
+	for _, r := range d.Reports {
+		boot |= bootDevice(r)
+	}
+	return boot
+}
+
+func (f *Field) value(data []byte, n int) int32 {
+	if f.Signed() {
+		return SignedBits(data, f.BitOffset+n*f.Size, f.Size)
+	}
+	return int32(Bits(data, f.BitOffset+n*f.Size, f.Size))
+}
+
+// BootReport translates input report id into its boot report, ok is false
+// for reports without one
+func (d *Descriptor) BootReport(id byte, data []byte) (byte, []byte, bool) {
+	r := d.Report(ReportInput, id)
+	if r == nil {
+		return 0, nil, false
+	}
+	report := make([]byte, r.Size())
+	copy(report, data)
+
+	switch bootDevice(r) {
+	case BootKeyboard:
+		return BootKeyboardReportID, bootKeyboard(r, report), true
+	case BootMouse:
+		return BootMouseReportID, bootMouse(r, report), true
+	}
+	return 0, nil, false
+}
+
+// bootKeyboard modifier bits, a reserved byte and six key codes, more keys
+// than that roll over
+func bootKeyboard(r *Report, data []byte) []byte {
+	boot := make([]byte, BootKeyboardSize)
+	var keys []byte
+	press := func(usage uint32) {
+		id := uint16(usage)
+		switch {
+		case usagePage(usage) != PageKeyboard || id == 0:
+		case id >= uint16(KeyLeftControl) && id <= uint16(KeyRightGUI):
+			boot[0] |= 1 << (id - uint16(KeyLeftControl))
+		case id <= 0xff:
+			keys = append(keys, byte(id))
+		}
+	}
+
+	for _, f := range r.Fields {
+		if f.Constant() {
+			continue
+		}
+		for n := 0; n < f.Count; n++ {
+			v := f.value(data, n)
+			if f.Variable() {
+				if v != 0 {
+					press(f.Usage(n))
+				}
+				continue
+			}
+			if v >= f.LogicalMin && v <= f.LogicalMax {
+				press(f.UsageMinimum + uint32(v-f.LogicalMin))
+			}
+		}
+	}
+
+	if len(keys) > BootKeyboardSize-2 {
+		for i := 2; i < BootKeyboardSize; i++ {
+			boot[i] = 0x01 // ErrorRollOver
+		}
+		return boot
+	}
+	copy(boot[2:], keys)
+	return boot
+}
+
+// bootMouse three buttons and relative x and y from -127 to 127
+func bootMouse(r *Report, data []byte) []byte {
+	boot := make([]byte, BootMouseSize)
+	axis := func(v int32) byte {
+		if v < -127 {
+			v = -127
+		} else if v > 127 {
+			v = 127
+		}
+		return byte(int8(v))
+	}
+
+	for _, f := range r.Fields {
+		if f.Constant() || !f.Variable() {
+			continue
+		}
+		for n := 0; n < f.Count; n++ {
+			usage, v := f.Usage(n), f.value(data, n)
+			switch {
+			case usagePage(usage) == PageButton && uint16(usage) >= 1 && uint16(usage) <= 3:
+				if v != 0 {
+					boot[0] |= 1 << (uint16(usage) - 1)
+				}
+			case usage == ExtendedUsage(PageGenericDesktop, uint16(DesktopX)):
+				boot[1] = axis(v)
+			case usage == ExtendedUsage(PageGenericDesktop, uint16(DesktopY)):
+				boot[2] = axis(v)
+			}
+		}
+	}
+	return boot
+}
+
+// FromBootOutput translates the boot keyboard led byte into the output
+// report of the descriptor carrying the leds
+func (d *Descriptor) FromBootOutput(data []byte) (byte, []byte, bool) {
+	if len(data) == 0 {
+		return 0, nil, false
+	}
+	for _, r := range d.Reports {
+		if r.Kind != ReportOutput {
+			continue
+		}
+		report := make([]byte, r.Size())
+		leds := false
+		for _, f := range r.Fields {
+			if f.Constant() || !f.Variable() {
+				continue
+			}
+			for n := 0; n < f.Count; n++ {
+				usage := f.Usage(n)
+				if usagePage(usage) != PageLED || uint16(usage) < 1 || uint16(usage) > 5 {
+					continue
+				}
+				leds = true
+				if data[0]>>(uint16(usage)-1)&1 != 0 {
+					PutBits(report, f.BitOffset+n*f.Size, f.Size, 1)
+				}
+			}
+		}
+		if leds {
+			return r.ID, report, true
+		}
+	}
+	return 0, nil, false
+}
@@ -0,0 +1,315 @@
+package hid
+
+import (
+	"errors"
+	"fmt"
+)
+
+// MainFlags of Input, Output and Feature, the zero values name the
+// defaults so a field reads Data|Variable|Absolute
+type MainFlags uint32
+
+const (
+	Data           MainFlags = 0
+	Constant       MainFlags = 1 << 0
+	Array          MainFlags = 0
+	Variable       MainFlags = 1 << 1
+	Absolute       MainFlags = 0
+	Relative       MainFlags = 1 << 2
+	NoWrap         MainFlags = 0
+	Wrap           MainFlags = 1 << 3
+	Linear         MainFlags = 0
+	NonLinear      MainFlags = 1 << 4
+	PreferredState MainFlags = 0
+	NoPreferred    MainFlags = 1 << 5
+	NoNullPosition MainFlags = 0
+	NullState      MainFlags = 1 << 6
+	NonVolatile    MainFlags = 0
+	Volatile       MainFlags = 1 << 7
+	BitField       MainFlags = 0
+	BufferedBytes  MainFlags = 1 << 8
+)
+
+type CollectionType byte
+
+const (
+	CollectionPhysical      CollectionType = 0x00
+	CollectionApplication   CollectionType = 0x01
+	CollectionLogical       CollectionType = 0x02
+	CollectionReport        CollectionType = 0x03
+	CollectionNamedArray    CollectionType = 0x04
+	CollectionUsageSwitch   CollectionType = 0x05
+	CollectionUsageModifier CollectionType = 0x06
+)
+
+// units of the SI linear and english rotation systems, combine other units
+// from the nibbles of the HID spec
+const (
+	UnitNone       uint32 = 0x00
+	UnitCentimeter uint32 = 0x11
+	UnitRadians    uint32 = 0x12
+	UnitInch       uint32 = 0x13
+	UnitDegrees    uint32 = 0x14
+	UnitSecond     uint32 = 0x1001
+	UnitGram       uint32 = 0x101
+	UnitKelvin     uint32 = 0x10001
+	UnitAmpere     uint32 = 0x100001
+	UnitCandela    uint32 = 0x1000001
+)
+
+var (
+	ErrUnbalancedCollection = errors.New("hid: unbalanced collection")
+	ErrOutsideCollection    = errors.New("hid: main item outside of a collection")
+	ErrMissingReportID      = errors.New("hid: report items before the first report id")
+	ErrReportIDZero         = errors.New("hid: report id 0 is reserved")
+	ErrReportIDReused       = errors.New("hid: report id used in two application collections")
+	ErrMissingReportSize    = errors.New("hid: report size or count not set")
+	ErrLogicalRange         = errors.New("hid: logical minimum above maximum")
+	ErrPopWithoutPush       = errors.New("hid: pop without push")
+	ErrVolatileInput        = errors.New("hid: inputs can not be volatile")
+)
+
+type builderState struct {
+	reportSize  uint32
+	reportCount uint32
+	reportID    byte
+	logicalMin  int32
+	logicalMax  int32
+}
+
+// Builder assembles a report descriptor from typed items, the first
+// mistake is kept and returned by Bytes
+type Builder struct {
+	items       []Item
+	err         error
+	depth       int
+	application int
+	state       builderState
+	stack       []builderState
+	idsUsed     bool
+	mainItems   int
+	ids         map[byte]int
+}
+
+func NewBuilder() *Builder {
+	return &Builder{ids: make(map[byte]int)}
+}
+
+func (b *Builder) fail(err error) *Builder {
+	if b.err == nil {
+		b.err = fmt.Errorf("%w at item %d", err, len(b.items))
+	}
+	return b
+}
+
+func (b *Builder) item(typ ItemType, tag byte, data []byte) *Builder {
+	b.items = append(b.items, Item{Type: typ, Tag: tag, Data: data})
+	return b
+}
+
+func (b *Builder) UsagePage(page uint16) *Builder {
+	return b.item(ItemGlobal, TagUsagePage, unsignedData(uint32(page)))
+}
+
+// Usage on the current page, ExtendedUsage values name their own
+func (b *Builder) Usage(usage uint32) *Builder {
+	return b.item(ItemLocal, TagUsage, usageData(usage))
+}
+
+// Usages adds one Usage item for each of usages
+func (b *Builder) Usages(usages ...uint32) *Builder {
+	for _, u := range usages {
+		b.Usage(u)
+	}
+	return b
+}
+
+func (b *Builder) UsageMinimum(usage uint32) *Builder {
+	return b.item(ItemLocal, TagUsageMinimum, usageData(usage))
+}
+
+func (b *Builder) UsageMaximum(usage uint32) *Builder {
+	return b.item(ItemLocal, TagUsageMaximum, usageData(usage))
+}
+
+// UsageRange is UsageMinimum and UsageMaximum
+func (b *Builder) UsageRange(min, max uint32) *Builder {
+	return b.UsageMinimum(min).UsageMaximum(max)
+}
+
+func usageData(usage uint32) []byte {
+	if usage > 0xffff {
+		return []byte{byte(usage), byte(usage >> 8), byte(usage >> 16), byte(usage >> 24)}
+	}
+	return unsignedData(usage)
+}
+
+func (b *Builder) DesignatorIndex(index uint32) *Builder {
+	return b.item(ItemLocal, TagDesignatorIndex, unsignedData(index))
+}
+
+func (b *Builder) StringIndex(index uint32) *Builder {
+	return b.item(ItemLocal, TagStringIndex, unsignedData(index))
+}
+
+func (b *Builder) LogicalMinimum(v int32) *Builder {
+	b.state.logicalMin = v
+	return b.item(ItemGlobal, TagLogicalMinimum, signedData(v))
+}
+
+func (b *Builder) LogicalMaximum(v int32) *Builder {
+	b.state.logicalMax = v
+	return b.item(ItemGlobal, TagLogicalMaximum, signedData(v))
+}
+
+// Logical is LogicalMinimum and LogicalMaximum
+func (b *Builder) Logical(min, max int32) *Builder {
+	return b.LogicalMinimum(min).LogicalMaximum(max)
+}
+
+func (b *Builder) PhysicalMinimum(v int32) *Builder {
+	return b.item(ItemGlobal, TagPhysicalMinimum, signedData(v))
+}
+
+func (b *Builder) PhysicalMaximum(v int32) *Builder {
+	return b.item(ItemGlobal, TagPhysicalMaximum, signedData(v))
+}
+
+// Physical is PhysicalMinimum and PhysicalMaximum
+func (b *Builder) Physical(min, max int32) *Builder {
+	return b.PhysicalMinimum(min).PhysicalMaximum(max)
+}
+
+// Unit one of the Unit constants or a nibble encoded system and exponents
+func (b *Builder) Unit(unit uint32) *Builder {
+	return b.item(ItemGlobal, TagUnit, unsignedData(unit))
+}
+
+// UnitExponent base 10 exponent from -8 to 7, stored as a nibble
+func (b *Builder) UnitExponent(exponent int8) *Builder {
+	if exponent < -8 || exponent > 7 {
+		return b.fail(fmt.Errorf("hid: unit exponent %d out of range", exponent))
+	}
+	return b.item(ItemGlobal, TagUnitExponent, []byte{byte(exponent) & 0x0f})
+}
+
+// ReportSize bits per field
+func (b *Builder) ReportSize(bits uint32) *Builder {
+	b.state.reportSize = bits
+	return b.item(ItemGlobal, TagReportSize, unsignedData(bits))
+}
+
+// ReportCount fields of the next main item
+func (b *Builder) ReportCount(count uint32) *Builder {
+	b.state.reportCount = count
+	return b.item(ItemGlobal, TagReportCount, unsignedData(count))
+}
+
+// ReportID every report of a descriptor carries one once any does
+func (b *Builder) ReportID(id byte) *Builder {
+	if id == 0 {
+		return b.fail(ErrReportIDZero)
+	}
+	if b.mainItems > 0 && !b.idsUsed {
+		return b.fail(ErrMissingReportID)
+	}
+	if app, ok := b.ids[id]; ok && app != b.application {
+		return b.fail(ErrReportIDReused)
+	}
+	b.ids[id] = b.application
+	b.idsUsed = true
+	b.state.reportID = id
+	return b.item(ItemGlobal, TagReportID, []byte{id})
+}
+
+// Push saves the global state, Pop restores it
+func (b *Builder) Push() *Builder {
+	b.stack = append(b.stack, b.state)
+	return b.item(ItemGlobal, TagPush, nil)
+}
+
+func (b *Builder) Pop() *Builder {
+	if len(b.stack) == 0 {
+		return b.fail(ErrPopWithoutPush)
+	}
+	b.state = b.stack[len(b.stack)-1]
+	b.stack = b.stack[:len(b.stack)-1]
+	return b.item(ItemGlobal, TagPop, nil)
+}
+
+func (b *Builder) Collection(typ CollectionType) *Builder {
+	if b.depth == 0 {
+		b.application++
+	}
+	b.depth++
+	return b.item(ItemMain, TagCollection, []byte{byte(typ)})
+}
+
+func (b *Builder) EndCollection() *Builder {
+	if b.depth == 0 {
+		return b.fail(ErrUnbalancedCollection)
+	}
+	b.depth--
+	return b.item(ItemMain, TagEndCollection, nil)
+}
+
+func (b *Builder) field(tag byte, flags MainFlags) *Builder {
+	switch {
+	case b.depth == 0:
+		return b.fail(ErrOutsideCollection)
+	case b.state.reportSize == 0 || b.state.reportCount == 0:
+		return b.fail(ErrMissingReportSize)
+	case flags&Constant == 0 && b.state.logicalMin > b.state.logicalMax:
+		return b.fail(ErrLogicalRange)
+	}
+	b.mainItems++
+	return b.item(ItemMain, tag, unsignedData(uint32(flags)))
+}
+
+func (b *Builder) Input(flags MainFlags) *Builder {
+	if flags&Volatile != 0 {
+		return b.fail(ErrVolatileInput)
+	}
+	return b.field(TagInput, flags)
+}
+
+func (b *Builder) Output(flags MainFlags) *Builder {
+	return b.field(TagOutput, flags)
+}
+
+func (b *Builder) Feature(flags MainFlags) *Builder {
+	return b.field(TagFeature, flags)
+}
+
+// Padding constant input bits to fill a report up to a byte boundary
+func (b *Builder) Padding(bits uint32) *Builder {
+	return b.ReportSize(1).ReportCount(bits).Input(Constant | Variable | Absolute)
+}
+
+func (b *Builder) Items() []Item {
+	return b.items
+}
+
+// Bytes the encoded descriptor or the first mistake
+func (b *Builder) Bytes() ([]byte, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	if b.depth != 0 {
+		return nil, ErrUnbalancedCollection
+	}
+	var buf []byte
+	for _, i := range b.items {
+		buf = append(buf, i.Bytes()...)
+	}
+	return buf, nil
+}
+
+// MustBytes is Bytes for descriptors fixed at compile time
+func (b *Builder) MustBytes() []byte {
+	buf, err := b.Bytes()
+	if err != nil {
+		panic(err)
+	}
+	return buf
+}
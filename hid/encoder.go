@@ -0,0 +1,198 @@
+package hid
+
+import "errors"
+
+// hidp DATA transaction, the low bits carry the report kind
+const hidpData = 0xA0
+
+var (
+	ErrNoReport   = errors.New("hid: descriptor has no such report")
+	ErrNoUsage    = errors.New("hid: report has no field with the usage")
+	ErrArrayFull  = errors.New("hid: more usages than array slots")
+	ErrNoInstance = errors.New("hid: descriptor has no such collection")
+)
+
+// Encoder packs one report of a parsed descriptor field by field, values
+// are clamped to the logical range of their field. it is library api for
+// descriptors known only at run time, vitrhid sends its own descriptors
+// with the structs hidgen writes for them
+type Encoder struct {
+	desc   *Descriptor
+	report *Report
+	data   []byte
+}
+
+func NewEncoder(desc *Descriptor, kind ReportKind, id byte) (*Encoder, error) {
+	r := desc.Report(kind, id)
+	if r == nil {
+		return nil, ErrNoReport
+	}
+	return &Encoder{desc: desc, report: r, data: make([]byte, r.Size())}, nil
+}
+
+func (e *Encoder) ID() byte {
+	return e.report.ID
+}
+
+// Reset zeroes every field
+func (e *Encoder) Reset() {
+	for i := range e.data {
+		e.data[i] = 0
+	}
+}
+
+// Data the report without report id, what ReportSender takes
+func (e *Encoder) Data() []byte {
+	return append([]byte(nil), e.data...)
+}
+
+// Packet the report as it goes over the interrupt channel, hidp header and
+// report id included
+func (e *Encoder) Packet() []byte {
+	packet := []byte{hidpData | byte(e.report.Kind)}
+	if e.report.ID != 0 {
+		packet = append(packet, e.report.ID)
+	}
+	return append(packet, e.data...)
+}
+
+func clamp(f *Field, v int32) int32 {
+	if v < f.LogicalMin {
+		return f.LogicalMin
+	}
+	if v > f.LogicalMax {
+		return f.LogicalMax
+	}
+	return v
+}
+
+// put writes v into element n of f
+func (e *Encoder) put(f *Field, n int, v int32) {
+	PutBits(e.data, f.BitOffset+n*f.Size, f.Size, uint32(v))
+}
+
+// set the nth element carrying usage within collection, -1 is anywhere
+func (e *Encoder) set(collection int, usage uint32, nth int, v int32) error {
+	for _, f := range e.report.Fields {
+		if f.Constant() || !f.Variable() {
+			continue
+		}
+		if collection >= 0 && !e.desc.within(f.Collection, collection) {
+			continue
+		}
+		for n := 0; n < f.Count; n++ {
+			if f.Usage(n) != usage {
+				continue
+			}
+			if nth > 0 {
+				nth--
+				continue
+			}
+			e.put(f, n, clamp(f, v))
+			return nil
+		}
+	}
+	return ErrNoUsage
+}
+
+// Set the first variable field element carrying usage, usages are
+// extended, ExtendedUsage(PageButton, 1) for the first button
+func (e *Encoder) Set(usage uint32, v int32) error {
+	return e.set(-1, usage, 0, v)
+}
+
+// SetNth the nth element carrying usage counted over the whole report
+func (e *Encoder) SetNth(usage uint32, nth int, v int32) error {
+	return e.set(-1, usage, nth, v)
+}
+
+// SetKeys sets the variable elements of usages to 1 and puts the rest in
+// array slots, like modifiers and keys of a keyboard, other elements are
+// cleared, too many keys fill the slots with ErrorRollOver
+func (e *Encoder) SetKeys(usages ...uint32) error {
+	var arrays []*Field
+	for _, f := range e.report.Fields {
+		if f.Constant() {
+			continue
+		}
+		if !f.Variable() {
+			arrays = append(arrays, f)
+			for n := 0; n < f.Count; n++ {
+				e.put(f, n, 0)
+			}
+			continue
+		}
+		if f.LogicalMax == 1 && f.UsageMaximum > f.UsageMinimum {
+			for n := 0; n < f.Count; n++ {
+				e.put(f, n, 0)
+			}
+		}
+	}
+
+	slots := make(map[*Field]int)
+	var full error
+	for _, usage := range usages {
+		if e.Set(usage, 1) == nil {
+			continue
+		}
+
+		placed := false
+		for _, f := range arrays {
+			if !f.HasUsage(usage) {
+				continue
+			}
+			if slots[f] == f.Count {
+				rollover(e, f)
+				full = ErrArrayFull
+				placed = true
+				break
+			}
+			e.put(f, slots[f], f.LogicalMin+int32(usage-f.UsageMinimum))
+			slots[f]++
+			placed = true
+			break
+		}
+		if !placed {
+			return ErrNoUsage
+		}
+	}
+	return full
+}
+
+// rollover marks every slot of f with ErrorRollOver of its page
+func rollover(e *Encoder, f *Field) {
+	usage := f.UsageMinimum&0xffff0000 | 0x01
+	v := int32(0)
+	if f.HasUsage(usage) {
+		v = f.LogicalMin + int32(usage-f.UsageMinimum)
+	}
+	for n := 0; n < f.Count; n++ {
+		e.put(f, n, v)
+	}
+}
+
+// In scopes Set to the nth instance of the collection with usage, the
+// second finger of a touch screen is In(ExtendedUsage(PageDigitizer, DigitizerFinger), 1)
+func (e *Encoder) In(usage uint32, nth int) (*Scope, error) {
+	for i, c := range e.desc.Collections {
+		if c.Usage != usage {
+			continue
+		}
+		if nth > 0 {
+			nth--
+			continue
+		}
+		return &Scope{e: e, collection: i}, nil
+	}
+	return nil, ErrNoInstance
+}
+
+// Scope sets fields inside one collection instance
+type Scope struct {
+	e          *Encoder
+	collection int
+}
+
+func (s *Scope) Set(usage uint32, v int32) error {
+	return s.e.set(s.collection, usage, 0, v)
+}
@@ -0,0 +1,173 @@
+package hid
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func testKeyboard() *Descriptor {
+	d, err := Parse(NewBuilder().
+		UsagePage(PageGenericDesktop).
+		Usage(DesktopKeyboard).
+		Collection(CollectionApplication).
+		ReportID(1).
+		ReportSize(1).
+		ReportCount(8).
+		UsagePage(PageKeyboard).
+		UsageRange(KeyLeftControl, KeyRightGUI).
+		Logical(0, 1).
+		Input(Data|Variable|Absolute).
+		ReportCount(1).
+		ReportSize(8).
+		Input(Constant|Variable|Absolute).
+		ReportCount(6).
+		ReportSize(8).
+		Logical(0, 255).
+		UsageRange(0x00, 0xFF).
+		Input(Data | Array | Absolute).
+		EndCollection().
+		MustBytes())
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+func testTouchScreen() *Descriptor {
+	b := NewBuilder().
+		UsagePage(PageDigitizer).
+		Usage(DigitizerTouchScreen).
+		Collection(CollectionApplication).
+		ReportID(2)
+	for i := 0; i < 2; i++ {
+		b.UsagePage(PageDigitizer).
+			Usage(DigitizerFinger).
+			Collection(CollectionLogical).
+			Usage(DigitizerTipSwitch).
+			Logical(0, 1).
+			ReportSize(8).
+			ReportCount(1).
+			Input(Data|Variable|Absolute).
+			UsagePage(PageGenericDesktop).
+			Usages(DesktopX, DesktopY).
+			Logical(-1000, 1000).
+			ReportSize(16).
+			ReportCount(2).
+			Input(Data | Variable | Absolute).
+			EndCollection()
+	}
+	d, err := Parse(b.EndCollection().MustBytes())
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+func key(usage uint32) uint32 {
+	return ExtendedUsage(PageKeyboard, uint16(usage))
+}
+
+func TestEncoderSetKeys(t *testing.T) {
+	tests := []struct {
+		name string
+		keys []uint32
+		want []byte
+		err  error
+	}{
+		{"nothing", nil, []byte{0, 0, 0, 0, 0, 0, 0, 0}, nil},
+		{"shift a", []uint32{key(KeyLeftShift), key(0x04)}, []byte{0x02, 0, 0x04, 0, 0, 0, 0, 0}, nil},
+		{"modifiers", []uint32{key(KeyLeftControl), key(KeyRightGUI)}, []byte{0x81, 0, 0, 0, 0, 0, 0, 0}, nil},
+		{"six keys", []uint32{key(4), key(5), key(6), key(7), key(8), key(9)}, []byte{0, 0, 4, 5, 6, 7, 8, 9}, nil},
+		{"rollover", []uint32{key(KeyLeftAlt), key(4), key(5), key(6), key(7), key(8), key(9), key(10)}, []byte{0x04, 0, 1, 1, 1, 1, 1, 1}, ErrArrayFull},
+		{"no such usage", []uint32{ExtendedUsage(PageButton, 1)}, nil, ErrNoUsage},
+	}
+
+	e, err := NewEncoder(testKeyboard(), ReportInput, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		// keys of the last test do not stay
+		e.SetKeys(key(0x2c), key(KeyRightShift))
+		err := e.SetKeys(tt.keys...)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.err)
+		}
+		if tt.want != nil && !bytes.Equal(e.Data(), tt.want) {
+			t.Errorf("%s: got % x, want % x", tt.name, e.Data(), tt.want)
+		}
+	}
+	if want := []byte{0xA1, 1}; !bytes.HasPrefix(e.Packet(), want) || len(e.Packet()) != 10 {
+		t.Errorf("packet % x", e.Packet())
+	}
+}
+
+func TestEncoderClamp(t *testing.T) {
+	x := ExtendedUsage(PageGenericDesktop, uint16(DesktopX))
+	tests := []struct {
+		v    int32
+		want []byte
+	}{
+		{0, []byte{0x00, 0x00}},
+		{-1000, []byte{0x18, 0xFC}},
+		{1000, []byte{0xE8, 0x03}},
+		{-40000, []byte{0x18, 0xFC}},
+		{40000, []byte{0xE8, 0x03}},
+	}
+
+	e, err := NewEncoder(testTouchScreen(), ReportInput, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		if err := e.Set(x, tt.v); err != nil {
+			t.Fatal(err)
+		}
+		if got := e.Data()[1:3]; !bytes.Equal(got, tt.want) {
+			t.Errorf("x %d: got % x, want % x", tt.v, got, tt.want)
+		}
+	}
+	// a tip switch of 5 is clamped to its maximum 1
+	if err := e.Set(ExtendedUsage(PageDigitizer, uint16(DigitizerTipSwitch)), 5); err != nil || e.Data()[0] != 1 {
+		t.Errorf("tip switch %d %v", e.Data()[0], err)
+	}
+	if err := e.Set(ExtendedUsage(PageButton, 1), 1); err != ErrNoUsage {
+		t.Errorf("button on a touch screen: %v", err)
+	}
+}
+
+func TestEncoderIn(t *testing.T) {
+	finger := ExtendedUsage(PageDigitizer, uint16(DigitizerFinger))
+	y := ExtendedUsage(PageGenericDesktop, uint16(DesktopY))
+
+	e, err := NewEncoder(testTouchScreen(), ReportInput, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := e.In(finger, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := second.Set(y, 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.SetNth(y, 0, 1); err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{0, 0, 0, 1, 0, 0, 0, 0, 2, 0}
+	if !bytes.Equal(e.Data(), want) {
+		t.Errorf("got % x, want % x", e.Data(), want)
+	}
+	if _, err := e.In(finger, 2); err != ErrNoInstance {
+		t.Errorf("third finger: %v", err)
+	}
+
+	e.Reset()
+	if !bytes.Equal(e.Data(), make([]byte, 10)) {
+		t.Errorf("after reset % x", e.Data())
+	}
+	if _, err := NewEncoder(testTouchScreen(), ReportOutput, 2); err != ErrNoReport {
+		t.Errorf("output encoder: %v", err)
+	}
+}
@@ -0,0 +1,346 @@
+package hid
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// hidp transaction types, the high nibble of the header
+const (
+	hidpHandshake   = 0x0
+	hidpControl     = 0x1
+	hidpGetReport   = 0x4
+	hidpSetReport   = 0x5
+	hidpGetProtocol = 0x6
+	hidpSetProtocol = 0x7
+	hidpDATA        = 0xA
+	hidpDATC        = 0xB
+)
+
+// GET_REPORT carries a two byte BufferSize when set
+const getReportSize = 0x08
+
+// Handshake result of a control request, handlers return one as error to
+// answer with it
+type Handshake byte
+
+const (
+	HandshakeSuccessful         Handshake = 0x0
+	HandshakeNotReady           Handshake = 0x1
+	HandshakeInvalidReportID    Handshake = 0x2
+	HandshakeUnsupportedRequest Handshake = 0x3
+	HandshakeInvalidParameter   Handshake = 0x4
+	HandshakeUnknown            Handshake = 0xE
+	HandshakeFatal              Handshake = 0xF
+)
+
+func (h Handshake) Error() string {
+	switch h {
+	case HandshakeSuccessful:
+		return "hidp: successful"
+	case HandshakeNotReady:
+		return "hidp: not ready"
+	case HandshakeInvalidReportID:
+		return "hidp: invalid report id"
+	case HandshakeUnsupportedRequest:
+		return "hidp: unsupported request"
+	case HandshakeInvalidParameter:
+		return "hidp: invalid parameter"
+	case HandshakeFatal:
+		return "hidp: fatal"
+	}
+	return "hidp: unknown error"
+}
+
+// ControlOp parameter of HID_CONTROL
+type ControlOp byte
+
+const (
+	ControlNop                ControlOp = 0x0
+	ControlHardReset          ControlOp = 0x1
+	ControlSoftReset          ControlOp = 0x2
+	ControlSuspend            ControlOp = 0x3
+	ControlExitSuspend        ControlOp = 0x4
+	ControlVirtualCableUnplug ControlOp = 0x5
+)
+
+func (op ControlOp) String() string {
+	switch op {
+	case ControlNop:
+		return "nop"
+	case ControlHardReset:
+		return "hard reset"
+	case ControlSoftReset:
+		return "soft reset"
+	case ControlSuspend:
+		return "suspend"
+	case ControlExitSuspend:
+		return "exit suspend"
+	case ControlVirtualCableUnplug:
+		return "virtual cable unplug"
+	}
+	return fmt.Sprintf("control %#x", byte(op))
+}
+
+// Protocol of GET_PROTOCOL and SET_PROTOCOL
+type Protocol byte
+
+const (
+	ProtocolBoot   Protocol = 0
+	ProtocolReport Protocol = 1
+)
+
+func (p Protocol) String() string {
+	if p == ProtocolBoot {
+		return "boot"
+	}
+	return "report"
+}
+
+// ControlHandler answers the host requests of one device, errors other
+// than a Handshake answer ERR_UNKNOWN, ErrNoReport ERR_INVALID_REPORT_ID
+type ControlHandler interface {
+	// GetReport the report without report id
+	GetReport(kind ReportKind, id byte) ([]byte, error)
+	SetReport(kind ReportKind, id byte, data []byte) error
+	GetProtocol() Protocol
+	SetProtocol(p Protocol) error
+	// Control gets no handshake, the host does not wait for one
+	Control(op ControlOp)
+}
+
+// DataPackets splits a DATA transaction of kind into packets of at most mtu
+// bytes, the rest goes in DATC packets and a last packet that fills the mtu
+// is followed by an empty DATC
+func DataPackets(kind ReportKind, payload []byte, mtu int) [][]byte {
+	if mtu < 2 {
+		mtu = L2CAPDefaultMTU
+	}
+	header := byte(hidpDATA<<4) | byte(kind)
+	var packets [][]byte
+	for {
+		n := len(payload)
+		if n > mtu-1 {
+			n = mtu - 1
+		}
+		packets = append(packets, append([]byte{header}, payload[:n]...))
+		payload = payload[n:]
+		if n < mtu-1 {
+			return packets
+		}
+		header = byte(hidpDATC<<4) | byte(kind)
+	}
+}
+
+// ControlServer speaks hidp on a control channel, rw has to keep packet
+// boundaries like a l2cap seqpacket socket
+type ControlServer struct {
+	rw      io.ReadWriter
+	mtu     int
+	handler ControlHandler
+	// ids whether the reports carry report ids, boot reports always do
+	ids bool
+	// pending SET_REPORT or DATA that filled the mtu, DATC continues it
+	pending []byte
+}
+
+// NewControlServer mtu is the outgoing mtu of the channel, desc tells
+// whether requests carry report ids
+func NewControlServer(rw io.ReadWriter, mtu int, desc *Descriptor, handler ControlHandler) *ControlServer {
+	if mtu < 2 {
+		mtu = L2CAPDefaultMTU
+	}
+	return &ControlServer{rw: rw, mtu: mtu, handler: handler, ids: desc.reportIDs()}
+}
+
+func (d *Descriptor) reportIDs() bool {
+	for _, r := range d.Reports {
+		if r.ID != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// ServeInterrupt hands the output reports the host sends as DATA on the
+// interrupt channel to handler.SetReport until reading fails, io.EOF once
+// the host closed the channel, nothing is answered there
+func ServeInterrupt(r io.Reader, desc *Descriptor, handler ControlHandler) error {
+	ids := desc.reportIDs()
+	buf := make([]byte, 0x10000)
+	for {
+		n, err := r.Read(buf)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return io.EOF
+		}
+		packet := buf[:n]
+		kind := ReportKind(packet[0] & 0x3)
+		if packet[0]>>4 != hidpDATA || (kind != ReportOutput && kind != ReportFeature) {
+			continue
+		}
+		payload := packet[1:]
+		if ids || handler.GetProtocol() == ProtocolBoot {
+			if len(payload) == 0 {
+				continue
+			}
+			handler.SetReport(kind, payload[0], append([]byte(nil), payload[1:]...))
+			continue
+		}
+		handler.SetReport(kind, 0, append([]byte(nil), payload...))
+	}
+}
+
+// Serve handles requests until reading fails, io.EOF once the host closed
+// the channel
+func (s *ControlServer) Serve() error {
+	buf := make([]byte, 0x10000)
+	for {
+		n, err := s.rw.Read(buf)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return io.EOF
+		}
+		if err := s.handle(append([]byte(nil), buf[:n]...)); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *ControlServer) withIDs() bool {
+	return s.ids || s.handler.GetProtocol() == ProtocolBoot
+}
+
+func (s *ControlServer) handshake(err error) error {
+	result := HandshakeSuccessful
+	if err != nil {
+		var h Handshake
+		switch {
+		case errors.As(err, &h):
+			result = h
+		case errors.Is(err, ErrNoReport):
+			result = HandshakeInvalidReportID
+		default:
+			result = HandshakeUnknown
+		}
+	}
+	_, werr := s.rw.Write([]byte{hidpHandshake<<4 | byte(result)})
+	return werr
+}
+
+func (s *ControlServer) data(kind ReportKind, payload []byte) error {
+	for _, p := range DataPackets(kind, payload, s.mtu) {
+		if _, err := s.rw.Write(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setReport the payload after the header, report id first when used
+func (s *ControlServer) setReport(packet []byte, answer bool) error {
+	kind := ReportKind(packet[0] & 0x3)
+	payload := packet[1:]
+	ids := s.withIDs()
+	var err error
+	switch {
+	case kind == 0:
+		err = HandshakeInvalidParameter
+	case ids && len(payload) == 0:
+		err = HandshakeInvalidReportID
+	case ids:
+		err = s.handler.SetReport(kind, payload[0], payload[1:])
+	default:
+		err = s.handler.SetReport(kind, 0, payload)
+	}
+	if !answer {
+		return nil
+	}
+	return s.handshake(err)
+}
+
+func (s *ControlServer) handle(packet []byte) error {
+	typ, param := packet[0]>>4, packet[0]&0x0f
+
+	if s.pending != nil {
+		pending := s.pending
+		s.pending = nil
+		if typ == hidpDATC {
+			pending = append(pending, packet[1:]...)
+			if len(packet) == s.mtu {
+				s.pending = pending
+				return nil
+			}
+			return s.setReport(pending, pending[0]>>4 == hidpSetReport)
+		}
+		if err := s.setReport(pending, pending[0]>>4 == hidpSetReport); err != nil {
+			return err
+		}
+	}
+
+	switch typ {
+	case hidpControl:
+		s.handler.Control(ControlOp(param))
+		return nil
+	case hidpGetReport:
+		return s.getReport(packet)
+	case hidpSetReport, hidpDATA:
+		// hidp 1.0 hosts may also send output reports as DATA on control
+		if len(packet) == s.mtu {
+			s.pending = packet
+			return nil
+		}
+		return s.setReport(packet, typ == hidpSetReport)
+	case hidpGetProtocol:
+		return s.data(0, []byte{byte(s.handler.GetProtocol())})
+	case hidpSetProtocol:
+		return s.handshake(s.handler.SetProtocol(Protocol(param & 0x1)))
+	case hidpHandshake, hidpDATC:
+		return nil
+	}
+	return s.handshake(HandshakeUnsupportedRequest)
+}
+
+func (s *ControlServer) getReport(packet []byte) error {
+	kind := ReportKind(packet[0] & 0x3)
+	if kind == 0 {
+		return s.handshake(HandshakeInvalidParameter)
+	}
+	rest := packet[1:]
+	ids := s.withIDs()
+
+	var id byte
+	if ids {
+		if len(rest) == 0 {
+			return s.handshake(HandshakeInvalidReportID)
+		}
+		id, rest = rest[0], rest[1:]
+	}
+
+	limit := -1
+	if packet[0]&getReportSize != 0 {
+		if len(rest) < 2 {
+			return s.handshake(HandshakeInvalidParameter)
+		}
+		limit = int(rest[0]) | int(rest[1])<<8
+	}
+
+	data, err := s.handler.GetReport(kind, id)
+	if err != nil {
+		return s.handshake(err)
+	}
+
+	payload := data
+	if ids {
+		payload = append([]byte{id}, data...)
+	}
+	if limit >= 0 && len(payload) > limit {
+		payload = payload[:limit]
+	}
+	return s.data(kind, payload)
+}
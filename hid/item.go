@@ -0,0 +1,179 @@
+package hid
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+type ItemType byte
+
+const (
+	ItemMain   ItemType = 0
+	ItemGlobal ItemType = 1
+	ItemLocal  ItemType = 2
+	ItemLong   ItemType = 3
+)
+
+// main item tags
+const (
+	TagInput         byte = 0x8
+	TagOutput        byte = 0x9
+	TagCollection    byte = 0xA
+	TagFeature       byte = 0xB
+	TagEndCollection byte = 0xC
+)
+
+// global item tags
+const (
+	TagUsagePage       byte = 0x0
+	TagLogicalMinimum  byte = 0x1
+	TagLogicalMaximum  byte = 0x2
+	TagPhysicalMinimum byte = 0x3
+	TagPhysicalMaximum byte = 0x4
+	TagUnitExponent    byte = 0x5
+	TagUnit            byte = 0x6
+	TagReportSize      byte = 0x7
+	TagReportID        byte = 0x8
+	TagReportCount     byte = 0x9
+	TagPush            byte = 0xA
+	TagPop             byte = 0xB
+)
+
+// local item tags
+const (
+	TagUsage             byte = 0x0
+	TagUsageMinimum      byte = 0x1
+	TagUsageMaximum      byte = 0x2
+	TagDesignatorIndex   byte = 0x3
+	TagDesignatorMinimum byte = 0x4
+	TagDesignatorMaximum byte = 0x5
+	TagStringIndex       byte = 0x7
+	TagStringMinimum     byte = 0x8
+	TagStringMaximum     byte = 0x9
+	TagDelimiter         byte = 0xA
+)
+
+// Item is one short item of a report descriptor, Data holds 0, 1, 2 or 4
+// little endian bytes
+type Item struct {
+	Type ItemType
+	Tag  byte
+	Data []byte
+}
+
+// Unsigned value of the data
+func (i Item) Unsigned() uint32 {
+	switch len(i.Data) {
+	case 1:
+		return uint32(i.Data[0])
+	case 2:
+		return uint32(binary.LittleEndian.Uint16(i.Data))
+	case 4:
+		return binary.LittleEndian.Uint32(i.Data)
+	}
+	return 0
+}
+
+// Signed value of the data, sign extended from its size
+func (i Item) Signed() int32 {
+	switch len(i.Data) {
+	case 1:
+		return int32(int8(i.Data[0]))
+	case 2:
+		return int32(int16(binary.LittleEndian.Uint16(i.Data)))
+	case 4:
+		return int32(binary.LittleEndian.Uint32(i.Data))
+	}
+	return 0
+}
+
+func (i Item) prefix() byte {
+	size := byte(len(i.Data))
+	if size == 4 {
+		size = 3
+	}
+	return i.Tag<<4 | byte(i.Type)<<2 | size
+}
+
+// Bytes the short item encoding
+func (i Item) Bytes() []byte {
+	return append([]byte{i.prefix()}, i.Data...)
+}
+
+// unsignedData smallest of 1, 2 or 4 bytes holding v
+func unsignedData(v uint32) []byte {
+	switch {
+	case v <= 0xff:
+		return []byte{byte(v)}
+	case v <= 0xffff:
+		return []byte{byte(v), byte(v >> 8)}
+	}
+	return []byte{byte(v), byte(v >> 8), byte(v >> 16), byte(v >> 24)}
+}
+
+// signedData smallest of 1, 2 or 4 bytes holding v in two's complement
+func signedData(v int32) []byte {
+	switch {
+	case v >= -0x80 && v <= 0x7f:
+		return []byte{byte(v)}
+	case v >= -0x8000 && v <= 0x7fff:
+		return []byte{byte(v), byte(v >> 8)}
+	}
+	return []byte{byte(v), byte(v >> 8), byte(v >> 16), byte(v >> 24)}
+}
+
+var itemNames = map[ItemType]map[byte]string{
+	ItemMain: {
+		TagInput:         "Input",
+		TagOutput:        "Output",
+		TagCollection:    "Collection",
+		TagFeature:       "Feature",
+		TagEndCollection: "End Collection",
+	},
+	ItemGlobal: {
+		TagUsagePage:       "Usage Page",
+		TagLogicalMinimum:  "Logical Minimum",
+		TagLogicalMaximum:  "Logical Maximum",
+		TagPhysicalMinimum: "Physical Minimum",
+		TagPhysicalMaximum: "Physical Maximum",
+		TagUnitExponent:    "Unit Exponent",
+		TagUnit:            "Unit",
+		TagReportSize:      "Report Size",
+		TagReportID:        "Report ID",
+		TagReportCount:     "Report Count",
+		TagPush:            "Push",
+		TagPop:             "Pop",
+	},
+	ItemLocal: {
+		TagUsage:             "Usage",
+		TagUsageMinimum:      "Usage Minimum",
+		TagUsageMaximum:      "Usage Maximum",
+		TagDesignatorIndex:   "Designator Index",
+		TagDesignatorMinimum: "Designator Minimum",
+		TagDesignatorMaximum: "Designator Maximum",
+		TagStringIndex:       "String Index",
+		TagStringMinimum:     "String Minimum",
+		TagStringMaximum:     "String Maximum",
+		TagDelimiter:         "Delimiter",
+	},
+}
+
+// String like "Report Size (8)", signed items show their sign
+func (i Item) String() string {
+	name, ok := itemNames[i.Type][i.Tag]
+	if !ok {
+		name = fmt.Sprintf("Item %d/%d", i.Type, i.Tag)
+	}
+	if len(i.Data) == 0 {
+		return name
+	}
+	switch {
+	case i.Type == ItemGlobal && i.Tag >= TagLogicalMinimum && i.Tag <= TagUnitExponent:
+		return fmt.Sprintf("%s (%d)", name, i.Signed())
+	case i.Type == ItemGlobal && i.Tag == TagUsagePage,
+		i.Type == ItemLocal && i.Tag <= TagUsageMaximum,
+		i.Type == ItemMain:
+		return fmt.Sprintf("%s (0x%02x)", name, i.Unsigned())
+	}
+	return fmt.Sprintf("%s (%d)", name, i.Unsigned())
+}
@@ -0,0 +1,77 @@
+package hid
+
+import "strings"
+
+// LEDs keyboard led state, bit n-1 is led usage n as in the boot output
+// report
+type LEDs byte
+
+const (
+	LEDsNumLock LEDs = 1 << iota
+	LEDsCapsLock
+	LEDsScrollLock
+	LEDsCompose
+	LEDsKana
+)
+
+var ledNames = []string{"num", "caps", "scroll", "compose", "kana"}
+
+// ParseLED "caps", "capslock" or "caps_lock" and the like
+func ParseLED(name string) (LEDs, bool) {
+	name = strings.ToLower(strings.Replace(name, "_", "", -1))
+	name = strings.TrimSuffix(name, "lock")
+	for i, n := range ledNames {
+		if n == name {
+			return 1 << uint(i), true
+		}
+	}
+	return 0, false
+}
+
+// Names of the leds that are on
+func (l LEDs) Names() []string {
+	names := []string{}
+	for i, n := range ledNames {
+		if l&(1<<uint(i)) != 0 {
+			names = append(names, n)
+		}
+	}
+	return names
+}
+
+func (l LEDs) String() string {
+	if l == 0 {
+		return "none"
+	}
+	return strings.Join(l.Names(), " ")
+}
+
+// LEDs the led state output report id sets, ok is false for reports
+// without leds
+func (d *Descriptor) LEDs(id byte, data []byte) (LEDs, bool) {
+	r := d.Report(ReportOutput, id)
+	if r == nil {
+		return 0, false
+	}
+	report := make([]byte, r.Size())
+	copy(report, data)
+
+	var leds LEDs
+	ok := false
+	for _, f := range r.Fields {
+		if f.Constant() || !f.Variable() {
+			continue
+		}
+		for n := 0; n < f.Count; n++ {
+			usage := f.Usage(n)
+			if usagePage(usage) != PageLED || uint16(usage) < 1 || uint16(usage) > uint16(len(ledNames)) {
+				continue
+			}
+			ok = true
+			if f.value(report, n) != 0 {
+				leds |= 1 << (uint16(usage) - 1)
+			}
+		}
+	}
+	return leds, ok
+}
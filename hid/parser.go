@@ -0,0 +1,547 @@
+package hid
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// L2CAPDefaultMTU what hidp channels get unless both sides agree on more,
+// a report with its hidp header and report id has to fit
+const L2CAPDefaultMTU = 672
+
+var (
+	ErrTruncated      = errors.New("hid: truncated item")
+	ErrRangeTooWide   = errors.New("hid: logical range does not fit the report size")
+	ErrReportTooLong  = errors.New("hid: report longer than the l2cap mtu")
+	ErrEmptyField     = errors.New("hid: report size or count is zero")
+	ErrUnknownMain    = errors.New("hid: unknown main item")
+	ErrUnbalancedPush = errors.New("hid: push without pop")
+)
+
+type ReportKind byte
+
+const (
+	ReportInput   ReportKind = 1
+	ReportOutput  ReportKind = 2
+	ReportFeature ReportKind = 3
+)
+
+func (k ReportKind) String() string {
+	switch k {
+	case ReportInput:
+		return "input"
+	case ReportOutput:
+		return "output"
+	case ReportFeature:
+		return "feature"
+	}
+	return fmt.Sprintf("kind %d", byte(k))
+}
+
+// Node an item of the descriptor tree, collections hold the items up to
+// and including their End Collection
+type Node struct {
+	Item     Item
+	Offset   int
+	Children []*Node
+}
+
+// Field is the layout of one Input, Output or Feature item, usages are
+// extended with their page
+type Field struct {
+	Kind     ReportKind
+	ReportID byte
+	Flags    MainFlags
+	// BitOffset from the first bit after the report id
+	BitOffset    int
+	Size         int
+	Count        int
+	Usages       []uint32
+	UsageMinimum uint32
+	UsageMaximum uint32
+	LogicalMin   int32
+	LogicalMax   int32
+	PhysicalMin  int32
+	PhysicalMax  int32
+	Unit         uint32
+	UnitExponent int8
+	// Collections usages of the enclosing collections, outermost first
+	Collections []uint32
+	// Collection index of the innermost one in Descriptor.Collections
+	Collection int
+}
+
+func (f *Field) Constant() bool {
+	return f.Flags&Constant != 0
+}
+
+func (f *Field) Variable() bool {
+	return f.Flags&Variable != 0
+}
+
+// Signed a negative logical minimum makes the values two's complement
+func (f *Field) Signed() bool {
+	return f.LogicalMin < 0
+}
+
+// Usage of element i, the last listed usage repeats for the rest, array
+// fields report their first usage
+func (f *Field) Usage(i int) uint32 {
+	if len(f.Usages) > 0 {
+		if i >= len(f.Usages) {
+			i = len(f.Usages) - 1
+		}
+		return f.Usages[i]
+	}
+	if f.UsageMaximum < f.UsageMinimum {
+		return 0
+	}
+	if u := f.UsageMinimum + uint32(i); u <= f.UsageMaximum {
+		return u
+	}
+	return f.UsageMaximum
+}
+
+// HasUsage whether any element of the field carries usage
+func (f *Field) HasUsage(usage uint32) bool {
+	for _, u := range f.Usages {
+		if u == usage {
+			return true
+		}
+	}
+	return f.UsageMaximum >= f.UsageMinimum && f.UsageMaximum != 0 &&
+		usage >= f.UsageMinimum && usage <= f.UsageMaximum
+}
+
+type Report struct {
+	Kind   ReportKind
+	ID     byte
+	Fields []*Field
+	Bits   int
+}
+
+// Size in bytes without the report id
+func (r *Report) Size() int {
+	return (r.Bits + 7) / 8
+}
+
+// Collection one instance of a collection, Parent is -1 at the top
+type Collection struct {
+	Type   CollectionType
+	Usage  uint32
+	Parent int
+}
+
+// Descriptor a parsed report descriptor, Problems are what Parse noticed
+// beyond undecodable bytes
+type Descriptor struct {
+	Raw         []byte
+	Tree        []*Node
+	Reports     []*Report
+	Collections []Collection
+	Problems    []error
+}
+
+// within whether collection c is index or inside it
+func (d *Descriptor) within(c, index int) bool {
+	for ; c >= 0; c = d.Collections[c].Parent {
+		if c == index {
+			return true
+		}
+	}
+	return false
+}
+
+type parserGlobals struct {
+	usagePage    uint16
+	logicalMin   int32
+	logicalMax   int32
+	physicalMin  int32
+	physicalMax  int32
+	unit         uint32
+	unitExponent int8
+	reportSize   int
+	reportCount  int
+	reportID     byte
+}
+
+type parserLocals struct {
+	usages       []uint32
+	usageMinimum uint32
+	usageMaximum uint32
+}
+
+func extend(page uint16, i Item) uint32 {
+	if len(i.Data) == 4 {
+		return i.Unsigned()
+	}
+	return uint32(page)<<16 | i.Unsigned()
+}
+
+// DecodeItems splits b into short items, long items are skipped
+func DecodeItems(b []byte) ([]Item, []int, error) {
+	var items []Item
+	var offsets []int
+	for n := 0; n < len(b); {
+		prefix := b[n]
+		if prefix == 0xfe {
+			// long item, size and tag follow
+			if n+2 >= len(b) || n+3+int(b[n+1]) > len(b) {
+				return nil, nil, fmt.Errorf("%w at byte %d", ErrTruncated, n)
+			}
+			n += 3 + int(b[n+1])
+			continue
+		}
+
+		size := int(prefix & 0x03)
+		if size == 3 {
+			size = 4
+		}
+		if n+1+size > len(b) {
+			return nil, nil, fmt.Errorf("%w at byte %d", ErrTruncated, n)
+		}
+		items = append(items, Item{
+			Type: ItemType(prefix >> 2 & 0x03),
+			Tag:  prefix >> 4,
+			Data: b[n+1 : n+1+size],
+		})
+		offsets = append(offsets, n)
+		n += 1 + size
+	}
+	return items, offsets, nil
+}
+
+// Parse decodes b into the item tree and the report layout
+func Parse(b []byte) (*Descriptor, error) {
+	items, offsets, err := DecodeItems(b)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &Descriptor{Raw: b}
+	problem := func(offset int, err error) {
+		d.Problems = append(d.Problems, fmt.Errorf("%w at byte %d", err, offset))
+	}
+
+	var (
+		globals     parserGlobals
+		locals      parserLocals
+		stack       []parserGlobals
+		open        []*Node
+		collections []uint32
+		instances   []int
+		reports     = make(map[[2]byte]*Report)
+		idsUsed     bool
+		unnumbered  bool
+	)
+
+	for n, item := range items {
+		node := &Node{Item: item, Offset: offsets[n]}
+		if len(open) == 0 {
+			d.Tree = append(d.Tree, node)
+		} else {
+			top := open[len(open)-1]
+			top.Children = append(top.Children, node)
+		}
+
+		switch item.Type {
+		case ItemGlobal:
+			switch item.Tag {
+			case TagUsagePage:
+				globals.usagePage = uint16(item.Unsigned())
+			case TagLogicalMinimum:
+				globals.logicalMin = item.Signed()
+			case TagLogicalMaximum:
+				// like the kernel, a maximum is unsigned unless the minimum is negative
+				if globals.logicalMin < 0 {
+					globals.logicalMax = item.Signed()
+				} else {
+					globals.logicalMax = int32(item.Unsigned())
+				}
+			case TagPhysicalMinimum:
+				globals.physicalMin = item.Signed()
+			case TagPhysicalMaximum:
+				if globals.physicalMin < 0 {
+					globals.physicalMax = item.Signed()
+				} else {
+					globals.physicalMax = int32(item.Unsigned())
+				}
+			case TagUnitExponent:
+				e := int8(item.Unsigned())
+				if len(item.Data) == 1 && e >= 0 && e <= 0x0f {
+					// nibble encoded
+					e = int8(e<<4) >> 4
+				}
+				globals.unitExponent = e
+			case TagUnit:
+				globals.unit = item.Unsigned()
+			case TagReportSize:
+				globals.reportSize = int(item.Unsigned())
+			case TagReportCount:
+				globals.reportCount = int(item.Unsigned())
+			case TagReportID:
+				if item.Unsigned() == 0 {
+					problem(node.Offset, ErrReportIDZero)
+				}
+				if unnumbered && !idsUsed {
+					problem(node.Offset, ErrMissingReportID)
+				}
+				idsUsed = true
+				globals.reportID = byte(item.Unsigned())
+			case TagPush:
+				stack = append(stack, globals)
+			case TagPop:
+				if len(stack) == 0 {
+					problem(node.Offset, ErrPopWithoutPush)
+					break
+				}
+				globals = stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+			}
+
+		case ItemLocal:
+			switch item.Tag {
+			case TagUsage:
+				locals.usages = append(locals.usages, extend(globals.usagePage, item))
+			case TagUsageMinimum:
+				locals.usageMinimum = extend(globals.usagePage, item)
+			case TagUsageMaximum:
+				locals.usageMaximum = extend(globals.usagePage, item)
+			}
+
+		case ItemMain:
+			switch item.Tag {
+			case TagCollection:
+				var usage uint32
+				if len(locals.usages) > 0 {
+					usage = locals.usages[0]
+				}
+				parent := -1
+				if len(instances) > 0 {
+					parent = instances[len(instances)-1]
+				}
+				d.Collections = append(d.Collections, Collection{
+					Type:   CollectionType(item.Unsigned()),
+					Usage:  usage,
+					Parent: parent,
+				})
+				instances = append(instances, len(d.Collections)-1)
+				collections = append(collections, usage)
+				open = append(open, node)
+
+			case TagEndCollection:
+				if len(open) == 0 {
+					problem(node.Offset, ErrUnbalancedCollection)
+					break
+				}
+				collections = collections[:len(collections)-1]
+				instances = instances[:len(instances)-1]
+				open = open[:len(open)-1]
+
+			case TagInput, TagOutput, TagFeature:
+				kind := map[byte]ReportKind{TagInput: ReportInput, TagOutput: ReportOutput, TagFeature: ReportFeature}[item.Tag]
+				if len(collections) == 0 {
+					problem(node.Offset, ErrOutsideCollection)
+				}
+				if globals.reportSize == 0 || globals.reportCount == 0 {
+					problem(node.Offset, ErrEmptyField)
+				}
+				if globals.reportID == 0 {
+					unnumbered = true
+					if idsUsed {
+						problem(node.Offset, ErrMissingReportID)
+					}
+				}
+
+				key := [2]byte{byte(kind), globals.reportID}
+				r := reports[key]
+				if r == nil {
+					r = &Report{Kind: kind, ID: globals.reportID}
+					reports[key] = r
+				}
+				f := &Field{
+					Kind:         kind,
+					ReportID:     globals.reportID,
+					Flags:        MainFlags(item.Unsigned()),
+					BitOffset:    r.Bits,
+					Size:         globals.reportSize,
+					Count:        globals.reportCount,
+					Usages:       locals.usages,
+					UsageMinimum: locals.usageMinimum,
+					UsageMaximum: locals.usageMaximum,
+					LogicalMin:   globals.logicalMin,
+					LogicalMax:   globals.logicalMax,
+					PhysicalMin:  globals.physicalMin,
+					PhysicalMax:  globals.physicalMax,
+					Unit:         globals.unit,
+					UnitExponent: globals.unitExponent,
+					Collections:  append([]uint32(nil), collections...),
+					Collection:   -1,
+				}
+				if len(instances) > 0 {
+					f.Collection = instances[len(instances)-1]
+				}
+				r.Fields = append(r.Fields, f)
+				r.Bits += f.Size * f.Count
+
+			default:
+				problem(node.Offset, ErrUnknownMain)
+			}
+			locals = parserLocals{}
+		}
+	}
+
+	if len(open) > 0 {
+		problem(len(b), ErrUnbalancedCollection)
+	}
+	if len(stack) > 0 {
+		problem(len(b), ErrUnbalancedPush)
+	}
+
+	for _, r := range reports {
+		d.Reports = append(d.Reports, r)
+	}
+	sort.Slice(d.Reports, func(i, j int) bool {
+		if d.Reports[i].ID != d.Reports[j].ID {
+			return d.Reports[i].ID < d.Reports[j].ID
+		}
+		return d.Reports[i].Kind < d.Reports[j].Kind
+	})
+	return d, nil
+}
+
+// Problems every mistake found in a descriptor
+type Problems []error
+
+func (p Problems) Error() string {
+	var msgs []string
+	for _, err := range p {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (p Problems) Is(target error) bool {
+	for _, err := range p {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// fits the logical range of f into its size, two's complement when the
+// minimum is negative
+func fits(f *Field) bool {
+	if f.Size >= 32 {
+		return true
+	}
+	if f.Signed() {
+		limit := int64(1) << uint(f.Size-1)
+		return int64(f.LogicalMin) >= -limit && int64(f.LogicalMax) < limit
+	}
+	return int64(f.LogicalMax) < int64(1)<<uint(f.Size)
+}
+
+// Validate returns Problems with what Parse found and the layout checks,
+// a report with its hidp header and id has to fit mtu, 0 skips that
+func (d *Descriptor) Validate(mtu int) error {
+	problems := append(Problems(nil), d.Problems...)
+	for _, r := range d.Reports {
+		for _, f := range r.Fields {
+			if f.Constant() || f.Size == 0 {
+				continue
+			}
+			if f.LogicalMin > f.LogicalMax {
+				problems = append(problems, fmt.Errorf("%w: %s report %d bit %d, %d..%d",
+					ErrLogicalRange, r.Kind, r.ID, f.BitOffset, f.LogicalMin, f.LogicalMax))
+			} else if !fits(f) {
+				problems = append(problems, fmt.Errorf("%w: %s report %d bit %d, %d..%d in %d bits",
+					ErrRangeTooWide, r.Kind, r.ID, f.BitOffset, f.LogicalMin, f.LogicalMax, f.Size))
+			}
+		}
+
+		length := 1 + r.Size()
+		if r.ID != 0 {
+			length++
+		}
+		if mtu > 0 && length > mtu {
+			problems = append(problems, fmt.Errorf("%w: %s report %d takes %d bytes, the mtu is %d",
+				ErrReportTooLong, r.Kind, r.ID, length, mtu))
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	return problems
+}
+
+// Check parses and validates b against the default l2cap mtu
+func Check(b []byte) error {
+	d, err := Parse(b)
+	if err != nil {
+		return err
+	}
+	return d.Validate(L2CAPDefaultMTU)
+}
+
+// CheckAll checks descriptors one by one and as the host sees them, one
+// after the other, so a report id used in two of them or a descriptor
+// without ids next to one with ids is refused
+func CheckAll(descriptors [][]byte) error {
+	type key struct {
+		kind ReportKind
+		id   byte
+	}
+	seen := make(map[key]bool)
+	var all []byte
+	for _, b := range descriptors {
+		d, err := Parse(b)
+		if err != nil {
+			return err
+		}
+		if err := d.Validate(L2CAPDefaultMTU); err != nil {
+			return err
+		}
+		for _, r := range d.Reports {
+			// report id is a global item, a descriptor without one takes
+			// the last id of the descriptor before it
+			if r.ID == 0 && len(descriptors) > 1 {
+				return fmt.Errorf("%w: %s report without id next to other descriptors", ErrMissingReportID, r.Kind)
+			}
+			k := key{r.Kind, r.ID}
+			if seen[k] {
+				return fmt.Errorf("%w: %s report %d", ErrReportIDReused, r.Kind, r.ID)
+			}
+			seen[k] = true
+		}
+		all = append(all, b...)
+	}
+	return Check(all)
+}
+
+// Report the layout of kind and id, nil when the descriptor has none
+func (d *Descriptor) Report(kind ReportKind, id byte) *Report {
+	for _, r := range d.Reports {
+		if r.Kind == kind && r.ID == id {
+			return r
+		}
+	}
+	return nil
+}
+
+// String the item tree, one item per line
+func (d *Descriptor) String() string {
+	var sb strings.Builder
+	var dump func(nodes []*Node, depth int)
+	dump = func(nodes []*Node, depth int) {
+		for _, n := range nodes {
+			fmt.Fprintf(&sb, "%04x  %s%s\n", n.Offset, strings.Repeat("  ", depth), n.Item)
+			dump(n.Children, depth+1)
+		}
+	}
+	dump(d.Tree, 0)
+	return sb.String()
+}
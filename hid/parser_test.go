@@ -0,0 +1,166 @@
+package hid
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  []byte
+		mtu  int
+		want error
+	}{
+		{"valid", []byte{
+			0x05, 0x01, 0x09, 0x02, 0xA1, 0x01, // Generic Desktop, Mouse, Application
+			0x85, 0x01, 0x75, 0x08, 0x95, 0x02, 0x15, 0x81, 0x25, 0x7F, 0x81, 0x06, // id 1, 2x8 bits -127..127
+			0xC0,
+		}, L2CAPDefaultMTU, nil},
+		{"collection not closed", []byte{
+			0x05, 0x01, 0x09, 0x02, 0xA1, 0x01,
+			0x75, 0x08, 0x95, 0x01, 0x81, 0x02,
+		}, L2CAPDefaultMTU, ErrUnbalancedCollection},
+		{"collection closed twice", []byte{
+			0x05, 0x01, 0x09, 0x02, 0xA1, 0x01,
+			0x75, 0x08, 0x95, 0x01, 0x81, 0x02,
+			0xC0, 0xC0,
+		}, L2CAPDefaultMTU, ErrUnbalancedCollection},
+		{"report without id next to one with", []byte{
+			0x05, 0x01, 0x09, 0x02, 0xA1, 0x01,
+			0x75, 0x08, 0x95, 0x01, 0x81, 0x02, // no report id
+			0x85, 0x01, 0x81, 0x02, // id 1
+			0xC0,
+		}, L2CAPDefaultMTU, ErrMissingReportID},
+		{"report id zero", []byte{
+			0x05, 0x01, 0x09, 0x02, 0xA1, 0x01,
+			0x85, 0x01, 0x75, 0x08, 0x95, 0x01, 0x81, 0x02,
+			0x85, 0x00, 0x81, 0x02, // id 0
+			0xC0,
+		}, L2CAPDefaultMTU, ErrReportIDZero},
+		{"unsigned range too wide", []byte{
+			0x05, 0x01, 0x09, 0x02, 0xA1, 0x01,
+			0x15, 0x00, 0x26, 0xFF, 0x00, 0x75, 0x04, 0x95, 0x02, 0x81, 0x02, // 0..255 in 4 bits
+			0xC0,
+		}, L2CAPDefaultMTU, ErrRangeTooWide},
+		{"signed range too wide", []byte{
+			0x05, 0x01, 0x09, 0x02, 0xA1, 0x01,
+			0x15, 0x80, 0x25, 0x7F, 0x75, 0x07, 0x95, 0x01, 0x81, 0x06, // -128..127 in 7 bits
+			0x75, 0x01, 0x81, 0x03,
+			0xC0,
+		}, L2CAPDefaultMTU, ErrRangeTooWide},
+		{"minimum above maximum", []byte{
+			0x05, 0x01, 0x09, 0x02, 0xA1, 0x01,
+			0x15, 0x05, 0x25, 0x01, 0x75, 0x08, 0x95, 0x01, 0x81, 0x02,
+			0xC0,
+		}, L2CAPDefaultMTU, ErrLogicalRange},
+		{"longer than the mtu", []byte{
+			0x06, 0x00, 0xFF, 0x09, 0x01, 0xA1, 0x01, // Vendor
+			0x85, 0x01, 0x75, 0x08, 0x96, 0xA0, 0x02, 0x81, 0x02, // 672 bytes
+			0xC0,
+		}, L2CAPDefaultMTU, ErrReportTooLong},
+		{"long report without mtu", []byte{
+			0x06, 0x00, 0xFF, 0x09, 0x01, 0xA1, 0x01,
+			0x85, 0x01, 0x75, 0x08, 0x96, 0xA0, 0x02, 0x81, 0x02,
+			0xC0,
+		}, 0, nil},
+		{"long report fitting a larger mtu", []byte{
+			0x06, 0x00, 0xFF, 0x09, 0x01, 0xA1, 0x01,
+			0x85, 0x01, 0x75, 0x08, 0x96, 0xA0, 0x02, 0x81, 0x02,
+			0xC0,
+		}, 674, nil},
+		{"input outside a collection", []byte{
+			0x05, 0x01, 0x75, 0x08, 0x95, 0x01, 0x81, 0x02,
+		}, L2CAPDefaultMTU, ErrOutsideCollection},
+		{"pop without push", []byte{
+			0x05, 0x01, 0x09, 0x02, 0xA1, 0x01, 0xB4,
+			0x75, 0x08, 0x95, 0x01, 0x81, 0x02,
+			0xC0,
+		}, L2CAPDefaultMTU, ErrPopWithoutPush},
+	}
+
+	for _, tt := range tests {
+		d, err := Parse(tt.raw)
+		if err != nil {
+			t.Errorf("%s: parse %s", tt.name, err)
+			continue
+		}
+		err = d.Validate(tt.mtu)
+		if tt.want == nil {
+			if err != nil {
+				t.Errorf("%s: %s", tt.name, err)
+			}
+			continue
+		}
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want %s", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestCheckAll(t *testing.T) {
+	mouse := func(id byte) []byte {
+		return []byte{
+			0x05, 0x01, 0x09, 0x02, 0xA1, 0x01,
+			0x85, id, 0x75, 0x08, 0x95, 0x02, 0x15, 0x81, 0x25, 0x7F, 0x81, 0x06,
+			0xC0,
+		}
+	}
+	noID := []byte{
+		0x05, 0x01, 0x09, 0x02, 0xA1, 0x01,
+		0x75, 0x08, 0x95, 0x02, 0x15, 0x81, 0x25, 0x7F, 0x81, 0x06,
+		0xC0,
+	}
+	tests := []struct {
+		name        string
+		descriptors [][]byte
+		want        error
+	}{
+		{"two ids", [][]byte{mouse(1), mouse(2)}, nil},
+		{"id in both", [][]byte{mouse(1), mouse(1)}, ErrReportIDReused},
+		{"one without id", [][]byte{mouse(1), noID}, ErrMissingReportID},
+		{"first without id", [][]byte{noID, mouse(1)}, ErrMissingReportID},
+		{"alone without id", [][]byte{noID}, nil},
+	}
+	for _, tt := range tests {
+		err := CheckAll(tt.descriptors)
+		if tt.want == nil && err != nil || !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestParseTruncated(t *testing.T) {
+	// Logical Maximum announcing two bytes with one left
+	if _, err := Parse([]byte{0x05, 0x01, 0x26, 0xFF}); !errors.Is(err, ErrTruncated) {
+		t.Errorf("got %v, want %s", err, ErrTruncated)
+	}
+}
+
+func TestParseLayout(t *testing.T) {
+	d, err := Parse([]byte{
+		0x05, 0x01, 0x09, 0x02, 0xA1, 0x01,
+		0x85, 0x03,
+		0x05, 0x09, 0x19, 0x01, 0x29, 0x02, 0x15, 0x00, 0x25, 0x01, 0x75, 0x01, 0x95, 0x02, 0x81, 0x02,
+		0x95, 0x06, 0x81, 0x03,
+		0x05, 0x01, 0x09, 0x30, 0x09, 0x31, 0x15, 0x81, 0x25, 0x7F, 0x75, 0x08, 0x95, 0x02, 0x81, 0x06,
+		0xC0,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := d.Report(ReportInput, 3)
+	if r == nil || r.Size() != 3 || len(r.Fields) != 3 {
+		t.Fatalf("report %+v", r)
+	}
+	xy := r.Fields[2]
+	if xy.BitOffset != 8 || xy.Size != 8 || xy.Count != 2 || xy.LogicalMin != -127 || xy.LogicalMax != 127 || !xy.Signed() {
+		t.Errorf("x y field %+v", xy)
+	}
+	if xy.Usage(1) != ExtendedUsage(PageGenericDesktop, uint16(DesktopY)) {
+		t.Errorf("second usage %#x", xy.Usage(1))
+	}
+	if !r.Fields[1].Constant() {
+		t.Error("padding not constant")
+	}
+}
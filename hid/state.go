@@ -0,0 +1,167 @@
+package hid
+
+import "sync"
+
+type reportKey struct {
+	kind ReportKind
+	id   byte
+}
+
+// ReportState the default ControlHandler, GET_REPORT answers the last
+// report stored or set by the host, zeros before that
+type ReportState struct {
+	lock      sync.Mutex
+	desc      *Descriptor
+	reports   map[reportKey][]byte
+	protocol  Protocol
+	suspended bool
+	onSet     []func(kind ReportKind, id byte, data []byte)
+	onControl []func(op ControlOp)
+}
+
+func NewReportState(desc *Descriptor) *ReportState {
+	return &ReportState{
+		desc:     desc,
+		reports:  make(map[reportKey][]byte),
+		protocol: ProtocolReport,
+	}
+}
+
+// Store keeps data as the current report, senders store what they send
+func (s *ReportState) Store(kind ReportKind, id byte, data []byte) {
+	s.lock.Lock()
+	s.reports[reportKey{kind, id}] = append([]byte(nil), data...)
+	s.lock.Unlock()
+}
+
+// GetReport in boot protocol input ids are the boot report ids
+func (s *ReportState) GetReport(kind ReportKind, id byte) ([]byte, error) {
+	if kind == ReportInput && s.GetProtocol() == ProtocolBoot {
+		return s.bootReport(id)
+	}
+
+	r := s.desc.Report(kind, id)
+	if r == nil {
+		return nil, ErrNoReport
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	data := make([]byte, r.Size())
+	copy(data, s.reports[reportKey{kind, id}])
+	return data, nil
+}
+
+// bootReport the boot form of the last report translating to boot id
+func (s *ReportState) bootReport(id byte) ([]byte, error) {
+	for _, r := range s.desc.Reports {
+		if r.Kind != ReportInput {
+			continue
+		}
+		s.lock.Lock()
+		data := s.reports[reportKey{ReportInput, r.ID}]
+		s.lock.Unlock()
+		if bootID, boot, ok := s.desc.BootReport(r.ID, data); ok && bootID == id {
+			return boot, nil
+		}
+	}
+	return nil, ErrNoReport
+}
+
+// ForProtocol the input report id as the host reads it in the current
+// protocol, ok is false in boot protocol for reports without a boot form
+func (s *ReportState) ForProtocol(id byte, data []byte) (byte, []byte, bool) {
+	if s.GetProtocol() != ProtocolBoot {
+		return id, data, true
+	}
+	return s.desc.BootReport(id, data)
+}
+
+// SetReport shorter reports are padded with zeros, longer ones refused, in
+// boot protocol the keyboard output report is the led byte
+func (s *ReportState) SetReport(kind ReportKind, id byte, data []byte) error {
+	if kind == ReportOutput && s.GetProtocol() == ProtocolBoot {
+		if id != BootKeyboardReportID {
+			return ErrNoReport
+		}
+		var ok bool
+		if id, data, ok = s.desc.FromBootOutput(data); !ok {
+			return ErrNoReport
+		}
+	}
+
+	r := s.desc.Report(kind, id)
+	if r == nil {
+		return ErrNoReport
+	}
+	if len(data) > r.Size() {
+		return HandshakeInvalidParameter
+	}
+	report := make([]byte, r.Size())
+	copy(report, data)
+
+	s.lock.Lock()
+	s.reports[reportKey{kind, id}] = report
+	handlers := s.onSet
+	s.lock.Unlock()
+
+	for _, fn := range handlers {
+		fn(kind, id, report)
+	}
+	return nil
+}
+
+func (s *ReportState) GetProtocol() Protocol {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.protocol
+}
+
+// SetProtocol boot protocol needs an input report with a boot form, nothing
+// could be sent in it otherwise
+func (s *ReportState) SetProtocol(p Protocol) error {
+	if p == ProtocolBoot && s.desc.Boot() == 0 {
+		return HandshakeUnsupportedRequest
+	}
+	s.lock.Lock()
+	s.protocol = p
+	s.lock.Unlock()
+	return nil
+}
+
+func (s *ReportState) Control(op ControlOp) {
+	s.lock.Lock()
+	switch op {
+	case ControlSuspend:
+		s.suspended = true
+	case ControlExitSuspend, ControlHardReset, ControlSoftReset:
+		s.suspended = false
+	}
+	handlers := s.onControl
+	s.lock.Unlock()
+
+	for _, fn := range handlers {
+		fn(op)
+	}
+}
+
+// Suspended between HID_CONTROL SUSPEND and EXIT_SUSPEND
+func (s *ReportState) Suspended() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.suspended
+}
+
+// OnSetReport runs fn for every report the host sets
+func (s *ReportState) OnSetReport(fn func(kind ReportKind, id byte, data []byte)) {
+	s.lock.Lock()
+	s.onSet = append(s.onSet, fn)
+	s.lock.Unlock()
+}
+
+// OnControl runs fn for every HID_CONTROL of the host
+func (s *ReportState) OnControl(fn func(op ControlOp)) {
+	s.lock.Lock()
+	s.onControl = append(s.onControl, fn)
+	s.lock.Unlock()
+}
@@ -0,0 +1,30 @@
+package hid
+
+import "testing"
+
+func TestSetProtocol(t *testing.T) {
+	tests := []struct {
+		name string
+		desc *Descriptor
+		p    Protocol
+		want error
+	}{
+		{"keyboard boot", testKeyboard(), ProtocolBoot, nil},
+		{"keyboard report", testKeyboard(), ProtocolReport, nil},
+		{"touch screen boot", testTouchScreen(), ProtocolBoot, HandshakeUnsupportedRequest},
+		{"touch screen report", testTouchScreen(), ProtocolReport, nil},
+	}
+	for _, tt := range tests {
+		s := NewReportState(tt.desc)
+		if err := s.SetProtocol(tt.p); err != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+		want := tt.p
+		if tt.want != nil {
+			want = ProtocolReport
+		}
+		if got := s.GetProtocol(); got != want {
+			t.Errorf("%s: protocol %s, want %s", tt.name, got, want)
+		}
+	}
+}
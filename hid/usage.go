@@ -0,0 +1,173 @@
+package hid
+
+import "fmt"
+
+// usage pages, see the HID Usage Tables
+const (
+	PageGenericDesktop uint16 = 0x01
+	PageSimulation     uint16 = 0x02
+	PageKeyboard       uint16 = 0x07
+	PageLED            uint16 = 0x08
+	PageButton         uint16 = 0x09
+	PageConsumer       uint16 = 0x0C
+	PageDigitizer      uint16 = 0x0D
+	PageVendor         uint16 = 0xFF00
+)
+
+// generic desktop usages
+const (
+	DesktopPointer   uint32 = 0x01
+	DesktopMouse     uint32 = 0x02
+	DesktopJoystick  uint32 = 0x04
+	DesktopGamepad   uint32 = 0x05
+	DesktopKeyboard  uint32 = 0x06
+	DesktopKeypad    uint32 = 0x07
+	DesktopX         uint32 = 0x30
+	DesktopY         uint32 = 0x31
+	DesktopZ         uint32 = 0x32
+	DesktopRx        uint32 = 0x33
+	DesktopRy        uint32 = 0x34
+	DesktopRz        uint32 = 0x35
+	DesktopWheel     uint32 = 0x38
+	DesktopHatSwitch uint32 = 0x39
+)
+
+// digitizer usages
+const (
+	DigitizerTouchScreen         uint32 = 0x04
+	DigitizerTouchPad            uint32 = 0x05
+	DigitizerFinger              uint32 = 0x22
+	DigitizerTipPressure         uint32 = 0x30
+	DigitizerInRange             uint32 = 0x32
+	DigitizerTipSwitch           uint32 = 0x42
+	DigitizerConfidence          uint32 = 0x47
+	DigitizerWidth               uint32 = 0x48
+	DigitizerHeight              uint32 = 0x49
+	DigitizerContactIdentifier   uint32 = 0x51
+	DigitizerContactCount        uint32 = 0x54
+	DigitizerContactCountMaximum uint32 = 0x55
+)
+
+// led usages
+const (
+	LEDNumLock    uint32 = 0x01
+	LEDCapsLock   uint32 = 0x02
+	LEDScrollLock uint32 = 0x03
+	LEDCompose    uint32 = 0x04
+	LEDKana       uint32 = 0x05
+)
+
+// keyboard usages of the modifier keys, the rest are key codes
+const (
+	KeyLeftControl  uint32 = 0xE0
+	KeyLeftShift    uint32 = 0xE1
+	KeyLeftAlt      uint32 = 0xE2
+	KeyLeftGUI      uint32 = 0xE3
+	KeyRightControl uint32 = 0xE4
+	KeyRightShift   uint32 = 0xE5
+	KeyRightAlt     uint32 = 0xE6
+	KeyRightGUI     uint32 = 0xE7
+)
+
+// consumer usages
+const (
+	ConsumerControl    uint32 = 0x01
+	ConsumerPlayPause  uint32 = 0xCD
+	ConsumerMute       uint32 = 0xE2
+	ConsumerVolumeUp   uint32 = 0xE9
+	ConsumerVolumeDown uint32 = 0xEA
+)
+
+// ExtendedUsage a usage carrying its own page, it ignores UsagePage
+func ExtendedUsage(page uint16, id uint16) uint32 {
+	return uint32(page)<<16 | uint32(id)
+}
+
+var pageNames = map[uint16]string{
+	PageGenericDesktop: "GenericDesktop",
+	PageSimulation:     "Simulation",
+	PageKeyboard:       "Keyboard",
+	PageLED:            "LED",
+	PageButton:         "Button",
+	PageConsumer:       "Consumer",
+	PageDigitizer:      "Digitizer",
+	PageVendor:         "Vendor",
+}
+
+var usageNames = map[uint16]map[uint16]string{
+	PageGenericDesktop: {
+		uint16(DesktopPointer):   "Pointer",
+		uint16(DesktopMouse):     "Mouse",
+		uint16(DesktopJoystick):  "Joystick",
+		uint16(DesktopGamepad):   "Gamepad",
+		uint16(DesktopKeyboard):  "Keyboard",
+		uint16(DesktopKeypad):    "Keypad",
+		uint16(DesktopX):         "X",
+		uint16(DesktopY):         "Y",
+		uint16(DesktopZ):         "Z",
+		uint16(DesktopRx):        "Rx",
+		uint16(DesktopRy):        "Ry",
+		uint16(DesktopRz):        "Rz",
+		uint16(DesktopWheel):     "Wheel",
+		uint16(DesktopHatSwitch): "HatSwitch",
+	},
+	PageDigitizer: {
+		uint16(DigitizerTouchScreen):         "TouchScreen",
+		uint16(DigitizerTouchPad):            "TouchPad",
+		uint16(DigitizerFinger):              "Finger",
+		uint16(DigitizerTipPressure):         "TipPressure",
+		uint16(DigitizerInRange):             "InRange",
+		uint16(DigitizerTipSwitch):           "TipSwitch",
+		uint16(DigitizerConfidence):          "Confidence",
+		uint16(DigitizerWidth):               "Width",
+		uint16(DigitizerHeight):              "Height",
+		uint16(DigitizerContactIdentifier):   "ContactIdentifier",
+		uint16(DigitizerContactCount):        "ContactCount",
+		uint16(DigitizerContactCountMaximum): "ContactCountMaximum",
+	},
+	PageLED: {
+		uint16(LEDNumLock):    "NumLock",
+		uint16(LEDCapsLock):   "CapsLock",
+		uint16(LEDScrollLock): "ScrollLock",
+		uint16(LEDCompose):    "Compose",
+		uint16(LEDKana):       "Kana",
+	},
+	PageKeyboard: {
+		uint16(KeyLeftControl):  "LeftControl",
+		uint16(KeyLeftShift):    "LeftShift",
+		uint16(KeyLeftAlt):      "LeftAlt",
+		uint16(KeyLeftGUI):      "LeftGUI",
+		uint16(KeyRightControl): "RightControl",
+		uint16(KeyRightShift):   "RightShift",
+		uint16(KeyRightAlt):     "RightAlt",
+		uint16(KeyRightGUI):     "RightGUI",
+	},
+	PageConsumer: {
+		uint16(ConsumerControl):    "ConsumerControl",
+		uint16(ConsumerPlayPause):  "PlayPause",
+		uint16(ConsumerMute):       "Mute",
+		uint16(ConsumerVolumeUp):   "VolumeUp",
+		uint16(ConsumerVolumeDown): "VolumeDown",
+	},
+}
+
+// PageName like "GenericDesktop", unknown pages are "Page" and the hex id
+func PageName(page uint16) string {
+	if name, ok := pageNames[page]; ok {
+		return name
+	}
+	return fmt.Sprintf("Page%04X", page)
+}
+
+// UsageName of an extended usage as a Go identifier, "X" or "Button3",
+// unknown usages are their page name and the hex id
+func UsageName(usage uint32) string {
+	page, id := uint16(usage>>16), uint16(usage)
+	if name, ok := usageNames[page][id]; ok {
+		return name
+	}
+	if page == PageButton {
+		return fmt.Sprintf("Button%d", id)
+	}
+	return fmt.Sprintf("%s%04X", PageName(page), id)
+}
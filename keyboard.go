@@ -0,0 +1,175 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+	"vitrhid/growcastle"
+	"vitrhid/hid"
+	"vitrhid/keyboard"
+)
+
+var errNoKeyboard = errors.New("keyboard not enabled")
+
+// SetKeyboard the layout and pace new host keyboards start with
+func (s *Services) SetKeyboard(layout *keyboard.Layout, pace time.Duration) {
+	s.lock.Lock()
+	s.layout = layout
+	s.keyPace = pace
+	s.lock.Unlock()
+}
+
+// hasKeyboard the descriptor carries the keyboard report
+func (s *Services) hasKeyboard() bool {
+	return s.descriptor != nil && s.descriptor.Report(hid.ReportInput, growcastle.KeyboardReportID) != nil
+}
+
+// keyboard the keyboard of d, made on first use, the caller holds the lock
+func (s *Services) keyboard(d *Device) *keyboard.Keyboard {
+	if d.Keyboard != nil {
+		return d.Keyboard
+	}
+	kb := keyboard.New(func(state keyboard.State) error {
+		r := growcastle.KeyboardInputReport{
+			LeftControl:  state.Modifiers&keyboard.LeftControl != 0,
+			LeftShift:    state.Modifiers&keyboard.LeftShift != 0,
+			LeftAlt:      state.Modifiers&keyboard.LeftAlt != 0,
+			LeftGUI:      state.Modifiers&keyboard.LeftGUI != 0,
+			RightControl: state.Modifiers&keyboard.RightControl != 0,
+			RightShift:   state.Modifiers&keyboard.RightShift != 0,
+			RightAlt:     state.Modifiers&keyboard.RightAlt != 0,
+			RightGUI:     state.Modifiers&keyboard.RightGUI != 0,
+			Keys:         state.Keys,
+		}
+		d.sendLock.Lock()
+		defer d.sendLock.Unlock()
+		d.report, _ = r.AppendBinary(d.report[:0])
+		return d.sendReport(r.ReportID(), d.report)
+	})
+	if s.layout != nil {
+		kb.SetLayout(s.layout)
+	}
+	kb.SetPace(s.keyPace)
+	if leds, ok := s.leds.Get(d.Addr); ok {
+		kb.SetCapsLock(leds&hid.LEDsCapsLock != 0)
+	}
+	d.Keyboard = kb
+	return kb
+}
+
+// syncCapsLock keeps the caps lock of the host keyboards in step with the
+// leds the hosts set
+func (s *Services) syncCapsLock(addr string, leds hid.LEDs) {
+	s.lock.RLock()
+	var kbs []*keyboard.Keyboard
+	key := addressKey(addr)
+	for k, d := range s.devices {
+		if d.Keyboard != nil && k == key {
+			kbs = append(kbs, d.Keyboard)
+		}
+	}
+	s.lock.RUnlock()
+
+	for _, kb := range kbs {
+		kb.SetCapsLock(leds&hid.LEDsCapsLock != 0)
+	}
+}
+
+// keyboards of the host addr, every attached host when addr is empty
+func (s *Services) keyboards(addr string) ([]*keyboard.Keyboard, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if !s.hasKeyboard() {
+		return nil, errNoKeyboard
+	}
+	key := addressKey(addr)
+	var kbs []*keyboard.Keyboard
+	for k, d := range s.devices {
+		if d.Disposed || (addr != "" && k != key && k != addr) {
+			continue
+		}
+		kbs = append(kbs, s.keyboard(d))
+	}
+	if len(kbs) == 0 {
+		return nil, errors.New("no devices")
+	}
+	return kbs, nil
+}
+
+// serveKeyboard /keyboard/type?text= (or the POST body), /keyboard/tap,
+// /keyboard/down and /keyboard/up ?keys=ctrl+alt+t, /keyboard/release and
+// /keyboard/layout?layout=de and /keyboard/pace?ms= set them per host,
+// addr picks a host, every attached one without it
+func (s *Services) serveKeyboard(rw http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	kbs, err := s.keyboards(q.Get("addr"))
+	if err != nil {
+		rw.Write([]byte(err.Error()))
+		return
+	}
+
+	var do func(kb *keyboard.Keyboard) error
+	switch r.URL.Path {
+	case "/keyboard/type":
+		text := q.Get("text")
+		if r.Method == http.MethodPost {
+			body, err := ioutil.ReadAll(http.MaxBytesReader(rw, r.Body, 1<<16))
+			if err != nil {
+				rw.Write([]byte("invalid body"))
+				return
+			}
+			text = string(body)
+		}
+		do = func(kb *keyboard.Keyboard) error { return kb.TypeText(text) }
+	case "/keyboard/tap", "/keyboard/down", "/keyboard/up":
+		keys := q.Get("keys")
+		if keys == "" {
+			rw.Write([]byte("invalid keys param"))
+			return
+		}
+		switch r.URL.Path {
+		case "/keyboard/tap":
+			do = func(kb *keyboard.Keyboard) error { return kb.Tap(keys) }
+		case "/keyboard/down":
+			do = func(kb *keyboard.Keyboard) error { return kb.Down(keys) }
+		default:
+			do = func(kb *keyboard.Keyboard) error { return kb.Up(keys) }
+		}
+	case "/keyboard/release":
+		do = func(kb *keyboard.Keyboard) error { return kb.ReleaseAll() }
+	case "/keyboard/layout":
+		layout, err := keyboard.LayoutByName(q.Get("layout"))
+		if err != nil {
+			rw.Write([]byte("invalid layout param"))
+			return
+		}
+		do = func(kb *keyboard.Keyboard) error {
+			kb.SetLayout(layout)
+			return nil
+		}
+	case "/keyboard/pace":
+		ms, err := strconv.Atoi(q.Get("ms"))
+		if err != nil || ms < 0 {
+			rw.Write([]byte("invalid ms param"))
+			return
+		}
+		do = func(kb *keyboard.Keyboard) error {
+			kb.SetPace(time.Millisecond * time.Duration(ms))
+			return nil
+		}
+	default:
+		http.NotFound(rw, r)
+		return
+	}
+
+	// hosts are typed on one after the other, each at its own pace
+	for _, kb := range kbs {
+		if err := do(kb); err != nil {
+			rw.Write([]byte(err.Error()))
+			return
+		}
+	}
+	rw.Write([]byte("success"))
+}
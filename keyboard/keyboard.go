@@ -0,0 +1,231 @@
+package keyboard
+
+import (
+	"fmt"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// RollOver keys a report holds, with more every slot is ErrorRollOver
+const RollOver = 6
+
+// State one input report, the modifiers and keys held
+type State struct {
+	Modifiers Modifiers
+	Keys      [RollOver]byte
+}
+
+// Keyboard tracks what is held on one host and sends a State for every
+// change, reports are at least the pace apart so slow hosts see each of them
+type Keyboard struct {
+	lock   sync.Mutex
+	send   func(State) error
+	layout *Layout
+	pace   time.Duration
+	mods   Modifiers
+	keys   []byte
+	last   time.Time
+
+	// capsLock has its own lock, the host sets it while TypeText holds lock
+	capsLockLock sync.Mutex
+	capsLock     bool
+}
+
+// New sends with the US layout and no pace
+func New(send func(State) error) *Keyboard {
+	return &Keyboard{send: send, layout: US}
+}
+
+// SetLayout the layout of the host, characters and chords are looked up on it
+func (k *Keyboard) SetLayout(l *Layout) {
+	k.lock.Lock()
+	k.layout = l
+	k.lock.Unlock()
+}
+
+func (k *Keyboard) Layout() *Layout {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	return k.layout
+}
+
+// SetPace the minimum time between two reports
+func (k *Keyboard) SetPace(pace time.Duration) {
+	k.lock.Lock()
+	k.pace = pace
+	k.lock.Unlock()
+}
+
+func (k *Keyboard) Pace() time.Duration {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	return k.pace
+}
+
+// SetCapsLock the caps lock led of the host, TypeText inverts shift for
+// letters while it is on
+func (k *Keyboard) SetCapsLock(on bool) {
+	k.capsLockLock.Lock()
+	k.capsLock = on
+	k.capsLockLock.Unlock()
+}
+
+func (k *Keyboard) CapsLock() bool {
+	k.capsLockLock.Lock()
+	defer k.capsLockLock.Unlock()
+	return k.capsLock
+}
+
+// State what is held right now
+func (k *Keyboard) State() State {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	return k.state(k.mods, k.keys)
+}
+
+func (k *Keyboard) state(mods Modifiers, keys []byte) State {
+	s := State{Modifiers: mods}
+	if len(keys) > RollOver {
+		for i := range s.Keys {
+			s.Keys[i] = KeyErrorRollOver
+		}
+		return s
+	}
+	copy(s.Keys[:], keys)
+	return s
+}
+
+// sendState waits for the pace, the caller holds the lock
+func (k *Keyboard) sendState(mods Modifiers, keys []byte) error {
+	if wait := time.Until(k.last.Add(k.pace)); wait > 0 {
+		time.Sleep(wait)
+	}
+	k.last = time.Now()
+	return k.send(k.state(mods, keys))
+}
+
+func (k *Keyboard) press(s Stroke) bool {
+	changed := k.mods|s.Modifiers != k.mods
+	k.mods |= s.Modifiers
+	if s.Usage == 0 {
+		return changed
+	}
+	for _, usage := range k.keys {
+		if usage == s.Usage {
+			return changed
+		}
+	}
+	k.keys = append(k.keys, s.Usage)
+	return true
+}
+
+func (k *Keyboard) release(s Stroke) bool {
+	changed := k.mods&s.Modifiers != 0
+	k.mods &^= s.Modifiers
+	for i, usage := range k.keys {
+		if s.Usage != 0 && usage == s.Usage {
+			k.keys = append(k.keys[:i], k.keys[i+1:]...)
+			return true
+		}
+	}
+	return changed
+}
+
+// Down presses and holds the keys of a chord like "shift+a"
+func (k *Keyboard) Down(chord string) error {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	strokes, err := ParseChord(chord, k.layout)
+	if err != nil {
+		return err
+	}
+	for _, s := range strokes {
+		if k.press(s) {
+			if err := k.sendState(k.mods, k.keys); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Up releases the keys of a chord, the last one first
+func (k *Keyboard) Up(chord string) error {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	strokes, err := ParseChord(chord, k.layout)
+	if err != nil {
+		return err
+	}
+	for i := len(strokes) - 1; i >= 0; i-- {
+		if k.release(strokes[i]) {
+			if err := k.sendState(k.mods, k.keys); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Tap presses the keys of a chord like "ctrl+alt+t" in order and releases
+// them in reverse
+func (k *Keyboard) Tap(chord string) error {
+	if err := k.Down(chord); err != nil {
+		return err
+	}
+	return k.Up(chord)
+}
+
+// ReleaseAll lets go of every key and modifier
+func (k *Keyboard) ReleaseAll() error {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	k.mods, k.keys = 0, nil
+	return k.sendState(0, nil)
+}
+
+// TypeText types text on the layout, keys held stay held, nothing is typed
+// when the layout misses a character
+func (k *Keyboard) TypeText(text string) error {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+
+	capsLock := k.CapsLock()
+	var strokes [][]Stroke
+	for _, r := range text {
+		s, ok := k.layout.Strokes(r)
+		if !ok {
+			return fmt.Errorf("keyboard: %q can not be typed on layout %s", r, k.layout.Name)
+		}
+		if capsLock && unicode.ToUpper(r) != unicode.ToLower(r) && s[0].Modifiers&AltGr == 0 {
+			s = append([]Stroke{{Usage: s[0].Usage, Modifiers: s[0].Modifiers ^ LeftShift}}, s[1:]...)
+		}
+		strokes = append(strokes, s)
+	}
+
+	for _, list := range strokes {
+		for _, s := range list {
+			if err := k.stroke(s); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// stroke modifiers go down ahead of the key so hosts never see the key
+// without them, the caller holds the lock
+func (k *Keyboard) stroke(s Stroke) error {
+	mods := k.mods | s.Modifiers
+	keys := append(append([]byte(nil), k.keys...), s.Usage)
+	if mods != k.mods {
+		if err := k.sendState(mods, k.keys); err != nil {
+			return err
+		}
+	}
+	if err := k.sendState(mods, keys); err != nil {
+		return err
+	}
+	return k.sendState(k.mods, k.keys)
+}
@@ -0,0 +1,244 @@
+package keyboard
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStrokes(t *testing.T) {
+	tests := []struct {
+		layout *Layout
+		r      rune
+		want   []Stroke
+	}{
+		{US, 'a', []Stroke{{Usage: 0x04}}},
+		{US, 'A', []Stroke{{Usage: 0x04, Modifiers: LeftShift}}},
+		{US, '@', []Stroke{{Usage: 0x1F, Modifiers: LeftShift}}},
+		{US, '^', []Stroke{{Usage: 0x23, Modifiers: LeftShift}}},
+		{US, '\n', []Stroke{{Usage: KeyEnter}}},
+		{US, 'ä', nil},
+		{UK, '@', []Stroke{{Usage: 0x34, Modifiers: LeftShift}}},
+		{UK, '"', []Stroke{{Usage: 0x1F, Modifiers: LeftShift}}},
+		{UK, '£', []Stroke{{Usage: 0x20, Modifiers: LeftShift}}},
+		{UK, '€', []Stroke{{Usage: 0x21, Modifiers: AltGr}}},
+		{UK, '\\', []Stroke{{Usage: KeyNonUSBackslash}}},
+		{DE, 'z', []Stroke{{Usage: 0x1C}}},
+		{DE, 'Y', []Stroke{{Usage: 0x1D, Modifiers: LeftShift}}},
+		{DE, 'ö', []Stroke{{Usage: 0x33}}},
+		{DE, '@', []Stroke{{Usage: 0x14, Modifiers: AltGr}}},
+		{DE, '\\', []Stroke{{Usage: 0x2D, Modifiers: AltGr}}},
+		{FR, 'a', []Stroke{{Usage: 0x14}}},
+		{FR, 'q', []Stroke{{Usage: 0x04}}},
+		{FR, 'w', []Stroke{{Usage: 0x1D}}},
+		{FR, 'm', []Stroke{{Usage: 0x33}}},
+		{FR, ',', []Stroke{{Usage: 0x10}}},
+		{FR, '1', []Stroke{{Usage: 0x1E, Modifiers: LeftShift}}},
+		{FR, 'é', []Stroke{{Usage: 0x1F}}},
+		{JIS, '@', []Stroke{{Usage: 0x2F}}},
+		{JIS, '"', []Stroke{{Usage: 0x1F, Modifiers: LeftShift}}},
+		{JIS, '¥', []Stroke{{Usage: KeyInternational3}}},
+		{JIS, '_', []Stroke{{Usage: KeyInternational1, Modifiers: LeftShift}}},
+	}
+	for _, tt := range tests {
+		got, ok := tt.layout.Strokes(tt.r)
+		if ok != (tt.want != nil) || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s %q: got %v %v, want %v", tt.layout.Name, tt.r, got, ok, tt.want)
+		}
+	}
+}
+
+func TestDeadKeys(t *testing.T) {
+	space := Stroke{Usage: KeySpace}
+	tests := []struct {
+		layout *Layout
+		r      rune
+		want   []Stroke
+	}{
+		{DE, '^', []Stroke{{Usage: 0x35}, space}},
+		{DE, '´', []Stroke{{Usage: 0x2E}, space}},
+		{DE, '`', []Stroke{{Usage: 0x2E, Modifiers: LeftShift}, space}},
+		{FR, '~', []Stroke{{Usage: 0x1F, Modifiers: AltGr}, space}},
+		{FR, '`', []Stroke{{Usage: 0x24, Modifiers: AltGr}, space}},
+		{FR, '¨', []Stroke{{Usage: 0x2F, Modifiers: LeftShift}, space}},
+		// no dead keys on these
+		{US, '`', []Stroke{{Usage: 0x35}}},
+		{UK, '^', []Stroke{{Usage: 0x23, Modifiers: LeftShift}}},
+	}
+	for _, tt := range tests {
+		if got, _ := tt.layout.Strokes(tt.r); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s %q: got %v, want %v", tt.layout.Name, tt.r, got, tt.want)
+		}
+	}
+}
+
+// recorder a keyboard that keeps every state it sends
+func recorder() (*Keyboard, *[]State) {
+	var states []State
+	k := New(func(s State) error {
+		states = append(states, s)
+		return nil
+	})
+	return k, &states
+}
+
+func keys(usages ...byte) [RollOver]byte {
+	var k [RollOver]byte
+	copy(k[:], usages)
+	return k
+}
+
+func TestCapsLock(t *testing.T) {
+	tests := []struct {
+		layout   *Layout
+		capsLock bool
+		text     string
+		want     Modifiers
+	}{
+		{US, false, "a", 0},
+		{US, false, "A", LeftShift},
+		{US, true, "a", LeftShift},
+		{US, true, "A", 0},
+		{US, true, "1", 0},
+		{US, true, "!", LeftShift},
+		{DE, true, "ö", LeftShift},
+		{DE, true, "Ü", 0},
+		{DE, true, "@", AltGr},
+		{UK, true, "€", AltGr},
+	}
+	for _, tt := range tests {
+		k, states := recorder()
+		k.SetLayout(tt.layout)
+		k.SetCapsLock(tt.capsLock)
+		if err := k.TypeText(tt.text); err != nil {
+			t.Errorf("%s %q: %s", tt.layout.Name, tt.text, err)
+			continue
+		}
+		// the state holding the key
+		var held *State
+		for i := range *states {
+			if (*states)[i].Keys[0] != 0 {
+				held = &(*states)[i]
+			}
+		}
+		if held == nil || held.Modifiers != tt.want {
+			t.Errorf("%s caps %v %q: states %v, want modifiers %#x", tt.layout.Name, tt.capsLock, tt.text, *states, tt.want)
+		}
+		if last := (*states)[len(*states)-1]; last != (State{}) {
+			t.Errorf("%s %q: left %v held", tt.layout.Name, tt.text, last)
+		}
+	}
+}
+
+func TestTypeText(t *testing.T) {
+	k, states := recorder()
+	if err := k.TypeText("aB"); err != nil {
+		t.Fatal(err)
+	}
+	want := []State{
+		{Keys: keys(0x04)},
+		{},
+		{Modifiers: LeftShift},
+		{Modifiers: LeftShift, Keys: keys(0x05)},
+		{},
+	}
+	if !reflect.DeepEqual(*states, want) {
+		t.Errorf("got %v, want %v", *states, want)
+	}
+
+	*states = nil
+	if err := k.TypeText("a€"); err == nil || len(*states) != 0 {
+		t.Errorf("typed %v of text the layout misses: %v", *states, err)
+	}
+}
+
+func TestParseChord(t *testing.T) {
+	tests := []struct {
+		chord  string
+		layout *Layout
+		want   []Stroke
+	}{
+		{"ctrl+alt+t", US, []Stroke{{Modifiers: LeftControl}, {Modifiers: LeftAlt}, {Usage: 0x17}}},
+		{"Shift + Plus", US, []Stroke{{Modifiers: LeftShift}, {Usage: 0x2E}}},
+		{"cmd+space", US, []Stroke{{Modifiers: LeftGUI}, {Usage: KeySpace}}},
+		{"f5", US, []Stroke{{Usage: KeyF1 + 4}}},
+		{"F12", US, []Stroke{{Usage: KeyF1 + 11}}},
+		{"A", US, []Stroke{{Usage: 0x04, Modifiers: LeftShift}}},
+		{"ctrl+z", DE, []Stroke{{Modifiers: LeftControl}, {Usage: 0x1C}}},
+		{"altgr+q", DE, []Stroke{{Modifiers: AltGr}, {Usage: 0x14}}},
+		{"ctrl+", US, nil},
+		{"ctrl+nope", US, nil},
+		{"ä", US, nil},
+		// a dead key takes two strokes
+		{"^", DE, nil},
+	}
+	for _, tt := range tests {
+		got, err := ParseChord(tt.chord, tt.layout)
+		if (err == nil) != (tt.want != nil) || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s on %s: got %v %v, want %v", tt.chord, tt.layout.Name, got, err, tt.want)
+		}
+	}
+}
+
+func TestTap(t *testing.T) {
+	k, states := recorder()
+	if err := k.Tap("ctrl+alt+t"); err != nil {
+		t.Fatal(err)
+	}
+	want := []State{
+		{Modifiers: LeftControl},
+		{Modifiers: LeftControl | LeftAlt},
+		{Modifiers: LeftControl | LeftAlt, Keys: keys(0x17)},
+		{Modifiers: LeftControl | LeftAlt},
+		{Modifiers: LeftControl},
+		{},
+	}
+	if !reflect.DeepEqual(*states, want) {
+		t.Errorf("got %v, want %v", *states, want)
+	}
+
+	// held keys are not pressed twice
+	*states = nil
+	k.Down("shift")
+	k.Down("shift+a")
+	if len(*states) != 2 || k.State() != (State{Modifiers: LeftShift, Keys: keys(0x04)}) {
+		t.Errorf("states %v", *states)
+	}
+}
+
+func TestRollOver(t *testing.T) {
+	k, states := recorder()
+	if err := k.Down("a+b+c+d+e+f"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := k.State(), (State{Keys: keys(0x04, 0x05, 0x06, 0x07, 0x08, 0x09)}); got != want {
+		t.Errorf("six keys %v, want %v", got, want)
+	}
+
+	k.Down("g")
+	full := keys(KeyErrorRollOver, KeyErrorRollOver, KeyErrorRollOver, KeyErrorRollOver, KeyErrorRollOver, KeyErrorRollOver)
+	if got := (*states)[len(*states)-1]; got.Keys != full {
+		t.Errorf("seven keys %v", got)
+	}
+
+	k.Up("a")
+	if got, want := k.State(), (State{Keys: keys(0x05, 0x06, 0x07, 0x08, 0x09, 0x0A)}); got != want {
+		t.Errorf("after releasing one %v, want %v", got, want)
+	}
+	if err := k.ReleaseAll(); err != nil || k.State() != (State{}) {
+		t.Errorf("after release all %v %v", k.State(), err)
+	}
+}
+
+func TestPace(t *testing.T) {
+	k, states := recorder()
+	k.SetPace(time.Millisecond * 20)
+	start := time.Now()
+	if err := k.Tap("a"); err != nil {
+		t.Fatal(err)
+	}
+	// the first report goes out right away
+	if elapsed := time.Since(start); len(*states) != 2 || elapsed < time.Millisecond*20 {
+		t.Errorf("%d reports in %s", len(*states), elapsed)
+	}
+}
@@ -0,0 +1,146 @@
+package keyboard
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Modifiers bit n is keyboard usage 0xE0+n, the first byte of a report
+type Modifiers byte
+
+const (
+	LeftControl Modifiers = 1 << iota
+	LeftShift
+	LeftAlt
+	LeftGUI
+	RightControl
+	RightShift
+	RightAlt
+	RightGUI
+)
+
+// AltGr is right alt on the layouts that have it
+const AltGr = RightAlt
+
+// key usages of the keyboard page that are no characters
+const (
+	KeyErrorRollOver  byte = 0x01
+	KeyEnter          byte = 0x28
+	KeyEscape         byte = 0x29
+	KeyBackspace      byte = 0x2A
+	KeyTab            byte = 0x2B
+	KeySpace          byte = 0x2C
+	KeyCapsLock       byte = 0x39
+	KeyF1             byte = 0x3A
+	KeyPrintScreen    byte = 0x46
+	KeyScrollLock     byte = 0x47
+	KeyPause          byte = 0x48
+	KeyInsert         byte = 0x49
+	KeyHome           byte = 0x4A
+	KeyPageUp         byte = 0x4B
+	KeyDelete         byte = 0x4C
+	KeyEnd            byte = 0x4D
+	KeyPageDown       byte = 0x4E
+	KeyRight          byte = 0x4F
+	KeyLeft           byte = 0x50
+	KeyDown           byte = 0x51
+	KeyUp             byte = 0x52
+	KeyNumLock        byte = 0x53
+	KeyNonUSBackslash byte = 0x64
+	KeyMenu           byte = 0x65
+	KeyInternational1 byte = 0x87
+	KeyInternational3 byte = 0x89
+)
+
+var modifierNames = map[string]Modifiers{
+	"ctrl":    LeftControl,
+	"control": LeftControl,
+	"lctrl":   LeftControl,
+	"shift":   LeftShift,
+	"lshift":  LeftShift,
+	"alt":     LeftAlt,
+	"lalt":    LeftAlt,
+	"option":  LeftAlt,
+	"gui":     LeftGUI,
+	"lgui":    LeftGUI,
+	"meta":    LeftGUI,
+	"super":   LeftGUI,
+	"win":     LeftGUI,
+	"cmd":     LeftGUI,
+	"rctrl":   RightControl,
+	"rshift":  RightShift,
+	"ralt":    RightAlt,
+	"altgr":   RightAlt,
+	"rgui":    RightGUI,
+}
+
+var keyNames = map[string]byte{
+	"enter":       KeyEnter,
+	"return":      KeyEnter,
+	"esc":         KeyEscape,
+	"escape":      KeyEscape,
+	"backspace":   KeyBackspace,
+	"tab":         KeyTab,
+	"space":       KeySpace,
+	"capslock":    KeyCapsLock,
+	"printscreen": KeyPrintScreen,
+	"scrolllock":  KeyScrollLock,
+	"pause":       KeyPause,
+	"insert":      KeyInsert,
+	"home":        KeyHome,
+	"pageup":      KeyPageUp,
+	"delete":      KeyDelete,
+	"del":         KeyDelete,
+	"end":         KeyEnd,
+	"pagedown":    KeyPageDown,
+	"right":       KeyRight,
+	"left":        KeyLeft,
+	"down":        KeyDown,
+	"up":          KeyUp,
+	"numlock":     KeyNumLock,
+	"menu":        KeyMenu,
+	"plus":        0x2E,
+	"minus":       0x2D,
+}
+
+func init() {
+	for i := 0; i < 12; i++ {
+		keyNames[fmt.Sprintf("f%d", i+1)] = KeyF1 + byte(i)
+	}
+}
+
+// ParseKey a modifier or key name like "ctrl" or "pageup", a single
+// character is looked up on layout with the modifiers it needs there
+func ParseKey(name string, layout *Layout) (Stroke, error) {
+	lower := strings.ToLower(name)
+	if m, ok := modifierNames[lower]; ok {
+		return Stroke{Modifiers: m}, nil
+	}
+	if usage, ok := keyNames[lower]; ok {
+		return Stroke{Usage: usage}, nil
+	}
+	if r := []rune(name); len(r) == 1 {
+		strokes, ok := layout.Strokes(r[0])
+		if ok && len(strokes) == 1 {
+			return strokes[0], nil
+		}
+	}
+	return Stroke{}, fmt.Errorf("keyboard: unknown key %q", name)
+}
+
+// ParseChord "ctrl+alt+t", a plus key is "plus"
+func ParseChord(chord string, layout *Layout) ([]Stroke, error) {
+	var keys []Stroke
+	for _, name := range strings.Split(chord, "+") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return nil, fmt.Errorf("keyboard: empty key in %q", chord)
+		}
+		k, err := ParseKey(name, layout)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
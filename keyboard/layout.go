@@ -0,0 +1,171 @@
+package keyboard
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Stroke one report that types part of a character
+type Stroke struct {
+	Usage     byte
+	Modifiers Modifiers
+}
+
+// Layout maps characters to the strokes the host layout of the same name
+// turns into them, dead keys are followed by a space
+type Layout struct {
+	Name string
+	keys map[rune][]Stroke
+}
+
+// Strokes of r, false when the layout can not type it
+func (l *Layout) Strokes(r rune) ([]Stroke, bool) {
+	strokes, ok := l.keys[r]
+	return strokes, ok
+}
+
+// keyDef the characters of one key plain, with shift and with altgr, 0
+// where it has none
+type keyDef struct {
+	usage               byte
+	plain, shift, altgr rune
+}
+
+// letters keyDefs of a-z in the usage order 0x04 to 0x1D, non letters in
+// order are skipped
+func letters(order string) []keyDef {
+	var defs []keyDef
+	for i, r := range order {
+		if unicode.IsLetter(r) {
+			defs = append(defs, keyDef{usage: 0x04 + byte(i), plain: r, shift: unicode.ToUpper(r)})
+		}
+	}
+	return defs
+}
+
+// newLayout the first key typing a character wins, dead lists the
+// characters that need a space after their key
+func newLayout(name string, dead string, defs ...[]keyDef) *Layout {
+	l := &Layout{Name: name, keys: make(map[rune][]Stroke)}
+	add := func(r rune, s Stroke) {
+		if r == 0 {
+			return
+		}
+		if _, ok := l.keys[r]; ok {
+			return
+		}
+		strokes := []Stroke{s}
+		if strings.ContainsRune(dead, r) {
+			strokes = append(strokes, Stroke{Usage: KeySpace})
+		}
+		l.keys[r] = strokes
+	}
+
+	add('\n', Stroke{Usage: KeyEnter})
+	add('\t', Stroke{Usage: KeyTab})
+	add(' ', Stroke{Usage: KeySpace})
+	add('\b', Stroke{Usage: KeyBackspace})
+	for _, list := range defs {
+		for _, d := range list {
+			add(d.plain, Stroke{Usage: d.usage})
+			add(d.shift, Stroke{Usage: d.usage, Modifiers: LeftShift})
+			add(d.altgr, Stroke{Usage: d.usage, Modifiers: AltGr})
+		}
+	}
+	return l
+}
+
+var US = newLayout("us", "",
+	letters("abcdefghijklmnopqrstuvwxyz"),
+	[]keyDef{
+		{0x1E, '1', '!', 0}, {0x1F, '2', '@', 0}, {0x20, '3', '#', 0}, {0x21, '4', '$', 0},
+		{0x22, '5', '%', 0}, {0x23, '6', '^', 0}, {0x24, '7', '&', 0}, {0x25, '8', '*', 0},
+		{0x26, '9', '(', 0}, {0x27, '0', ')', 0},
+		{0x2D, '-', '_', 0}, {0x2E, '=', '+', 0}, {0x2F, '[', '{', 0}, {0x30, ']', '}', 0},
+		{0x31, '\\', '|', 0}, {0x33, ';', ':', 0}, {0x34, '\'', '"', 0}, {0x35, '`', '~', 0},
+		{0x36, ',', '<', 0}, {0x37, '.', '>', 0}, {0x38, '/', '?', 0},
+	},
+)
+
+var UK = newLayout("uk", "",
+	letters("abcdefghijklmnopqrstuvwxyz"),
+	[]keyDef{
+		{0x1E, '1', '!', 0}, {0x1F, '2', '"', 0}, {0x20, '3', '£', 0}, {0x21, '4', '$', '€'},
+		{0x22, '5', '%', 0}, {0x23, '6', '^', 0}, {0x24, '7', '&', 0}, {0x25, '8', '*', 0},
+		{0x26, '9', '(', 0}, {0x27, '0', ')', 0},
+		{0x2D, '-', '_', 0}, {0x2E, '=', '+', 0}, {0x2F, '[', '{', 0}, {0x30, ']', '}', 0},
+		{0x32, '#', '~', 0}, {0x33, ';', ':', 0}, {0x34, '\'', '@', 0}, {0x35, '`', '¬', 0},
+		{0x36, ',', '<', 0}, {0x37, '.', '>', 0}, {0x38, '/', '?', 0},
+		{KeyNonUSBackslash, '\\', '|', 0},
+	},
+)
+
+var DE = newLayout("de", "^´`",
+	letters("abcdefghijklmnopqrstuvwxzy"),
+	[]keyDef{
+		{0x1E, '1', '!', 0}, {0x1F, '2', '"', '²'}, {0x20, '3', '§', '³'}, {0x21, '4', '$', 0},
+		{0x22, '5', '%', 0}, {0x23, '6', '&', 0}, {0x24, '7', '/', '{'}, {0x25, '8', '(', '['},
+		{0x26, '9', ')', ']'}, {0x27, '0', '=', '}'},
+		{0x2D, 'ß', '?', '\\'}, {0x2E, '´', '`', 0}, {0x2F, 'ü', 'Ü', 0}, {0x30, '+', '*', '~'},
+		{0x32, '#', '\'', 0}, {0x33, 'ö', 'Ö', 0}, {0x34, 'ä', 'Ä', 0}, {0x35, '^', '°', 0},
+		{0x36, ',', ';', 0}, {0x37, '.', ':', 0}, {0x38, '-', '_', 0},
+		{KeyNonUSBackslash, '<', '>', '|'},
+		{0x14, 0, 0, '@'}, {0x08, 0, 0, '€'}, {0x10, 0, 0, 'µ'},
+	},
+)
+
+var FR = newLayout("fr", "~`¨",
+	// a and q, z and w swap, m sits right of l and its key types a comma
+	letters("qbcdefghijkl_noparstuvzxyw"),
+	[]keyDef{
+		{0x1E, '&', '1', 0}, {0x1F, 'é', '2', '~'}, {0x20, '"', '3', '#'}, {0x21, '\'', '4', '{'},
+		{0x22, '(', '5', '['}, {0x23, '-', '6', '|'}, {0x24, 'è', '7', '`'}, {0x25, '_', '8', '\\'},
+		{0x26, 'ç', '9', '^'}, {0x27, 'à', '0', '@'},
+		{0x2D, ')', '°', ']'}, {0x2E, '=', '+', '}'}, {0x2F, '^', '¨', 0}, {0x30, '$', '£', 0},
+		{0x32, '*', 'µ', 0}, {0x33, 'm', 'M', 0}, {0x34, 'ù', '%', 0}, {0x35, '²', 0, 0},
+		{0x10, ',', '?', 0}, {0x36, ';', '.', 0}, {0x37, ':', '/', 0}, {0x38, '!', '§', 0},
+		{KeyNonUSBackslash, '<', '>', 0},
+		{0x08, 0, 0, '€'},
+	},
+)
+
+var JIS = newLayout("jis", "",
+	letters("abcdefghijklmnopqrstuvwxyz"),
+	[]keyDef{
+		{0x1E, '1', '!', 0}, {0x1F, '2', '"', 0}, {0x20, '3', '#', 0}, {0x21, '4', '$', 0},
+		{0x22, '5', '%', 0}, {0x23, '6', '&', 0}, {0x24, '7', '\'', 0}, {0x25, '8', '(', 0},
+		{0x26, '9', ')', 0}, {0x27, '0', 0, 0},
+		{0x2D, '-', '=', 0}, {0x2E, '^', '~', 0}, {0x2F, '@', '`', 0}, {0x30, '[', '{', 0},
+		{0x32, ']', '}', 0}, {0x33, ';', '+', 0}, {0x34, ':', '*', 0},
+		{0x36, ',', '<', 0}, {0x37, '.', '>', 0}, {0x38, '/', '?', 0},
+		{KeyInternational1, '\\', '_', 0}, {KeyInternational3, '¥', '|', 0},
+	},
+)
+
+var layouts = map[string]*Layout{
+	US.Name:  US,
+	UK.Name:  UK,
+	DE.Name:  DE,
+	FR.Name:  FR,
+	JIS.Name: JIS,
+}
+
+// LayoutByName one of Layouts, case does not matter
+func LayoutByName(name string) (*Layout, error) {
+	l, ok := layouts[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("keyboard: unknown layout %q, have %s", name, strings.Join(Layouts(), " "))
+	}
+	return l, nil
+}
+
+func Layouts() []string {
+	var names []string
+	for name := range layouts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
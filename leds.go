@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+	"vitrhid/hid"
+)
+
+// ledWaitTimeout /leds/wait gives up after it unless timeout says otherwise
+const ledWaitTimeout = time.Second * 30
+
+// LEDs the keyboard leds every host set through output reports
+type LEDs struct {
+	lock     sync.Mutex
+	hosts    map[string]hid.LEDs
+	handlers []func(addr string, leds hid.LEDs)
+	// changed is closed and replaced with every change
+	changed chan struct{}
+}
+
+func NewLEDs() *LEDs {
+	return &LEDs{
+		hosts:   make(map[string]hid.LEDs),
+		changed: make(chan struct{}),
+	}
+}
+
+// normalAddress hosts are kept as "AA:BB:CC:DD:EE:FF" whatever case or
+// colons the address came with
+func normalAddress(addr string) string {
+	return colonAddress(addressKey(addr))
+}
+
+// Update the leds of the host "AA:BB:CC:DD:EE:FF", handlers only run on
+// changes
+func (l *LEDs) Update(addr string, leds hid.LEDs) {
+	addr = normalAddress(addr)
+	l.lock.Lock()
+	old, known := l.hosts[addr]
+	l.hosts[addr] = leds
+	handlers := append([]func(addr string, leds hid.LEDs){}, l.handlers...)
+	if known && old == leds {
+		l.lock.Unlock()
+		return
+	}
+	close(l.changed)
+	l.changed = make(chan struct{})
+	l.lock.Unlock()
+
+	log.Printf("Device %s LEDs %s", addr, leds)
+	for _, fn := range handlers {
+		fn(addr, leds)
+	}
+}
+
+// Forget drops a host that went away
+func (l *LEDs) Forget(addr string) {
+	addr = normalAddress(addr)
+	l.lock.Lock()
+	delete(l.hosts, addr)
+	l.lock.Unlock()
+}
+
+func (l *LEDs) Get(addr string) (hid.LEDs, bool) {
+	addr = normalAddress(addr)
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	leds, ok := l.hosts[addr]
+	return leds, ok
+}
+
+// OnChange fn runs with every new led state of a host
+func (l *LEDs) OnChange(fn func(addr string, leds hid.LEDs)) {
+	l.lock.Lock()
+	l.handlers = append(l.handlers, fn)
+	l.lock.Unlock()
+}
+
+// Wait until done holds for the leds of addr, any host when addr is empty,
+// false once timeout passed
+func (l *LEDs) Wait(addr string, timeout time.Duration, done func(leds hid.LEDs) bool) (string, hid.LEDs, bool) {
+	if addr != "" {
+		addr = normalAddress(addr)
+	}
+	deadline := time.After(timeout)
+	for {
+		l.lock.Lock()
+		changed := l.changed
+		for host, leds := range l.hosts {
+			if (addr == "" || host == addr) && done(leds) {
+				l.lock.Unlock()
+				return host, leds, true
+			}
+		}
+		l.lock.Unlock()
+
+		select {
+		case <-changed:
+		case <-deadline:
+			return "", 0, false
+		}
+	}
+}
+
+func (l *LEDs) infos() map[string][]string {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	infos := make(map[string][]string)
+	for addr, leds := range l.hosts {
+		infos[addr] = leds.Names()
+	}
+	return infos
+}
+
+// ServeHTTP /leds lists the leds that are on per host, /leds/wait?led=caps
+// blocks until caps lock toggles, state=on or off waits for that state,
+// addr picks a host and timeout is in seconds
+func (l *LEDs) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/leds" {
+		rw.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(rw).Encode(l.infos())
+		return
+	}
+
+	if r.URL.Path == "/leds/wait" {
+		q := r.URL.Query()
+		led, ok := hid.ParseLED(q.Get("led"))
+		if !ok {
+			rw.Write([]byte("invalid led param"))
+			return
+		}
+		addr := q.Get("addr")
+
+		timeout := ledWaitTimeout
+		if t := q.Get("timeout"); t != "" {
+			seconds, err := strconv.Atoi(t)
+			if err != nil {
+				rw.Write([]byte("invalid timeout param"))
+				return
+			}
+			timeout = time.Second * time.Duration(seconds)
+		}
+
+		var done func(leds hid.LEDs) bool
+		switch q.Get("state") {
+		case "on":
+			done = func(leds hid.LEDs) bool { return leds&led != 0 }
+		case "off":
+			done = func(leds hid.LEDs) bool { return leds&led == 0 }
+		case "":
+			if addr == "" {
+				rw.Write([]byte("toggle needs an addr param"))
+				return
+			}
+			current, _ := l.Get(addr)
+			done = func(leds hid.LEDs) bool { return (leds^current)&led != 0 }
+		default:
+			rw.Write([]byte("invalid state param"))
+			return
+		}
+
+		host, leds, ok := l.Wait(addr, timeout, done)
+		if !ok {
+			rw.Write([]byte("timeout"))
+			return
+		}
+		rw.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(rw).Encode(struct {
+			Addr string   `json:"addr"`
+			LEDs []string `json:"leds"`
+		}{host, leds.Names()})
+		return
+	}
+
+	http.NotFound(rw, r)
+}
@@ -1,12 +1,23 @@
 package main
 
 import (
+	"crypto/sha256"
+	"encoding/binary"
 	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
 	"log"
 	"net/http"
+	"os"
+	"strings"
 	"syscall"
+	"time"
+	"unsafe"
 	"vitrhid/bluez"
 	"vitrhid/growcastle"
+	"vitrhid/hid"
+	"vitrhid/keyboard"
 	"vitrhid/mgmt"
 
 	"golang.org/x/sys/unix"
@@ -17,6 +28,37 @@ var (
 	interruptListenFd int
 )
 
+var (
+	presencePatterns = flag.String("presence", "", "only connectable and discoverable while a bonded device sending an advertisement matching type:offset:hex[,...] is nearby, e.g. ff:0:4c00")
+	presenceRSSI     = flag.Int("presence-rssi", 0, "rssi threshold in dBm for -presence, 0 uses the kernel default")
+	controllerIndex  = flag.Int("index", -1, "controller index, -1 picks the first one")
+	publicAddress    = flag.String("public-address", "", "public address for unconfigured controllers, a locally administered one derived from /etc/machine-id when empty")
+	allowDevices     = flag.String("allow", "", "comma separated addresses allowed to pair, empty allows every device not denied")
+	denyDevices      = flag.String("deny", "", "comma separated addresses never allowed to pair")
+	pairingWindow    = flag.Int("pairing-window", 300, "seconds pairing is accepted after start, -1 keeps it open")
+	listenMode       = flag.String("listen", "profile", "how hosts connect, profile takes the channels from bluez, raw listens on the l2cap psms itself")
+	hogpEnabled      = flag.Bool("hogp", false, "also serve the mouse as HID over GATT for LE hosts")
+	batterySpec      = flag.String("battery", "", "battery level reported to hosts, a percentage, script:/path printing one or sysfs[:name] for /sys/class/power_supply")
+	busAddress       = flag.String("bus", "", "d-bus address bluetoothd is reached on, empty is the system bus")
+	lockdown         = flag.Bool("lockdown", false, "limit the services bluetoothd accepts on the adapter to hid, pnp and -lockdown-services, without it the limit is lifted again")
+	lockdownServices = flag.String("lockdown-services", "", "comma separated service uuids allowed besides hid and pnp with -lockdown")
+	confirmMode      = flag.String("confirm", "api", "numeric comparison answer, api waits for /pairing/confirm, auto accepts anyone inside the pairing window")
+	keyboardEnabled  = flag.Bool("keyboard", false, "also announce a keyboard and serve the /keyboard endpoints")
+	keyboardLayout   = flag.String("keyboard-layout", "us", "layout of the hosts text is typed for, one of "+strings.Join(keyboard.Layouts(), " "))
+	keyPace          = flag.Int("key-pace", 10, "milliseconds between two keyboard reports to a host")
+	httpAddress      = flag.String("http", ":8080", "address the http api listens on")
+)
+
+func deviceMatches(list string) []bluez.DeviceMatch {
+	var matches []bluez.DeviceMatch
+	for _, addr := range strings.Split(list, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			matches = append(matches, bluez.DeviceMatch{Address: addr})
+		}
+	}
+	return matches
+}
+
 func l2capListen(psm uint16) (int, error) {
 	fd, err := unix.Socket(syscall.AF_BLUETOOTH, syscall.SOCK_SEQPACKET, unix.BTPROTO_L2CAP)
 	if err != nil {
@@ -41,13 +83,45 @@ func l2capListen(psm uint16) (int, error) {
 	return fd, nil
 }
 
-func initLowLevelBluetooth() (uint16, error) {
-	ll := mgmt.NewBluetoothLowLevel()
-	if err := ll.Connect(); err != nil {
-		return 0, err
+const (
+	solL2CAP     = 6
+	l2capOptions = 1
+)
+
+// l2capOutMTU the outgoing mtu of a connected l2cap socket, the first field
+// of struct l2cap_options, the l2cap default when it can not be read
+func l2capOutMTU(fd int) int {
+	var opts [12]byte
+	size := uint32(len(opts))
+	_, _, errno := unix.Syscall6(unix.SYS_GETSOCKOPT, uintptr(fd), solL2CAP, l2capOptions,
+		uintptr(unsafe.Pointer(&opts[0])), uintptr(unsafe.Pointer(&size)), 0)
+	if errno != 0 || size < 2 {
+		return hid.L2CAPDefaultMTU
 	}
+	return int(binary.LittleEndian.Uint16(opts[:]))
+}
 
-	list, err := ll.ReadControllerIndexList()
+// machineAddress a stable address for controllers without one, it has the
+// locally administered bit set and so is no valid IEEE assigned public
+// BD_ADDR even though it is programmed as one, -public-address takes the
+// address printed on the dongle instead
+func machineAddress() ([6]byte, error) {
+	var addr [6]byte
+	id, err := ioutil.ReadFile("/etc/machine-id")
+	if err != nil {
+		return addr, err
+	}
+	sum := sha256.Sum256(id)
+	copy(addr[:], sum[:])
+	// unicast and locally administered
+	addr[5] = addr[5]&0xFC | 0x02
+	return addr, nil
+}
+
+// configureController some dongles only show up as unconfigured until they
+// got a public address, configure the first one and wait for it to be added
+func configureController(ll *mgmt.BluetoothLowLevel) (uint16, error) {
+	list, err := ll.ReadUnconfiguredControllerIndexList()
 	if err != nil {
 		return 0, err
 	}
@@ -57,84 +131,183 @@ func initLowLevelBluetooth() (uint16, error) {
 
 	index := list.Controllers[0]
 
-	if _, err := ll.SetPowered(index, mgmt.On); err != nil {
+	info, err := ll.ReadControllerConfigurationInformation(index)
+	if err != nil {
 		return 0, err
 	}
+	log.Printf("Bluetooth Unconfigured Controller %d Missing Options %#x", index, info.MissingOptions)
+	if info.MissingOptions == 0 {
+		return index, nil
+	}
+
+	added := make(chan uint16, 1)
+	cancel := ll.On(mgmt.EvIndexAdded, func(ev *mgmt.Event) {
+		if ev.Controller != index {
+			return
+		}
+		select {
+		case added <- ev.Controller:
+		default:
+		}
+	})
+	defer cancel()
+
+	missing := info.MissingOptions
+	if missing&mgmt.OptionExternalConfiguration != 0 {
+		missing, err = ll.SetExternalConfiguration(index, mgmt.On)
+		if err != nil {
+			return 0, err
+		}
+		log.Printf("Bluetooth Set External Configuration")
+	}
+
+	if missing&mgmt.OptionPublicAddress != 0 {
+		var addr [6]byte
+		if *publicAddress != "" {
+			addr, err = mgmt.ParseAddress(*publicAddress)
+		} else {
+			addr, err = machineAddress()
+		}
+		if err != nil {
+			return 0, err
+		}
+		missing, err = ll.SetPublicAddress(index, addr)
+		if err != nil {
+			return 0, err
+		}
+		log.Printf("Bluetooth Set Public Address %s", mgmt.AddressString(addr))
+	}
+
+	if missing != 0 {
+		return 0, errors.New("controller still missing configuration options")
+	}
+
+	select {
+	case <-added:
+	case <-time.After(time.Second * 5):
+		return 0, errors.New("configured controller not added")
+	}
+	log.Printf("Bluetooth Controller %d Configured", index)
+
+	return index, nil
+}
+
+func initLowLevelBluetooth() (*mgmt.BluetoothLowLevel, uint16, error) {
+	ll := mgmt.NewBluetoothLowLevel()
+	if err := ll.Connect(); err != nil {
+		return nil, 0, err
+	}
+
+	list, err := ll.ReadControllerIndexList()
+	if err != nil {
+		return nil, 0, err
+	}
+	var index uint16
+	if *controllerIndex >= 0 {
+		index = uint16(*controllerIndex)
+	} else if len(list.Controllers) == 0 {
+		index, err = configureController(ll)
+		if err != nil {
+			return nil, 0, err
+		}
+	} else {
+		index = list.Controllers[0]
+	}
+
+	if _, err := ll.SetPowered(index, mgmt.On); err != nil {
+		return nil, 0, err
+	}
 	log.Printf("Bluetooth Powered On")
 
-	if _, err := ll.SetConnectable(index, mgmt.On); err != nil {
-		return 0, err
+	// presence mode turns connectable on once a host is nearby
+	if *presencePatterns == "" {
+		if _, err := ll.SetConnectable(index, mgmt.On); err != nil {
+			return nil, 0, err
+		}
+		log.Printf("Bluetooth Connectable On")
 	}
-	log.Printf("Bluetooth Connectable On")
 
 	if err := ll.SetLocalName(index, "AnonymousCheat", "AC"); err != nil {
-		return 0, err
+		return nil, 0, err
 	}
 	log.Printf("Bluetooth SetLocalName")
 
 	if _, err := ll.SetSecureSimplePairing(index, mgmt.On); err != nil {
-		return 0, err
+		return nil, 0, err
 	}
 	log.Printf("Bluetooth Set Secure Simple Pairing")
 
-	if _, err := ll.SetDiscoverable(index, mgmt.On, 0x500); err != nil {
-		return 0, err
+	if *presencePatterns == "" {
+		if _, err := ll.SetDiscoverable(index, mgmt.On, 0x500); err != nil {
+			return nil, 0, err
+		}
+		log.Printf("Bluetooth Set Discovereable")
 	}
-	log.Printf("Bluetooth Set Discovereable")
 
 	if _, err := ll.SetDeviceClass(index, 5, 64); err != nil {
-		return 0, err
+		return nil, 0, err
 	}
 	log.Printf("Bluetooth Set Device Class")
 
 	if err := ll.SetAppearance(index, 0x03C0); err != nil {
-		return 0, err
+		return nil, 0, err
 	}
 	log.Printf("Bluetooth Set Appearance")
 
-	return index, nil
+	return ll, index, nil
 }
 
-func initBluez(index uint16) error {
+func initBluez(index uint16, pairing *Pairing, s *Services, battery *BatteryLevel) error {
 	am, err := bluez.NewAgentManager()
 	if err != nil {
 		return err
 	}
 
-	_, err = bluez.NewSimpleAgent(growcastle.AgentPath)
+	agent, err := bluez.NewPolicyAgent(growcastle.AgentPath, bluez.AgentPolicy{
+		Allow:       deviceMatches(*allowDevices),
+		Deny:        deviceMatches(*denyDevices),
+		Services:    []string{growcastle.HIDServiceUUID, "0x1200"},
+		Confirm:     pairing.Confirm,
+		TrustOnPair: true,
+	})
 	if err != nil {
 		return err
 	}
+	pairing.SetAgent(agent)
 
-	err = am.RegisterAgent(growcastle.AgentPath, bluez.AgentCapabilityDisplayOnly)
-	if err != nil {
-		return err
+	if *pairingWindow != 0 {
+		agent.OpenPairingWindow(time.Second * time.Duration(*pairingWindow))
 	}
 
-	err = am.RequestDefaultAgent(growcastle.AgentPath)
-	if err != nil {
-		return err
+	// bluez only asks for numeric comparison when the agent can answer yes
+	// or no, just works pairing comes as RequestAuthorization either way
+	capability := bluez.AgentCapabilityDisplayOnly
+	if *confirmMode == "api" {
+		capability = bluez.AgentCapabilityDisplayYesNo
 	}
-
-	pm, err := bluez.NewProfileManager()
+	err = agent.Register(am, capability, true)
 	if err != nil {
 		return err
 	}
 
-	_, err = growcastle.NewProfile()
+	pm, err := bluez.NewProfileManager()
 	if err != nil {
 		return err
 	}
 
 	var descriptor [][]byte
 	descriptor = append(descriptor, growcastle.MouseDescriptor())
+	if *keyboardEnabled {
+		descriptor = append(descriptor, growcastle.KeyboardDescriptor(growcastle.KeyboardReportID))
+	}
 
-	record, err := growcastle.SDPRecord(descriptor)
+	record, err := growcastle.SDPRecord(descriptor, battery != nil)
 	if err != nil {
 		return err
 	}
-
-	service := "00001124-0000-1000-8000-00805f9b34fb"
+	if err := s.SetDescriptor(descriptor); err != nil {
+		return err
+	}
 
 	opts := make(map[string]interface{})
 	opts["Name"] = "GrowCastle"
@@ -142,44 +315,288 @@ func initBluez(index uint16) error {
 	opts["AutoConnect"] = true
 	opts["ServiceRecord"] = record
 
-	err = pm.RegisterProfile(
-		growcastle.ProfilePath,
-		service, // HumanInterfaceDeviceServiceClass
-		opts,
-	)
+	if *listenMode == "raw" {
+		// only publishes the record, the channels are accepted on our own sockets
+		_, err = growcastle.NewProfile()
+		if err != nil {
+			return err
+		}
+
+		return pm.RegisterProfile(
+			growcastle.ProfilePath,
+			growcastle.HIDServiceUUID,
+			opts,
+		)
+	}
+
+	opts["RequireAuthentication"] = true
+
+	profile, err := bluez.NewHIDProfile(growcastle.ProfilePath, s.Attach, s.Detach)
+	if err != nil {
+		return err
+	}
+
+	return profile.Register(pm, growcastle.HIDServiceUUID, opts)
+}
+
+// initHOGP every subscribed LE host gets the same notifications, services
+// sees them as a single "le" device
+func initHOGP(ll *mgmt.BluetoothLowLevel, index uint16, s *Services, battery *BatteryLevel) error {
+	if _, err := ll.SetLowEnergy(index, mgmt.On); err != nil {
+		return err
+	}
+
+	var hogp *bluez.HOGP
+	reportMap := growcastle.MouseDescriptor()
+	reports := []bluez.HOGPReport{
+		{ID: growcastle.MouseReportID, Type: bluez.ReportTypeInput},
+	}
+	if *keyboardEnabled {
+		reportMap = append(reportMap, growcastle.KeyboardDescriptor(growcastle.KeyboardReportID)...)
+		reports = append(reports, bluez.HOGPReport{ID: growcastle.KeyboardReportID, Type: bluez.ReportTypeInput})
+	}
+	desc, err := hid.Parse(reportMap)
+	if err != nil {
+		return err
+	}
+
+	hogp = bluez.NewHOGP(growcastle.GattPath, bluez.HOGPConfig{
+		ReportMap:    reportMap,
+		Reports:      reports,
+		Manufacturer: "vitrhid",
+		BatteryLevel: 100,
+		Boot:         desc,
+		BootKeyboard: desc.Boot()&hid.BootKeyboard != 0,
+		BootMouse:    desc.Boot()&hid.BootMouse != 0,
+		OnSubscribe: func(subscribed bool) {
+			if subscribed {
+				s.AttachReports("le", hogp)
+			} else {
+				s.DetachReports("le")
+			}
+		},
+	})
+
+	if battery != nil {
+		hogp.SetBatteryLevel(battery.Level())
+		battery.OnChange(hogp.SetBatteryLevel)
+	}
+
+	adapter := fmt.Sprintf("hci%d", index)
+	if err := hogp.Register(adapter); err != nil {
+		return err
+	}
+
+	advertisement := bluez.NewAdvertisement(growcastle.AdvertisementPath, bluez.AdvertisementData{
+		ServiceUUIDs: []string{bluez.HIDServiceUUID, bluez.BatteryServiceUUID},
+		Appearance:   0x03C2, // mouse
+		LocalName:    "AnonymousCheat",
+		Discoverable: true,
+	})
+	advertisement.OnRelease = func() {
+		log.Printf("Bluetooth Advertisement Released")
+	}
+	return advertisement.Register(adapter)
+}
+
+// initLockdown leaves nothing but the hid role to nearby hosts even when
+// bluetoothd runs with its audio and obex plugins, the list stays in its
+// storage until it is cleared
+func initLockdown(index uint16) error {
+	policy, err := bluez.NewAdminPolicy(fmt.Sprintf("hci%d", index))
 	if err != nil {
 		return err
 	}
+	defer policy.Close()
 
+	services := []string{growcastle.HIDServiceUUID, "0x1200"}
+	if *hogpEnabled {
+		services = append(services, bluez.HIDServiceUUID, bluez.BatteryServiceUUID, bluez.DeviceInformationServiceUUID)
+	}
+	for _, uuid := range strings.Split(*lockdownServices, ",") {
+		if uuid = strings.TrimSpace(uuid); uuid != "" {
+			services = append(services, uuid)
+		}
+	}
+
+	if err := policy.SetServiceAllowList(services); err != nil {
+		return err
+	}
+
+	allowed, err := policy.GetServiceAllowList()
+	if err != nil {
+		return err
+	}
+	log.Printf("Bluetooth Service Allow List %s", strings.Join(allowed, ","))
 	return nil
 }
 
+// clearLockdown bluetoothd keeps the allow list of an earlier -lockdown
+// run, without the flag every service is allowed again
+func clearLockdown(index uint16) error {
+	policy, err := bluez.NewAdminPolicy(fmt.Sprintf("hci%d", index))
+	if err != nil {
+		return err
+	}
+	defer policy.Close()
+
+	allowed, err := policy.GetServiceAllowList()
+	if err != nil || len(allowed) == 0 {
+		return err
+	}
+	if err := policy.SetServiceAllowList(nil); err != nil {
+		return err
+	}
+	log.Printf("Bluetooth Service Allow List cleared")
+	return nil
+}
+
+func initBattery(index uint16, s *Services) (*BatteryLevel, error) {
+	battery, err := NewBatteryLevel(*batterySpec)
+	if err != nil {
+		return nil, err
+	}
+	go battery.Poll(time.Minute)
+
+	provider := bluez.NewBatteryProvider(growcastle.BatteryPath)
+	if err := provider.Register(fmt.Sprintf("hci%d", index)); err != nil {
+		// older bluez without the experimental battery api
+		log.Printf("battery: provider %s", err)
+		provider = nil
+	}
+	s.SetBattery(battery, provider)
+
+	return battery, nil
+}
+
+func initPresence(ll *mgmt.BluetoothLowLevel, index uint16, w *bluez.Watcher) error {
+	if w == nil {
+		return errors.New("needs the bluez watcher to know the bonded devices")
+	}
+	patterns, err := mgmt.ParseAdvertisementPatterns(*presencePatterns)
+	if err != nil {
+		return err
+	}
+
+	if _, err := ll.SetLowEnergy(index, mgmt.On); err != nil {
+		return err
+	}
+
+	var rssi *mgmt.AdvertisementMonitorRSSI
+	if *presenceRSSI != 0 {
+		rssi = &mgmt.AdvertisementMonitorRSSI{
+			HighThreshold:        int8(*presenceRSSI),
+			HighThresholdTimeout: 1,
+			LowThreshold:         int8(*presenceRSSI - 10),
+			LowThresholdTimeout:  5,
+			SamplingPeriod:       0,
+		}
+	}
+
+	bonded := func(addr [6]byte) bool {
+		_, props, ok := w.DeviceByAddress(mgmt.AddressString(addr))
+		return ok && (props.Bonded || props.Paired)
+	}
+	return NewPresence(ll, index, 0x500, bonded).Start(rssi, patterns)
+}
+
 func main() {
 	var err error
 
-	controlListenFd, err = l2capListen(0x11)
-	if err != nil {
-		log.Fatalf("l2cap: listen control")
+	flag.Parse()
+
+	if flag.Arg(0) == "doctor" {
+		os.Exit(runDoctor())
+	}
+
+	if *listenMode != "profile" && *listenMode != "raw" {
+		log.Fatalf("listen: unknown mode %s\n", *listenMode)
 	}
-	interruptListenFd, err = l2capListen(0x13)
+
+	if *listenMode == "raw" {
+		controlListenFd, err = l2capListen(0x11)
+		if err != nil {
+			log.Fatalf("l2cap: listen control %s, vitrhid doctor tells why\n", err)
+		}
+		interruptListenFd, err = l2capListen(0x13)
+		if err != nil {
+			log.Fatalf("l2cap: listen interrupt %s, vitrhid doctor tells why\n", err)
+		}
+	}
+
+	conn, err := bluez.Dial(*busAddress)
 	if err != nil {
-		log.Fatalf("l2cap: listen interrupt")
+		log.Fatalf("dbus: %s\n", err)
 	}
+	defer conn.Close()
+	bluez.SetConn(conn)
 
-	index, err := initLowLevelBluetooth()
+	ll, index, err := initLowLevelBluetooth()
 	if err != nil {
 		log.Fatalf("bluetooth: %s\n", err)
 	}
 
-	if err := initBluez(index); err != nil {
-		log.Fatalf("bluez: %s\n", err)
+	w, err := bluez.NewWatcher()
+	if err != nil {
+		log.Printf("bluez: watcher %s", err)
+	}
+
+	if *presencePatterns != "" {
+		if err := initPresence(ll, index, w); err != nil {
+			log.Fatalf("presence: %s\n", err)
+		}
+	}
+
+	if *lockdown {
+		if err := initLockdown(index); err != nil {
+			log.Fatalf("lockdown: %s\n", err)
+		}
+	} else if err := clearLockdown(index); err != nil {
+		// bluez without the admin policy plugin has nothing to clear
+		log.Printf("lockdown: %s", err)
+	}
+
+	if *confirmMode != "auto" && *confirmMode != "api" {
+		log.Fatalf("confirm: unknown mode %s\n", *confirmMode)
+	}
+	pairing := NewPairing(*confirmMode == "auto")
+
+	layout, err := keyboard.LayoutByName(*keyboardLayout)
+	if err != nil {
+		log.Fatalf("%s\n", err)
 	}
 
 	s := NewServices()
-	go s.AcceptControl()
-	go s.AcceptInterrupt()
+	s.SetPairing(pairing)
+	s.SetKeyboard(layout, time.Millisecond*time.Duration(*keyPace))
+
+	var battery *BatteryLevel
+	if *batterySpec != "" {
+		battery, err = initBattery(index, s)
+		if err != nil {
+			log.Fatalf("battery: %s\n", err)
+		}
+	}
+
+	if err := initBluez(index, pairing, s, battery); err != nil {
+		log.Fatalf("bluez: %s\n", err)
+	}
+
+	if w != nil {
+		s.SetWatcher(w)
+	}
+	if *hogpEnabled {
+		if err := initHOGP(ll, index, s, battery); err != nil {
+			log.Fatalf("hogp: %s\n", err)
+		}
+	}
+
+	if *listenMode == "raw" {
+		go s.AcceptControl()
+		go s.AcceptInterrupt()
+	}
 
-	if err := http.ListenAndServe(":8080", s); err != nil {
+	if err := http.ListenAndServe(*httpAddress, s); err != nil {
 		log.Fatalf("http: %s\n", err)
 	}
 }
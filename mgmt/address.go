@@ -0,0 +1,33 @@
+package mgmt
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidAddress = errors.New("invalid address")
+
+// ParseAddress parse "AA:BB:CC:DD:EE:FF" into mgmt little endian byte order
+func ParseAddress(s string) ([6]byte, error) {
+	var addr [6]byte
+	parts := strings.Split(s, ":")
+	if len(parts) != 6 {
+		return addr, ErrInvalidAddress
+	}
+	for i := 0; i < 6; i++ {
+		v, err := strconv.ParseUint(parts[i], 16, 8)
+		if err != nil {
+			return addr, ErrInvalidAddress
+		}
+		addr[5-i] = byte(v)
+	}
+	return addr, nil
+}
+
+// AddressString format mgmt little endian address as "AA:BB:CC:DD:EE:FF"
+func AddressString(addr [6]byte) string {
+	return fmt.Sprintf("%02X:%02X:%02X:%02X:%02X:%02X",
+		addr[5], addr[4], addr[3], addr[2], addr[1], addr[0])
+}
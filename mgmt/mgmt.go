@@ -7,6 +7,7 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"sync"
 	"syscall"
 
 	"golang.org/x/sys/unix"
@@ -84,17 +85,86 @@ func (e *CommandError) String() string {
 
 // BluetoothLowLevel detail docs https://github.com/bluez/bluez/blob/master/doc/mgmt-api.txt
 type BluetoothLowLevel struct {
-	fd      int
-	pending *list.List
+	fd       int
+	lock     sync.Mutex
+	pending  *list.List
+	handlers map[uint16][]*eventHandler
 }
 
 func NewBluetoothLowLevel() *BluetoothLowLevel {
 	b := BluetoothLowLevel{}
 	b.fd = -1
 	b.pending = list.New()
+	b.handlers = make(map[uint16][]*eventHandler)
 	return &b
 }
 
+// AnyEvent subscribes a handler to every event
+const AnyEvent uint16 = 0
+
+// Event is an unsolicited management event, Payload holds the decoded
+// parameters when the event code is known otherwise nil
+type Event struct {
+	Code       uint16
+	Controller uint16
+	Data       []byte
+	Payload    interface{}
+}
+
+// EventHandler runs on the event loop, issuing commands from inside a handler
+// blocks the loop so hand them off to another goroutine
+type EventHandler func(ev *Event)
+
+type eventHandler struct {
+	fn EventHandler
+}
+
+// On registers handler for event code, the returned func removes it again
+func (b *BluetoothLowLevel) On(code uint16, handler EventHandler) func() {
+	h := &eventHandler{fn: handler}
+
+	b.lock.Lock()
+	b.handlers[code] = append(b.handlers[code], h)
+	b.lock.Unlock()
+
+	return func() {
+		b.lock.Lock()
+		defer b.lock.Unlock()
+		hs := b.handlers[code]
+		for i := 0; i < len(hs); i++ {
+			if hs[i] == h {
+				b.handlers[code] = append(hs[:i:i], hs[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+func (b *BluetoothLowLevel) dispatch(cmd *Command) {
+	ev := &Event{
+		Code:       cmd.OpCode,
+		Controller: cmd.Controller,
+		Data:       cmd.Data,
+	}
+	if len(cmd.Data) > 0 {
+		// handlers would get a half decoded payload of a short event
+		if err := autoTransEvent(bytes.NewReader(cmd.Data), ev); err != nil && err != errNoTransform {
+			log.Printf("mgmt: dropped event %#04x of hci%d: %s", ev.Code, ev.Controller, err)
+			return
+		}
+	}
+
+	b.lock.Lock()
+	var hs []*eventHandler
+	hs = append(hs, b.handlers[ev.Code]...)
+	hs = append(hs, b.handlers[AnyEvent]...)
+	b.lock.Unlock()
+
+	for i := 0; i < len(hs); i++ {
+		hs[i].fn(ev)
+	}
+}
+
 func (b *BluetoothLowLevel) commandComplete(cmd *Command) {
 	if len(cmd.Data) < 3 {
 		return
@@ -109,6 +179,9 @@ func (b *BluetoothLowLevel) commandComplete(cmd *Command) {
 	binary.Read(r, binaryOrder, &cmdCode)
 	binary.Read(r, binaryOrder, &cmdStatus)
 
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
 	element := b.pending.Front()
 	for element != nil {
 		pendingCmd := element.Value.(*Command)
@@ -174,6 +247,8 @@ func (b *BluetoothLowLevel) eventLoop(epollFd int) {
 				case EventCommandComplete, EventCommandStatus:
 					b.commandComplete(base)
 					break
+				default:
+					b.dispatch(base)
 				}
 			}
 		}
@@ -228,9 +303,14 @@ func (b *BluetoothLowLevel) Send(cmd *Command) (*CommandComplete, error) {
 	cmd.pkt = make(chan *CommandComplete, 1)
 	defer close(cmd.pkt)
 
-	b.pending.PushBack(cmd)
+	b.lock.Lock()
+	element := b.pending.PushBack(cmd)
+	b.lock.Unlock()
 
 	if _, err := unix.Write(b.fd, buf); err != nil {
+		b.lock.Lock()
+		b.pending.Remove(element)
+		b.lock.Unlock()
 		return nil, err
 	}
 
@@ -256,6 +336,28 @@ func (b *BluetoothLowLevel) oneByteCommand(index, opcode uint16, e byte) (*Comma
 	})
 }
 
+func (b *BluetoothLowLevel) ReadManagementVersionInformation() (*ReadVersion, error) {
+	pkt, err := b.Send(&Command{
+		OpCode:     OpReadManagementVersionInformation,
+		Controller: NonController,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pkt.Response.(*ReadVersion), nil
+}
+
+func (b *BluetoothLowLevel) ReadControllerInformation(index uint16) (*ReadControllerInformation, error) {
+	pkt, err := b.Send(&Command{
+		OpCode:     OpReadControllerInformation,
+		Controller: index,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pkt.Response.(*ReadControllerInformation), nil
+}
+
 func (b *BluetoothLowLevel) SetPowered(index uint16, powered byte) (uint32, error) {
 	pkt, err := b.oneByteCommand(index, OpSetPowered, powered)
 	if err != nil {
@@ -362,6 +464,50 @@ func (b *BluetoothLowLevel) ReadControllerIndexList() (*ReadControllerIndexList,
 	return pkt.Response.(*ReadControllerIndexList), nil
 }
 
+func (b *BluetoothLowLevel) ReadUnconfiguredControllerIndexList() (*ReadControllerIndexList, error) {
+	pkt, err := b.Send(&Command{
+		OpCode:     OpReadUnconfiguredControllerIndexList,
+		Controller: NonController,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pkt.Response.(*ReadControllerIndexList), nil
+}
+
+func (b *BluetoothLowLevel) ReadControllerConfigurationInformation(index uint16) (*ControllerConfigurationInformation, error) {
+	pkt, err := b.Send(&Command{
+		OpCode:     OpReadControllerConfigurationInformation,
+		Controller: index,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pkt.Response.(*ControllerConfigurationInformation), nil
+}
+
+// SetExternalConfiguration returns the missing options
+func (b *BluetoothLowLevel) SetExternalConfiguration(index uint16, configuration byte) (uint32, error) {
+	pkt, err := b.oneByteCommand(index, OpSetExternalConfiguration, configuration)
+	if err != nil {
+		return 0, err
+	}
+	return pkt.Response.(uint32), nil
+}
+
+// SetPublicAddress returns the missing options, address in mgmt byte order see ParseAddress
+func (b *BluetoothLowLevel) SetPublicAddress(index uint16, address [6]byte) (uint32, error) {
+	pkt, err := b.Send(&Command{
+		OpCode:     OpSetPublicAddress,
+		Controller: index,
+		Data:       address[:],
+	})
+	if err != nil {
+		return 0, err
+	}
+	return pkt.Response.(uint32), nil
+}
+
 func (b *BluetoothLowLevel) SetLocalName(index uint16, name, shortName string) error {
 	bName := []byte(name)
 	bShortName := []byte(shortName)
@@ -405,7 +551,7 @@ func (b *BluetoothLowLevel) RemoveUUID(index uint16, uuid []byte) error {
 	_, err := b.Send(&Command{
 		OpCode:     OpRemoveUUID,
 		Controller: index,
-		Data:       append(uuid),
+		Data:       uuid,
 	})
 	if err != nil {
 		return err
@@ -427,6 +573,211 @@ func (b *BluetoothLowLevel) SetAppearance(index uint16, appearance uint16) error
 	return nil
 }
 
+func (b *BluetoothLowLevel) addressCommand(index, opcode uint16, address [6]byte, addressType byte, extra ...byte) (*AddressInfo, error) {
+	data := append(address[:], addressType)
+	pkt, err := b.Send(&Command{
+		OpCode:     opcode,
+		Controller: index,
+		Data:       append(data, extra...),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pkt.Response.(*AddressInfo), nil
+}
+
+func (b *BluetoothLowLevel) PairDevice(index uint16, address [6]byte, addressType byte, ioCapability byte) (*AddressInfo, error) {
+	return b.addressCommand(index, OpPairDevice, address, addressType, ioCapability)
+}
+
+// UnpairDevice disconnect 1 terminates the link as well
+func (b *BluetoothLowLevel) UnpairDevice(index uint16, address [6]byte, addressType byte, disconnect byte) (*AddressInfo, error) {
+	return b.addressCommand(index, OpUnpairDevice, address, addressType, disconnect)
+}
+
+func (b *BluetoothLowLevel) CancelPairDevice(index uint16, address [6]byte, addressType byte) (*AddressInfo, error) {
+	return b.addressCommand(index, OpCancelPairDevice, address, addressType)
+}
+
+func (b *BluetoothLowLevel) BlockDevice(index uint16, address [6]byte, addressType byte) (*AddressInfo, error) {
+	return b.addressCommand(index, OpBlockDevice, address, addressType)
+}
+
+func (b *BluetoothLowLevel) UnblockDevice(index uint16, address [6]byte, addressType byte) (*AddressInfo, error) {
+	return b.addressCommand(index, OpUnblockDevice, address, addressType)
+}
+
+func (b *BluetoothLowLevel) Disconnect(index uint16, address [6]byte, addressType byte) (*AddressInfo, error) {
+	return b.addressCommand(index, OpDisconnect, address, addressType)
+}
+
+func (b *BluetoothLowLevel) GetConnections(index uint16) ([]AddressInfo, error) {
+	pkt, err := b.Send(&Command{
+		OpCode:     OpGetConnections,
+		Controller: index,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pkt.Response.([]AddressInfo), nil
+}
+
+// LoadLinkKeys replaces every stored link key of the controller, an empty
+// list clears them
+func (b *BluetoothLowLevel) LoadLinkKeys(index uint16, debugKeys byte, keys []LinkKey) error {
+	buf := &bytes.Buffer{}
+	binary.Write(buf, binaryOrder, debugKeys)
+	binary.Write(buf, binaryOrder, uint16(len(keys)))
+	binary.Write(buf, binaryOrder, keys)
+	_, err := b.Send(&Command{
+		OpCode:     OpLoadLinkKeys,
+		Controller: index,
+		Data:       buf.Bytes(),
+	})
+	return err
+}
+
+func (b *BluetoothLowLevel) SetDeviceID(index uint16, id DeviceID) error {
+	buf := &bytes.Buffer{}
+	binary.Write(buf, binaryOrder, id)
+	_, err := b.Send(&Command{
+		OpCode:     OpSetDeviceID,
+		Controller: index,
+		Data:       buf.Bytes(),
+	})
+	return err
+}
+
+func (b *BluetoothLowLevel) ReadAdvertisingFeatures(index uint16) (*AdvertisingFeatures, error) {
+	pkt, err := b.Send(&Command{
+		OpCode:     OpReadAdvertisingFeatures,
+		Controller: index,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pkt.Response.(*AdvertisingFeatures), nil
+}
+
+// AddAdvertising returns the instance, advData and scanRsp are raw AD structures
+func (b *BluetoothLowLevel) AddAdvertising(index uint16, adv Advertising) (byte, error) {
+	if len(adv.AdvData) > 0xFF || len(adv.ScanRsp) > 0xFF {
+		return 0, errors.New("advertising data length not allow")
+	}
+	buf := &bytes.Buffer{}
+	binary.Write(buf, binaryOrder, adv.Instance)
+	binary.Write(buf, binaryOrder, adv.Flags)
+	binary.Write(buf, binaryOrder, adv.Duration)
+	binary.Write(buf, binaryOrder, adv.Timeout)
+	binary.Write(buf, binaryOrder, uint8(len(adv.AdvData)))
+	binary.Write(buf, binaryOrder, uint8(len(adv.ScanRsp)))
+	buf.Write(adv.AdvData)
+	buf.Write(adv.ScanRsp)
+	pkt, err := b.Send(&Command{
+		OpCode:     OpAddAdvertising,
+		Controller: index,
+		Data:       buf.Bytes(),
+	})
+	if err != nil {
+		return 0, err
+	}
+	return pkt.Response.(byte), nil
+}
+
+// RemoveAdvertising instance 0 removes all instances
+func (b *BluetoothLowLevel) RemoveAdvertising(index uint16, instance byte) (byte, error) {
+	pkt, err := b.oneByteCommand(index, OpRemoveAdvertising, instance)
+	if err != nil {
+		return 0, err
+	}
+	return pkt.Response.(byte), nil
+}
+
+func (b *BluetoothLowLevel) UserConfirmationReply(index uint16, address [6]byte, addressType byte) (*AddressInfo, error) {
+	return b.addressCommand(index, OpUserConfirmationReply, address, addressType)
+}
+
+func (b *BluetoothLowLevel) UserConfirmationNegativeReply(index uint16, address [6]byte, addressType byte) (*AddressInfo, error) {
+	return b.addressCommand(index, OpUserConfirmationNegativeReply, address, addressType)
+}
+
+func (b *BluetoothLowLevel) ReadAdvertisementMonitorFeatures(index uint16) (*AdvertisementMonitorFeatures, error) {
+	pkt, err := b.Send(&Command{
+		OpCode:     OpReadAdvertisementMonitorFeatures,
+		Controller: index,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pkt.Response.(*AdvertisementMonitorFeatures), nil
+}
+
+func serializePatterns(buf *bytes.Buffer, patterns []AdvertisementPattern) error {
+	if len(patterns) == 0 || len(patterns) > 0xFF {
+		return errors.New("pattern count not allow")
+	}
+	binary.Write(buf, binaryOrder, uint8(len(patterns)))
+	for i := 0; i < len(patterns); i++ {
+		p := patterns[i]
+		if len(p.Value) == 0 || int(p.Offset)+len(p.Value) > 31 {
+			return errors.New("pattern length not allow")
+		}
+		value := make([]byte, 31)
+		copy(value, p.Value)
+		buf.Write([]byte{p.Type, p.Offset, byte(len(p.Value))})
+		buf.Write(value)
+	}
+	return nil
+}
+
+func (b *BluetoothLowLevel) AddAdvertisementPatternsMonitor(index uint16, patterns []AdvertisementPattern) (uint16, error) {
+	buf := &bytes.Buffer{}
+	if err := serializePatterns(buf, patterns); err != nil {
+		return 0, err
+	}
+	pkt, err := b.Send(&Command{
+		OpCode:     OpAddAdvertisementPatternsMonitor,
+		Controller: index,
+		Data:       buf.Bytes(),
+	})
+	if err != nil {
+		return 0, err
+	}
+	return pkt.Response.(uint16), nil
+}
+
+func (b *BluetoothLowLevel) AddAdvertisementPatternsMonitorWithRSSIThreshold(index uint16, rssi AdvertisementMonitorRSSI, patterns []AdvertisementPattern) (uint16, error) {
+	buf := &bytes.Buffer{}
+	binary.Write(buf, binaryOrder, rssi)
+	if err := serializePatterns(buf, patterns); err != nil {
+		return 0, err
+	}
+	pkt, err := b.Send(&Command{
+		OpCode:     OpAddAdvertisementPatternsMonitorWithRSSIThreshold,
+		Controller: index,
+		Data:       buf.Bytes(),
+	})
+	if err != nil {
+		return 0, err
+	}
+	return pkt.Response.(uint16), nil
+}
+
+// RemoveAdvertisementMonitor handle 0 removes all monitors
+func (b *BluetoothLowLevel) RemoveAdvertisementMonitor(index uint16, handle uint16) (uint16, error) {
+	data := make([]byte, 2)
+	binaryOrder.PutUint16(data, handle)
+	pkt, err := b.Send(&Command{
+		OpCode:     OpRemoveAdvertisementMonitor,
+		Controller: index,
+		Data:       data,
+	})
+	if err != nil {
+		return 0, err
+	}
+	return pkt.Response.(uint16), nil
+}
+
 func (b *BluetoothLowLevel) Close() error {
 	if b.fd != -1 {
 		if err := unix.Close(b.fd); err != nil {
@@ -157,7 +157,10 @@ const (
 	OpAddExtendedAdvertisingParameters
 	OpAddExtendedAdvertisingData
 	OpAddAdvertisementPatternsMonitorWithRSSIThreshold
-	EvComplete
+)
+
+const (
+	EvComplete uint16 = iota + 1
 	EvStatus
 	EvControllerError
 	EvIndexAdded
@@ -203,6 +206,8 @@ const (
 	EvAdvertisementMonitorRemoved
 	EvControllerSuspend
 	EvControllerResume
+	EvAdvertisementMonitorDeviceFound
+	EvAdvertisementMonitorDeviceLost
 )
 
 type ReadVersion struct {
@@ -240,6 +245,38 @@ const (
 	SettingWidebandSpeech          = 1 << 17
 )
 
+var settingNames = []string{
+	"powered",
+	"connectable",
+	"fast-connectable",
+	"discoverable",
+	"bondable",
+	"link-security",
+	"ssp",
+	"br/edr",
+	"hs",
+	"le",
+	"advertising",
+	"secure-conn",
+	"debug-keys",
+	"privacy",
+	"configuration",
+	"static-addr",
+	"phy-configuration",
+	"wide-band-speech",
+}
+
+// SettingNames names every bit set in settings
+func SettingNames(settings uint32) []string {
+	var names []string
+	for i := 0; i < len(settingNames); i++ {
+		if settings&(1<<uint(i)) != 0 {
+			names = append(names, settingNames[i])
+		}
+	}
+	return names
+}
+
 type ReadControllerInformation struct {
 	Address           [6]byte
 	BluetoothVersion  byte
@@ -251,7 +288,186 @@ type ReadControllerInformation struct {
 	ShortName         [11]byte
 }
 
+const (
+	OptionExternalConfiguration = 1
+	OptionPublicAddress         = 1 << 1
+)
+
+type ControllerConfigurationInformation struct {
+	Manufacturer     uint16
+	SupportedOptions uint32
+	MissingOptions   uint32
+}
+
+type ConfigurationOptions struct {
+	MissingOptions uint32
+}
+
 type LocalName struct {
 	Name      [249]byte
 	ShortName [11]byte
 }
+
+const (
+	AdvertisementMonitorFeatureOrPatterns = 1
+)
+
+type AdvertisementMonitorFeatures struct {
+	SupportedFeatures uint32
+	EnabledFeatures   uint32
+	MaxNumHandles     uint16
+	MaxNumPatterns    uint8
+	Handles           []uint16
+}
+
+// AdvertisementPattern matches Value against the AD structure of Type
+// starting at Offset, Offset plus length of Value must fit in 31 bytes
+type AdvertisementPattern struct {
+	Type   byte
+	Offset byte
+	Value  []byte
+}
+
+// AdvertisementMonitorRSSI timeouts are in seconds, SamplingPeriod in 100ms units
+type AdvertisementMonitorRSSI struct {
+	HighThreshold        int8
+	HighThresholdTimeout uint16
+	LowThreshold         int8
+	LowThresholdTimeout  uint16
+	SamplingPeriod       uint8
+}
+
+type AdvertisementMonitorHandle struct {
+	Handle uint16
+}
+
+const (
+	AddressBREDR    byte = 0
+	AddressLEPublic byte = 1
+	AddressLERandom byte = 2
+)
+
+const (
+	IOCapabilityDisplayOnly     byte = 0
+	IOCapabilityDisplayYesNo    byte = 1
+	IOCapabilityKeyboardOnly    byte = 2
+	IOCapabilityNoInputNoOutput byte = 3
+	IOCapabilityKeyboardDisplay byte = 4
+)
+
+type AddressInfo struct {
+	Address     [6]byte
+	AddressType byte
+}
+
+type LinkKey struct {
+	Address     [6]byte
+	AddressType byte
+	KeyType     byte
+	Value       [16]byte
+	PINLength   byte
+}
+
+type NewLinkKey struct {
+	StoreHint byte
+	Key       LinkKey
+}
+
+const (
+	DeviceIDSourceDisabled  uint16 = 0
+	DeviceIDSourceBluetooth uint16 = 1
+	DeviceIDSourceUSB       uint16 = 2
+)
+
+type DeviceID struct {
+	Source  uint16
+	Vendor  uint16
+	Product uint16
+	Version uint16
+}
+
+const (
+	AdvertisingFlagConnectable  uint32 = 1
+	AdvertisingFlagDiscoverable uint32 = 1 << 1
+	AdvertisingFlagLimited      uint32 = 1 << 2
+	AdvertisingFlagManagedFlags uint32 = 1 << 3
+	AdvertisingFlagTxPower      uint32 = 1 << 4
+	AdvertisingFlagAppearance   uint32 = 1 << 5
+	AdvertisingFlagLocalName    uint32 = 1 << 6
+)
+
+type AdvertisingFeatures struct {
+	SupportedFlags uint32
+	MaxAdvDataLen  uint8
+	MaxScanRspLen  uint8
+	MaxInstances   uint8
+	Instances      []uint8
+}
+
+// Advertising Duration and Timeout are in seconds
+type Advertising struct {
+	Instance byte
+	Flags    uint32
+	Duration uint16
+	Timeout  uint16
+	AdvData  []byte
+	ScanRsp  []byte
+}
+
+type DeviceConnected struct {
+	Address     [6]byte
+	AddressType byte
+	Flags       uint32
+	EIR         []byte
+}
+
+type DeviceDisconnected struct {
+	Address     [6]byte
+	AddressType byte
+	Reason      byte
+}
+
+// AddressStatus carries the status of connect or authentication failures
+type AddressStatus struct {
+	Address     [6]byte
+	AddressType byte
+	Status      byte
+}
+
+type Discovering struct {
+	AddressType byte
+	Discovering byte
+}
+
+type PasskeyNotify struct {
+	Address     [6]byte
+	AddressType byte
+	Passkey     uint32
+	Entered     byte
+}
+
+type UserConfirmationRequest struct {
+	Address     [6]byte
+	AddressType byte
+	ConfirmHint byte
+	Value       uint32
+}
+
+type DeviceFound struct {
+	Address     [6]byte
+	AddressType byte
+	RSSI        int8
+	Flags       uint32
+	EIR         []byte
+}
+
+type AdvertisementMonitorDeviceFound struct {
+	Handle uint16
+	DeviceFound
+}
+
+type AdvertisementMonitorDeviceLost struct {
+	Handle      uint16
+	Address     [6]byte
+	AddressType byte
+}
@@ -0,0 +1,45 @@
+package mgmt
+
+import (
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// ParseAdvertisementPatterns parse "type:offset:hexvalue" pairs separated by comma
+// e.g. "ff:0:4c00" matches apple manufacturer specific data
+func ParseAdvertisementPatterns(s string) ([]AdvertisementPattern, error) {
+	var patterns []AdvertisementPattern
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		parts := strings.Split(item, ":")
+		if len(parts) != 3 {
+			return nil, errors.New("invalid pattern " + item)
+		}
+		t, err := strconv.ParseUint(parts[0], 16, 8)
+		if err != nil {
+			return nil, err
+		}
+		offset, err := strconv.ParseUint(parts[1], 10, 8)
+		if err != nil {
+			return nil, err
+		}
+		value, err := hex.DecodeString(parts[2])
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, AdvertisementPattern{
+			Type:   byte(t),
+			Offset: byte(offset),
+			Value:  value,
+		})
+	}
+	if len(patterns) == 0 {
+		return nil, errors.New("no pattern")
+	}
+	return patterns, nil
+}
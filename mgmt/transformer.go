@@ -6,6 +6,9 @@ import (
 	"io"
 )
 
+// errNoTransform the code has no payload type, the raw data is all there is
+var errNoTransform = errors.New("not support to trans")
+
 func simpleTo(r io.Reader, v interface{}) error {
 	return binary.Read(r, binaryOrder, v)
 }
@@ -45,7 +48,7 @@ func autoTransResponse(r io.Reader, base *CommandComplete) error {
 
 		base.Response = commands
 		return nil
-	case OpReadControllerIndexList:
+	case OpReadControllerIndexList, OpReadUnconfiguredControllerIndexList:
 		var numControllers uint16
 		if err := binary.Read(r, binaryOrder, &numControllers); err != nil {
 			return err
@@ -78,13 +81,228 @@ func autoTransResponse(r io.Reader, base *CommandComplete) error {
 		}
 		base.Response = cs
 		return nil
+	case OpReadControllerConfigurationInformation:
+		base.Response = &ControllerConfigurationInformation{}
+		return simpleTo(r, base.Response)
+	case OpSetExternalConfiguration, OpSetPublicAddress:
+		var missing uint32
+		if err := simpleTo(r, &missing); err != nil {
+			return err
+		}
+		base.Response = missing
+		return nil
 	case OpSetDeviceClass:
 		base.Response = make([]byte, 3)
 		return simpleTo(r, base.Response)
 	case OpSetLocalName:
 		base.Response = &LocalName{}
 		return simpleTo(r, base.Response)
+	case OpPairDevice,
+		OpUnpairDevice,
+		OpCancelPairDevice,
+		OpBlockDevice,
+		OpUnblockDevice,
+		OpDisconnect,
+		OpUserConfirmationReply,
+		OpUserConfirmationNegativeReply:
+		base.Response = &AddressInfo{}
+		return simpleTo(r, base.Response)
+	case OpGetConnections:
+		var count uint16
+		if err := simpleTo(r, &count); err != nil {
+			return err
+		}
+		conns := make([]AddressInfo, count)
+		if err := simpleTo(r, conns); err != nil {
+			return err
+		}
+		base.Response = conns
+		return nil
+	case OpReadAdvertisingFeatures:
+		features := &AdvertisingFeatures{}
+		if err := simpleTo(r, &features.SupportedFlags); err != nil {
+			return err
+		}
+		if err := simpleTo(r, &features.MaxAdvDataLen); err != nil {
+			return err
+		}
+		if err := simpleTo(r, &features.MaxScanRspLen); err != nil {
+			return err
+		}
+		if err := simpleTo(r, &features.MaxInstances); err != nil {
+			return err
+		}
+		var num uint8
+		if err := simpleTo(r, &num); err != nil {
+			return err
+		}
+		features.Instances = make([]uint8, num)
+		if err := simpleTo(r, features.Instances); err != nil {
+			return err
+		}
+		base.Response = features
+		return nil
+	case OpAddAdvertising, OpRemoveAdvertising:
+		var instance byte
+		if err := simpleTo(r, &instance); err != nil {
+			return err
+		}
+		base.Response = instance
+		return nil
+	case OpReadAdvertisementMonitorFeatures:
+		features := &AdvertisementMonitorFeatures{}
+		if err := simpleTo(r, &features.SupportedFeatures); err != nil {
+			return err
+		}
+		if err := simpleTo(r, &features.EnabledFeatures); err != nil {
+			return err
+		}
+		if err := simpleTo(r, &features.MaxNumHandles); err != nil {
+			return err
+		}
+		if err := simpleTo(r, &features.MaxNumPatterns); err != nil {
+			return err
+		}
+		var numHandles uint16
+		if err := simpleTo(r, &numHandles); err != nil {
+			return err
+		}
+		features.Handles = make([]uint16, numHandles)
+		if err := simpleTo(r, features.Handles); err != nil {
+			return err
+		}
+		base.Response = features
+		return nil
+	case OpAddAdvertisementPatternsMonitor,
+		OpAddAdvertisementPatternsMonitorWithRSSIThreshold,
+		OpRemoveAdvertisementMonitor:
+		var handle uint16
+		if err := simpleTo(r, &handle); err != nil {
+			return err
+		}
+		base.Response = handle
+		return nil
+	}
+
+	return errNoTransform
+}
+
+func deviceFoundTo(r io.Reader, d *DeviceFound) error {
+	if err := simpleTo(r, &d.Address); err != nil {
+		return err
+	}
+	if err := simpleTo(r, &d.AddressType); err != nil {
+		return err
+	}
+	if err := simpleTo(r, &d.RSSI); err != nil {
+		return err
+	}
+	if err := simpleTo(r, &d.Flags); err != nil {
+		return err
+	}
+	var eirLen uint16
+	if err := simpleTo(r, &eirLen); err != nil {
+		return err
+	}
+	d.EIR = make([]byte, eirLen)
+	return simpleTo(r, d.EIR)
+}
+
+func autoTransEvent(r io.Reader, ev *Event) error {
+	switch ev.Code {
+	case EvControllerError:
+		var code byte
+		if err := simpleTo(r, &code); err != nil {
+			return err
+		}
+		ev.Payload = code
+		return nil
+	case EvNewSettings:
+		var settings uint32
+		if err := simpleTo(r, &settings); err != nil {
+			return err
+		}
+		ev.Payload = settings
+		return nil
+	case EvClassOfDeviceChanged:
+		class := make([]byte, 3)
+		if err := simpleTo(r, class); err != nil {
+			return err
+		}
+		ev.Payload = class
+		return nil
+	case EvLocalNameChanged:
+		ev.Payload = &LocalName{}
+		return simpleTo(r, ev.Payload)
+	case EvNewLinkKey:
+		ev.Payload = &NewLinkKey{}
+		return simpleTo(r, ev.Payload)
+	case EvDeviceConnected:
+		conn := &DeviceConnected{}
+		if err := simpleTo(r, &conn.Address); err != nil {
+			return err
+		}
+		if err := simpleTo(r, &conn.AddressType); err != nil {
+			return err
+		}
+		if err := simpleTo(r, &conn.Flags); err != nil {
+			return err
+		}
+		var eirLen uint16
+		if err := simpleTo(r, &eirLen); err != nil {
+			return err
+		}
+		conn.EIR = make([]byte, eirLen)
+		if err := simpleTo(r, conn.EIR); err != nil {
+			return err
+		}
+		ev.Payload = conn
+		return nil
+	case EvDeviceDisconnected:
+		ev.Payload = &DeviceDisconnected{}
+		return simpleTo(r, ev.Payload)
+	case EvConnectFailed, EvAuthenticationFailed:
+		ev.Payload = &AddressStatus{}
+		return simpleTo(r, ev.Payload)
+	case EvDeviceBlocked, EvDeviceUnblocked, EvDeviceUnpaired:
+		ev.Payload = &AddressInfo{}
+		return simpleTo(r, ev.Payload)
+	case EvDiscovering:
+		ev.Payload = &Discovering{}
+		return simpleTo(r, ev.Payload)
+	case EvPasskeyNotify:
+		ev.Payload = &PasskeyNotify{}
+		return simpleTo(r, ev.Payload)
+	case EvNewConfigurationOptions:
+		ev.Payload = &ConfigurationOptions{}
+		return simpleTo(r, ev.Payload)
+	case EvUserConfirmationRequest:
+		ev.Payload = &UserConfirmationRequest{}
+		return simpleTo(r, ev.Payload)
+	case EvDeviceFound:
+		found := &DeviceFound{}
+		if err := deviceFoundTo(r, found); err != nil {
+			return err
+		}
+		ev.Payload = found
+		return nil
+	case EvAdvertisementMonitorAdded, EvAdvertisementMonitorRemoved:
+		ev.Payload = &AdvertisementMonitorHandle{}
+		return simpleTo(r, ev.Payload)
+	case EvAdvertisementMonitorDeviceFound:
+		found := &AdvertisementMonitorDeviceFound{}
+		if err := simpleTo(r, &found.Handle); err != nil {
+			return err
+		}
+		if err := deviceFoundTo(r, &found.DeviceFound); err != nil {
+			return err
+		}
+		ev.Payload = found
+		return nil
+	case EvAdvertisementMonitorDeviceLost:
+		ev.Payload = &AdvertisementMonitorDeviceLost{}
+		return simpleTo(r, ev.Payload)
 	}
 
-	return errors.New("not support to trans")
+	return errNoTransform
 }
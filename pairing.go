@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+	"vitrhid/bluez"
+)
+
+// pairingTimeout numeric comparisons nobody answered are rejected after it
+const pairingTimeout = time.Second * 30
+
+type pendingConfirm struct {
+	id     int
+	req    *bluez.ConfirmRequest
+	answer chan bool
+}
+
+type pendingInfo struct {
+	ID      int    `json:"id"`
+	Addr    string `json:"addr"`
+	Name    string `json:"name,omitempty"`
+	Passkey string `json:"passkey,omitempty"`
+}
+
+// Pairing holds the numeric comparisons waiting for an answer through http,
+// auto accepts them without asking
+type Pairing struct {
+	agent   *bluez.PolicyAgent
+	auto    bool
+	lock    sync.Mutex
+	nextID  int
+	pending map[int]*pendingConfirm
+}
+
+func NewPairing(auto bool) *Pairing {
+	return &Pairing{
+		auto:    auto,
+		pending: make(map[int]*pendingConfirm),
+	}
+}
+
+func (p *Pairing) SetAgent(agent *bluez.PolicyAgent) {
+	p.agent = agent
+}
+
+// Confirm is the AgentPolicy.Confirm callback
+func (p *Pairing) Confirm(req *bluez.ConfirmRequest) bool {
+	if req.JustWorks {
+		log.Printf("Pairing %s Just Works", req.Props.Address)
+	} else {
+		log.Printf("Pairing %s Passkey %06d", req.Props.Address, req.Passkey)
+	}
+	if p.auto {
+		return true
+	}
+
+	p.lock.Lock()
+	p.nextID++
+	c := &pendingConfirm{id: p.nextID, req: req, answer: make(chan bool, 1)}
+	p.pending[c.id] = c
+	p.lock.Unlock()
+
+	defer func() {
+		p.lock.Lock()
+		delete(p.pending, c.id)
+		p.lock.Unlock()
+	}()
+
+	select {
+	case accept := <-c.answer:
+		return accept
+	case <-req.Canceled:
+		return false
+	case <-time.After(pairingTimeout):
+		log.Printf("Pairing %s Timeout", req.Props.Address)
+		return false
+	}
+}
+
+func (p *Pairing) pendingInfos() []pendingInfo {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	infos := []pendingInfo{}
+	for _, c := range p.pending {
+		info := pendingInfo{
+			ID:   c.id,
+			Addr: c.req.Props.Address,
+			Name: c.req.Props.Alias,
+		}
+		if !c.req.JustWorks {
+			info.Passkey = fmt.Sprintf("%06d", c.req.Passkey)
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+func (p *Pairing) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/pairing" {
+		rw.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(rw).Encode(p.pendingInfos())
+		return
+	}
+
+	if r.URL.Path == "/pairing/confirm" {
+		id, err := strconv.Atoi(r.URL.Query().Get("id"))
+		if err != nil {
+			rw.Write([]byte("invalid id param"))
+			return
+		}
+		accept := r.URL.Query().Get("accept") != "0" && r.URL.Query().Get("accept") != "false"
+
+		p.lock.Lock()
+		c, ok := p.pending[id]
+		p.lock.Unlock()
+		if !ok {
+			rw.Write([]byte("no such request"))
+			return
+		}
+		select {
+		case c.answer <- accept:
+		default:
+		}
+		rw.Write([]byte("success"))
+		return
+	}
+
+	if r.URL.Path == "/pairing/window" {
+		if p.agent == nil {
+			rw.Write([]byte("no agent"))
+			return
+		}
+		seconds, err := strconv.Atoi(r.URL.Query().Get("seconds"))
+		if err != nil {
+			rw.Write([]byte("invalid seconds param"))
+			return
+		}
+		if seconds == 0 {
+			p.agent.ClosePairingWindow()
+		} else {
+			// negative keeps the window open
+			p.agent.OpenPairingWindow(time.Second * time.Duration(seconds))
+		}
+		rw.Write([]byte("success"))
+		return
+	}
+
+	http.NotFound(rw, r)
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"vitrhid/mgmt"
+)
+
+// Presence keeps the controller connectable and discoverable only while a
+// bonded device matching the advertisement monitor is nearby
+type Presence struct {
+	ll      *mgmt.BluetoothLowLevel
+	index   uint16
+	timeout uint16
+	bonded  func(addr [6]byte) bool
+	// rssi and patterns of the monitor, it is added again after the
+	// kernel removed it
+	rssi     *mgmt.AdvertisementMonitorRSSI
+	patterns []mgmt.AdvertisementPattern
+	lock     sync.Mutex
+	handle   uint16
+	// adding while the monitor is added its events can come ahead of the
+	// handle, they wait in early
+	adding  bool
+	early   []*mgmt.Event
+	stopped bool
+	nearby  map[[6]byte]struct{}
+	// visible the state apply makes the controller take, changes wakes it
+	// without blocking the event loop
+	visible bool
+	changes chan struct{}
+	cancel  []func()
+}
+
+// NewPresence bonded tells the hosts apart from anyone else sending a
+// matching advertisement
+func NewPresence(ll *mgmt.BluetoothLowLevel, index uint16, timeout uint16, bonded func(addr [6]byte) bool) *Presence {
+	return &Presence{
+		ll:      ll,
+		index:   index,
+		timeout: timeout,
+		bonded:  bonded,
+		nearby:  make(map[[6]byte]struct{}),
+		changes: make(chan struct{}, 1),
+	}
+}
+
+func (p *Presence) Start(rssi *mgmt.AdvertisementMonitorRSSI, patterns []mgmt.AdvertisementPattern) error {
+	features, err := p.ll.ReadAdvertisementMonitorFeatures(p.index)
+	if err != nil {
+		return err
+	}
+	if len(features.Handles) >= int(features.MaxNumHandles) && features.MaxNumHandles > 0 {
+		return errors.New("no advertisement monitor handle left")
+	}
+
+	p.cancel = append(p.cancel,
+		p.ll.On(mgmt.EvAdvertisementMonitorDeviceFound, p.deviceFound),
+		p.ll.On(mgmt.EvAdvertisementMonitorDeviceLost, p.deviceLost),
+		p.ll.On(mgmt.EvAdvertisementMonitorRemoved, p.monitorRemoved),
+	)
+
+	p.rssi, p.patterns = rssi, patterns
+	if err := p.add(); err != nil {
+		p.Stop()
+		return err
+	}
+
+	go p.apply()
+
+	return nil
+}
+
+// add the monitor and replay what it found while the reply was on its way
+func (p *Presence) add() error {
+	p.lock.Lock()
+	p.adding = true
+	p.lock.Unlock()
+	var handle uint16
+	var err error
+	if p.rssi != nil {
+		handle, err = p.ll.AddAdvertisementPatternsMonitorWithRSSIThreshold(p.index, *p.rssi, p.patterns)
+	} else {
+		handle, err = p.ll.AddAdvertisementPatternsMonitor(p.index, p.patterns)
+	}
+	p.lock.Lock()
+	p.adding = false
+	stopped := p.stopped
+	if err == nil && !stopped {
+		p.handle = handle
+	}
+	early := p.early
+	p.early = nil
+	p.lock.Unlock()
+	if err != nil {
+		return err
+	}
+	if stopped {
+		p.ll.RemoveAdvertisementMonitor(p.index, handle)
+		return nil
+	}
+	log.Printf("Presence monitor %d added", handle)
+	for _, ev := range early {
+		p.replay(ev)
+	}
+	return nil
+}
+
+func (p *Presence) Stop() {
+	for _, cancel := range p.cancel {
+		cancel()
+	}
+	p.cancel = nil
+	p.lock.Lock()
+	p.stopped = true
+	handle := p.handle
+	p.handle = 0
+	p.lock.Unlock()
+	if handle != 0 {
+		p.ll.RemoveAdvertisementMonitor(p.index, handle)
+	}
+}
+
+// set hands the state to apply, the handlers run on the event loop which
+// the mgmt commands of apply need, so this never blocks
+func (p *Presence) set(visible bool) {
+	p.lock.Lock()
+	p.visible = visible
+	p.lock.Unlock()
+	select {
+	case p.changes <- struct{}{}:
+	default:
+	}
+}
+
+// ours the event is of our monitor, events that come while it is added
+// are kept for replay
+func (p *Presence) ours(ev *mgmt.Event, handle uint16) bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.adding {
+		p.early = append(p.early, ev)
+		return false
+	}
+	return p.handle != 0 && handle == p.handle
+}
+
+func (p *Presence) replay(ev *mgmt.Event) {
+	switch ev.Code {
+	case mgmt.EvAdvertisementMonitorDeviceFound:
+		p.deviceFound(ev)
+	case mgmt.EvAdvertisementMonitorDeviceLost:
+		p.deviceLost(ev)
+	case mgmt.EvAdvertisementMonitorRemoved:
+		p.monitorRemoved(ev)
+	}
+}
+
+func (p *Presence) deviceFound(ev *mgmt.Event) {
+	found, ok := ev.Payload.(*mgmt.AdvertisementMonitorDeviceFound)
+	if !ok || ev.Controller != p.index || !p.ours(ev, found.Handle) || !p.bonded(found.Address) {
+		return
+	}
+	p.lock.Lock()
+	_, exists := p.nearby[found.Address]
+	p.nearby[found.Address] = struct{}{}
+	first := len(p.nearby) == 1
+	p.lock.Unlock()
+	if !exists && first {
+		p.set(true)
+	}
+}
+
+func (p *Presence) deviceLost(ev *mgmt.Event) {
+	lost, ok := ev.Payload.(*mgmt.AdvertisementMonitorDeviceLost)
+	if !ok || ev.Controller != p.index || !p.ours(ev, lost.Handle) {
+		return
+	}
+	p.lock.Lock()
+	_, exists := p.nearby[lost.Address]
+	delete(p.nearby, lost.Address)
+	empty := len(p.nearby) == 0
+	p.lock.Unlock()
+	if exists && empty {
+		p.set(false)
+	}
+}
+
+func (p *Presence) monitorRemoved(ev *mgmt.Event) {
+	h, ok := ev.Payload.(*mgmt.AdvertisementMonitorHandle)
+	if !ok || ev.Controller != p.index || !p.ours(ev, h.Handle) {
+		return
+	}
+	log.Printf("Presence monitor %d removed by kernel", h.Handle)
+	// hidden until the monitor is back, hosts would never see the
+	// controller again without it
+	p.lock.Lock()
+	p.handle = 0
+	p.nearby = make(map[[6]byte]struct{})
+	p.lock.Unlock()
+	p.set(false)
+	go p.readd()
+}
+
+// readd runs outside of the event loop, the controller stays visible when
+// the monitor can not come back
+func (p *Presence) readd() {
+	if err := p.add(); err != nil {
+		log.Printf("presence: monitor %s, staying visible", err)
+		p.set(true)
+	}
+}
+
+// apply runs outside of the event loop, mgmt commands block until replied
+func (p *Presence) apply() {
+	for range p.changes {
+		p.lock.Lock()
+		nearby := p.visible
+		p.lock.Unlock()
+		if nearby {
+			if _, err := p.ll.SetConnectable(p.index, mgmt.On); err != nil {
+				log.Printf("presence: connectable %s", err)
+			}
+			if _, err := p.ll.SetDiscoverable(p.index, mgmt.On, p.timeout); err != nil {
+				log.Printf("presence: discoverable %s", err)
+			}
+			log.Printf("Presence host nearby, discoverable")
+		} else {
+			if _, err := p.ll.SetDiscoverable(p.index, mgmt.Off, 0); err != nil {
+				log.Printf("presence: discoverable %s", err)
+			}
+			if _, err := p.ll.SetConnectable(p.index, mgmt.Off); err != nil {
+				log.Printf("presence: connectable %s", err)
+			}
+			log.Printf("Presence host gone, hidden")
+		}
+	}
+}
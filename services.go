@@ -1,16 +1,22 @@
 package main
 
 import (
-	"bytes"
-	"encoding/binary"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
+	"vitrhid/bluez"
 	"vitrhid/growcastle"
+	"vitrhid/hid"
+	"vitrhid/keyboard"
 
+	"github.com/godbus/dbus"
 	"golang.org/x/sys/unix"
 )
 
@@ -19,20 +25,49 @@ type Device struct {
 	Control   int
 	Interrupt int
 	Close     chan struct{}
+	closeLock sync.Mutex
 	Disposed  bool
+	Path      dbus.ObjectPath
+	Reports   bluez.ReportSender
+	// State answers the requests of the host on the control channel
+	State *hid.ReportState
+	// Keyboard types on the host when the descriptor has a keyboard
+	Keyboard *keyboard.Keyboard
+	// sendLock guards the buffers reports are marshaled into with
+	// AppendBinary and sent from so sending does not allocate
+	sendLock sync.Mutex
+	report   []byte
+	packet   []byte
 }
 
-func (d *Device) Send(x, y, tip int8) {
-	// reset
-	buf := &bytes.Buffer{}
-	buf.Write([]byte{0xA1, growcastle.MouseReportId})
-	binary.Write(buf, binary.LittleEndian, tip) // Tip Switch
-	binary.Write(buf, binary.LittleEndian, x)   // x
-	binary.Write(buf, binary.LittleEndian, y)   // y
+// sendReport goes through Reports for hosts connected over gatt, the
+// caller holds sendLock
+func (d *Device) sendReport(id byte, data []byte) error {
+	if d.State != nil {
+		d.State.Store(hid.ReportInput, id, data)
+		// the protocol is looked up per report so SET_PROTOCOL takes
+		// effect with the next one
+		var ok bool
+		if id, data, ok = d.State.ForProtocol(id, data); !ok {
+			return nil
+		}
+	}
+	if d.Reports != nil {
+		return d.Reports.SendReport(id, data)
+	}
+	d.packet = append(append(d.packet[:0], 0xA1, id), data...)
+	_, err := unix.Write(d.Interrupt, d.packet)
+	return err
+}
 
-	b := buf.Bytes()
+func (d *Device) Send(x, y, tip int8) {
+	r := growcastle.MouseInputReport{Button1: tip != 0, X: x, Y: y}
+	d.sendLock.Lock()
+	d.report, _ = r.AppendBinary(d.report[:0])
+	err := d.sendReport(r.ReportID(), d.report)
+	d.sendLock.Unlock()
 
-	if _, err := unix.Write(d.Interrupt, b); err != nil {
+	if err != nil {
 		d.Disposed = true
 		d.Stop()
 		return
@@ -64,53 +99,433 @@ func (d *Device) internalRun(cnt, step int8) {
 }
 
 func (d *Device) Start(sleep time.Duration) {
+	d.closeLock.Lock()
 	if d.Close == nil {
 		d.Close = make(chan struct{}, 1)
 	}
+	stop := d.Close
+	d.closeLock.Unlock()
 
 	for {
 		d.internalRun(8, 39)
 		select {
 		case <-time.After(time.Second * sleep):
 			break
-		case <-d.Close:
+		case <-stop:
 			return
 		}
 	}
 }
 
+// Stop the Start loop, it may be called any number of times
 func (d *Device) Stop() {
+	d.closeLock.Lock()
 	if d.Close != nil {
 		close(d.Close)
 		d.Close = nil
 	}
+	d.closeLock.Unlock()
 }
 
 type Services struct {
 	lock    sync.RWMutex
 	devices map[string]*Device
 	isStart byte
+	watcher *bluez.Watcher
+	pairing *Pairing
+	battery *BatteryLevel
+	// leds the keyboard leds the hosts set
+	leds *LEDs
+	// descriptor what the sdp record announces, control requests are
+	// answered by its layout
+	descriptor *hid.Descriptor
+	// layout and keyPace new host keyboards start with
+	layout  *keyboard.Layout
+	keyPace time.Duration
+	// batteries shows the level on the bluez device of every attached host
+	batteries *bluez.BatteryProvider
 }
 
 func NewServices() *Services {
 	s := &Services{}
 	s.devices = make(map[string]*Device)
+	s.leds = NewLEDs()
+	s.leds.OnChange(s.syncCapsLock)
 
 	return s
 }
 
+// SetWatcher lets the services describe connected hosts with what bluez knows
+func (s *Services) SetWatcher(w *bluez.Watcher) {
+	s.lock.Lock()
+	s.watcher = w
+	s.lock.Unlock()
+}
+
+// SetPairing serves the /pairing endpoints
+func (s *Services) SetPairing(p *Pairing) {
+	s.lock.Lock()
+	s.pairing = p
+	s.lock.Unlock()
+}
+
+// SetBattery serves /battery, provider may be nil
+func (s *Services) SetBattery(b *BatteryLevel, provider *bluez.BatteryProvider) {
+	s.lock.Lock()
+	s.battery = b
+	s.batteries = provider
+	s.lock.Unlock()
+
+	if provider == nil {
+		return
+	}
+	b.OnChange(func(level byte) {
+		for _, battery := range provider.Batteries("") {
+			battery.SetPercentage(level)
+		}
+	})
+}
+
+// SetDescriptor the report descriptors of the sdp record, hosts see them
+// as one
+func (s *Services) SetDescriptor(descriptors [][]byte) error {
+	var raw []byte
+	for _, d := range descriptors {
+		raw = append(raw, d...)
+	}
+	desc, err := hid.Parse(raw)
+	if err != nil {
+		return err
+	}
+	s.lock.Lock()
+	s.descriptor = desc
+	s.lock.Unlock()
+	return nil
+}
+
+// fdConn a connected l2cap seqpacket socket, one packet per call
+type fdConn int
+
+func (c fdConn) Read(b []byte) (int, error) {
+	n, err := unix.Read(int(c), b)
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+func (c fdConn) Write(b []byte) (int, error) {
+	n, err := unix.Write(int(c), b)
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// state the report state of d, made on first use, output reports update
+// the leds of the host and unplug drops it, the caller holds the lock
+func (s *Services) state(d *Device) *hid.ReportState {
+	if d.State != nil {
+		return d.State
+	}
+	addr := d.Addr
+	state := hid.NewReportState(s.descriptor)
+	state.OnSetReport(func(kind hid.ReportKind, id byte, data []byte) {
+		if kind != hid.ReportOutput {
+			return
+		}
+		if leds, ok := s.descriptor.LEDs(id, data); ok {
+			s.leds.Update(addr, leds)
+		}
+	})
+	state.OnControl(func(op hid.ControlOp) {
+		log.Printf("Device %s %s", colonAddress(addr), op)
+		if op == hid.ControlVirtualCableUnplug {
+			s.lock.Lock()
+			s.disconnect(addr)
+			s.lock.Unlock()
+		}
+	})
+	d.State = state
+	return state
+}
+
+// serveControl answers GET_REPORT, SET_REPORT, the protocol requests and
+// HID_CONTROL on the control channel fd of d until it goes down and closes
+// fd, a new channel starts in report protocol, the caller holds the lock
+func (s *Services) serveControl(d *Device, fd int) {
+	if s.descriptor == nil {
+		go drain(fd)
+		return
+	}
+	state := s.state(d)
+	state.SetProtocol(hid.ProtocolReport)
+
+	addr := d.Addr
+	server := hid.NewControlServer(fdConn(fd), l2capOutMTU(fd), s.descriptor, state)
+	go func() {
+		defer unix.Close(fd)
+		if err := server.Serve(); err != nil && err != io.EOF && err != unix.EBADF {
+			log.Printf("Device %s control: %s", colonAddress(addr), err)
+		}
+	}()
+}
+
+// serveInterrupt reads the output reports the host sends on the interrupt
+// channel fd of d and closes it once it went down, the caller holds the lock
+func (s *Services) serveInterrupt(d *Device, fd int) {
+	if s.descriptor == nil {
+		go drain(fd)
+		return
+	}
+	state := s.state(d)
+
+	addr := d.Addr
+	go func() {
+		defer unix.Close(fd)
+		if err := hid.ServeInterrupt(fdConn(fd), s.descriptor, state); err != nil && err != io.EOF && err != unix.EBADF {
+			log.Printf("Device %s interrupt: %s", colonAddress(addr), err)
+		}
+	}()
+}
+
+// drain reads a channel nobody answers on until it goes down and closes it
+func drain(fd int) {
+	defer unix.Close(fd)
+	b := make([]byte, 1024)
+	for {
+		if n, err := unix.Read(fd, b); n <= 0 || err != nil {
+			return
+		}
+	}
+}
+
+// hangup shuts a channel down, the fd stays open until its reader closed
+// it so the number is not reused under the reader
+func hangup(fd int) {
+	if fd > 0 {
+		unix.Shutdown(fd, unix.SHUT_RDWR)
+	}
+}
+
+// deviceKey the hex device key of an accepted l2cap peer, the kernel hands
+// the address out little endian and keys are in display order
+func deviceKey(addr [6]byte) string {
+	var b [6]byte
+	for i := range addr {
+		b[i] = addr[5-i]
+	}
+	return hex.EncodeToString(b[:])
+}
+
+// addressKey the hex device key of "AA:BB:CC:DD:EE:FF"
+func addressKey(addr string) string {
+	return strings.ToLower(strings.Replace(addr, ":", "", -1))
+}
+
+// colonAddress turns the hex device key into "AA:BB:CC:DD:EE:FF", keys
+// which are no address are returned as they are
+func colonAddress(addr string) string {
+	if len(addr) != 12 {
+		return addr
+	}
+	var parts []string
+	for i := 0; i+2 <= len(addr); i += 2 {
+		parts = append(parts, strings.ToUpper(addr[i:i+2]))
+	}
+	return strings.Join(parts, ":")
+}
+
+// Host returns the bluez view of the device, false without a watcher or
+// when bluez does not know the address
+func (s *Services) Host(d *Device) (bluez.DeviceProperties, bool) {
+	s.lock.RLock()
+	w := s.watcher
+	s.lock.RUnlock()
+	if w == nil {
+		return bluez.DeviceProperties{}, false
+	}
+	_, props, ok := w.DeviceByAddress(colonAddress(d.Addr))
+	return props, ok
+}
+
+type deviceInfo struct {
+	Addr        string `json:"addr"`
+	Name        string `json:"name,omitempty"`
+	AddressType string `json:"address_type,omitempty"`
+	Class       uint32 `json:"class,omitempty"`
+	Icon        string `json:"icon,omitempty"`
+	Modalias    string `json:"modalias,omitempty"`
+	Paired      bool   `json:"paired"`
+	Bonded      bool   `json:"bonded"`
+	Trusted     bool   `json:"trusted"`
+	Connected   bool   `json:"connected"`
+	Disposed    bool   `json:"disposed"`
+	// LEDs on, missing until the host set them
+	LEDs []string `json:"leds,omitempty"`
+}
+
+func (s *Services) deviceInfos() []deviceInfo {
+	s.lock.RLock()
+	var devices []*Device
+	for _, d := range s.devices {
+		devices = append(devices, d)
+	}
+	s.lock.RUnlock()
+
+	var infos []deviceInfo
+	for _, d := range devices {
+		info := deviceInfo{Addr: colonAddress(d.Addr), Disposed: d.Disposed}
+		if leds, ok := s.leds.Get(info.Addr); ok {
+			info.LEDs = leds.Names()
+		}
+		if props, ok := s.Host(d); ok {
+			info.Name = props.Alias
+			info.AddressType = props.AddressType
+			info.Class = props.Class
+			info.Icon = props.Icon
+			info.Modalias = props.Modalias
+			info.Paired = props.Paired
+			info.Bonded = props.Bonded
+			info.Trusted = props.Trusted
+			info.Connected = props.Connected
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+// bluezDevice looks up the bluez device of "AA:BB:CC:DD:EE:FF"
+func (s *Services) bluezDevice(addr string) (*bluez.Device, error) {
+	s.lock.RLock()
+	w := s.watcher
+	s.lock.RUnlock()
+	if w == nil {
+		return nil, errors.New("no bluez watcher")
+	}
+	path, _, ok := w.DeviceByAddress(addr)
+	if !ok {
+		return nil, errors.New("unknown device")
+	}
+	return bluez.NewDeviceWithFullPath(path)
+}
+
+// reconnect asks bluez to connect the HID profile of a known host again
+func (s *Services) reconnect(addr string) error {
+	d, err := s.bluezDevice(addr)
+	if err != nil {
+		return err
+	}
+	return d.ConnectProfile(growcastle.HIDServiceUUID)
+}
+
+func (s *Services) hangup(addr string) error {
+	d, err := s.bluezDevice(addr)
+	if err != nil {
+		return err
+	}
+	return d.Disconnect()
+}
+
+// disconnect hangs up the channels of addr, their readers close the fds,
+// the caller holds the lock
 func (s *Services) disconnect(addr string) {
 	d, ok := s.devices[addr]
 	if ok {
-		unix.Close(d.Control)
-		unix.Close(d.Interrupt)
-		if d.Close != nil {
-			close(d.Close)
+		if d.Reports == nil {
+			hangup(d.Control)
+			hangup(d.Interrupt)
 		}
+		d.Stop()
+		s.leds.Forget(addr)
 		delete(s.devices, addr)
 	}
 }
 
+// Attach takes over the channels bluez handed to the hid profile
+func (s *Services) Attach(c *bluez.HIDConnection) {
+	strAddr := addressKey(c.Address)
+
+	log.Printf("Device %s Attached", c.Address)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.batteries != nil && len(s.batteries.Batteries(c.Device)) == 0 {
+		if _, err := s.batteries.AddBattery(c.Device, "vitrhid", s.battery.Level()); err != nil {
+			log.Printf("battery: %s", err)
+		}
+	}
+	if d, ok := s.devices[strAddr]; ok {
+		if d.Control != c.Control {
+			hangup(d.Control)
+		}
+		if d.Interrupt != c.Interrupt {
+			hangup(d.Interrupt)
+		}
+		if d.Control != c.Control {
+			s.serveControl(d, c.Control)
+		}
+		if d.Interrupt != c.Interrupt {
+			s.serveInterrupt(d, c.Interrupt)
+		}
+		d.Control = c.Control
+		d.Interrupt = c.Interrupt
+		d.Path = c.Device
+		d.Disposed = false
+		return
+	}
+	d := &Device{
+		Addr:      strAddr,
+		Control:   c.Control,
+		Interrupt: c.Interrupt,
+		Path:      c.Device,
+	}
+	s.devices[strAddr] = d
+	s.serveControl(d, c.Control)
+	s.serveInterrupt(d, c.Interrupt)
+}
+
+// Detach drops the device bluez asked to disconnect
+func (s *Services) Detach(device dbus.ObjectPath) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.batteries != nil {
+		for _, b := range s.batteries.Batteries(device) {
+			s.batteries.RemoveBattery(b)
+		}
+	}
+	for addr, d := range s.devices {
+		if d.Path == device {
+			s.disconnect(addr)
+			log.Printf("Device %s Detached", colonAddress(addr))
+			return
+		}
+	}
+}
+
+// AttachReports adds a host reached through sender instead of l2cap channels
+func (s *Services) AttachReports(name string, sender bluez.ReportSender) {
+	log.Printf("Device %s Attached", name)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if d, ok := s.devices[name]; ok {
+		d.Reports = sender
+		d.Disposed = false
+		return
+	}
+	s.devices[name] = &Device{Addr: name, Reports: sender}
+}
+
+func (s *Services) DetachReports(name string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, ok := s.devices[name]; ok {
+		s.disconnect(name)
+		log.Printf("Device %s Detached", name)
+	}
+}
+
 func (s *Services) AcceptControl() {
 	for {
 		fd, addr, err := unix.Accept(controlListenFd)
@@ -119,7 +534,7 @@ func (s *Services) AcceptControl() {
 			continue
 		}
 		l2addr := addr.(*unix.SockaddrL2)
-		strAddr := hex.EncodeToString(l2addr.Addr[:])
+		strAddr := deviceKey(l2addr.Addr)
 
 		s.lock.Lock()
 		d, ok := s.devices[strAddr]
@@ -128,8 +543,10 @@ func (s *Services) AcceptControl() {
 			d.Addr = strAddr
 			d.Disposed = false
 		} else {
-			s.devices[strAddr] = &Device{Control: fd}
+			d = &Device{Addr: strAddr, Control: fd}
+			s.devices[strAddr] = d
 		}
+		s.serveControl(d, fd)
 		s.lock.Unlock()
 	}
 }
@@ -142,7 +559,7 @@ func (s *Services) AcceptInterrupt() {
 			continue
 		}
 		l2addr := addr.(*unix.SockaddrL2)
-		strAddr := hex.EncodeToString(l2addr.Addr[:])
+		strAddr := deviceKey(l2addr.Addr)
 
 		s.lock.Lock()
 		d, ok := s.devices[strAddr]
@@ -151,13 +568,57 @@ func (s *Services) AcceptInterrupt() {
 			d.Addr = strAddr
 			d.Disposed = false
 		} else {
-			s.devices[strAddr] = &Device{Interrupt: fd}
+			d = &Device{Addr: strAddr, Interrupt: fd}
+			s.devices[strAddr] = d
 		}
+		s.serveInterrupt(d, fd)
 		s.lock.Unlock()
 	}
 }
 
 func (s *Services) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, "/pairing") && s.pairing != nil {
+		s.pairing.ServeHTTP(rw, r)
+		return
+	}
+
+	if r.URL.Path == "/battery" && s.battery != nil {
+		s.battery.ServeHTTP(rw, r)
+		return
+	}
+
+	if strings.HasPrefix(r.URL.Path, "/keyboard/") {
+		s.serveKeyboard(rw, r)
+		return
+	}
+
+	if strings.HasPrefix(r.URL.Path, "/leds") {
+		s.leds.ServeHTTP(rw, r)
+		return
+	}
+
+	if r.URL.Path == "/devices" {
+		rw.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(rw).Encode(s.deviceInfos())
+		return
+	}
+
+	if r.URL.Path == "/connect" || r.URL.Path == "/disconnect" {
+		addr := r.URL.Query().Get("addr")
+		var err error
+		if r.URL.Path == "/connect" {
+			err = s.reconnect(addr)
+		} else {
+			err = s.hangup(addr)
+		}
+		if err != nil {
+			rw.Write([]byte(err.Error()))
+			return
+		}
+		rw.Write([]byte("success"))
+		return
+	}
+
 	if r.URL.Path == "/start" {
 		if len(s.devices) == 0 {
 			rw.Write([]byte("no devices"))